@@ -0,0 +1,81 @@
+package readline
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/reeflective/readline/internal/keymap"
+)
+
+// AbbreviationCursor is a marker that can be used in abbreviation expansions
+// to place the cursor at its position once the abbreviation is expanded, eg.
+// `"gcm": "git commit -m \"%|\""`. The marker itself is not inserted, and
+// neither is the space having triggered the expansion.
+const AbbreviationCursor = "%|"
+
+// commandSeparators are the characters after which a new command starts.
+const commandSeparators = ";|&("
+
+// expandAbbreviation replaces the word before the cursor with its expansion in
+// Shell.Abbreviations, if any, as a single undoable edit. Unless the inputrc
+// option `abbreviations-anywhere` is set, only words in command position are
+// expanded. Returns true if the character having triggered the expansion must
+// not be inserted (because the cursor has been placed with a marker).
+func (rl *Shell) expandAbbreviation() (skipInsert bool) {
+	if len(rl.Abbreviations) == 0 {
+		return false
+	}
+
+	searching, _, _ := rl.completer.NonIncrementallySearching()
+	if searching || rl.Keymap.Local() == keymap.Isearch {
+		return false
+	}
+
+	epos := rl.cursor.Pos()
+	bpos := epos
+
+	for bpos > 0 && !isWordBoundary((*rl.line)[bpos-1]) {
+		bpos--
+	}
+
+	expansion, found := rl.Abbreviations[string((*rl.line)[bpos:epos])]
+	if !found || bpos == epos {
+		return false
+	}
+
+	if !rl.Config.GetBool("abbreviations-anywhere") && !rl.isCommandPosition(bpos) {
+		return false
+	}
+
+	// Save the abbreviation as typed, so that undo restores it.
+	rl.History.Save()
+
+	cursor := strings.Index(expansion, AbbreviationCursor)
+	expanded := []rune(strings.Replace(expansion, AbbreviationCursor, "", 1))
+
+	rl.line.Cut(bpos, epos)
+	rl.line.Insert(bpos, expanded...)
+
+	if cursor == -1 {
+		rl.cursor.Set(bpos + len(expanded))
+		return false
+	}
+
+	rl.cursor.Set(bpos + len([]rune(expansion[:cursor])))
+
+	return true
+}
+
+// isCommandPosition returns true if the word starting at pos is
+// the first one in the line, or the first one after a separator.
+func (rl *Shell) isCommandPosition(pos int) bool {
+	for pos > 0 && unicode.IsSpace((*rl.line)[pos-1]) {
+		pos--
+	}
+
+	return pos == 0 || strings.ContainsRune(commandSeparators, (*rl.line)[pos-1])
+}
+
+func isWordBoundary(char rune) bool {
+	return unicode.IsSpace(char) || strings.ContainsRune(commandSeparators, char)
+}
@@ -0,0 +1,68 @@
+package readline
+
+import (
+	"fmt"
+	"time"
+)
+
+// BellStyle is the way the shell signals failures to the user,
+// like failed completions, missing history matches or undefined keys.
+type BellStyle int
+
+const (
+	// BellNone does not signal anything (default).
+	BellNone BellStyle = iota
+	// BellAudible rings the terminal bell.
+	BellAudible
+	// BellVisual briefly flashes the terminal screen instead.
+	BellVisual
+)
+
+// Terminal sequences for flashing the screen (reverse video).
+const (
+	flashOn  = "\x1b[?5h"
+	flashOff = "\x1b[?5l"
+)
+
+// flashDuration is the time during which the screen is flashed.
+const flashDuration = 100 * time.Millisecond
+
+// bell signals a failure to the user according to the shell bell style.
+func (rl *Shell) bell() {
+	switch rl.Bell {
+	case BellAudible:
+		fmt.Fprint(rl.output, "\a")
+	case BellVisual:
+		rl.flash()
+	}
+}
+
+// flash reverses the screen colors, and queues their restoration
+// to the main loop once the flash duration is elapsed, so that it
+// is not printed in the middle of another display refresh.
+func (rl *Shell) flash() {
+	if rl.flashing != nil {
+		rl.flashing.Stop()
+	}
+
+	fmt.Fprint(rl.output, flashOn)
+
+	rl.flashing = time.AfterFunc(flashDuration, func() {
+		rl.Keys.Queue(rl.stopFlash)
+	})
+}
+
+// stopFlash restores the screen colors if they are still reversed.
+// It is also called when returning from Readline(), so that the screen
+// is never left with reversed colors after a flash. Restorations still
+// queued after this are no-ops.
+func (rl *Shell) stopFlash() {
+	if rl.flashing == nil {
+		return
+	}
+
+	rl.flashing.Stop()
+	rl.flashing = nil
+
+	fmt.Fprint(rl.output, flashOff)
+}
@@ -0,0 +1,91 @@
+package readline
+
+import (
+	"github.com/reeflective/readline/internal/completion"
+	"github.com/reeflective/readline/internal/history"
+)
+
+// UndoState is a state of the input line in its undo history:
+// its contents and the cursor position. It can be serialized as JSON.
+type UndoState = history.UndoState
+
+// UndoGranularity determines how the characters typed by the user are grouped
+// into undo steps. It is set with the History.UndoGranularity shell field.
+type UndoGranularity = history.UndoGranularity
+
+// Undo granularities.
+const (
+	UndoPerCommand = history.UndoPerCommand // A run of insertions, until another command (default).
+	UndoPerWord    = history.UndoPerWord    // A run of insertions, until a word is ended by a space.
+	UndoPerKey     = history.UndoPerKey     // Each inserted character.
+)
+
+// bufferState is a line to edit, with its undo history.
+type bufferState struct {
+	line   string
+	cursor int
+	undo   []UndoState
+}
+
+// SetBuffer replaces the input line with line, and places the cursor at
+// the given position (clamped to the line). The undo history of the line
+// is replaced with undo (from the oldest state), as returned by UndoHistory,
+// so that the user can undo back through the way the line was written: if
+// it is empty, the first undo reverts the line to an empty one.
+//
+// If Readline() is running, the change is queued to the input loop, like
+// Inject, and is applied between two commands. Otherwise, the line is the one
+// edited by the next Readline() call, eg. to recall and continue editing a line.
+func (rl *Shell) SetBuffer(line string, cursor int, undo []UndoState) {
+	buffer := bufferState{line: line, cursor: cursor, undo: undo}
+
+	if !rl.reading.Load() {
+		rl.buffer = &buffer
+		return
+	}
+
+	rl.Keys.Queue(func() { rl.setBuffer(buffer) })
+}
+
+// UndoHistory returns the undo history of the input line (from the oldest
+// state), which can be saved along with the line and restored with SetBuffer.
+// It is meant to be called when Readline() has returned, since it returns the
+// undo history of the line it has returned until the next Readline() call.
+func (rl *Shell) UndoHistory() []UndoState {
+	return rl.History.UndoStates()
+}
+
+// KillRing returns the texts in the kill ring, from the most recent kill (the
+// one pasted by yank) to the oldest one, eg. to build a custom paste menu. The
+// texts are copies, and the kill ring is not modified by the caller using them.
+// Like UndoHistory, it is meant to be called when Readline() is not running.
+func (rl *Shell) KillRing() []string {
+	return rl.Buffers.KillRing()
+}
+
+// Registers returns the texts stored in the Vim registers, indexed by their
+// names ("0" to "9" for the numbered ones, which are the kill ring, "a" to "z"
+// for the lettered ones). Like those of KillRing, the texts are copies, and it
+// is meant to be called when Readline() is not running.
+func (rl *Shell) Registers() map[string]string {
+	return rl.Buffers.Registers()
+}
+
+// setBuffer replaces the line being edited and its undo history.
+func (rl *Shell) setBuffer(buffer bufferState) {
+	completion.UpdateInserted(rl.completer)
+	rl.line, rl.cursor, rl.selection = rl.completer.GetBuffer()
+
+	undo := buffer.undo
+	if len(undo) == 0 {
+		undo = []UndoState{{}}
+	}
+
+	rl.History.SetUndoStates(undo)
+
+	rl.line.Set([]rune(buffer.line)...)
+	rl.cursor.Set(buffer.cursor)
+	rl.selection.Reset()
+
+	rl.History.Save()
+}
@@ -0,0 +1,78 @@
+package readline
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestShell_SetBuffer(t *testing.T) {
+	undo := []UndoState{{}, {Line: "git", Cursor: 3}, {Line: "git status", Cursor: 10}}
+
+	tests := []struct {
+		name   string
+		line   string
+		cursor int
+		undo   []UndoState
+		keys   []string
+		want   string
+	}{
+		{name: "Line set", line: "git status", cursor: 3, keys: []string{"\r"}, want: "git status"},
+		{name: "Cursor set", line: "git status", cursor: 3, keys: []string{"x", "\r"}, want: "gitx status"},
+		{name: "Cursor clamped", line: "ls", cursor: 10, keys: []string{"x", "\r"}, want: "lsx"},
+		{name: "Undo without history", line: "git status", cursor: 10, keys: []string{"\x1f", "\r"}, want: ""},
+		{name: "Undo with history", line: "git status", cursor: 10, undo: undo, keys: []string{"\x1f", "\r"}, want: "git"},
+		{name: "Undo to the oldest state", line: "git status", cursor: 10, undo: undo, keys: []string{"\x1f", "\x1f", "\r"}, want: ""},
+		{name: "Undo after editing", line: "git", cursor: 3, keys: []string{" add", "\x1f", "\r"}, want: "git"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rl := NewShell()
+			rl.SetBuffer(test.line, test.cursor, test.undo)
+
+			got, err := readTestLine(t, rl, test.keys...)
+			if err != nil {
+				t.Errorf("Readline() error = %v", err)
+			}
+
+			if got != test.want {
+				t.Errorf("Readline() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestShell_UndoHistory(t *testing.T) {
+	undo := []UndoState{{}, {Line: "git", Cursor: 3}, {Line: "git status", Cursor: 10}}
+
+	rl := NewShell()
+	rl.SetBuffer("git status", 10, undo)
+
+	if _, err := readTestLine(t, rl, "\r"); err != nil {
+		t.Fatalf("Readline() error = %v", err)
+	}
+
+	// The undo history restored is returned along with the line.
+	if got := rl.UndoHistory(); !reflect.DeepEqual(got, undo) {
+		t.Errorf("UndoHistory() = %+v, want %+v", got, undo)
+	}
+}
+
+func TestShell_SetBuffer_reading(t *testing.T) {
+	rl := NewShell()
+	rl.RegisterCommand("set-buffer", func() { rl.SetBuffer("ls -l", 2, nil) })
+
+	if err := rl.BindKey("emacs", `\C-xb`, "set-buffer"); err != nil {
+		t.Fatalf("BindKey() error = %v", err)
+	}
+
+	// The buffer is set between two commands, and then edited.
+	got, err := readTestLine(t, rl, "git", "\x18b", "x", "\r")
+	if err != nil {
+		t.Errorf("Readline() error = %v", err)
+	}
+
+	if got != "lsx -l" {
+		t.Errorf("Readline() = %q, want %q", got, "lsx -l")
+	}
+}
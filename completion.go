@@ -2,13 +2,62 @@ package readline
 
 import (
 	"fmt"
+	"time"
 
-	"github.com/reeflective/readline/internal/color"
 	"github.com/reeflective/readline/internal/completion"
+	"github.com/reeflective/readline/internal/core"
 	"github.com/reeflective/readline/internal/history"
 	"github.com/reeflective/readline/internal/keymap"
+	"github.com/reeflective/readline/internal/ui"
 )
 
+// NoMatchBehavior is the way the shell signals a completion request
+// for which there is no matching candidate (see CompletionNoMatch).
+type NoMatchBehavior int
+
+const (
+	// NoMatchHintBell shows a "no matches" hint, and rings the bell (default).
+	NoMatchHintBell NoMatchBehavior = iota
+	// NoMatchHint only shows a "no matches" hint.
+	NoMatchHint
+	// NoMatchBell only rings the bell.
+	NoMatchBell
+	// NoMatchNone does not signal anything.
+	NoMatchNone
+)
+
+// CompletionPanicError is the error passed to OnError when a completer panics,
+// with the value passed to panic() and the stack trace of the completer.
+type CompletionPanicError = completion.PanicError
+
+// CompletionStats are statistics about the completions produced by the shell
+// completer (or stream completer) for a completion request, which are passed
+// to the OnCompletionGenerate callback. Cached completions are not reported.
+type CompletionStats struct {
+	Prefix     string        // The word being completed (before the cursor).
+	Candidates int           // Candidates produced, before being filtered with the prefix.
+	Tags       int           // Distinct tags (groups) of these candidates.
+	Elapsed    time.Duration // Time taken by the completer (until its stream is closed).
+}
+
+// add accounts for a list (or a streamed batch) of completions produced
+// for the line and cursor position, updating the set of tags already seen.
+func (s *CompletionStats) add(line []rune, pos int, comps Completions, values completion.Values, tags map[string]bool) {
+	if s.Prefix == "" {
+		buf := core.Line(line)
+		s.Prefix = completion.Prefix(&buf, pos, values)
+	}
+
+	s.Candidates += len(comps.values)
+
+	for _, candidate := range comps.values {
+		if !tags[candidate.Tag] {
+			tags[candidate.Tag] = true
+			s.Tags++
+		}
+	}
+}
+
 func (rl *Shell) completionCommands() commands {
 	return map[string]func(){
 		"complete":               rl.completeWord,
@@ -20,9 +69,24 @@ func (rl *Shell) completionCommands() commands {
 
 		"menu-complete-next-tag":   rl.menuCompleteNextTag,
 		"menu-complete-prev-tag":   rl.menuCompletePrevTag,
+		"menu-collapse-tag":        rl.menuCollapseTag,
+		"menu-expand-tag":          rl.menuExpandTag,
+		"menu-collapse-all-tags":   rl.menuCollapseAllTags,
+		"menu-expand-all-tags":     rl.menuExpandAllTags,
+		"menu-page-next":           rl.menuPageNext,
+		"menu-page-prev":           rl.menuPagePrev,
+		"menu-first":               rl.menuFirst,
+		"menu-last":                rl.menuLast,
 		"accept-and-menu-complete": rl.acceptAndMenuComplete,
 		"vi-registers-complete":    rl.viRegistersComplete,
 		"menu-incremental-search":  rl.menuIncrementalSearch,
+
+		"isearch-toggle-descriptions": rl.isearchToggleDescriptions,
+		"isearch-next-match":          rl.isearchNextMatch,
+		"isearch-previous-match":      rl.isearchPreviousMatch,
+		"isearch-reverse-direction":   rl.isearchReverseDirection,
+		"isearch-backward":            rl.isearchBackward,
+		"isearch-forward":             rl.isearchForward,
 	}
 }
 
@@ -40,12 +104,15 @@ func (rl *Shell) completeWord() {
 	if !rl.completer.IsActive() {
 		rl.startMenuComplete(rl.commandCompletion)
 
-		if rl.Config.GetBool("menu-complete-display-prefix") {
+		if rl.listOnFirstTab() {
 			return
 		}
 	}
 
-	rl.completer.Select(1, 0)
+	if rl.selectCandidates(1) {
+		rl.bell()
+	}
+
 	rl.completer.SkipDisplay()
 }
 
@@ -77,7 +144,8 @@ func (rl *Shell) insertCompletions() {
 	rl.completer.ClearMenu(true)
 }
 
-// Like complete-word, except that menu completion is used.
+// Like complete-word, except that menu completion is used. A numeric
+// argument moves forward by that many candidates (backward if negative).
 func (rl *Shell) menuComplete() {
 	rl.History.SkipSave()
 
@@ -87,12 +155,14 @@ func (rl *Shell) menuComplete() {
 		rl.startMenuComplete(rl.commandCompletion)
 
 		// Immediately select only if not asked to display first.
-		if rl.Config.GetBool("menu-complete-display-prefix") {
+		if rl.listOnFirstTab() {
 			return
 		}
 	}
 
-	rl.completer.Select(1, 0)
+	if rl.selectCandidates(1) {
+		rl.bell()
+	}
 }
 
 // Deletes the character under the cursor if not at the
@@ -110,16 +180,26 @@ func (rl *Shell) deleteCharOrList() {
 
 // Identical to menu-complete, but moves backward through the
 // list of possible completions, as if menu-complete had been
-// given a negative argument.
+// given a negative argument. When no completion menu is active,
+// this opens it and selects the last candidate.
 func (rl *Shell) menuCompleteBackward() {
 	rl.History.SkipSave()
 
-	// We don't do anything when not already completing.
+	// Like menu-complete, generate the completions first, and
+	// then immediately select (the last candidate) unless asked
+	// to only display them. Selecting backward from the first
+	// group wraps around to the last candidate of the last one.
 	if !rl.completer.IsActive() {
 		rl.startMenuComplete(rl.commandCompletion)
+
+		if rl.listOnFirstTab() {
+			return
+		}
 	}
 
-	rl.completer.Select(-1, 0)
+	if rl.selectCandidates(-1) {
+		rl.bell()
+	}
 }
 
 // In a menu completion, if there are several tags
@@ -131,7 +211,9 @@ func (rl *Shell) menuCompleteNextTag() {
 		return
 	}
 
-	rl.completer.SelectTag(true)
+	if rl.completer.SelectTag(true) {
+		rl.bell()
+	}
 }
 
 // In a menu completion, if there are several tags of
@@ -143,7 +225,102 @@ func (rl *Shell) menuCompletePrevTag() {
 		return
 	}
 
-	rl.completer.SelectTag(false)
+	if rl.completer.SelectTag(false) {
+		rl.bell()
+	}
+}
+
+// In a menu completion, hide the candidates of the current tag, only showing
+// its header and the number of hidden candidates. The candidates of collapsed
+// tags are skipped when cycling through the menu, but their headers can still
+// be reached with menu-complete-next-tag and menu-complete-prev-tag.
+func (rl *Shell) menuCollapseTag() {
+	rl.History.SkipSave()
+
+	if !rl.completer.IsActive() {
+		return
+	}
+
+	if !rl.completer.CollapseTag(true) {
+		rl.bell()
+	}
+}
+
+// In a menu completion, show again the candidates of the current (collapsed) tag.
+func (rl *Shell) menuExpandTag() {
+	rl.History.SkipSave()
+
+	if !rl.completer.IsActive() {
+		return
+	}
+
+	if !rl.completer.CollapseTag(false) {
+		rl.bell()
+	}
+}
+
+// In a menu completion, collapse all tags, so that only their headers are shown.
+func (rl *Shell) menuCollapseAllTags() {
+	rl.History.SkipSave()
+
+	if rl.completer.IsActive() {
+		rl.completer.CollapseAll(true)
+	}
+}
+
+// In a menu completion, expand all collapsed tags.
+func (rl *Shell) menuExpandAllTags() {
+	rl.History.SkipSave()
+
+	if rl.completer.IsActive() {
+		rl.completer.CollapseAll(false)
+	}
+}
+
+// In a menu completion, move the selection forward by a page of candidates, that
+// is, as many as can be displayed by the menu. Like menu-complete, this either
+// wraps around or stops at the last candidate, depending on completion-no-wrap.
+func (rl *Shell) menuPageNext() {
+	rl.History.SkipSave()
+
+	if !rl.completer.IsActive() {
+		return
+	}
+
+	if rl.completer.SelectPage(true) {
+		rl.bell()
+	}
+}
+
+// In a menu completion, move the selection backward by a page of candidates.
+func (rl *Shell) menuPagePrev() {
+	rl.History.SkipSave()
+
+	if !rl.completer.IsActive() {
+		return
+	}
+
+	if rl.completer.SelectPage(false) {
+		rl.bell()
+	}
+}
+
+// In a menu completion, select the first candidate of the first tag.
+func (rl *Shell) menuFirst() {
+	rl.History.SkipSave()
+
+	if rl.completer.IsActive() {
+		rl.completer.SelectEdge(false)
+	}
+}
+
+// In a menu completion, select the last candidate of the last tag.
+func (rl *Shell) menuLast() {
+	rl.History.SkipSave()
+
+	if rl.completer.IsActive() {
+		rl.completer.SelectEdge(true)
+	}
 }
 
 // In a menu completion, insert the current completion
@@ -156,21 +333,29 @@ func (rl *Shell) acceptAndMenuComplete() {
 		return
 	}
 
-	// Also return if no candidate
+	// If no candidate is selected yet, select the first one.
+	// If it was the only one, it has already been accepted.
 	if !rl.completer.IsInserting() {
-		return
+		rl.completer.Select(1, 0)
+
+		if !rl.completer.IsInserting() {
+			return
+		}
 	}
 
 	// First insert the current candidate.
 	rl.completer.Cancel(false, false)
 
 	// And cycle to the next one.
-	rl.completer.Select(1, 0)
+	if rl.selectCandidates(1) {
+		rl.bell()
+	}
 }
 
 // Open a completion menu (similar to menu-complete) with all currently populated Vim registers.
+// The contents of the selected register are pasted at the cursor.
 func (rl *Shell) viRegistersComplete() {
-	rl.History.SkipSave()
+	rl.History.Save()
 	rl.startMenuComplete(rl.Buffers.Complete)
 }
 
@@ -188,6 +373,115 @@ func (rl *Shell) menuIncrementalSearch() {
 	// Always regenerate the list of completions.
 	rl.completer.GenerateWith(rl.commandCompletion)
 	rl.completer.IsearchStart("completions", false, false)
+
+	if rl.Iterations.IsSet() {
+		rl.completer.IsearchMatchCase()
+	}
+}
+
+// In incremental search mode, toggle matching the search pattern against
+// the candidates descriptions (and display strings), in addition to their
+// values. Matches in descriptions are highlighted. This is only valid for
+// the current search: the default is set with the `isearch-descriptions` option.
+func (rl *Shell) isearchToggleDescriptions() {
+	rl.History.SkipSave()
+	rl.completer.IsearchToggleDescriptions()
+}
+
+// In incremental search mode, insert the next match in the current direction
+// of the search (the next older history line in a reverse history search).
+func (rl *Shell) isearchNextMatch() {
+	rl.History.SkipSave()
+
+	if rl.completer.IsearchNextMatch(true) {
+		rl.bell()
+	}
+}
+
+// In incremental search mode, insert the previous match
+// in the current direction of the search.
+func (rl *Shell) isearchPreviousMatch() {
+	rl.History.SkipSave()
+
+	if rl.completer.IsearchNextMatch(false) {
+		rl.bell()
+	}
+}
+
+// In incremental history search mode, reverse the direction of the search,
+// so that the next matches are the newer lines when searching backward, and
+// conversely. The currently inserted match is kept.
+func (rl *Shell) isearchReverseDirection() {
+	rl.History.SkipSave()
+	rl.completer.IsearchReverseDirection()
+}
+
+// In incremental search mode, insert the next match toward older
+// history lines, reversing the search direction if it was forward.
+func (rl *Shell) isearchBackward() {
+	rl.isearchTowards(false)
+}
+
+// In incremental search mode, insert the next match toward newer
+// history lines, reversing the search direction if it was backward.
+func (rl *Shell) isearchForward() {
+	rl.isearchTowards(true)
+}
+
+// isearchTowards inserts the next incremental search match in the
+// given direction, reversing the search direction first if needed.
+// Searches without a direction just move to the next/previous match.
+func (rl *Shell) isearchTowards(forward bool) {
+	directed, current := rl.completer.IsearchDirection()
+
+	switch {
+	case !directed && !forward:
+		rl.isearchPreviousMatch()
+		return
+	case directed && current != forward:
+		rl.completer.IsearchReverseDirection()
+	}
+
+	rl.isearchNextMatch()
+}
+
+// GenerateCompletions runs the shell completer (Completer, or StreamCompleter
+// until all its completions are sent) for a line and cursor position, without
+// any terminal interaction nor completion menu, and returns the completions as
+// the completion engine receives them (not yet filtered by the current word).
+// This is meant to test completers: the result can be marshaled to JSON.
+// An ErrNoCompleter error is returned if the shell has no completer.
+func (rl *Shell) GenerateCompletions(line string, pos int) (completion.Values, error) {
+	buf := []rune(line)
+
+	if pos < 0 || pos > len(buf) {
+		return completion.Values{}, fmt.Errorf("invalid cursor position %d in line of length %d", pos, len(buf))
+	}
+
+	if rl.StreamCompleter != nil {
+		done := make(chan struct{})
+		defer close(done)
+
+		values := completion.AddRaw(nil)
+
+		for batch := range rl.StreamCompleter(buf, pos, done) {
+			values.Merge(batch.convert())
+		}
+
+		values.Separators = rl.WordSeparators
+
+		return values, nil
+	}
+
+	if rl.Completer == nil {
+		return completion.Values{}, ErrNoCompleter
+	}
+
+	comps := rl.Completer(buf, pos)
+	values := comps.convert()
+	values.Separators = rl.WordSeparators
+
+	return values, nil
 }
 
 //
@@ -199,20 +493,152 @@ func (rl *Shell) menuIncrementalSearch() {
 func (rl *Shell) startMenuComplete(completer completion.Completer) {
 	rl.History.SkipSave()
 
+	rl.completer.SaveLine()
 	rl.Keymap.SetLocal(keymap.MenuSelect)
 	rl.completer.GenerateWith(completer)
+
+	if rl.completer.Matches() == 0 && !rl.completer.Streaming() {
+		rl.noMatchBell()
+	}
+}
+
+// noMatchBell rings the bell for a completion request
+// without any match, unless disabled by CompletionNoMatch.
+func (rl *Shell) noMatchBell() {
+	if rl.CompletionNoMatch == NoMatchHintBell || rl.CompletionNoMatch == NoMatchBell {
+		rl.bell()
+	}
+}
+
+// listOnFirstTab returns true if the first completion request should only
+// display the completions, and the next ones should select candidates.
+// With CompletionListOnFirstTab or the `list-on-first-tab` option, this is
+// like bash: the first Tab lists candidates, and the second one starts
+// cycling through them. The state is
+// reset as soon as the menu is cancelled or the line is modified (since the
+// completions are not active anymore). Note that with autocomplete enabled,
+// completions are always active, therefore the first Tab selects a candidate.
+func (rl *Shell) listOnFirstTab() bool {
+	return rl.CompletionListOnFirstTab ||
+		rl.Config.GetBool("list-on-first-tab") ||
+		rl.Config.GetBool("menu-complete-display-prefix")
+}
+
+// selectCandidates moves the selection by as many candidates as the numeric
+// argument (1 by default), forward if step is positive, and backward otherwise:
+// like in GNU readline, a negative argument reverses the direction. It returns
+// true if the selection has been clamped because of `completion-no-wrap`.
+func (rl *Shell) selectCandidates(step int) (clamped bool) {
+	times := rl.Iterations.Get()
+	if times < 0 {
+		step, times = -step, -times
+	}
+
+	for i := 0; i < times; i++ {
+		if rl.completer.Select(step, 0) {
+			return true
+		}
+	}
+
+	return false
 }
 
 // commandCompletion generates the completions for commands/args/flags.
 func (rl *Shell) commandCompletion() completion.Values {
+	if rl.StreamCompleter != nil {
+		return rl.completer.Stream(rl.streamCompletion)
+	}
+
 	if rl.Completer == nil {
 		return completion.Values{}
 	}
 
 	line, cursor := rl.completer.Line()
-	comps := rl.Completer(*line, cursor.Pos())
 
-	return comps.convert()
+	if values, found := rl.completer.CachedValues(*line, cursor.Pos()); found {
+		return values
+	}
+
+	// Completions generated for the word being typed are filtered again.
+	if values, found := rl.completer.RefinedValues(*line, cursor.Pos()); found {
+		return values
+	}
+
+	// The completer might be awaited in the background:
+	// it must not have access to the line being edited.
+	buf, pos := []rune(string(*line)), cursor.Pos()
+
+	onGenerate := rl.OnCompletionGenerate
+
+	values := rl.completer.Await(func() completion.Values {
+		start := time.Now()
+		comps := rl.Completer(buf, pos)
+		elapsed := time.Since(start)
+
+		values := comps.convert()
+		values.Separators = rl.WordSeparators
+
+		if onGenerate != nil {
+			stats := CompletionStats{Elapsed: elapsed}
+			stats.add(buf, pos, comps, values, make(map[string]bool))
+
+			go onGenerate(stats)
+		}
+
+		return values
+	})
+
+	// Streamed completions are not known yet.
+	if !rl.completer.Streaming() {
+		rl.completer.CacheValues(*line, cursor.Pos(), values)
+		rl.completer.KeepValues(*line, cursor.Pos(), values)
+	}
+
+	return values
+}
+
+// streamCompletion starts the asynchronous command completer, and
+// converts each batch of completions it sends to the completion engine.
+func (rl *Shell) streamCompletion(done <-chan struct{}) <-chan completion.Values {
+	line, cursor := rl.completer.Line()
+
+	// The completer runs in the background: it must
+	// not have access to the line being edited.
+	buf, pos := []rune(string(*line)), cursor.Pos()
+	onGenerate := rl.OnCompletionGenerate
+
+	start := time.Now()
+	comps := rl.StreamCompleter(buf, pos, done)
+	values := make(chan completion.Values)
+
+	go func() {
+		defer close(values)
+
+		var stats CompletionStats
+		tags := make(map[string]bool)
+
+		// Report the stream once it is closed by the completer.
+		defer func() {
+			if onGenerate != nil {
+				stats.Elapsed = time.Since(start)
+				onGenerate(stats)
+			}
+		}()
+
+		for batch := range comps {
+			converted := batch.convert()
+			converted.Separators = rl.WordSeparators
+			stats.add(buf, pos, batch, converted, tags)
+
+			select {
+			case values <- converted:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return values
 }
 
 // historyCompletion manages the various completion/isearch modes related
@@ -239,7 +665,7 @@ func (rl *Shell) historyCompletion(forward, filterLine, substring bool) {
 	default:
 		// Notify if we don't have history sources at all.
 		if rl.History.Current() == nil {
-			rl.Hint.SetTemporary(fmt.Sprintf("%s%s%s %s", color.Dim, color.FgRed, "No command history source", color.Reset))
+			rl.Hint.SetTemporary(rl.Hint.Format("No command history source", ui.HintError))
 			return
 		}
 
@@ -251,7 +677,12 @@ func (rl *Shell) historyCompletion(forward, filterLine, substring bool) {
 
 		if substring {
 			rl.completer.GenerateWith(completer)
-			rl.completer.IsearchStart(rl.History.Name(), true, true)
+			rl.completer.IsearchStart(rl.History.Name()+rl.History.Scope(), true, true)
+			rl.completer.IsearchSetDirection(forward)
+
+			if rl.Iterations.IsSet() {
+				rl.completer.IsearchMatchCase()
+			}
 		} else {
 			rl.startMenuComplete(completer)
 			rl.completer.AutocompleteForce()
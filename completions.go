@@ -9,6 +9,48 @@ import (
 // Completion represents a completion candidate.
 type Completion = completion.Candidate
 
+// QuoteStyle is the style used to quote/escape the completion values inserted
+// in the line, when those contain spaces or other shell metacharacters.
+type QuoteStyle = completion.QuoteStyle
+
+// Quoting styles for inserted completion values.
+const (
+	QuoteNone      = completion.QuoteNone      // Insert values verbatim (default).
+	QuoteSingle    = completion.QuoteSingle    // Enclose values in single quotes: 'my file'.
+	QuoteDouble    = completion.QuoteDouble    // Enclose values in double quotes: "my file".
+	QuoteBackslash = completion.QuoteBackslash // Escape metacharacters with backslashes: my\ file.
+)
+
+// MatchMode is the way completion candidates are matched against the word being completed.
+type MatchMode = completion.MatchMode
+
+// Matching modes for completion candidates.
+const (
+	MatchPrefix    = completion.MatchPrefix    // Values starting with the word (default).
+	MatchSubstring = completion.MatchSubstring // Values containing the word anywhere.
+	MatchFuzzy     = completion.MatchFuzzy     // Values containing the word characters, in order.
+)
+
+// Layout is the way completion candidates of a group are arranged in the menu.
+type Layout = completion.Layout
+
+// Completion menu layouts.
+const (
+	LayoutAuto = completion.LayoutAuto // Grid, except for described commands, listed (default).
+	LayoutList = completion.LayoutList // One candidate per line.
+	LayoutGrid = completion.LayoutGrid // As many columns as the terminal width allows.
+)
+
+// Headers is whether the tags of completion groups are displayed above their candidates.
+type Headers = completion.Headers
+
+// Completion group headers visibility.
+const (
+	HeadersAuto   = completion.HeadersAuto   // Only when there are several groups (default).
+	HeadersAlways = completion.HeadersAlways // Even for a single group.
+	HeadersNever  = completion.HeadersNever  // Only for collapsed groups.
+)
+
 // Completions holds all completions candidates and their associated data,
 // including usage strings, messages, and suffix matchers for autoremoval.
 // Some of those additional settings will apply to all contained candidates,
@@ -18,11 +60,27 @@ type Completions struct {
 	messages completion.Messages
 	noSpace  completion.SuffixMatcher
 	usage    string
-	listLong map[string]bool
+	layouts  map[string]Layout
+	headers  map[string]Headers
 	noSort   map[string]bool
 	listSep  map[string]string
 	pad      map[string]bool
 	escapes  map[string]bool
+	unique   map[string]bool
+	wrap     map[string]bool
+	quote    QuoteStyle
+	match    MatchMode
+	space    bool
+
+	// Styles of groups headers and candidates, by tag.
+	headerStyles map[string]string
+	tagStyles    map[string]string
+
+	// Called with the matching candidates, before display.
+	postFilter func(candidates []Completion) []Completion
+
+	// Path of the command being completed, shown above the menu.
+	context []string
 
 	// Initially this will be set to the part of the current word
 	// from the beginning of the word up to the position of the cursor.
@@ -133,6 +191,11 @@ func (c Completions) Suppress(expr ...string) Completions {
 // These suffixes will be used for all completions that have not specified their
 // own suffix-matching patterns.
 // This is used for slash-autoremoval in path completions, comma-separated completions, etc.
+//
+// With AppendSpace, values ending with one of these characters are inserted without
+// a trailing space (eg. directories ending with a slash), while the others are followed
+// by one (eg. files). A NoSpace() call without characters takes precedence over all
+// suffix rules (even when merged with other completions), and disables the space.
 func (c Completions) NoSpace(suffixes ...rune) Completions {
 	if len(suffixes) == 0 {
 		c.noSpace.Add('*')
@@ -143,6 +206,15 @@ func (c Completions) NoSpace(suffixes ...rune) Completions {
 	return c
 }
 
+// AppendSpace makes inserted values followed by a space, so that the user can type
+// the next word right away, unless they end with one of the NoSpace characters (or
+// NoSpace was given no characters), or already end with a space. By default, values
+// are inserted as is, which is what completers adding their own spaces should keep.
+func (c Completions) AppendSpace() Completions {
+	c.space = true
+	return c
+}
+
 // Prefix adds a prefix to values (only the ones inserted, not the display values)
 //
 //	a := CompleteValues("melon", "drop", "fall").Invoke(c)
@@ -217,6 +289,38 @@ func (c Completions) StyleF(f func(s string) string) Completions {
 	return c
 }
 
+// HeaderStyle sets the style of the headers of the groups (their tags), with
+// the same format as candidates styles. A series of tags can be passed to restrict
+// this to these tags. If empty, will be applied to all groups. Groups without a
+// style use the one of the inputrc `completion-header-style` option.
+//
+//	CompleteValues("main.go").Tag("files").HeaderStyle("34", "files")
+func (c Completions) HeaderStyle(style string, tags ...string) Completions {
+	c.headerStyles = setTags(c.headerStyles, style, tags)
+	return c
+}
+
+// TagStyle sets the style of the candidates of groups not having their own style
+// (see Style), which is thus the default style for these groups. A series of tags
+// can be passed to restrict this to these tags. If empty, will be applied to all
+// groups. The style of group headers is set independently with HeaderStyle.
+//
+//	CompleteValues("ls", "cd").Tag("commands").TagStyle("32", "commands")
+func (c Completions) TagStyle(style string, tags ...string) Completions {
+	c.tagStyles = setTags(c.tagStyles, style, tags)
+	return c
+}
+
+// Context sets the path of the command being completed (eg. "git", "remote",
+// "add"), displayed as a breadcrumb above all groups in the completion menu,
+// so that users know where they are in a tree of subcommands. The completer
+// should set it each time it descends into a subcommand. This only changes
+// the display: candidates are inserted as usual.
+func (c Completions) Context(path ...string) Completions {
+	c.context = path
+	return c
+}
+
 // Tag sets the tag.
 //
 //	CompleteValues("192.168.1.1", "127.0.0.1").Tag("interfaces").
@@ -243,21 +347,41 @@ func (c Completions) TagF(f func(value string) string) Completions {
 // A series of tags can be passed to restrict this to these tags. If empty,
 // will be applied to all completions.
 func (c Completions) DisplayList(tags ...string) Completions {
-	if c.listLong == nil {
-		c.listLong = make(map[string]bool)
+	return c.DisplayLayout(LayoutList, tags...)
+}
+
+// DisplayLayout sets the layout of the completions in the menu: a list with one
+// candidate per line (LayoutList), or a grid with as many columns as the terminal
+// allows (LayoutGrid). A series of tags can be passed to restrict this to these
+// tags. If empty, will be applied to all completions. Groups without a layout
+// use the Shell.CompletionLayout one.
+func (c Completions) DisplayLayout(layout Layout, tags ...string) Completions {
+	if c.layouts == nil {
+		c.layouts = make(map[string]Layout)
 	}
 
 	if len(tags) == 0 {
-		c.listLong["*"] = true
+		c.layouts["*"] = layout
 	}
 
 	for _, tag := range tags {
-		c.listLong[tag] = true
+		c.layouts[tag] = layout
 	}
 
 	return c
 }
 
+// DisplayHeaders sets whether the tags of the groups are displayed as headers
+// above their candidates: only when there are several groups (HeadersAuto),
+// always, or never. Collapsed groups always show their header, since nothing
+// else is displayed for them. A series of tags can be passed to restrict this
+// to these tags. If empty, will be applied to all completions. Groups without
+// a setting use the Shell.CompletionHeaders one.
+func (c Completions) DisplayHeaders(headers Headers, tags ...string) Completions {
+	c.headers = setTags(c.headers, headers, tags)
+	return c
+}
+
 // ListSeparator accepts a custom separator to use between the candidates and their descriptions.
 // If more than one separator is given, the list is considered to be a map of tag:separators, in
 // which case it will fail if the list has an odd number of values.
@@ -309,6 +433,18 @@ func (c Completions) NoSort(tags ...string) Completions {
 	return c
 }
 
+// InsertUnique sets whether a candidate is inserted right away when it is the only
+// one left (true), without opening the menu, or if the menu is still shown so that
+// it is explicitly selected (false). A series of tags can be passed to restrict
+// this to these tags. If empty, will be applied to all completions. Groups without
+// a setting use the Shell.CompletionMenuUnique one.
+//
+//	CompleteValues("main.go").Tag("files").InsertUnique(true)
+func (c Completions) InsertUnique(insert bool, tags ...string) Completions {
+	c.unique = setTags(c.unique, insert, tags)
+	return c
+}
+
 // Filter filters given values (this should be done before any call
 // to Prefix/Suffix as those alter the values being filtered)
 //
@@ -319,6 +455,27 @@ func (c Completions) Filter(values []string) Completions {
 	return c
 }
 
+// MarkUsed marks the candidates with the given values as already used (like flags
+// already specified on the command line): instead of being removed like with Filter,
+// they are shown dimmed after the other candidates of their group, and can still be
+// selected and inserted.
+//
+//	CompleteValues("--all", "--force").MarkUsed("--all")
+func (c Completions) MarkUsed(values ...string) Completions {
+	used := make(map[string]bool, len(values))
+	for _, value := range values {
+		used[value] = true
+	}
+
+	for i := range c.values {
+		if used[c.values[i].Value] {
+			c.values[i].Used = true
+		}
+	}
+
+	return c
+}
+
 // JustifyDescriptions accepts a list of tags for which descriptions (if any), will be left justified.
 // If no arguments are given, description justification (padding) will apply to all tags.
 func (c Completions) JustifyDescriptions(tags ...string) Completions {
@@ -337,6 +494,16 @@ func (c Completions) JustifyDescriptions(tags ...string) Completions {
 	return c
 }
 
+// WrapDescriptions wraps the descriptions too long to fit on the row of their
+// candidate on continuation lines, aligned with the descriptions column, instead
+// of truncating them. This only applies to list layouts (see DisplayList), and
+// the selection highlighting only covers the candidate row. A series of tags can
+// be passed to restrict this to these tags. If empty, will be applied to all tags.
+func (c Completions) WrapDescriptions(tags ...string) Completions {
+	c.wrap = setTags(c.wrap, true, tags)
+	return c
+}
+
 // PreserveEscapes forces the completion engine to keep all escaped characters in
 // the inserted completion (c.Value of the Completion type). By default, those are
 // stripped out and only kept in the completion.Display. If no arguments are given,
@@ -366,6 +533,42 @@ func (c Completions) PreserveEscapes(tags ...string) Completions {
 	return c
 }
 
+// Quote sets the style used to quote the completion values when inserting them in
+// the line, if they contain spaces or other shell metacharacters: the values and
+// their displays in the menu remain unquoted. When the word being completed already
+// starts with a quote, the inserted value is enclosed in the same quotes, since the
+// user already started quoting it. Embedded quotes in values are always escaped.
+//
+// By default, values are inserted verbatim (QuoteNone), which is what completers
+// producing their own quoting should keep using.
+func (c Completions) Quote(style QuoteStyle) Completions {
+	c.quote = style
+	return c
+}
+
+// Match sets the way candidates are matched against the word being completed:
+// by prefix (default), anywhere in their values (MatchSubstring), or with all the
+// word characters in order but not necessarily contiguous (MatchFuzzy). The
+// matching part of candidates is highlighted in the completion menu.
+// The inputrc options `completion-ignore-case` and `completion-smart-case` (matching
+// case-insensitively unless the word has uppercase letters) apply to all modes.
+func (c Completions) Match(mode MatchMode) Completions {
+	c.match = mode
+	return c
+}
+
+// PostFilter sets a function called with all the candidates matching the word being
+// completed (of all tags, once filtered according to the match mode), and returning
+// the candidates to display and insert instead: it can drop candidates (eg. values
+// already in the line), enforce an allowlist, or reorder them (in groups for which
+// sorting is disabled with NoSort). Returning no candidates
+// has the same effect as having no matches. When merging completions, the first
+// post filter set is used.
+func (c Completions) PostFilter(filter func(candidates []Completion) []Completion) Completions {
+	c.postFilter = filter
+	return c
+}
+
 // Merge merges Completions (existing values are overwritten)
 //
 //	a := CompleteValues("A", "B").Invoke(c)
@@ -394,6 +597,40 @@ func (c Completions) Merge(others ...Completions) Completions {
 	return c
 }
 
+// CombineCompleters returns a completer running all completers with the line and
+// cursor, and merging their completions, so that the groups of candidates of each
+// (according to their tags) are all displayed in the menu. Candidates with the same
+// value and tag are only kept once. A completer panicking does not prevent others
+// from running: the panic is recovered and notified as a completion message.
+func CombineCompleters(completers ...func(line []rune, cursor int) Completions) func(line []rune, cursor int) Completions {
+	return func(line []rune, cursor int) Completions {
+		combined := make([]completion.Completer, 0, len(completers))
+
+		for _, completer := range completers {
+			if completer == nil {
+				continue
+			}
+
+			completer := completer
+
+			combined = append(combined, func() completion.Values {
+				comps := completer(line, cursor)
+				return comps.convert()
+			})
+		}
+
+		return completionsFrom(completion.Combine(combined...)())
+	}
+}
+
+// Map returns the completions with the function applied to each candidate
+// (eg. to add a description or style to all of them), while the candidates
+// of the receiver are left untouched, unlike with EachValue.
+func (c Completions) Map(f func(comp Completion) Completion) Completions {
+	c.values = c.values.Map(f)
+	return c
+}
+
 // EachValue runs a function on each value, overwriting with the returned one.
 func (c *Completions) EachValue(tagF func(comp Completion) Completion) {
 	for index, v := range c.values {
@@ -407,14 +644,21 @@ func (c *Completions) merge(other Completions) {
 	}
 
 	c.noSpace.Merge(other.noSpace)
+	c.space = c.space || other.space
 	c.messages.Merge(other.messages)
 
-	for tag := range other.listLong {
-		if _, found := c.listLong[tag]; !found {
-			c.listLong[tag] = true
+	for tag := range other.layouts {
+		if _, found := c.layouts[tag]; !found {
+			c.layouts[tag] = other.layouts[tag]
 		}
 	}
 
+	c.headerStyles = mergeTags(c.headerStyles, other.headerStyles)
+	c.tagStyles = mergeTags(c.tagStyles, other.tagStyles)
+	c.unique = mergeTags(c.unique, other.unique)
+	c.wrap = mergeTags(c.wrap, other.wrap)
+	c.headers = mergeTags(c.headers, other.headers)
+
 	for tag := range other.noSort {
 		if _, found := c.noSort[tag]; !found {
 			c.noSort[tag] = true
@@ -427,6 +671,22 @@ func (c *Completions) merge(other Completions) {
 		}
 	}
 
+	if c.quote == QuoteNone {
+		c.quote = other.quote
+	}
+
+	if c.match == MatchPrefix {
+		c.match = other.match
+	}
+
+	if c.postFilter == nil {
+		c.postFilter = other.postFilter
+	}
+
+	if len(c.context) == 0 {
+		c.context = other.context
+	}
+
 	for tag := range other.pad {
 		if _, found := c.pad[tag]; !found {
 			c.pad[tag] = other.pad[tag]
@@ -439,15 +699,96 @@ func (c *Completions) convert() completion.Values {
 
 	comps.Messages = c.messages
 	comps.NoSpace = c.noSpace
+	comps.AddSpace = c.space
 	comps.Usage = c.usage
-	comps.ListLong = c.listLong
+	comps.Layouts = c.layouts
+	comps.Headers = c.headers
+	comps.HeaderStyles = c.headerStyles
+	comps.TagStyles = c.tagStyles
 	comps.NoSort = c.noSort
 	comps.ListSep = c.listSep
 	comps.Pad = c.pad
 	comps.Escapes = c.escapes
+	comps.InsertUnique = c.unique
+	comps.WrapDescriptions = c.wrap
+	comps.Quote = c.quote
+	comps.Match = c.match
+	comps.Context = c.context
+
+	if c.postFilter != nil {
+		comps.PostFilter = func(values completion.RawValues) completion.RawValues {
+			return c.postFilter(values)
+		}
+	}
 
 	comps.PREFIX = c.PREFIX
 	comps.SUFFIX = c.SUFFIX
 
 	return comps
 }
+
+// completionsFrom returns the completions corresponding to converted ones.
+func completionsFrom(values completion.Values) Completions {
+	comps := CompleteRaw(values.Raw())
+
+	comps.messages = values.Messages
+	comps.noSpace = values.NoSpace
+	comps.space = values.AddSpace
+	comps.usage = values.Usage
+	comps.layouts = values.Layouts
+	comps.headers = values.Headers
+	comps.headerStyles = values.HeaderStyles
+	comps.tagStyles = values.TagStyles
+	comps.noSort = values.NoSort
+	comps.listSep = values.ListSep
+	comps.pad = values.Pad
+	comps.escapes = values.Escapes
+	comps.unique = values.InsertUnique
+	comps.wrap = values.WrapDescriptions
+	comps.quote = values.Quote
+	comps.match = values.Match
+	comps.context = values.Context
+
+	if values.PostFilter != nil {
+		comps.postFilter = func(candidates []Completion) []Completion {
+			return values.PostFilter(candidates)
+		}
+	}
+
+	comps.PREFIX = values.PREFIX
+	comps.SUFFIX = values.SUFFIX
+
+	return comps
+}
+
+// setTags sets a value for all given tags, or for all tags ("*") if none.
+func setTags[T any](settings map[string]T, value T, tags []string) map[string]T {
+	if settings == nil {
+		settings = make(map[string]T)
+	}
+
+	if len(tags) == 0 {
+		settings["*"] = value
+	}
+
+	for _, tag := range tags {
+		settings[tag] = value
+	}
+
+	return settings
+}
+
+// mergeTags adds all tag settings found in other and not in tags.
+func mergeTags[T any](tags, other map[string]T) map[string]T {
+	if len(other) > 0 && tags == nil {
+		tags = make(map[string]T)
+	}
+
+	for tag, value := range other {
+		if _, found := tags[tag]; !found {
+			tags[tag] = value
+		}
+	}
+
+	return tags
+}
@@ -0,0 +1,276 @@
+package readline
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/reeflective/readline/internal/color"
+)
+
+func TestCombineCompleters(t *testing.T) {
+	files := func(line []rune, cursor int) Completions {
+		return CompleteValues("main.go", "go.mod").Tag("files")
+	}
+
+	commands := func(line []rune, cursor int) Completions {
+		return CompleteValues("go", "git", "main.go").Tag("commands")
+	}
+
+	panicking := func(line []rune, cursor int) Completions {
+		panic("boom")
+	}
+
+	tests := []struct {
+		name       string
+		completers []func(line []rune, cursor int) Completions
+		want       []string
+		wantPanic  bool
+	}{
+		{
+			name:       "Groups of all completers",
+			completers: []func(line []rune, cursor int) Completions{files, commands},
+			want:       []string{"files:main.go", "files:go.mod", "commands:go", "commands:git", "commands:main.go"},
+		},
+		{
+			name:       "Duplicated values and tags kept once",
+			completers: []func(line []rune, cursor int) Completions{files, files},
+			want:       []string{"files:main.go", "files:go.mod"},
+		},
+		{
+			name:       "Panicking and nil completers skipped",
+			completers: []func(line []rune, cursor int) Completions{panicking, nil, commands},
+			want:       []string{"commands:go", "commands:git", "commands:main.go"},
+			wantPanic:  true,
+		},
+		{
+			name: "No completers",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			comps := CombineCompleters(test.completers...)([]rune("go "), 3)
+
+			var got []string
+			for _, value := range comps.values {
+				got = append(got, value.Tag+":"+value.Value)
+			}
+
+			if strings.Join(got, " ") != strings.Join(test.want, " ") {
+				t.Errorf("CombineCompleters() values = %v, want %v", got, test.want)
+			}
+
+			if panicked := len(comps.messages.Get()) > 0; panicked != test.wantPanic {
+				t.Errorf("CombineCompleters() messages = %v, want panic %v", comps.messages.Get(), test.wantPanic)
+			}
+		})
+	}
+}
+
+func TestCompletions_Map(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		mapper func(comp Completion) Completion
+		want   []string
+	}{
+		{
+			name:   "Values changed",
+			values: []string{"main", "dev"},
+			mapper: func(comp Completion) Completion {
+				comp.Value = "origin/" + comp.Value
+				return comp
+			},
+			want: []string{"origin/main", "origin/dev"},
+		},
+		{
+			name:   "Descriptions added",
+			values: []string{"main"},
+			mapper: func(comp Completion) Completion {
+				comp.Description = "branch"
+				return comp
+			},
+			want: []string{"main"},
+		},
+		{
+			name:   "No values",
+			mapper: func(comp Completion) Completion { return comp },
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			comps := CompleteValues(test.values...)
+			mapped := comps.Map(test.mapper)
+
+			var got []string
+			for i, value := range mapped.values {
+				got = append(got, value.Value)
+
+				if want := test.mapper(comps.values[i]); value != want {
+					t.Errorf("Map() candidate = %+v, want %+v", value, want)
+				}
+			}
+
+			if strings.Join(got, " ") != strings.Join(test.want, " ") {
+				t.Errorf("Map() values = %v, want %v", got, test.want)
+			}
+
+			for i, value := range comps.values {
+				if value.Value != test.values[i] || value.Description != "" {
+					t.Errorf("Map() modified the original candidate %+v", value)
+				}
+			}
+		})
+	}
+}
+
+func TestShell_CompletionDimBackground(t *testing.T) {
+	tests := []struct {
+		name         string
+		keys         []string
+		autocomplete bool
+		wantDimmed   bool
+	}{
+		{name: "Menu selection", keys: []string{"g", "\t", "\t", "x", "\r"}, wantDimmed: true},
+		{name: "Autocompletion menu", keys: []string{"g", "i", "\r"}, autocomplete: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rl := NewShell()
+			rl.CompletionDimBackground = true
+			rl.Prompt.Primary(func() string { return "> " })
+			rl.Completer = func(line []rune, cursor int) Completions {
+				return CompleteValues("git", "go", "gofmt")
+			}
+
+			if err := rl.BindKey("emacs", `\C-i`, "menu-complete"); err != nil {
+				t.Fatalf("BindKey() error = %v", err)
+			}
+
+			if err := rl.Config.Set("autocomplete", test.autocomplete); err != nil {
+				t.Fatalf("Config.Set() error = %v", err)
+			}
+
+			if _, err := readTestLine(t, rl, test.keys...); err != nil {
+				t.Errorf("Readline() error = %v", err)
+			}
+
+			output := rl.OutputWriter.(*testTerminal).output.String()
+			dimmed := color.Dim + "> "
+
+			if got := strings.Contains(output, dimmed); got != test.wantDimmed {
+				t.Errorf("Readline() dimmed the prompt: %v, want %v", got, test.wantDimmed)
+			}
+
+			// The last prompt printed (when the menu is closed) is never dimmed.
+			if strings.HasSuffix(output[:strings.LastIndex(output, "> ")], color.Dim) {
+				t.Errorf("Readline() output = %q, want the prompt not dimmed once the menu is closed", output)
+			}
+		})
+	}
+}
+
+func TestShell_Bell(t *testing.T) {
+	tests := []struct {
+		name string
+		bell BellStyle
+		want bool
+	}{
+		{name: "Default", want: false},
+		{name: "Audible", bell: BellAudible, want: true},
+		{name: "None", bell: BellNone, want: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rl := NewShell()
+			rl.Bell = test.bell
+			rl.Completer = func(line []rune, cursor int) Completions {
+				return CompleteValues("git", "go")
+			}
+
+			// No candidate matches the word to complete.
+			if _, err := readTestLine(t, rl, "x", "\t", "\r"); err != nil {
+				t.Fatalf("Readline() error = %v", err)
+			}
+
+			output := rl.OutputWriter.(*testTerminal).output.String()
+
+			if got := strings.Contains(output, "\a"); got != test.want {
+				t.Errorf("Readline() rang the bell: %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestShell_CompletionAppendSpace(t *testing.T) {
+	tests := []struct {
+		name    string
+		keys    []string
+		noSpace []rune
+		want    string
+	}{
+		{name: "Directory", keys: []string{"ls s", "\t", "x", "\r"}, noSpace: []rune{'/'}, want: "ls src/x"},
+		{name: "File", keys: []string{"ls m", "\t", "x", "\r"}, noSpace: []rune{'/'}, want: "ls main.go x"},
+		{name: "File before other words", keys: []string{"ls m -l", "\x02\x02\x02", "\t", "x", "\r"}, noSpace: []rune{'/'}, want: "ls main.go x -l"},
+		{name: "Global NoSpace", keys: []string{"ls m", "\t", "\r"}, want: "ls main.go"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rl := NewShell()
+			rl.Completer = func(line []rune, cursor int) Completions {
+				return CompleteValues("src/", "main.go").NoSpace(test.noSpace...).AppendSpace()
+			}
+
+			// The character typed after the completion (if any) shows where the cursor is.
+			line, err := readTestLine(t, rl, test.keys...)
+			if err != nil {
+				t.Fatalf("Readline() error = %v", err)
+			}
+
+			if line != test.want {
+				t.Errorf("Readline() = %q, want %q", line, test.want)
+			}
+		})
+	}
+}
+
+func TestShell_CompletionListOnFirstTab(t *testing.T) {
+	tests := []struct {
+		name   string
+		keys   []string
+		option bool
+		want   string
+	}{
+		{name: "First Tab selects", keys: []string{"g", "\t", " ", "\r"}, want: "gist "},
+		{name: "First Tab lists", keys: []string{"g", "\t", " ", "\r"}, option: true, want: "g "},
+		{name: "Second Tab selects", keys: []string{"g", "\t", "\t", " ", "\r"}, option: true, want: "gist "},
+		{name: "Line modified", keys: []string{"g", "\t", "i", "\t", " ", "\r"}, option: true, want: "gi "},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rl := NewShell()
+			rl.CompletionListOnFirstTab = test.option
+			rl.Completer = func(line []rune, cursor int) Completions {
+				return CompleteValues("git", "gist", "go")
+			}
+
+			if err := rl.BindKey("emacs", `\C-i`, "menu-complete"); err != nil {
+				t.Fatalf("BindKey() error = %v", err)
+			}
+
+			line, err := readTestLine(t, rl, test.keys...)
+			if err != nil {
+				t.Fatalf("Readline() error = %v", err)
+			}
+
+			if line != test.want {
+				t.Errorf("Readline() = %q, want %q", line, test.want)
+			}
+		})
+	}
+}
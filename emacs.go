@@ -2,7 +2,6 @@ package readline
 
 import (
 	"fmt"
-	"io"
 	"sort"
 	"strings"
 	"unicode"
@@ -10,11 +9,11 @@ import (
 	"github.com/rivo/uniseg"
 
 	"github.com/reeflective/readline/inputrc"
-	"github.com/reeflective/readline/internal/color"
 	"github.com/reeflective/readline/internal/completion"
+	"github.com/reeflective/readline/internal/core"
 	"github.com/reeflective/readline/internal/keymap"
 	"github.com/reeflective/readline/internal/strutil"
-	"github.com/reeflective/readline/internal/term"
+	"github.com/reeflective/readline/internal/ui"
 )
 
 // standardCommands returns all standard/emacs commands.
@@ -68,6 +67,8 @@ func (rl *Shell) standardCommands() commands {
 		"delete-horizontal-whitespace": rl.deleteHorizontalWhitespace,
 
 		"delete-word":      rl.deleteWord,
+		"insert-newline":   rl.insertNewline,
+		"expand-word":      rl.expandWord,
 		"quote-region":     rl.quoteRegion,
 		"quote-line":       rl.quoteLine,
 		"keyword-increase": rl.keywordIncrease,
@@ -89,12 +90,14 @@ func (rl *Shell) standardCommands() commands {
 		"yank-pop":            rl.yankPop,
 
 		"kill-buffer":              rl.killBuffer,
+		"kill-to-matching-bracket": rl.killToMatchingBracket,
 		"shell-kill-word":          rl.shellKillWord,
 		"shell-backward-kill-word": rl.shellBackwardKillWord,
 		"copy-prev-shell-word":     rl.copyPrevShellWord,
 
 		// Numeric arguments
-		"digit-argument": rl.digitArgument,
+		"digit-argument":     rl.digitArgument,
+		"universal-argument": rl.universalArgument,
 
 		// Macros
 		"start-kbd-macro":      rl.startKeyboardMacro,
@@ -113,6 +116,7 @@ func (rl *Shell) standardCommands() commands {
 		"undo":                      rl.undoLast,
 		"revert-line":               rl.revertLine,
 		"set-mark":                  rl.setMark,
+		"set-mark-command":          rl.setMark,
 		"exchange-point-and-mark":   rl.exchangePointAndMark,
 		"character-search":          rl.characterSearch,
 		"character-search-backward": rl.characterSearchBackward,
@@ -163,7 +167,7 @@ func (rl *Shell) forwardChar() {
 	startPos := rl.cursor.Pos()
 
 	// Only exception where we actually don't forward a character.
-	if rl.Config.GetBool("history-autosuggest") && rl.cursor.Pos() >= rl.line.Len()-1 {
+	if rl.Display.Autosuggesting() && rl.cursor.Pos() >= rl.line.Len()-1 {
 		rl.autosuggestAccept()
 	}
 
@@ -288,22 +292,14 @@ func (rl *Shell) downLine() {
 // This does not clear the terminal's output buffer.
 func (rl *Shell) clearScreen() {
 	rl.History.SkipSave()
-
-	fmt.Print(term.CursorTopLeft)
-	fmt.Print(term.ClearScreen)
-
-	rl.Display.PrintPrimaryPrompt()
+	rl.Display.ClearScreen(false)
 }
 
 // Clear the current screen and redisplay the prompt and input line.
 // This does clear the terminal's output buffer.
 func (rl *Shell) clearDisplay() {
 	rl.History.SkipSave()
-
-	fmt.Print(term.CursorTopLeft)
-	fmt.Print(term.ClearDisplay)
-
-	rl.Display.PrintPrimaryPrompt()
+	rl.Display.ClearScreen(true)
 }
 
 //
@@ -319,7 +315,7 @@ func (rl *Shell) endOfFile() {
 	switch rl.line.Len() {
 	case 0:
 		rl.Display.AcceptLine()
-		rl.History.Accept(false, false, io.EOF)
+		rl.History.Accept(false, false, ErrEOF)
 	default:
 		rl.deleteChar()
 	}
@@ -358,13 +354,21 @@ func (rl *Shell) backwardDeleteChar() {
 		return
 	}
 
+	// The characters deleted in Vim insert mode are repeated with vi-redo.
+	defer rl.viRecordDeleted(rl.cursor.Pos())
+
 	vii := rl.Iterations.Get()
 
 	switch vii {
 	case 1:
+		// Remove a whole indentation level at the start of a line.
+		if rl.AutoIndent && rl.unindent() {
+			return
+		}
+
 		// Handle removal of autopairs characters.
 		if rl.Config.GetBool("autopairs") {
-			completion.AutopairDelete(rl.line, rl.cursor)
+			completion.AutopairDelete(rl.line, rl.cursor, rl.AutoPairs)
 		}
 
 		// And then delete the character under cursor.
@@ -392,8 +396,10 @@ func (rl *Shell) forwardBackwardDeleteChar() {
 
 // Add the next character that you type to the line verbatim.
 // This is how to insert characters like C-q, for example.
+// Control characters are displayed with their caret notation
+// (eg. ^Q), and the insertion is undone on its own.
 func (rl *Shell) quotedInsert() {
-	rl.History.SkipSave()
+	rl.History.Save()
 	rl.completer.TrimSuffix()
 
 	done := rl.Keymap.PendingCursor()
@@ -401,9 +407,7 @@ func (rl *Shell) quotedInsert() {
 
 	key, _ := rl.Keys.ReadKey()
 
-	quoted, _ := strutil.Quote(key)
-
-	rl.cursor.InsertAt(quoted...)
+	rl.cursor.InsertAt([]rune(strutil.ConvertMeta([]rune{key}))...)
 }
 
 // Insert a tab character.
@@ -415,31 +419,86 @@ func (rl *Shell) tabInsert() {
 
 // Insert the character typed.
 func (rl *Shell) selfInsert() {
-	rl.History.SkipSave()
+	key := rl.Keys.Caller()
+
+	// Digits typed after a numeric argument extend it.
+	if rl.argumentDigit(key[0]) {
+		return
+	}
+
+	// Expand any abbreviation before the cursor on word boundaries.
+	// This must be done before skipping saves, so that it can be undone.
+	if key[0] == ' ' && rl.expandAbbreviation() {
+		rl.History.SkipSave()
+		return
+	}
+
+	rl.History.SaveInsert(key[0])
+
+	for vii := rl.Iterations.Get(); vii > 0; vii-- {
+		if len(rl.fitLine([]rune{key[0]}, true)) == 0 {
+			break
+		}
+
+		pos := rl.cursor.Pos()
+		rl.insertChar(key[0])
+		rl.viRecordTyped(pos, key[0])
+	}
+
+	rl.triggerCompletion(key[0])
+}
+
+// triggerCompletion starts autocompleting the line if the character just
+// typed is one of the CompletionTriggerChars, and if not already completing.
+func (rl *Shell) triggerCompletion(char rune) {
+	if !strings.ContainsRune(string(rl.CompletionTriggerChars), char) {
+		return
+	}
 
+	searching, _, _ := rl.completer.NonIncrementallySearching()
+	if searching || rl.completer.IsActive() {
+		return
+	}
+
+	if rl.Completer == nil && rl.StreamCompleter == nil {
+		return
+	}
+
+	// Drop any completer cached by a previous completion.
+	rl.completer.Cancel(false, true)
+	rl.completer.AutocompleteForce()
+}
+
+// insertChar inserts a character typed by the user at the cursor
+// position, removing any inserted completion suffix and handling
+// auto-pairs, and quoting it if it is a control character.
+func (rl *Shell) insertChar(char rune) {
 	// Handle suffix-autoremoval for inserted completions.
 	rl.completer.TrimSuffix()
 
-	key := rl.Keys.Caller()
-
 	// Handle autopair insertion (for the closer only)
 	searching, _, _ := rl.completer.NonIncrementallySearching()
 	isearch := rl.Keymap.Local() == keymap.Isearch
 
 	if !searching && !isearch && rl.Config.GetBool("autopairs") {
-		if jump := completion.AutopairInsertOrJump(key[0], rl.line, rl.cursor); jump {
+		if jump := completion.AutopairInsertOrJump(char, rl.line, rl.cursor, rl.AutoPairs); jump {
 			return
 		}
 	}
 
+	// Closing brackets end the indentation level of their block.
+	if rl.AutoIndent && strings.ContainsRune(indentClosers, char) {
+		rl.unindent()
+	}
+
 	var quoted []rune
 	var length int
 
-	if rl.Config.GetBool("output-meta") && key[0] != inputrc.Esc {
-		quoted = append(quoted, key[0])
+	if rl.Config.GetBool("output-meta") && char != inputrc.Esc {
+		quoted = append(quoted, char)
 		length = uniseg.StringWidth(string(quoted))
 	} else {
-		quoted, length = strutil.Quote(key[0])
+		quoted, length = strutil.Quote(char)
 	}
 
 	rl.cursor.InsertAt(quoted...)
@@ -447,9 +506,62 @@ func (rl *Shell) selfInsert() {
 	rl.cursor.Move(length)
 }
 
+// fitLine returns the part of chars that can be inserted in the line without
+// exceeding MaxLineLength (either all or none of them if all is true), and
+// signals with a hint and the bell that the limit is reached if they don't fit.
+// Searches minibuffers are not limited.
+func (rl *Shell) fitLine(chars []rune, all bool) []rune {
+	searching, _, _ := rl.completer.NonIncrementallySearching()
+	if searching || rl.Keymap.Local() == keymap.Isearch {
+		return chars
+	}
+
+	fit, capped := rl.line.Fit(chars, rl.MaxLineLength, all)
+	if capped {
+		limit := fmt.Sprintf("Line length limit reached (%d characters)", rl.MaxLineLength)
+		rl.Hint.SetTemporary(rl.Hint.Format(limit, ui.HintError))
+		rl.bell()
+	}
+
+	return fit
+}
+
+// Insert the text pasted in the terminal at once, until the end of the
+// paste: it is not interpreted as keys, and can be undone at once. Pasted
+// carriage returns are inserted as newlines, instead of accepting the line.
+// If the region is active, the pasted text replaces it.
+// This requires the enable-bracketed-paste option to be set.
 func (rl *Shell) bracketedPasteBegin() {
-	// keys, _ := rl.Keys.PeekAllBytes()
-	// fmt.Println(string(keys))
+	pasted := core.PopPaste(rl.Keys, rl.Config)
+	pasted = strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(pasted)
+
+	chars := rl.fitLine([]rune(pasted), rl.RejectLongPaste)
+	if len(chars) == 0 {
+		rl.History.SkipSave()
+		return
+	}
+
+	rl.History.Save()
+	rl.completer.TrimSuffix()
+	rl.deleteRegion()
+	rl.cursor.InsertAt(chars...)
+}
+
+// deleteRegion deletes the text of the active region, if any, so that the
+// text yanked or pasted replaces it: the region is then deactivated, and its
+// text is not saved to the kill ring. This only applies in Emacs mode.
+func (rl *Shell) deleteRegion() {
+	if !rl.Keymap.IsEmacs() || !rl.selection.Active() {
+		return
+	}
+
+	bpos, _ := rl.selection.Pos()
+	if bpos == -1 {
+		return
+	}
+
+	rl.selection.Cut()
+	rl.cursor.Set(bpos)
 }
 
 // Drag the character before point forward over the character
@@ -731,6 +843,18 @@ func (rl *Shell) deleteWord() {
 	rl.selection.Cut()
 }
 
+// Insert a newline at the cursor position, without accepting the line:
+// the input then spans several lines, between which the cursor can move
+// with up-line-or-history and down-line-or-history. Like newlines inserted
+// when AcceptMultiline refuses the line, it is auto-indented with AutoIndent.
+func (rl *Shell) insertNewline() {
+	rl.History.Save()
+
+	for vii := rl.Iterations.Get(); vii > 0; vii-- {
+		rl.breakLine()
+	}
+}
+
 // Quote the region from the cursor to the mark.
 func (rl *Shell) quoteRegion() {
 	rl.History.Save()
@@ -930,21 +1054,48 @@ func (rl *Shell) backwardKillWord() {
 
 // Kill the text between the point and mark (saved cursor
 // position).  This text is referred to as the region.
+// If no mark is set, kill the word behind point, like
+// unix-word-rubout, which is what C-w does by default.
 func (rl *Shell) killRegion() {
+	if !rl.selection.Active() && !rl.activateRegion() {
+		rl.backwardKillWord()
+		return
+	}
+
 	rl.History.Save()
 
-	if !rl.selection.Active() {
+	bpos, _ := rl.selection.Pos()
+	rl.Buffers.Write([]rune(rl.selection.Cut())...)
+
+	if bpos != -1 {
+		rl.cursor.Set(bpos)
+	}
+}
+
+// Kill the text between the bracket under the cursor (or the first closing
+// one after it) and its matching bracket, both included.
+func (rl *Shell) killToMatchingBracket() {
+	pos, match, found := rl.matchingBracket()
+	if !found {
+		rl.bell()
 		return
 	}
 
-	rl.Buffers.Write([]rune(rl.selection.Cut())...)
+	rl.History.Save()
+
+	bpos, epos := min(pos, match), max(pos, match)+1
+
+	rl.Buffers.Write((*rl.line)[bpos:epos]...)
+	rl.line.Cut(bpos, epos)
+	rl.cursor.Set(bpos)
 }
 
 // Copy the text in the region to the kill buffer.
 func (rl *Shell) copyRegionAsKill() {
 	rl.History.SkipSave()
 
-	if !rl.selection.Active() {
+	if !rl.selection.Active() && !rl.activateRegion() {
+		rl.bell()
 		return
 	}
 
@@ -979,13 +1130,16 @@ func (rl *Shell) copyForwardWord() {
 }
 
 // Yank the top of the kill ring into the buffer at point.
+// If the region is active, the yanked text replaces it.
 func (rl *Shell) yank() {
 	buf := rl.Buffers.Active()
 
+	rl.deleteRegion()
+
 	vii := rl.Iterations.Get()
 
 	for i := 1; i <= vii; i++ {
-		rl.cursor.InsertAt(buf...)
+		rl.cursor.InsertAt(rl.fitLine(buf, rl.RejectLongPaste)...)
 	}
 }
 
@@ -996,7 +1150,7 @@ func (rl *Shell) yankPop() {
 
 	for i := 1; i <= vii; i++ {
 		buf := rl.Buffers.Pop()
-		rl.cursor.InsertAt(buf...)
+		rl.cursor.InsertAt(rl.fitLine(buf, rl.RejectLongPaste)...)
 	}
 }
 
@@ -1089,6 +1243,32 @@ func (rl *Shell) digitArgument() {
 	rl.Iterations.Add(string(keys))
 }
 
+// Start a numeric argument for the next command: without digits, the argument
+// is 4, and each further universal-argument multiplies it by four. Digits typed
+// right after it (with or without the Meta modifier) set the argument instead.
+// This command is not bound by default: bind it with `"\C-u": universal-argument`.
+func (rl *Shell) universalArgument() {
+	rl.History.SkipSave()
+	rl.Iterations.Universal()
+}
+
+// argumentDigit adds a digit typed right after a numeric argument in Emacs
+// mode to this argument, like digit-argument does, and returns true if so.
+func (rl *Shell) argumentDigit(char rune) bool {
+	if !rl.Iterations.IsSet() || !rl.Keymap.IsEmacs() || rl.Keymap.Local() != "" {
+		return false
+	}
+
+	if char < '0' || char > '9' {
+		return false
+	}
+
+	rl.History.SkipSave()
+	rl.Iterations.Add(string(char))
+
+	return true
+}
+
 //
 // Macros ----------------------------------------------------------------------
 //
@@ -1136,7 +1316,7 @@ func (rl *Shell) macroToggleRecord() {
 	done := rl.Keymap.PendingCursor()
 	defer done()
 
-	rl.Hint.SetTemporary(color.Dim + "REC (macro arg)")
+	rl.Hint.SetTemporary(rl.Hint.Format("REC (macro arg)", ui.HintInfo))
 	rl.Display.Refresh()
 
 	key, isAbort := rl.Keys.ReadKey()
@@ -1154,7 +1334,7 @@ func (rl *Shell) macroRun() {
 	done := rl.Keymap.PendingCursor()
 	defer done()
 
-	rl.Hint.SetTemporary(color.Dim + "Run (macro arg)")
+	rl.Hint.SetTemporary(rl.Hint.Format("Run (macro arg)", ui.HintInfo))
 	rl.Display.Refresh()
 
 	key, isAbort := rl.Keys.ReadKey()
@@ -1176,7 +1356,7 @@ func (rl *Shell) reReadInitFile() {
 
 	err := rl.Keymap.ReloadConfig(rl.Opts...)
 	if err != nil {
-		rl.Hint.SetTemporary(color.FgRed + "Inputrc reload error: " + err.Error())
+		rl.Hint.SetTemporary(rl.Hint.Format("Inputrc reload error: "+err.Error(), ui.HintError))
 		return
 	}
 
@@ -1197,7 +1377,7 @@ func (rl *Shell) reReadInitFile() {
 	}
 
 	// Notify successfully reloaded
-	rl.Hint.SetTemporary(color.FgGreen + "Inputrc reloaded")
+	rl.Hint.SetTemporary(rl.Hint.Format("Inputrc reloaded", ui.HintSuccess))
 }
 
 // Abort the current editing command.
@@ -1211,7 +1391,7 @@ func (rl *Shell) abort() {
 	// Cancel active completion insertion and/or incremental search.
 	if rl.completer.AutoCompleting() || rl.completer.IsInserting() {
 		rl.Hint.Reset()
-		rl.completer.ResetForce()
+		rl.completer.Abort()
 
 		return
 	}
@@ -1234,7 +1414,7 @@ func (rl *Shell) abort() {
 		key := rl.Keys.Caller()
 		if key[0] == rune(inputrc.Unescape(`\C-C`)[0]) {
 			quoted, _ := strutil.Quote(key[0])
-			fmt.Print(string(quoted))
+			fmt.Fprint(rl.output, string(quoted))
 		}
 	}
 
@@ -1306,53 +1486,51 @@ func (rl *Shell) undoLast() {
 // This is like executing the undo command enough
 // times to return the line to its initial state.
 func (rl *Shell) revertLine() {
+	// Not a movement a pending Vim operator can act on (eg. `yU`).
+	if rl.viCancelPending() {
+		return
+	}
+
 	rl.History.Revert()
 }
 
 // Set the mark to the point. If a numeric argument is
-// supplied, the mark is set to that position.
+// supplied, the mark is set to that position. The region,
+// between the mark and the point, is then active (highlighted)
+// until it is killed or copied, or until the line is modified.
 func (rl *Shell) setMark() {
-	switch {
-	case rl.Iterations.IsSet():
-		rl.cursor.SetMark()
-	default:
-		cpos := rl.cursor.Pos()
-		mark := rl.Iterations.Get()
+	rl.History.SkipSave()
 
-		if mark > rl.line.Len()-1 {
-			return
-		}
+	mark := rl.cursor.Pos()
 
-		rl.cursor.Set(mark)
-		rl.cursor.SetMark()
-		rl.cursor.Set(cpos)
+	if rl.Iterations.IsSet() {
+		mark = rl.Iterations.Get()
+	}
+
+	if mark < 0 || mark > rl.line.Len() {
+		rl.bell()
+		return
 	}
+
+	rl.marks.set(regionMark, mark)
+	rl.activateRegion()
 }
 
 // Swap the point with the mark.  The current cursor position
 // is set to the saved position, and the old cursor position
 // is saved as the mark.
 func (rl *Shell) exchangePointAndMark() {
-	// Deactivate mark if out of bound
-	if rl.cursor.Mark() > rl.line.Len() {
-		rl.cursor.ResetMark()
-	}
-
-	// And set it to start if negative.
-	if rl.cursor.Mark() < 0 {
-		cpos := rl.cursor.Pos()
-		rl.cursor.Set(0)
-		rl.cursor.SetMark()
-		rl.cursor.Set(cpos)
-	} else {
-		mark := rl.cursor.Mark()
-
-		rl.cursor.SetMark()
-		rl.cursor.Set(mark)
+	rl.History.SkipSave()
 
-		rl.selection.MarkRange(rl.cursor.Mark(), rl.cursor.Pos())
-		rl.selection.Visual(false)
+	mark, found := rl.marks.get(regionMark)
+	if !found {
+		rl.bell()
+		return
 	}
+
+	rl.marks.set(regionMark, rl.cursor.Pos())
+	rl.cursor.Set(mark)
+	rl.activateRegion()
 }
 
 // A character is read and point is moved to the next
@@ -1431,7 +1609,7 @@ func (rl *Shell) insertComment() {
 // can be made part of an inputrc file.
 func (rl *Shell) dumpFunctions() {
 	rl.Display.ClearHelpers()
-	fmt.Println()
+	fmt.Fprintln(rl.output)
 
 	defer func() {
 		rl.Prompt.PrimaryPrint()
@@ -1448,7 +1626,7 @@ func (rl *Shell) dumpFunctions() {
 // can be made part of an inputrc file.
 func (rl *Shell) dumpVariables() {
 	rl.Display.ClearHelpers()
-	fmt.Println()
+	fmt.Fprintln(rl.output)
 
 	defer func() {
 		rl.Prompt.PrimaryPrint()
@@ -1468,12 +1646,12 @@ func (rl *Shell) dumpVariables() {
 	if rl.Iterations.IsSet() {
 		for _, variable := range variables {
 			value := rl.Config.Vars[variable]
-			fmt.Printf("set %s %v\n", variable, value)
+			fmt.Fprintf(rl.output, "set %s %v\n", variable, value)
 		}
 	} else {
 		for _, variable := range variables {
 			value := rl.Config.Vars[variable]
-			fmt.Printf("%s is set to `%v'\n", variable, value)
+			fmt.Fprintf(rl.output, "%s is set to `%v'\n", variable, value)
 		}
 	}
 }
@@ -1484,7 +1662,7 @@ func (rl *Shell) dumpVariables() {
 // can be made part of an inputrc file.
 func (rl *Shell) dumpMacros() {
 	rl.Display.ClearHelpers()
-	fmt.Println()
+	fmt.Fprintln(rl.output)
 
 	defer func() {
 		rl.Prompt.PrimaryPrint()
@@ -1510,12 +1688,12 @@ func (rl *Shell) dumpMacros() {
 	if rl.Iterations.IsSet() {
 		for _, key := range macroBinds {
 			action := inputrc.Escape(binds[inputrc.Unescape(key)].Action)
-			fmt.Printf("\"%s\": \"%s\"\n", key, action)
+			fmt.Fprintf(rl.output, "\"%s\": \"%s\"\n", key, action)
 		}
 	} else {
 		for _, key := range macroBinds {
 			action := inputrc.Escape(binds[inputrc.Unescape(key)].Action)
-			fmt.Printf("%s outputs %s\n", key, action)
+			fmt.Fprintf(rl.output, "%s outputs %s\n", key, action)
 		}
 	}
 }
@@ -1531,8 +1709,7 @@ func (rl *Shell) editAndExecuteCommand() {
 		rl.History.SkipSave()
 
 		errStr := strings.ReplaceAll(err.Error(), "\n", "")
-		changeHint := fmt.Sprintf(color.FgRed+"Editor error: %s", errStr)
-		rl.Hint.SetTemporary(changeHint)
+		rl.Hint.SetTemporary(rl.Hint.Format("Editor error: "+errStr, ui.HintError))
 
 		return
 	}
@@ -1553,8 +1730,7 @@ func (rl *Shell) editCommandLine() {
 		rl.History.SkipSave()
 
 		errStr := strings.ReplaceAll(err.Error(), "\n", "")
-		changeHint := fmt.Sprintf(color.FgRed+"Editor error: %s", errStr)
-		rl.Hint.SetTemporary(changeHint)
+		rl.Hint.SetTemporary(rl.Hint.Format("Editor error: "+errStr, ui.HintError))
 
 		return
 	}
@@ -0,0 +1,74 @@
+package readline
+
+import "testing"
+
+func TestShell_emacsRegion(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []string
+		want string
+	}{
+		{name: "Kill text typed after the mark", keys: []string{"ab ", "\x00", "cd ef", "\x17", "\r"}, want: "ab "},
+		{name: "Kill region before the mark", keys: []string{"abc def", "\x00", "\x1bb", "\x17", "\r"}, want: "abc "},
+		{name: "Kill region and yank it", keys: []string{"abc def", "\x01", "\x00", "\x1bf", "\x17", "\x05", "\x19", "\r"}, want: "defabc "},
+		{name: "Kill without mark", keys: []string{"abc def", "\x17", "\r"}, want: "abc "},
+		{name: "Copy region and yank it", keys: []string{"abc", "\x01", "\x00", "\x05", "\x1bw", "\x19", "\r"}, want: "abcabc"},
+		{name: "Copy without mark", keys: []string{"abc", "\x1bw", "\x19", "\r"}, want: "abc"},
+		{name: "Exchange point and mark", keys: []string{"abc", "\x00", "\x01", "\x18\x18", "X", "\r"}, want: "abcX"},
+		{name: "Deleted mark", keys: []string{"abc", "\x02", "\x00", "\x04", "\x17", "\r"}, want: ""},
+		{name: "Yank replaces the region", keys: []string{"foo bar", "\x17", "baz", "\x00", "\x1bb", "\x19", "\r"}, want: "foo bar"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rl := NewShell()
+
+			if err := rl.BindKey("emacs", `\C-w`, "kill-region"); err != nil {
+				t.Fatalf("BindKey() error = %v", err)
+			}
+
+			if err := rl.BindKey("emacs", `\M-w`, "copy-region-as-kill"); err != nil {
+				t.Fatalf("BindKey() error = %v", err)
+			}
+
+			got, err := readTestLine(t, rl, test.keys...)
+			if err != nil {
+				t.Errorf("Readline() error = %v", err)
+			}
+
+			if got != test.want {
+				t.Errorf("Readline() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestShell_insertNewline(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []string
+		want string
+	}{
+		{name: "Insert newline", keys: []string{"ab", "\x02", "\x18n", "\r"}, want: "a\nb"},
+		{name: "Insert newline with argument", keys: []string{"ab", "\x02", "\x1b3", "\x18n", "\r"}, want: "a\n\n\nb"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rl := NewShell()
+
+			if err := rl.BindKey("emacs", `\C-xn`, "insert-newline"); err != nil {
+				t.Fatalf("BindKey() error = %v", err)
+			}
+
+			got, err := readTestLine(t, rl, test.keys...)
+			if err != nil {
+				t.Errorf("Readline() error = %v", err)
+			}
+
+			if got != test.want {
+				t.Errorf("Readline() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package readline
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/reeflective/readline/internal/ui"
+)
+
+// ExpandEnv can be used as a Shell.ExpandPreview function: it expands a leading
+// tilde (~ or ~user) to the corresponding home directory, and all $VAR/${VAR}
+// environment variables in the word. Unset variables are left as is, and make
+// ok false, as does an unknown user.
+func ExpandEnv(word string) (expanded string, ok bool) {
+	ok = true
+
+	// Home directories
+	if strings.HasPrefix(word, "~") {
+		name, rest, _ := strings.Cut(word[1:], string(filepath.Separator))
+
+		var home string
+
+		if name == "" {
+			home, _ = os.UserHomeDir()
+		} else if usr, err := user.Lookup(name); err == nil {
+			home = usr.HomeDir
+		}
+
+		if home == "" {
+			ok = false
+		} else if rest != "" || strings.HasSuffix(word, string(filepath.Separator)) {
+			word = home + string(filepath.Separator) + rest
+		} else {
+			word = home
+		}
+	}
+
+	// Environment variables
+	expanded = os.Expand(word, func(name string) string {
+		value, set := os.LookupEnv(name)
+		if !set {
+			ok = false
+			return "$" + name
+		}
+
+		return value
+	})
+
+	return expanded, ok
+}
+
+// previewExpansion shows in the hint the expansion of the word under the
+// cursor returned by Shell.ExpandPreview, if any and if it is different from
+// the word itself. Words that cannot be fully expanded are shown as errors.
+// The preview does not overwrite any other hint being shown.
+func (rl *Shell) previewExpansion() {
+	if rl.ExpandPreview == nil {
+		return
+	}
+
+	hint := ""
+
+	if word, _, _ := rl.wordUnderCursor(); word != "" && !rl.completer.IsActive() {
+		if expanded, ok := rl.ExpandPreview(word); expanded != word {
+			if ok {
+				hint = rl.Hint.Format("→ "+expanded, ui.HintInfo)
+			} else {
+				hint = rl.Hint.Format("→ "+expanded, ui.HintError)
+			}
+		}
+	}
+
+	// Only replace our own preview, the mode indicator, or an empty hint.
+	if rl.Hint.Len() > 0 && rl.Hint.Text() != rl.expansion && rl.Hint.Text() != rl.indicator {
+		return
+	}
+
+	if hint == "" && rl.expansion != "" {
+		rl.Hint.Reset()
+	} else if hint != "" {
+		rl.Hint.Set(hint)
+	}
+
+	rl.expansion = hint
+}
+
+// Replace the word under the cursor with its expansion by the Shell.ExpandPreview
+// function (or ExpandEnv if the former is nil), as a single undoable edit. If the
+// word cannot be fully expanded (eg. an unset variable), the line is not modified.
+func (rl *Shell) expandWord() {
+	expand := rl.ExpandPreview
+	if expand == nil {
+		expand = ExpandEnv
+	}
+
+	word, bpos, epos := rl.wordUnderCursor()
+	if word == "" {
+		return
+	}
+
+	expanded, ok := expand(word)
+	if !ok {
+		rl.bell()
+		return
+	}
+
+	if expanded == word {
+		return
+	}
+
+	rl.History.Save()
+
+	rl.line.Cut(bpos, epos)
+	rl.line.Insert(bpos, []rune(expanded)...)
+	rl.cursor.Set(bpos + len([]rune(expanded)))
+}
+
+// wordUnderCursor returns the blank-separated word under (or right
+// before) the cursor, with its begin and (exclusive) end positions.
+func (rl *Shell) wordUnderCursor() (word string, bpos, epos int) {
+	bpos, epos = rl.cursor.Pos(), rl.cursor.Pos()
+
+	for bpos > 0 && !unicode.IsSpace((*rl.line)[bpos-1]) {
+		bpos--
+	}
+
+	for epos < rl.line.Len() && !unicode.IsSpace((*rl.line)[epos]) {
+		epos++
+	}
+
+	return string((*rl.line)[bpos:epos]), bpos, epos
+}
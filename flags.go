@@ -0,0 +1,91 @@
+package readline
+
+// Flag is a command flag to be completed with CompleteFlags,
+// with its short and/or long forms (without their leading
+// dashes, eg. "v" and "verbose") and its description.
+type Flag struct {
+	Short       string // Short form, completed as `-v`.
+	Long        string // Long form, completed as `--verbose`.
+	Description string // Shown next to the flag in the menu.
+	Argument    bool   // The flag requires an argument: the long form is completed as `--output=`.
+}
+
+// FlagGroup is a list of flags completed under a common
+// tag (eg. "global flags"), with CompleteFlagGroups.
+type FlagGroup struct {
+	Tag   string
+	Flags []Flag
+}
+
+// flagsTag is the tag of flags completed with CompleteFlags.
+const flagsTag = "flags"
+
+// CompleteFlags completes command flags under a "flags" tag.
+// See CompleteFlagGroups for the way they are completed.
+func CompleteFlags(flags ...Flag) Completions {
+	return CompleteFlagGroups(FlagGroup{Tag: flagsTag, Flags: flags})
+}
+
+// CompleteFlagGroups completes command flags, each group under its own tag.
+// Flags having a long form are completed with it, and their short form is
+// shown next to them in the menu: flags are thus listed once, one per line,
+// with aligned descriptions and in the order given. Flags only having a
+// short form are completed with it.
+//
+// Flags are inserted with a trailing space, except the long forms of those
+// requiring an argument, which end with an '=' so that the argument can be
+// typed right away. The candidates can be styled with TagStyle().
+func CompleteFlagGroups(groups ...FlagGroup) Completions {
+	var values []Completion
+
+	tags := make([]string, 0, len(groups))
+
+	for _, group := range groups {
+		tags = append(tags, group.Tag)
+
+		for _, flag := range group.Flags {
+			if candidate, valid := flag.candidate(group.Tag); valid {
+				values = append(values, candidate)
+			}
+		}
+	}
+
+	return CompleteRaw(values).
+		NoSort(tags...).
+		DisplayList(tags...).
+		JustifyDescriptions(tags...).
+		NoSpace('=').
+		AppendSpace()
+}
+
+// candidate returns the completion candidate for the flag, or false if
+// the flag has neither a long nor a short form.
+func (f Flag) candidate(tag string) (Completion, bool) {
+	candidate := Completion{
+		Description: f.Description,
+		Tag:         tag,
+	}
+
+	switch {
+	case f.Long != "":
+		candidate.Value = "--" + f.Long
+
+		if f.Argument {
+			candidate.Value += "="
+		}
+
+		if f.Short != "" {
+			candidate.Annotation = "-" + f.Short
+		}
+
+	case f.Short != "":
+		candidate.Value = "-" + f.Short
+
+	default:
+		return candidate, false
+	}
+
+	candidate.Display = candidate.Value
+
+	return candidate, true
+}
@@ -3,9 +3,10 @@ package readline
 import (
 	"strings"
 
-	"github.com/reeflective/readline/inputrc"
+	"github.com/reeflective/readline/internal/display"
 	"github.com/reeflective/readline/internal/history"
 	"github.com/reeflective/readline/internal/strutil"
+	"github.com/reeflective/readline/internal/ui"
 )
 
 //
@@ -18,6 +19,10 @@ import (
 // Users who want an easy to use, file-based history should use NewHistoryFromFile().
 type History = history.Source
 
+// TimedHistory is a history source also recording when each line has been written.
+// The history completion menu shows how long ago each line of such sources was run.
+type TimedHistory = history.TimedSource
+
 // NewHistoryFromFile creates a new command history source writing to and reading
 // from a file. The caller should bind the history source returned from this call
 // to the readline instance, with shell.History.Add().
@@ -28,6 +33,18 @@ var NewHistoryFromFile = history.NewSourceFromFile
 // to the readline instance, with shell.History.Add().
 var NewInMemoryHistory = history.NewInMemoryHistory
 
+// AutosuggestPrecedence determines how the line autosuggested from the history
+// (with the `history-autosuggest` option) and the completion menu are displayed
+// when both are available. It is set with the AutosuggestPrecedence shell field.
+type AutosuggestPrecedence = display.AutosuggestPrecedence
+
+// Autosuggestion precedences.
+const (
+	MenuOverAutosuggest = display.MenuOverAutosuggest // Hide the suggestion while the menu is displayed (default).
+	AutosuggestOverMenu = display.AutosuggestOverMenu // Hide the menu (not the hints) while a line is suggested.
+	AutosuggestWithMenu = display.AutosuggestWithMenu // Display both of them.
+)
+
 // historyCommands returns all history commands.
 // Under each comment are gathered all commands related to the comment's
 // subject. When there are two subgroups separated by an empty line, the
@@ -43,6 +60,7 @@ func (rl *Shell) historyCommands() commands {
 		"fetch-history":                          rl.fetchHistory,
 		"forward-search-history":                 rl.forwardSearchHistory,
 		"reverse-search-history":                 rl.reverseSearchHistory,
+		"search-session-history":                 rl.searchSessionHistory,
 		"non-incremental-forward-search-history": rl.nonIncrementalForwardSearchHistory,
 		"non-incremental-reverse-search-history": rl.nonIncrementalReverseSearchHistory,
 		"history-search-forward":                 rl.historySearchForward,
@@ -55,11 +73,13 @@ func (rl *Shell) historyCommands() commands {
 		"magic-space":                            rl.magicSpace,
 
 		"accept-and-hold":                    rl.acceptAndHold,
+		"accept-or-insert-newline":           rl.acceptOrInsertNewline,
 		"accept-and-infer-next-history":      rl.acceptAndInferNextHistory,
 		"down-line-or-history":               rl.downLineOrHistory,
 		"vi-down-line-or-history":            rl.viDownLineOrHistory,
 		"up-line-or-history":                 rl.upLineOrHistory,
 		"up-line-or-search":                  rl.upLineOrSearch,
+		"down-line-or-search":                rl.downLineOrSearch,
 		"down-line-or-select":                rl.downLineOrSelect,
 		"infer-next-history":                 rl.inferNextHistory,
 		"beginning-of-buffer-or-history":     rl.beginningOfBufferOrHistory,
@@ -114,15 +134,11 @@ func (rl *Shell) beginningOfHistory() {
 	rl.History.Walk(history.Len())
 }
 
-// Move to the last event in the history list.
+// Move to the end of the input history, i.e., the line currently
+// being entered, as it was before moving through the history.
 func (rl *Shell) endOfHistory() {
-	history := rl.History.Current()
-
-	if history == nil {
-		return
-	}
-
-	rl.History.Walk(-history.Len() + 1)
+	rl.History.SkipSave()
+	rl.History.WalkEnd()
 }
 
 // Execute the current line, and push the next history event on the buffer stack.
@@ -167,6 +183,32 @@ func (rl *Shell) reverseSearchHistory() {
 	rl.historyCompletion(forward, filterLine, regexp)
 }
 
+// Search backward through the lines accepted during the current session only,
+// that is, in the session history source (see Shell.History.AddSession()).
+// This is an incremental search, like reverse-search-history.
+func (rl *Shell) searchSessionHistory() {
+	rl.History.SkipSave()
+
+	if !rl.History.UseSession() {
+		rl.Hint.SetTemporary(rl.Hint.Format("No session history source", ui.HintError))
+		return
+	}
+
+	forward := false
+	filterLine := false
+	regexp := true
+
+	rl.historyCompletion(forward, filterLine, regexp)
+}
+
+// leaveSessionHistory makes the history source active before searching the
+// session history active again, once the search is done (not completing).
+func (rl *Shell) leaveSessionHistory() {
+	if !rl.completer.IsActive() {
+		rl.History.LeaveSession()
+	}
+}
+
 // Search forward through the history starting at the current line
 // using a non-incremental search for a string supplied by the user.
 func (rl *Shell) nonIncrementalForwardSearchHistory() {
@@ -197,7 +239,9 @@ func (rl *Shell) historySearchForward() {
 	forward := true
 	regexp := false
 
-	rl.History.InsertMatch(nil, nil, usePos, forward, regexp)
+	rl.bellOnNoMatch(func() {
+		rl.History.InsertMatch(nil, nil, usePos, forward, regexp)
+	})
 }
 
 // Search backward through the history for the string of characters
@@ -210,7 +254,9 @@ func (rl *Shell) historySearchBackward() {
 	forward := false
 	regexp := false
 
-	rl.History.InsertMatch(nil, nil, usePos, forward, regexp)
+	rl.bellOnNoMatch(func() {
+		rl.History.InsertMatch(nil, nil, usePos, forward, regexp)
+	})
 }
 
 // Search forward through the history for the string of characters
@@ -222,7 +268,9 @@ func (rl *Shell) historySubstringSearchForward() {
 	forward := true
 	regexp := true
 
-	rl.History.InsertMatch(rl.line, rl.cursor, usePos, forward, regexp)
+	rl.bellOnNoMatch(func() {
+		rl.History.InsertMatch(rl.line, rl.cursor, usePos, forward, regexp)
+	})
 }
 
 // Search backward through the history for the string of characters
@@ -234,7 +282,9 @@ func (rl *Shell) historySubstringSearchBackward() {
 	forward := false
 	regexp := true
 
-	rl.History.InsertMatch(rl.line, rl.cursor, usePos, forward, regexp)
+	rl.bellOnNoMatch(func() {
+		rl.History.InsertMatch(rl.line, rl.cursor, usePos, forward, regexp)
+	})
 }
 
 // Insert the last argument to the previous command (the last
@@ -250,31 +300,110 @@ func (rl *Shell) historySubstringSearchBackward() {
 // facilities are used to extract the last argument, as if
 // the "!$" history expansion had been specified.
 func (rl *Shell) yankLastArg() {
-	// Get the last history line.
-	last := rl.History.GetLast()
-	if last == "" {
+	history := rl.History.Current()
+	if history == nil || history.Len() == 0 {
+		rl.bell()
+		rl.Hint.SetTemporary(rl.Hint.Format("No previous history", ui.HintError))
+
 		return
 	}
 
-	// Split it into words, and get the last one.
-	words, err := strutil.Split(last)
-	if err != nil || len(words) == 0 {
+	state := &rl.yankArg
+	cycling := state.line != "" && state.line == string(*rl.line) && state.end == rl.cursor.Pos()
+
+	// A new cycle starts with the last history line, and
+	// with the word selected by the numeric argument, if any.
+	if !cycling {
+		state.index = history.Len()
+		state.nth, state.last = 0, !rl.Iterations.IsSet()
+		state.backward = true
+
+		if !state.last {
+			state.nth = rl.Iterations.Get()
+		}
+
+		state.start, state.end = rl.cursor.Pos(), rl.cursor.Pos()
+		rl.History.Save()
+	} else if rl.Iterations.IsSet() && rl.Iterations.Get() < 0 {
+		state.backward = !state.backward
+	}
+
+	// Find the next history line having the wanted word.
+	arg, found := "", false
+
+	for pos := state.index; !found; {
+		if state.backward {
+			pos--
+		} else {
+			pos++
+		}
+
+		if pos < 0 || pos >= history.Len() {
+			break
+		}
+
+		if line, err := history.GetLine(pos); err == nil {
+			arg, found = historyArg(line, state.nth, state.last)
+		}
+
+		state.index = pos
+	}
+
+	if !found {
+		rl.bell()
 		return
 	}
 
-	// Get the last word, and quote it if it contains spaces.
-	lastArg := words[len(words)-1]
-	if strings.ContainsAny(lastArg, " \t") {
-		if strings.Contains(lastArg, "\"") {
-			lastArg = "'" + lastArg + "'"
+	// Replace the argument previously inserted, if any.
+	rl.line.Cut(state.start, state.end)
+	rl.line.Insert(state.start, []rune(arg)...)
+	rl.cursor.Set(state.start + len([]rune(arg)))
+
+	state.end = rl.cursor.Pos()
+	state.line = string(*rl.line)
+}
+
+// yankArgState keeps track of the arguments successively inserted
+// by yank-last-arg, so that each call replaces the previous one.
+type yankArgState struct {
+	line       string // The line after the last insertion.
+	start, end int    // Position of the inserted argument.
+	index      int    // History line the argument comes from.
+	nth        int    // The word to insert, if not the last one.
+	last       bool   // Insert the last word of lines.
+	backward   bool   // Direction of the cycle in history.
+}
+
+// historyArg returns the nth word of a history line (words begin with 0, and
+// negative numbers count from the end), or its last one, quoted if needed.
+func historyArg(line string, nth int, last bool) (arg string, found bool) {
+	words, err := strutil.Split(line)
+	if err != nil || len(words) == 0 {
+		words = strings.Fields(line)
+	}
+
+	switch {
+	case last:
+		nth = len(words) - 1
+	case nth < 0:
+		nth += len(words)
+	}
+
+	if nth < 0 || nth >= len(words) {
+		return "", false
+	}
+
+	// Quote the word if it contains spaces.
+	arg = words[nth]
+	if strings.ContainsAny(arg, " \t") {
+		if strings.Contains(arg, "\"") {
+			arg = "'" + arg + "'"
 		} else {
-			lastArg = "\"" + lastArg + "\""
+			arg = "\"" + arg + "\""
 		}
 	}
 
-	// And append it to the end of the line.
-	rl.line.Insert(rl.cursor.Pos(), []rune(lastArg)...)
-	rl.cursor.Move(len(lastArg))
+	return arg, true
 }
 
 // Insert the first argument to the previous command (usually
@@ -322,48 +451,24 @@ func (rl *Shell) yankNthArg() {
 }
 
 // Perform history expansion on the current line and insert a space.
-// If the current blank word under cursor starts with an exclamation
-// mark, the word up to the cursor is matched as a prefix against
-// the history lines, and the first match is inserted in place of it.
+// History events (!!, !$, !n, !-n, !prefix, etc) are expanded in the whole
+// line, and the expansion is briefly shown as a hint (until the next key).
+// If an event cannot be found, the error is shown as a hint instead.
 func (rl *Shell) magicSpace() {
-	cpos := rl.cursor.Pos()
-	lineLen := rl.line.Len()
-
-	// If no line, or the cursor is on a space, we can't perform.
-	if lineLen == 0 || (cpos == lineLen && (*rl.line)[cpos-1] == inputrc.Space) {
-		rl.selfInsert()
-		return
-	}
-
-	// Select the word around cursor.
-	rl.viSelectInBlankWord()
-	word, bpos, _, _ := rl.selection.Pop()
-	rl.cursor.Set(cpos)
-
-	// Fail if empty or not prefixed expandable.
-	if len(strings.TrimSpace(word)) == 0 {
-		rl.selfInsert()
-		return
-	}
+	line := string(*rl.line)
+	expanded, err := rl.History.ExpandLine(line)
 
-	if !strings.HasPrefix(word, "!") || word == "!" {
-		rl.selfInsert()
-		return
-	}
-
-	// Else, perform expansion on the remainder.
-	pattern := (*rl.line)[bpos+1:]
-	suggested := rl.History.Suggest(&pattern)
-
-	if string(suggested) == string(pattern) {
-		rl.selfInsert()
-		return
+	switch {
+	case err != nil:
+		rl.Hint.SetTemporary(rl.Hint.Format(err.Error(), ui.HintError))
+	case expanded != line:
+		rl.Hint.SetTemporary(rl.Hint.Format(line+" → "+expanded, ui.HintInfo))
+		rl.History.Save()
+		rl.line.Set([]rune(expanded)...)
+		rl.cursor.Set(rl.line.Len())
 	}
 
-	rl.History.Save()
-	rl.line.Cut(bpos, lineLen)
-	rl.line.Insert(bpos, suggested...)
-	rl.cursor.Set(bpos + suggested.Len())
+	rl.selfInsert()
 }
 
 //
@@ -376,6 +481,17 @@ func (rl *Shell) acceptAndHold() {
 	rl.acceptLineWith(false, true)
 }
 
+// Accept the line if the cursor is at the end of the buffer,
+// or insert a newline at the cursor position otherwise.
+func (rl *Shell) acceptOrInsertNewline() {
+	if rl.cursor.Pos() < rl.line.Len() {
+		rl.insertNewline()
+		return
+	}
+
+	rl.acceptLine()
+}
+
 // Execute the contents of the buffer. Then search the history list for a line
 // matching the current one and push the event following onto the buffer stack.
 func (rl *Shell) acceptAndInferNextHistory() {
@@ -426,8 +542,10 @@ func (rl *Shell) upLineOrHistory() {
 	}
 }
 
-// If the cursor is on the first line of the buffer, start an incremental
-// search backward on the history lines. Otherwise, move up a line in the buffer.
+// If the cursor is on the first line of the buffer, search backward for
+// a history line starting with the current line. Otherwise, move up a line
+// in the buffer. Repeated calls keep using the same prefix, and with an
+// empty line, this behaves like previous-history.
 func (rl *Shell) upLineOrSearch() {
 	rl.History.SkipSave()
 
@@ -435,7 +553,26 @@ func (rl *Shell) upLineOrSearch() {
 	case rl.cursor.LinePos() > 0:
 		rl.cursor.LineMove(-1)
 	default:
-		rl.historySearchBackward()
+		rl.bellOnNoMatch(func() {
+			rl.History.SearchPrefix(!rl.isPrefixSearching(), false)
+		})
+	}
+}
+
+// If the cursor is on the last line of the buffer, search forward for
+// a history line starting with the current line. Otherwise, move down
+// a line in the buffer. Repeated calls keep using the same prefix, and
+// with an empty line, this behaves like next-history.
+func (rl *Shell) downLineOrSearch() {
+	rl.History.SkipSave()
+
+	switch {
+	case rl.cursor.LinePos() < rl.line.Lines():
+		rl.cursor.LineMove(1)
+	default:
+		rl.bellOnNoMatch(func() {
+			rl.History.SearchPrefix(!rl.isPrefixSearching(), true)
+		})
 	}
 }
 
@@ -650,24 +787,16 @@ func (rl *Shell) acceptLineWith(infer, hold bool) {
 	// Use the correct buffer for the rest of the function.
 	rl.line, rl.cursor, rl.selection = rl.completer.GetBuffer()
 
-	// Without multiline support, we always return the line.
-	if rl.AcceptMultiline == nil {
-		rl.Macros.StopRecord(rl.Keys.Caller()...)
-
-		rl.Display.AcceptLine()
-		rl.History.Accept(hold, infer, nil)
-
+	// Keep editing the line if history events cannot be expanded.
+	if !rl.expandHistory() {
 		return
 	}
 
-	// Ask the caller if the line should be accepted
-	// as is, save the command line and accept it.
-	if rl.AcceptMultiline(*rl.line) {
-		rl.Macros.StopRecord(rl.Keys.Caller()...)
-
-		rl.Display.AcceptLine()
-		rl.History.Accept(hold, infer, nil)
-
+	// Without multiline support, we always return the line. Otherwise,
+	// ask the caller if the line should be accepted as is, save the
+	// command line and accept it.
+	if rl.AcceptMultiline == nil || rl.AcceptMultiline(*rl.line) {
+		rl.acceptTransformed(infer, hold)
 		return
 	}
 
@@ -675,8 +804,67 @@ func (rl *Shell) acceptLineWith(infer, hold bool) {
 	// and insert a newline where our cursor value is.
 	// This has the nice advantage of being able to work
 	// in multiline mode even in the middle of the buffer.
-	rl.line.Insert(rl.cursor.Pos(), '\n')
-	rl.cursor.Inc()
+	rl.breakLine()
+}
+
+// acceptTransformed accepts the line, once joined if the JoinLines option is set,
+// and transformed by OnAccept, if any: the line is still displayed as it was, but
+// the transformed one is returned and saved in history (unless RecordOriginal).
+// If the line is held (accept-and-hold), the line as typed is edited again.
+// If OnAccept returns an error, it is shown in the hint and the line is kept.
+func (rl *Shell) acceptTransformed(infer, hold bool) {
+	typed := []rune(string(*rl.line))
+
+	line := string(*rl.line)
+	if rl.JoinLines {
+		line = strings.ReplaceAll(line, "\n", " ")
+	}
+
+	accepted := line
+
+	if rl.OnAccept != nil {
+		var err error
+
+		if accepted, err = rl.OnAccept(line); err != nil {
+			rl.Hint.Set(rl.Hint.Format(err.Error(), ui.HintError))
+			return
+		}
+	}
+
+	rl.Macros.StopRecord(rl.Keys.Caller()...)
+	rl.Display.AcceptLine()
+
+	if !rl.RecordOriginal {
+		line = accepted
+	}
+
+	rl.line.Set([]rune(line)...)
+	rl.History.Accept(hold, infer, nil)
+	rl.History.AcceptAs([]rune(accepted))
+	rl.History.HoldAs(typed)
+}
+
+// expandHistory performs history expansion on the line when History.Expand or the
+// history-expansion option is enabled, and returns false if some history events
+// could not be expanded.
+func (rl *Shell) expandHistory() bool {
+	if !rl.History.Expand && !rl.Config.GetBool("history-expansion") {
+		return true
+	}
+
+	expanded, err := rl.History.ExpandLine(string(*rl.line))
+	if err != nil {
+		rl.Hint.Set(rl.Hint.Format(err.Error(), ui.HintError))
+		return false
+	}
+
+	if expanded != string(*rl.line) {
+		rl.History.Save()
+		rl.line.Set([]rune(expanded)...)
+		rl.cursor.Set(rl.line.Len())
+	}
+
+	return true
 }
 
 func (rl *Shell) insertAutosuggestPartial(emacs bool) {
@@ -685,7 +873,7 @@ func (rl *Shell) insertAutosuggestPartial(emacs bool) {
 		return
 	}
 
-	if !rl.Config.GetBool("history-autosuggest") {
+	if !rl.Display.Autosuggesting() {
 		return
 	}
 
@@ -707,3 +895,26 @@ func (rl *Shell) insertAutosuggestPartial(emacs bool) {
 		rl.line.Insert(cpos+1, suggested[cpos+1:cpos+forward+1]...)
 	}
 }
+
+// isPrefixSearching returns true if the last command was a prefix search,
+// in which case the search prefix used by the latter must be kept.
+func (rl *Shell) isPrefixSearching() bool {
+	switch rl.History.Last().Action {
+	case "up-line-or-search", "down-line-or-search":
+		return true
+	default:
+		return false
+	}
+}
+
+// bellOnNoMatch runs a history search command, and
+// rings the bell if it did not change the input line.
+func (rl *Shell) bellOnNoMatch(search func()) {
+	line := string(*rl.line)
+
+	search()
+
+	if string(*rl.line) == line {
+		rl.bell()
+	}
+}
@@ -0,0 +1,103 @@
+package readline
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestShell_magicSpace(t *testing.T) {
+	tests := []struct {
+		name     string
+		keys     []string
+		want     string
+		wantHint string
+	}{
+		{name: "Last line", keys: []string{"sudo !!", " ", "\r"}, want: "sudo git status ", wantHint: "sudo !! → sudo git status"},
+		{name: "Literal bang", keys: []string{`echo "hi!"`, " ", "\r"}, want: `echo "hi!" `},
+		{name: "Event not found", keys: []string{"!make", " ", "\r"}, want: "!make ", wantHint: "!make: event not found"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rl := NewShell()
+
+			source := NewInMemoryHistory()
+			source.Write("git status")
+			rl.History.Add("test", source)
+
+			if err := rl.BindKey("emacs", " ", "magic-space"); err != nil {
+				t.Fatalf("BindKey() error = %v", err)
+			}
+
+			got, err := readTestLine(t, rl, test.keys...)
+			if err != nil {
+				t.Errorf("Readline() error = %v", err)
+			}
+
+			if got != test.want {
+				t.Errorf("Readline() = %q, want %q", got, test.want)
+			}
+
+			output := rl.OutputWriter.(*testTerminal).output.String()
+
+			if test.wantHint != "" && !strings.Contains(output, test.wantHint) {
+				t.Errorf("Readline() output does not show the hint %q: %q", test.wantHint, output)
+			}
+		})
+	}
+}
+
+func TestShell_searchSessionHistory(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []string
+		want string
+	}{
+		{name: "Persistent history walked", keys: []string{"\x1b[A", "\r"}, want: "git status"},
+		{name: "Session left", keys: []string{"\x18s", "\x07", "\x1b[A", "\r"}, want: "git status"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rl := NewShell()
+
+			source := NewInMemoryHistory()
+			source.Write("git status")
+			rl.History.Add("persistent", source)
+			rl.History.AddSession("session")
+
+			if err := rl.BindKey("emacs", `\C-xs`, "search-session-history"); err != nil {
+				t.Fatalf("BindKey() error = %v", err)
+			}
+
+			got, err := readTestLine(t, rl, test.keys...)
+			if err != nil {
+				t.Errorf("Readline() error = %v", err)
+			}
+
+			if got != test.want {
+				t.Errorf("Readline() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestShell_acceptAndHold_transformed(t *testing.T) {
+	rl := NewShell()
+	rl.OnAccept = func(line string) (string, error) {
+		return line + " --color", nil
+	}
+
+	if err := rl.BindKey("emacs", `\C-xh`, "accept-and-hold"); err != nil {
+		t.Fatalf("BindKey() error = %v", err)
+	}
+
+	if got, err := readTestLine(t, rl, "ls", "\x18h"); err != nil || got != "ls --color" {
+		t.Fatalf("Readline() = %q, %v, want %q", got, err, "ls --color")
+	}
+
+	// The line held is the one typed, not the one transformed.
+	if got, err := readTestLine(t, rl, "\r"); err != nil || got != "ls --color" {
+		t.Errorf("Readline() = %q, %v, want %q", got, err, "ls --color")
+	}
+}
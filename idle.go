@@ -0,0 +1,40 @@
+package readline
+
+import "time"
+
+// armIdle (re)starts the idle timer, if OnIdle is set with a positive IdleTimeout:
+// once the timeout is elapsed without any key being read, OnIdle is queued to the
+// main loop, and is thus run on the input goroutine. It is called once before
+// reading input, and again after each key: the callback only runs once per idle
+// period. Callbacks of timers stopped or re-armed meanwhile are no-ops.
+func (rl *Shell) armIdle() {
+	rl.stopIdle()
+
+	if rl.OnIdle == nil || rl.IdleTimeout <= 0 {
+		return
+	}
+
+	var timer *time.Timer
+
+	timer = time.AfterFunc(rl.IdleTimeout, func() {
+		rl.Keys.Queue(func() {
+			if rl.idle == timer {
+				rl.idle = nil
+				rl.OnIdle()
+			}
+		})
+	})
+
+	rl.idle = timer
+}
+
+// stopIdle stops the idle timer, if any. It is also called when
+// returning from Readline(), so that OnIdle is never run afterwards.
+func (rl *Shell) stopIdle() {
+	if rl.idle == nil {
+		return
+	}
+
+	rl.idle.Stop()
+	rl.idle = nil
+}
@@ -0,0 +1,87 @@
+package readline
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Characters opening and closing an indentation level.
+const (
+	indentOpeners = "{(["
+	indentClosers = "})]"
+)
+
+// breakLine inserts a newline at the cursor position. With AutoIndent,
+// the new line starts with the indentation of the current one, with an
+// additional IndentUnit if the current line ends (before the cursor) with
+// an opening bracket. If the cursor was then right before a closing one,
+// the latter is moved to its own line, at the indentation of the opener.
+func (rl *Shell) breakLine() {
+	rl.cursor.InsertAt('\n')
+
+	if !rl.AutoIndent {
+		return
+	}
+
+	bpos := rl.lineStart(rl.cursor.Pos() - 1)
+	current := (*rl.line)[bpos : rl.cursor.Pos()-1]
+
+	indent := leadingSpace(current)
+	opened := false
+
+	trimmed := strings.TrimRightFunc(string(current), unicode.IsSpace)
+	if rl.IndentUnit != "" && trimmed != "" && strings.ContainsRune(indentOpeners, rune(trimmed[len(trimmed)-1])) {
+		opened = true
+	}
+
+	if opened {
+		rl.cursor.InsertAt(append(append([]rune{}, indent...), []rune(rl.IndentUnit)...)...)
+	} else {
+		rl.cursor.InsertAt(indent...)
+	}
+
+	// Move the closing bracket of the block just opened on its own line.
+	if opened && rl.cursor.Pos() < rl.line.Len() && strings.ContainsRune(indentClosers, rl.cursor.Char()) {
+		rl.line.Insert(rl.cursor.Pos(), append([]rune{'\n'}, indent...)...)
+	}
+}
+
+// unindent removes an IndentUnit before the cursor, if the latter is only
+// preceded by indentation on its line, and returns true if it did so.
+func (rl *Shell) unindent() bool {
+	unit := []rune(rl.IndentUnit)
+	if len(unit) == 0 {
+		return false
+	}
+
+	bpos := rl.lineStart(rl.cursor.Pos())
+	before := (*rl.line)[bpos:rl.cursor.Pos()]
+
+	if len(leadingSpace(before)) != len(before) || !strings.HasSuffix(string(before), rl.IndentUnit) {
+		return false
+	}
+
+	rl.cursor.Move(-len(unit))
+	rl.line.Cut(rl.cursor.Pos(), rl.cursor.Pos()+len(unit))
+
+	return true
+}
+
+// lineStart returns the position of the beginning of the line containing pos.
+func (rl *Shell) lineStart(pos int) int {
+	for pos > 0 && (*rl.line)[pos-1] != '\n' {
+		pos--
+	}
+
+	return pos
+}
+
+// leadingSpace returns the whitespace at the beginning of a line.
+func leadingSpace(line []rune) []rune {
+	end := 0
+	for end < len(line) && (line[end] == ' ' || line[end] == '\t') {
+		end++
+	}
+
+	return line[:end]
+}
@@ -0,0 +1,100 @@
+package readline
+
+import (
+	"github.com/reeflective/readline/internal/keymap"
+	"github.com/reeflective/readline/internal/ui"
+)
+
+// ModeIndicatorPlacement is where the keymap mode indicator is displayed.
+type ModeIndicatorPlacement int
+
+const (
+	// ModeIndicatorRight shows the indicator at the end of the right prompt (default).
+	ModeIndicatorRight ModeIndicatorPlacement = iota
+	// ModeIndicatorBelow shows the indicator in the hint below the input line,
+	// unless another hint (completion usage, search, errors) is being shown.
+	ModeIndicatorBelow
+)
+
+// DefaultModeIndicator can be used as a Shell.ModeIndicator function: it returns
+// Vim-like mode indicators (eg. `-- INSERT --`), and nothing in Emacs mode.
+func DefaultModeIndicator(mode string) string {
+	switch mode {
+	case keymap.ViInsert:
+		return "-- INSERT --"
+	case keymap.ViCommand:
+		return "-- NORMAL --"
+	case keymap.Visual:
+		return "-- VISUAL --"
+	case keymap.ViOpp:
+		return "-- PENDING --"
+	case keymap.Isearch:
+		return "-- SEARCH --"
+	case keymap.MenuSelect:
+		return "-- MENU --"
+	default:
+		return ""
+	}
+}
+
+// modeIndicator returns the Shell.ModeIndicator string for the current
+// keymap mode: the local one if any is active, the main one otherwise.
+func (rl *Shell) modeIndicator() string {
+	if rl.ModeIndicator == nil {
+		return ""
+	}
+
+	mode := rl.Keymap.Local()
+
+	switch {
+	case mode != "":
+	case rl.Keymap.IsEmacs():
+		mode = keymap.Emacs
+	case rl.Keymap.Main() == keymap.ViCommand, rl.Keymap.Main() == keymap.ViMove:
+		mode = keymap.ViCommand
+	default:
+		mode = rl.Keymap.Main()
+	}
+
+	return rl.ModeIndicator(string(mode))
+}
+
+// rightModeIndicator returns the mode indicator printed with the right prompt.
+func (rl *Shell) rightModeIndicator() string {
+	if rl.ModeIndicatorPlacement != ModeIndicatorRight {
+		return ""
+	}
+
+	indicator := rl.modeIndicator()
+	if indicator == "" {
+		return ""
+	}
+
+	return rl.Hint.Format(indicator, ui.HintInfo)
+}
+
+// hintModeIndicator shows the mode indicator in the hint, if it must be
+// displayed there. Like expansion previews, it only replaces itself or an
+// empty hint, so that it never overwrites more important messages.
+func (rl *Shell) hintModeIndicator() {
+	if rl.ModeIndicatorPlacement != ModeIndicatorBelow {
+		return
+	}
+
+	hint := ""
+	if indicator := rl.modeIndicator(); indicator != "" {
+		hint = rl.Hint.Format(indicator, ui.HintInfo)
+	}
+
+	if rl.Hint.Len() > 0 && rl.Hint.Text() != rl.indicator {
+		return
+	}
+
+	if hint == "" && rl.indicator != "" {
+		rl.Hint.Reset()
+	} else if hint != "" {
+		rl.Hint.Set(hint)
+	}
+
+	rl.indicator = hint
+}
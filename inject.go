@@ -0,0 +1,113 @@
+package readline
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/reeflective/readline/internal/completion"
+)
+
+// ErrNotReading is returned when trying to act on the input line
+// from another goroutine while no Readline() call is running.
+var ErrNotReading = errors.New("readline is not reading input")
+
+// ErrNoCompleter is returned when requesting completions while
+// the shell has neither a Completer nor a StreamCompleter.
+var ErrNoCompleter = errors.New("no completer function")
+
+// Inject inserts text at the cursor position in the line currently being read,
+// as if it had been typed by the user: abbreviations are expanded and auto-pairs
+// are inserted if enabled, and the whole insertion can be undone at once.
+// Newlines and carriage returns are inserted as newlines, like when pasted.
+// It is safe to call from any goroutine: the insertion is queued to the input
+// loop and applied between two commands, after which the display is refreshed.
+// An ErrNotReading error is returned if no Readline() call is running.
+func (rl *Shell) Inject(text string) error {
+	if !rl.reading.Load() {
+		return ErrNotReading
+	}
+
+	rl.Keys.Queue(func() { rl.inject(text) })
+
+	return nil
+}
+
+// inject inserts text in the line as typed input, in a single undo unit.
+func (rl *Shell) inject(text string) {
+	completion.UpdateInserted(rl.completer)
+	rl.line, rl.cursor, rl.selection = rl.completer.GetBuffer()
+
+	rl.History.Save()
+
+	text = strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(text)
+
+	for _, char := range text {
+		rl.History.SkipSave()
+
+		if char == ' ' && rl.expandAbbreviation() {
+			continue
+		}
+
+		if len(rl.fitLine([]rune{char}, true)) == 0 {
+			break
+		}
+
+		// Newlines are inserted as is, like when pasted,
+		// instead of being quoted like other control keys.
+		if char == '\n' {
+			rl.cursor.InsertAt(char)
+			continue
+		}
+
+		rl.insertChar(char)
+	}
+
+	rl.History.Reset()
+	rl.History.Save()
+}
+
+// Complete opens the completion menu for the line currently being read, exactly
+// as if the user had pressed Tab (menu-complete): completions are generated by
+// the shell completer for the current line and cursor, and the first candidate
+// is selected unless CompletionListOnFirstTab (or list-on-first-tab) is set.
+// If the menu is already open, the next candidate is selected.
+// It is safe to call from any goroutine: the completion is queued to the input
+// loop. An ErrNotReading error is returned if no Readline() call is running,
+// and an ErrNoCompleter one if the shell has no completer.
+func (rl *Shell) Complete() error {
+	return rl.CompleteAndSelect(0)
+}
+
+// CompleteAndSelect is like Complete, except that once the completions are
+// generated, the nth candidate (starting at 1) of the menu is selected, even
+// if another one was already selected. A zero n behaves like Complete.
+func (rl *Shell) CompleteAndSelect(n int) error {
+	switch {
+	case rl.Completer == nil && rl.StreamCompleter == nil:
+		return ErrNoCompleter
+	case !rl.reading.Load():
+		return ErrNotReading
+	}
+
+	rl.Keys.Queue(func() { rl.complete(n) })
+
+	return nil
+}
+
+// complete opens the completion menu and selects the nth candidate.
+func (rl *Shell) complete(n int) {
+	rl.line, rl.cursor, rl.selection = rl.completer.GetBuffer()
+
+	if n <= 0 {
+		rl.menuComplete()
+		return
+	}
+
+	if !rl.completer.IsActive() {
+		rl.startMenuComplete(rl.commandCompletion)
+	}
+
+	if rl.completer.SelectIndex(n) {
+		rl.bell()
+	}
+}
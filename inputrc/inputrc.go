@@ -115,6 +115,11 @@ func escape(s string, m map[rune]string) string {
 		case '\\', '"', '\'':
 			v = append(v, `\`+string(c))
 		default:
+			if (IsMeta(c) && !isPlain(Demeta(c))) || (IsControl(c) && !isPlain(Decontrol(c))) {
+				// \C- and \M- only read back a plain character: use octal.
+				v = append(v, fmt.Sprintf(`\%03o`, c))
+				continue
+			}
 			var s string
 			if IsControl(c) {
 				s += `\C-`
@@ -127,7 +132,7 @@ func escape(s string, m map[rune]string) string {
 			if unicode.IsPrint(c) {
 				s += string(c)
 			} else {
-				s += fmt.Sprintf(`\x%2x`, c)
+				s += fmt.Sprintf(`\x%02x`, c)
 			}
 			v = append(v, s)
 		}
@@ -135,6 +140,11 @@ func escape(s string, m map[rune]string) string {
 	return strings.Join(v, "")
 }
 
+// isPlain returns true when c is printable and needs no escaping.
+func isPlain(c rune) bool {
+	return unicode.IsPrint(c) && c != '\\' && c != '"' && c != '\''
+}
+
 // Encontrol encodes a Control-c code.
 func Encontrol(c rune) rune {
 	return unicode.ToUpper(c) & Control
@@ -5,6 +5,8 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+
+	"github.com/rivo/uniseg"
 )
 
 // Base text effects.
@@ -110,6 +112,45 @@ func Trim(input string, maxPrintableLength int) string {
 	return input[:maxPrintableLength]
 }
 
+// TrimWidth returns the beginning of the input fitting in the given number of
+// terminal columns, including all escape codes found in it. Unlike Trim, this
+// accounts for wide characters, and never splits a character (grapheme) in two.
+func TrimWidth(input string, width int) string {
+	var trimmed strings.Builder
+
+	escapes := re.FindAllStringIndex(input, -1)
+	pos := 0
+
+	for pos < len(input) {
+		// Escape sequences don't use any column.
+		if len(escapes) > 0 && escapes[0][0] == pos {
+			trimmed.WriteString(input[pos:escapes[0][1]])
+			pos = escapes[0][1]
+			escapes = escapes[1:]
+
+			continue
+		}
+
+		// Else, the next character, without any
+		// escape sequence that might follow it.
+		end := len(input)
+		if len(escapes) > 0 {
+			end = escapes[0][0]
+		}
+
+		grapheme, _, charWidth, _ := uniseg.FirstGraphemeClusterInString(input[pos:end], -1)
+		if charWidth > width {
+			break
+		}
+
+		trimmed.WriteString(grapheme)
+		width -= charWidth
+		pos += len(grapheme)
+	}
+
+	return trimmed.String()
+}
+
 // UnquoteRC removes the `\e` escape used in readline .inputrc
 // configuration values and replaces it with the printable escape.
 func UnquoteRC(color string) string {
@@ -199,3 +240,32 @@ var re = regexp.MustCompile(ansi)
 func Strip(str string) string {
 	return re.ReplaceAllString(str, "")
 }
+
+var sgr = regexp.MustCompile(`\x1b\[([0-9;]*)m`)
+
+// StripSGR removes the SGR sequences (colors and other text effects) from
+// a string, leaving any other escape sequence in it untouched, unlike Strip.
+func StripSGR(str string) string {
+	return sgr.ReplaceAllString(str, "")
+}
+
+// Dimmed returns the string with a reduced intensity (dim), which is applied
+// again after all sequences resetting it in the string, so that its colors and
+// other effects are attenuated, not replaced. The intensity is reset at its end.
+func Dimmed(str string) string {
+	if Dim == "" {
+		return str
+	}
+
+	dimmed := sgr.ReplaceAllStringFunc(str, func(seq string) string {
+		for _, param := range strings.Split(sgr.FindStringSubmatch(seq)[1], ";") {
+			if param == "" || param == "0" || param == "1" || param == "22" {
+				return seq + Dim
+			}
+		}
+
+		return seq
+	})
+
+	return Dim + dimmed + Reset
+}
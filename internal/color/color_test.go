@@ -0,0 +1,56 @@
+package color
+
+import "testing"
+
+func TestDimmed(t *testing.T) {
+	tests := []struct {
+		name string
+		str  string
+		want string
+	}{
+		{
+			name: "Plain text",
+			str:  "git status",
+			want: Dim + "git status" + Reset,
+		},
+		{
+			name: "Syntax colors",
+			str:  "\x1b[32mgit\x1b[0m status",
+			want: Dim + "\x1b[32mgit\x1b[0m" + Dim + " status" + Reset,
+		},
+		{
+			name: "Short reset",
+			str:  "\x1b[1;31mgit\x1b[m status",
+			want: Dim + "\x1b[1;31m" + Dim + "git\x1b[m" + Dim + " status" + Reset,
+		},
+		{
+			name: "Bold and intensity resets",
+			str:  "\x1b[1mgit\x1b[22m status",
+			want: Dim + "\x1b[1m" + Dim + "git\x1b[22m" + Dim + " status" + Reset,
+		},
+		{
+			name: "Other effects kept",
+			str:  "\x1b[4mgit\x1b[24m \x1b[49mstatus",
+			want: Dim + "\x1b[4mgit\x1b[24m \x1b[49mstatus" + Reset,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Dimmed(test.str); got != test.want {
+				t.Errorf("Dimmed(%q) = %q, want %q", test.str, got, test.want)
+			}
+		})
+	}
+}
+
+func TestDimmed_noEffects(t *testing.T) {
+	dim := Dim
+	defer func() { Dim = dim }()
+
+	Dim = ""
+
+	if got := Dimmed("\x1b[32mgit\x1b[0m"); got != "\x1b[32mgit\x1b[0m" {
+		t.Errorf("Dimmed() = %q without effects, want the string unchanged", got)
+	}
+}
@@ -0,0 +1,177 @@
+package completion
+
+import (
+	"container/list"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// cache is a least-recently-used cache of generated completions, keyed by
+// the word they were generated for and the line before it (see cacheKey).
+type cache struct {
+	entries map[string]*list.Element
+	order   *list.List
+	mutex   sync.Mutex
+}
+
+// generated are the last completions generated by the shell completer, which
+// can be filtered again as the user types the word they complete, instead of
+// being generated again (see RefinedValues).
+type generated struct {
+	line   []rune
+	cursor int
+	values Values
+}
+
+type cacheEntry struct {
+	key     string
+	values  Values
+	created time.Time
+}
+
+// CachedValues returns a copy of the completions cached for the word under the
+// cursor and the line before it, if the completion cache is enabled and they are
+// not expired yet. The rest of the line after the word is not considered.
+func (e *Engine) CachedValues(line []rune, cursor int) (values Values, found bool) {
+	if e.config.GetInt("completion-cache-size") <= 0 {
+		return
+	}
+
+	e.cache.mutex.Lock()
+	defer e.cache.mutex.Unlock()
+
+	elem, found := e.cache.entries[cacheKey(line, cursor)]
+	if !found {
+		return
+	}
+
+	entry := elem.Value.(*cacheEntry)
+
+	ttl := time.Duration(e.config.GetInt("completion-cache-ttl")) * time.Second
+	if ttl > 0 && time.Since(entry.created) > ttl {
+		e.cache.order.Remove(elem)
+		delete(e.cache.entries, entry.key)
+
+		return values, false
+	}
+
+	e.cache.order.MoveToFront(elem)
+
+	return entry.values.clone(), true
+}
+
+// CacheValues caches a copy of the completions generated for the word under the
+// cursor, evicting the least recently used ones if the cache is full.
+func (e *Engine) CacheValues(line []rune, cursor int, values Values) {
+	size := e.config.GetInt("completion-cache-size")
+	if size <= 0 {
+		return
+	}
+
+	e.cache.mutex.Lock()
+	defer e.cache.mutex.Unlock()
+
+	if e.cache.entries == nil {
+		e.cache.entries = make(map[string]*list.Element)
+		e.cache.order = list.New()
+	}
+
+	key := cacheKey(line, cursor)
+
+	if elem, found := e.cache.entries[key]; found {
+		e.cache.order.Remove(elem)
+	}
+
+	entry := &cacheEntry{key: key, values: values.clone(), created: time.Now()}
+	e.cache.entries[key] = e.cache.order.PushFront(entry)
+
+	for e.cache.order.Len() > size {
+		oldest := e.cache.order.Back()
+		e.cache.order.Remove(oldest)
+		delete(e.cache.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// KeepValues keeps the completions generated for the given line and cursor
+// position, so that they can be filtered again by the next completion requests
+// instead of being generated again, as long as they complete the same word.
+// Completions setting their own prefix or suffix, or inserted at the cursor,
+// are not kept, since they might depend on the word completed.
+func (e *Engine) KeepValues(line []rune, cursor int, values Values) {
+	e.generated = nil
+
+	if !e.config.GetBool("completion-refilter") {
+		return
+	}
+
+	if values.PREFIX != "" || values.SUFFIX != "" || values.AtCursor {
+		return
+	}
+
+	e.generated = &generated{line: []rune(string(line)), cursor: cursor, values: values}
+}
+
+// RefinedValues returns the completions kept with KeepValues if they can just be
+// filtered again for the given line and cursor position: the line must be the same
+// except for characters typed at the end of the completed word, which must be word
+// characters (letters, digits, '-' and '_'), since other characters (like a slash or
+// a word separator) might change what is completed. When the line is the same, like
+// when updating an incremental search, they are also returned.
+func (e *Engine) RefinedValues(line []rune, cursor int) (values Values, found bool) {
+	last := e.generated
+	if last == nil || cursor < last.cursor || cursor > len(line) {
+		return
+	}
+
+	typed := cursor - last.cursor
+
+	if len(line) != len(last.line)+typed ||
+		string(line[:last.cursor]) != string(last.line[:last.cursor]) ||
+		string(line[cursor:]) != string(last.line[last.cursor:]) {
+		return
+	}
+
+	for _, char := range line[last.cursor:cursor] {
+		if !isRefiningChar(char) || strings.ContainsRune(last.values.Separators, char) {
+			return
+		}
+	}
+
+	return last.values, true
+}
+
+// isRefiningChar returns true if typing the character can
+// only refine the word being completed, not change it.
+func isRefiningChar(char rune) bool {
+	return unicode.IsLetter(char) || unicode.IsDigit(char) || char == '-' || char == '_'
+}
+
+// InvalidateCache drops all cached completions.
+// It is safe to call this function concurrently.
+func (e *Engine) InvalidateCache() {
+	e.cache.mutex.Lock()
+	defer e.cache.mutex.Unlock()
+
+	e.cache.entries = nil
+	e.cache.order = nil
+	e.generated = nil
+}
+
+// cacheKey returns the key of completions generated for the given line and
+// cursor: the line up to the end of the word under the cursor, and the cursor
+// position in it, so that arguments after the word do not matter.
+func cacheKey(line []rune, cursor int) string {
+	if cursor > len(line) {
+		cursor = len(line)
+	}
+
+	end := cursor
+	for end < len(line) && !unicode.IsSpace(line[end]) {
+		end++
+	}
+
+	return strconv.Itoa(cursor) + ":" + string(line[:end])
+}
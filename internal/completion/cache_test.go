@@ -0,0 +1,154 @@
+package completion
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEngine_RefinedValues(t *testing.T) {
+	values := AddRaw(RawValues{{Value: "commit"}, {Value: "config"}, {Value: "clone"}})
+
+	tests := []struct {
+		name     string
+		keptLine string
+		kept     Values
+		line     string
+		cursor   int
+		disabled bool
+		want     bool
+	}{
+		{name: "Same line", keptLine: "git co", kept: values, line: "git co", cursor: 6, want: true},
+		{name: "Word typed further", keptLine: "git co", kept: values, line: "git comm", cursor: 8, want: true},
+		{name: "Word typed before other words", keptLine: "git co --amend", kept: values, line: "git com --amend", cursor: 7, want: true},
+		{name: "Word deleted", keptLine: "git co", kept: values, line: "git c", cursor: 5},
+		{name: "Slash typed", keptLine: "git co", kept: values, line: "git co/", cursor: 7},
+		{name: "Space typed", keptLine: "git co", kept: values, line: "git co ", cursor: 7},
+		{name: "Line modified before the word", keptLine: "git co", kept: values, line: "gti co", cursor: 6},
+		{name: "Completions with their own prefix", keptLine: "git co", kept: Values{PREFIX: "co"}, line: "git co", cursor: 6},
+		{name: "Refilter disabled", keptLine: "git co", kept: values, line: "git comm", cursor: 8, disabled: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eng := newTestEngine(tt.keptLine)
+			eng.config.Set("completion-refilter", !tt.disabled)
+			eng.KeepValues([]rune(tt.keptLine), 6, tt.kept)
+
+			if _, found := eng.RefinedValues([]rune(tt.line), tt.cursor); found != tt.want {
+				t.Errorf("RefinedValues() found = %v, want %v", found, tt.want)
+			}
+		})
+	}
+}
+
+func TestEngine_CachedValues(t *testing.T) {
+	tests := []struct {
+		name         string
+		size         int
+		cachedLine   string
+		cachedCursor int
+		line         string
+		cursor       int
+		want         bool
+	}{
+		{name: "Same line", size: 10, cachedLine: "git co", cachedCursor: 6, line: "git co", cursor: 6, want: true},
+		{name: "Later argument edited", size: 10, cachedLine: "git co --amend", cachedCursor: 6, line: "git co --fixup", cursor: 6, want: true},
+		{name: "Later argument added", size: 10, cachedLine: "git co", cachedCursor: 6, line: "git co main", cursor: 6, want: true},
+		{name: "Word typed further", size: 10, cachedLine: "git co", cachedCursor: 6, line: "git com", cursor: 7},
+		{name: "Word end edited", size: 10, cachedLine: "git comm", cachedCursor: 6, line: "git coll", cursor: 6},
+		{name: "Context edited", size: 10, cachedLine: "git co", cachedCursor: 6, line: "got co", cursor: 6},
+		{name: "Cursor moved in the word", size: 10, cachedLine: "git co", cachedCursor: 6, line: "git co", cursor: 5},
+		{name: "Cache disabled", cachedLine: "git co", cachedCursor: 6, line: "git co", cursor: 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eng := newTestEngine(tt.cachedLine)
+			eng.config.Set("completion-cache-size", tt.size)
+
+			eng.CacheValues([]rune(tt.cachedLine), tt.cachedCursor, AddRaw(RawValues{{Value: "commit"}}))
+
+			if _, found := eng.CachedValues([]rune(tt.line), tt.cursor); found != tt.want {
+				t.Errorf("CachedValues() found = %v, want %v", found, tt.want)
+			}
+		})
+	}
+}
+
+func TestEngine_CacheValues_eviction(t *testing.T) {
+	eng := newTestEngine("")
+	eng.config.Set("completion-cache-size", 2)
+
+	values := AddRaw(RawValues{{Value: "commit"}})
+
+	eng.CacheValues([]rune("git a"), 5, values)
+	eng.CacheValues([]rune("git b"), 5, values)
+
+	// The first line is now the most recently used one.
+	if _, found := eng.CachedValues([]rune("git a"), 5); !found {
+		t.Fatalf("CachedValues(git a) not found before eviction")
+	}
+
+	eng.CacheValues([]rune("git c"), 5, values)
+
+	for line, want := range map[string]bool{"git a": true, "git b": false, "git c": true} {
+		if _, found := eng.CachedValues([]rune(line), 5); found != want {
+			t.Errorf("CachedValues(%s) found = %v, want %v", line, found, want)
+		}
+	}
+}
+
+func TestEngine_CachedValues_expiry(t *testing.T) {
+	tests := []struct {
+		name string
+		ttl  int
+		age  time.Duration
+		want bool
+	}{
+		{name: "Not expired", ttl: 60, age: 30 * time.Second, want: true},
+		{name: "Expired", ttl: 60, age: 90 * time.Second},
+		{name: "No expiry", age: time.Hour, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eng := newTestEngine("git co")
+			eng.config.Set("completion-cache-size", 10)
+			eng.config.Set("completion-cache-ttl", tt.ttl)
+
+			eng.CacheValues([]rune("git co"), 6, AddRaw(RawValues{{Value: "commit"}}))
+
+			entry := eng.cache.order.Front().Value.(*cacheEntry)
+			entry.created = entry.created.Add(-tt.age)
+
+			if _, found := eng.CachedValues([]rune("git co"), 6); found != tt.want {
+				t.Errorf("CachedValues() found = %v, want %v", found, tt.want)
+			}
+
+			if cached := eng.cache.order.Len() == 1; cached != tt.want {
+				t.Errorf("Entry still cached = %v, want %v", cached, tt.want)
+			}
+		})
+	}
+}
+
+func TestEngine_CachedValues_copy(t *testing.T) {
+	eng := newTestEngine("git co")
+	eng.config.Set("completion-cache-size", 10)
+
+	values := AddRaw(RawValues{{Value: "commit"}})
+	values.NoSort["*"] = true
+
+	eng.CacheValues([]rune("git co"), 6, values)
+
+	// Neither the values cached nor the ones returned are shared with the cache.
+	values.NoSort["*"] = false
+	values.values[0].Value = "changed"
+
+	cached, _ := eng.CachedValues([]rune("git co"), 6)
+	cached.Layouts["*"] = LayoutGrid
+	cached.values[0].Value = "changed"
+
+	cached, _ = eng.CachedValues([]rune("git co"), 6)
+
+	if !cached.NoSort["*"] || len(cached.Layouts) != 0 || cached.values[0].Value != "commit" {
+		t.Errorf("CachedValues() = %+v, shares its values with callers", cached)
+	}
+}
@@ -0,0 +1,94 @@
+package completion
+
+// CollapseTag hides the candidates of the current group (collapse=true),
+// only showing its header with a count of hidden candidates, or shows them
+// again (collapse=false). Candidates of collapsed groups are skipped by the
+// menu selection, but their headers can still be reached with SelectTag().
+// The state is kept until the completion list is cleared. Returns false if
+// the current group cannot be collapsed/expanded (no tag, or already done).
+func (e *Engine) CollapseTag(collapse bool) bool {
+	grp := e.currentGroup()
+	if grp == nil || grp.tag == "" || grp.collapsed == collapse {
+		return false
+	}
+
+	e.setCollapsed(grp, collapse)
+
+	// The selection now stays on the group header.
+	if len(e.selected.Value) > 0 {
+		e.cancelCompletedLine()
+		e.hintUnselect()
+	}
+
+	grp.posX, grp.posY = -1, -1
+
+	return true
+}
+
+// CollapseAll collapses (or expands) all groups having a tag.
+func (e *Engine) CollapseAll(collapse bool) {
+	if len(e.selected.Value) > 0 {
+		e.cancelCompletedLine()
+		e.hintUnselect()
+	}
+
+	for _, grp := range e.groups {
+		if grp.tag == "" || grp.collapsed == collapse {
+			continue
+		}
+
+		e.setCollapsed(grp, collapse)
+		grp.posX, grp.posY = -1, -1
+	}
+}
+
+// setCollapsed updates the collapsed state of a group, and
+// remembers it for when the groups are generated again.
+func (e *Engine) setCollapsed(grp *group, collapse bool) {
+	grp.collapsed = collapse
+
+	if e.collapsed == nil {
+		e.collapsed = make(map[string]bool)
+	}
+
+	if collapse {
+		e.collapsed[grp.tag] = true
+	} else {
+		delete(e.collapsed, grp.tag)
+	}
+}
+
+// cycleExpandedGroup selects the first candidate of the next non-collapsed
+// group (or the last candidate of the previous one if next is false).
+// If all groups are collapsed, the current one stays a collapsed one.
+func (e *Engine) cycleExpandedGroup(next bool) {
+	for range e.groups {
+		if next {
+			e.cycleNextGroup()
+		} else {
+			e.cyclePreviousGroup()
+		}
+
+		grp := e.currentGroup()
+		if grp.collapsed {
+			continue
+		}
+
+		if next {
+			grp.firstCell()
+		} else {
+			grp.lastCell()
+		}
+
+		return
+	}
+}
+
+// hiddenCount returns the number of candidates hidden in a collapsed group.
+func (g *group) hiddenCount() (count int) {
+	for _, row := range g.rows {
+		count += len(row)
+	}
+
+	return count
+}
@@ -1,10 +1,79 @@
 package completion
 
+import (
+	"fmt"
+	"runtime/debug"
+
+	"github.com/reeflective/readline/internal/color"
+)
+
 // Completer is a function generating completions.
 // This is generally used so that a given completer function
 // (history, registers, etc) can be cached and reused by the engine.
 type Completer func() Values
 
+// Combine returns a completer running all completers and merging their
+// completions (see Values.Merge), so that the groups of candidates of each
+// (according to their tags) are all displayed. A completer returning no
+// completions, or panicking, does not prevent the others from running:
+// the panic is recovered and notified as a completion message.
+func Combine(completers ...Completer) Completer {
+	return func() Values {
+		combined := AddRaw(nil)
+
+		for _, completer := range completers {
+			if completer == nil {
+				continue
+			}
+
+			combined.Merge(Recover(completer, nil)())
+		}
+
+		return combined
+	}
+}
+
+// PanicError is the error of a completer having panicked,
+// with the stack of the goroutine at the time of the panic.
+type PanicError struct {
+	Value any    // The value passed to panic().
+	Stack []byte // The formatted stack trace (see runtime/debug.Stack).
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("completer panicked: %v", e.Value)
+}
+
+// Recover returns a completer running completer and recovering from any panic
+// in it: the completions are then empty, with an error message notifying the
+// panic, and the corresponding PanicError is passed to onError if not nil.
+func Recover(completer Completer, onError func(err error)) Completer {
+	return func() (values Values) {
+		defer func() {
+			if err := recover(); err != nil {
+				values = recovered(err, onError)
+			}
+		}()
+
+		return completer()
+	}
+}
+
+// recovered returns the completions notifying a recovered panic,
+// after passing it to onError (if not nil) as a PanicError.
+func recovered(value any, onError func(err error)) Values {
+	err := &PanicError{Value: value, Stack: debug.Stack()}
+
+	if onError != nil {
+		onError(err)
+	}
+
+	values := AddRaw(nil)
+	values.Messages.Add(color.FgRed + err.Error())
+
+	return values
+}
+
 // Candidate represents a completion candidate.
 type Candidate struct {
 	Value       string // Value is the value of the completion as actually inserted in the line
@@ -12,14 +81,17 @@ type Candidate struct {
 	Description string // A description to display next to the completion candidate.
 	Style       string // An arbitrary string of color/text effects to use when displaying the completion.
 	Tag         string // All completions with the same tag are grouped together and displayed under the tag heading.
+	Annotation  string // Shown dimmed after the display in the menu (eg. the value itself), but never inserted.
+	Used        bool   // Already used (eg. a flag already on the line): dimmed and listed last, but still selectable.
 
 	// A list of runes that are automatically trimmed when a space or a non-nil character is
 	// inserted immediately after the completion. This is used for slash-autoremoval in path
 	// completions, comma-separated completions, etc.
 	noSpace SuffixMatcher
 
-	displayLen int // Real length of the displayed candidate, that is not counting escaped sequences.
-	descLen    int
+	displayLen  int    // Real length of the displayed candidate, that is not counting escaped sequences.
+	fullDisplay string // The complete display, when it is truncated in the menu.
+	descLen     int
 }
 
 // Values is used internally to hold all completion candidates and their associated data.
@@ -28,11 +100,15 @@ type Values struct {
 	Messages Messages
 	NoSpace  SuffixMatcher
 	Usage    string
-	ListLong map[string]bool
+	Layouts  map[string]Layout
+	Headers  map[string]Headers
 	NoSort   map[string]bool
 	ListSep  map[string]string
 	Pad      map[string]bool
 	Escapes  map[string]bool
+	Quote    QuoteStyle
+	Match    MatchMode
+	AddSpace bool
 
 	// Initially this will be set to the part of the current word
 	// from the beginning of the word up to the position of the cursor.
@@ -44,15 +120,47 @@ type Values struct {
 	// It may be altered so that inserted completions don't overwrite
 	// entirely any suffix when completing in the middle of a word.
 	SUFFIX string
+
+	// Separators is a list of characters separating words (in addition
+	// to spaces) when computing the PREFIX and SUFFIX of the current word,
+	// when those are not set. If empty, only spaces separate words.
+	Separators string
+
+	// AtCursor inserts candidates at the cursor position, without matching
+	// them against the current word nor replacing it (eg. register contents).
+	AtCursor bool
+
+	// HeaderStyles and TagStyles are the styles (like candidates ones) of the
+	// headers of groups, and of their candidates not having their own style,
+	// by tag ("*" for all tags). Unset ones use the default styles.
+	HeaderStyles map[string]string
+	TagStyles    map[string]string
+
+	// Context is the path of the command being completed (eg. `git remote add`),
+	// shown above all groups in the menu, so that users know where they are in
+	// a tree of subcommands. It does not change the insertion of candidates.
+	Context []string
+
+	// WrapDescriptions is whether descriptions too long for their row are
+	// wrapped on continuation lines in list layouts, by tag ("*" for all tags).
+	WrapDescriptions map[string]bool
+
+	// InsertUnique is whether the only candidate left is inserted right away,
+	// by tag ("*" for all tags). Unset ones use the default of the engine.
+	InsertUnique map[string]bool
+
+	// PostFilter, if not nil, is called with all the candidates matching
+	// the prefix (of all tags), and returns the candidates to use instead.
+	PostFilter func(values RawValues) RawValues
 }
 
 // AddRaw adds completion values in bulk.
 func AddRaw(values []Candidate) Values {
 	return Values{
-		values:   RawValues(values),
-		ListLong: make(map[string]bool),
-		NoSort:   make(map[string]bool),
-		ListSep:  make(map[string]string),
-		Pad:      make(map[string]bool),
+		values:  RawValues(values),
+		Layouts: make(map[string]Layout),
+		NoSort:  make(map[string]bool),
+		ListSep: make(map[string]string),
+		Pad:     make(map[string]bool),
 	}
 }
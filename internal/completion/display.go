@@ -1,12 +1,11 @@
 package completion
 
 import (
-	"bufio"
 	"fmt"
-	"regexp"
 	"strings"
 
 	"github.com/reeflective/readline/internal/color"
+	"github.com/reeflective/readline/internal/strutil"
 	"github.com/reeflective/readline/internal/term"
 )
 
@@ -14,31 +13,48 @@ import (
 // respecting the current display and completion settings.
 func Display(eng *Engine, maxRows int) {
 	eng.usedY = 0
+	eng.contextRows = 0
 
-	defer fmt.Print(term.ClearScreenBelow)
+	defer fmt.Fprint(eng.out, term.ClearScreenBelow)
 
 	// The completion engine might be inactive but still having
 	// a non-empty list of completions. This is on purpose, as
 	// sometimes it's better to keep completions printed for a
 	// little more time. The engine itself is responsible for
 	// deleting those lists when it deems them useless.
-	if eng.Matches() == 0 || eng.skipDisplay {
-		fmt.Print(term.ClearLineAfter)
+	if !eng.HasMenu() {
+		fmt.Fprint(eng.out, term.ClearLineAfter)
 		return
 	}
 
-	// The final completions string to print.
-	completions := term.ClearLineAfter
+	// Groups are laid out for the terminal width at the time
+	// they were generated: arrange them again if it changed.
+	width := eng.out.Width()
 
 	for _, group := range eng.groups {
-		completions += eng.renderCompletions(group)
+		if group.termWidth != width {
+			group.relayout(width)
+		}
 	}
 
-	// Crop the completions so that it fits within our terminal
-	completions, eng.usedY = eng.cropCompletions(completions, maxRows)
+	// The preview of the selected candidate is printed below the menu,
+	// which is cropped so that the whole fits within our terminal.
+	preview := eng.renderPreview(width, maxRows/2)
+	previewRows := strings.Count(preview, term.NewlineReturn)
+
+	// The context is printed above the menu, and is never cropped.
+	context := eng.renderContext()
+	eng.contextRows = strings.Count(context, term.NewlineReturn)
+
+	// Only render the completions rows fitting within our terminal.
+	var completions string
+	completions, eng.usedY = eng.renderMenu(maxRows - previewRows - eng.contextRows)
+
+	completions = context + term.ClearLineAfter + completions + preview
+	eng.usedY += previewRows + eng.contextRows
 
 	if completions != "" {
-		fmt.Print(completions)
+		fmt.Fprint(eng.out, completions)
 	}
 }
 
@@ -48,58 +64,216 @@ func Coordinates(e *Engine) int {
 	return e.usedY
 }
 
-// renderCompletions renders all completions in a given list (with aliases or not).
-// The descriptions list argument is optional.
-func (e *Engine) renderCompletions(grp *group) string {
+// renderContext renders the path of the command being completed, if any,
+// as a breadcrumb on its own line (eg. `git › remote › add`), styled so
+// that it is not mistaken for a group header.
+func (e *Engine) renderContext() string {
+	if len(e.context) == 0 {
+		return ""
+	}
+
+	separator := color.Reset + color.Dim + " › " + color.Reset + color.Underscore
+	context := color.Underscore + strings.Join(e.context, separator) + color.Reset
+
+	return term.ClearLineAfter + context + term.ClearLineAfter + term.NewlineReturn
+}
+
+// renderMenu renders the rows of the menu (group headers included) which fit
+// within maxRows and show the selected candidate, followed by a hint if more
+// rows remain below them. Since only those rows are rendered, the time taken
+// does not depend on the number of candidates, only on the size of the menu.
+func (e *Engine) renderMenu(maxRows int) (menu string, usedY int) {
+	first, last := e.menuWindow(maxRows)
+
 	var builder strings.Builder
 
+	offset := 0
+	for _, group := range e.groups {
+		offset += e.renderCompletions(&builder, group, offset, first, last)
+	}
+
+	menu = strings.TrimSuffix(builder.String(), term.NewlineReturn)
+	count := max(min(last, offset)-first, 0)
+	e.menuOffset, e.pageRows = first, count
+
+	// Add hint for remaining completions, if any.
+	_, used := e.completionCount()
+	remain := used - (first + count)
+
+	if remain <= 0 {
+		return menu, count - 1
+	}
+
+	menu += fmt.Sprintf(term.NewlineReturn+color.Dim+color.FgYellow+" %d more completion rows... (scroll down to show)"+color.Reset, remain)
+
+	return menu, count
+}
+
+// menuWindow returns the range of menu rows (absolute, group headers included)
+// to display within maxRows, so that the selected candidate is always visible:
+// the menu is shown from its top, until the selection goes below its last row,
+// in which case the menu is scrolled so that the selection is on this last row.
+func (e *Engine) menuWindow(maxRows int) (first, last int) {
+	absPos := e.getAbsPos()
+
+	if absPos < maxRows-1 {
+		return 0, maxRows - 1
+	}
+
+	return absPos - maxRows + 2, absPos + 1
+}
+
+// renderCompletions renders the rows of a group (with aliases or not), starting at
+// the offset row of the menu, which are within the [first, last) range of menu rows.
+// It returns the number of rows of the group, whether they are rendered or not.
+func (e *Engine) renderCompletions(builder *strings.Builder, grp *group, offset, first, last int) (rows int) {
 	if len(grp.rows) == 0 {
-		return ""
+		return 0
 	}
 
-	if grp.tag != "" {
-		tag := fmt.Sprintf("%s%s%s %s", color.Bold, color.FgYellow, grp.tag, color.Reset)
-		builder.WriteString(tag + term.ClearLineAfter + term.NewlineReturn)
+	visible := func(row int) bool { return offset+row >= first && offset+row < last }
+
+	if e.hasHeader(grp) {
+		rows++
+
+		if visible(0) {
+			builder.WriteString(e.renderHeader(grp))
+		}
+
+		if grp.collapsed {
+			return rows
+		}
+	}
+
+	headerRows := rows
+	rows += grp.lines(len(grp.rows))
+
+	// Groups out of the window are not rendered at all.
+	if offset+rows <= first || offset >= last {
+		return rows
 	}
 
+	grp.columnsX = grp.columnsX[:0]
+
+	line := headerRows
+
 	for rowIndex, row := range grp.rows {
-		for columnIndex := range grp.columnsWidth {
-			var value Candidate
+		continuations := grp.continuations(rowIndex)
+
+		// Rows out of the window are not rendered, except the first one,
+		// which is needed to know where columns start (for the mouse),
+		// and those whose wrapped description is partly in the window.
+		shown := visible(line)
+		if !shown && rowIndex > 0 && offset+line+continuations < first {
+			line += 1 + continuations
+			continue
+		} else if !shown && rowIndex > 0 && offset+line >= last {
+			break
+		}
+
+		rendered, descX := e.renderRow(grp, row, rowIndex)
 
-			// If there are aliases, we might have no completions at the current
-			// coordinates, so just print the corresponding padding and return.
-			if len(row) > columnIndex {
-				value = row[columnIndex]
+		if shown {
+			builder.WriteString(rendered)
+		}
+
+		for cont := 1; cont <= continuations; cont++ {
+			if visible(line + cont) {
+				builder.WriteString(e.renderContinuation(grp.wrapped[rowIndex][cont], descX))
 			}
+		}
+
+		line += 1 + continuations
+	}
 
-			// Apply all highlightings to the displayed value:
-			// selection, prefixes, styles and other things,
-			padding := grp.getPad(value, columnIndex, false)
-			isSelected := rowIndex == grp.posY && columnIndex == grp.posX && grp.isCurrent
-			display := e.highlightDisplay(grp, value, padding, columnIndex, isSelected)
+	return rows
+}
 
-			builder.WriteString(display)
+// renderContinuation renders a continuation line of a wrapped description,
+// aligned with the first line of the description, and never highlighted.
+func (e *Engine) renderContinuation(desc string, descX int) string {
+	compDescStyle := color.UnquoteRC(e.config.GetString("completion-description-style"))
 
-			// Add description if no aliases, or if done with them.
-			onLast := columnIndex == len(grp.columnsWidth)-1
-			if grp.aliased && onLast && value.Description == "" {
-				value = row[0]
-			}
+	return padSpace(descX) + compDescStyle + desc + color.Reset + term.ClearLineAfter + term.NewlineReturn
+}
 
-			if !grp.aliased || onLast {
-				grp.maxDescAllowed = grp.setMaximumSizes(columnIndex)
+// renderHeader renders the tag of a group. Collapsed groups only show their
+// tag and hidden candidates count, highlighted like candidates when the group
+// header is selected.
+func (e *Engine) renderHeader(grp *group) string {
+	tag := fmt.Sprintf("%s%s %s", grp.headerStyle, grp.tag, color.Reset)
 
-				descPad := grp.getPad(value, columnIndex, true)
-				desc := e.highlightDesc(grp, value, descPad, rowIndex, columnIndex, isSelected)
-				builder.WriteString(desc)
-			}
+	if grp.collapsed {
+		if grp.isCurrent {
+			userStyle := color.UnquoteRC(e.config.GetString("completion-selection-style"))
+			tag = color.Fmt(color.Bg+"255") + userStyle + grp.tag + color.Reset + " "
 		}
 
-		// We're done for this line.
-		builder.WriteString(term.ClearLineAfter + term.NewlineReturn)
+		tag += fmt.Sprintf("%s(%d hidden)%s", color.Dim, grp.hiddenCount(), color.Reset)
 	}
 
-	return builder.String()
+	return tag + term.ClearLineAfter + term.NewlineReturn
+}
+
+// renderRow renders a row of candidates of a group, with their descriptions,
+// and returns the column at which the (last) description starts. When rendering
+// the first row, it records where the columns of the group start.
+func (e *Engine) renderRow(grp *group, row []Candidate, rowIndex int) (rendered string, descX int) {
+	var builder strings.Builder
+	var rowWidth int
+
+	for columnIndex := range grp.columnsWidth {
+		var value Candidate
+
+		// If there are aliases, we might have no completions at the current
+		// coordinates, so just print the corresponding padding and return.
+		if len(row) > columnIndex {
+			value = row[columnIndex]
+		}
+
+		// Apply all highlightings to the displayed value:
+		// selection, prefixes, styles and other things,
+		padding := grp.getPad(value, columnIndex, false)
+		isSelected := rowIndex == grp.posY && columnIndex == grp.posX && grp.isCurrent
+		display := e.highlightDisplay(grp, value, padding, columnIndex, isSelected)
+
+		// Remember where columns start, for selecting candidates with the mouse.
+		if rowIndex == 0 {
+			grp.columnsX = append(grp.columnsX, rowWidth)
+		}
+
+		rowWidth += strutil.RealLength(display)
+
+		builder.WriteString(display)
+
+		// Add description if no aliases, or if done with them.
+		onLast := columnIndex == len(grp.columnsWidth)-1
+		if grp.aliased && onLast && value.Description == "" {
+			value = row[0]
+		}
+
+		if !grp.aliased || onLast {
+			grp.maxDescAllowed = grp.setMaximumSizes(columnIndex)
+			descX = rowWidth + strutil.RealLength(grp.listSep())
+
+			// Wrapped descriptions only show their first line on the row.
+			if rowIndex < len(grp.wrapped) && len(grp.wrapped[rowIndex]) > 0 {
+				value.Description = grp.wrapped[rowIndex][0]
+				value.descLen = strutil.RealLength(value.Description)
+			}
+
+			descPad := grp.getPad(value, columnIndex, true)
+			desc := e.highlightDesc(grp, value, descPad, rowIndex, columnIndex, isSelected)
+			rowWidth += strutil.RealLength(desc)
+
+			builder.WriteString(desc)
+		}
+	}
+
+	// We're done for this line.
+	builder.WriteString(term.ClearLineAfter + term.NewlineReturn)
+
+	return builder.String(), descX
 }
 
 func (e *Engine) highlightDisplay(grp *group, val Candidate, pad, col int, selected bool) (candidate string) {
@@ -109,36 +283,61 @@ func (e *Engine) highlightDisplay(grp *group, val Candidate, pad, col int, selec
 	}
 
 	reset := color.Fmt(val.Style)
-	candidate, padded := grp.trimDisplay(val, pad, col)
-
-	if e.IsearchRegex != nil && e.isearchBuf.Len() > 0 && !selected {
-		match := e.IsearchRegex.FindString(candidate)
-		match = color.Fmt(color.Bg+"244") + match + color.Reset + reset
-		candidate = e.IsearchRegex.ReplaceAllLiteralString(candidate, match)
+	if val.Used {
+		reset += color.Dim
 	}
 
-	if selected {
-		// If the comp is currently selected, overwrite any highlighting already applied.
+	candidate, padded := grp.trimDisplay(val, pad, col)
+	indicator := e.renderIndicator(grp, selected)
+
+	if selected && !e.indOnly {
+		// If the comp is currently selected, use the selection style instead
+		// of the candidate one, but keep its matching parts highlighted.
 		userStyle := color.UnquoteRC(e.config.GetString("completion-selection-style"))
 		selectionHighlightStyle := color.Fmt(color.Bg+"255") + userStyle
-		candidate = selectionHighlightStyle + candidate
+		candidate = selectionHighlightStyle + e.highlightMatches(candidate, selectionHighlightStyle)
 
 		if grp.aliased {
 			candidate += color.Reset
 		}
 	} else {
-		// Highlight the prefix if any and configured for it.
-		if e.config.GetBool("colored-completion-prefix") && e.prefix != "" {
-			if prefixMatch, err := regexp.Compile(fmt.Sprintf("^%s", e.prefix)); err == nil {
-				prefixColored := color.Bold + color.FgBlue + e.prefix + color.BoldReset + color.FgDefault + reset
-				candidate = prefixMatch.ReplaceAllString(candidate, prefixColored)
-			}
-		}
+		candidate = reset + e.highlightMatches(candidate, reset) + color.Reset
+	}
+
+	return indicator + candidate + padded
+}
+
+// renderIndicator returns the selection indicator if the candidate is selected,
+// or as many spaces as its width otherwise, so that candidates stay aligned.
+func (e *Engine) renderIndicator(grp *group, selected bool) string {
+	if grp.indicatorWidth == 0 {
+		return ""
+	}
 
-		candidate = reset + candidate + color.Reset
+	if !selected {
+		return padSpace(grp.indicatorWidth)
 	}
 
-	return candidate + padded
+	return color.Fmt(e.indStyle) + e.indicator + color.Reset
+}
+
+// highlightMatches highlights the parts of a candidate matching the incremental
+// search minibuffer when searching, or the completed word otherwise, and restores
+// the candidate style (reset) after each of them. Prefixes are only highlighted
+// when configured for it, while substring and fuzzy matches always are, since the
+// matching part of the candidate is not obvious otherwise.
+func (e *Engine) highlightMatches(candidate, reset string) string {
+	if e.IsearchRegex != nil && e.isearchBuf.Len() > 0 {
+		return e.IsearchRegex.ReplaceAllStringFunc(candidate, func(match string) string {
+			return color.Fmt(color.Bg+"244") + match + color.Reset + reset
+		})
+	}
+
+	if e.config.GetBool("colored-completion-prefix") || e.matchMode != MatchPrefix {
+		return highlightMatch(candidate, e.prefix, e.matchMode, e.matchCase(e.prefix), reset)
+	}
+
+	return candidate
 }
 
 func (e *Engine) highlightDesc(grp *group, val Candidate, pad, row, col int, selected bool) (desc string) {
@@ -151,15 +350,15 @@ func (e *Engine) highlightDesc(grp *group, val Candidate, pad, row, col int, sel
 	// If the next row has the same completions, replace the description with our hint.
 	if len(grp.rows) > row+1 && grp.rows[row+1][0].Description == val.Description {
 		desc = "|"
-	} else if e.IsearchRegex != nil && e.isearchBuf.Len() > 0 && !selected {
-		match := e.IsearchRegex.FindString(desc)
-		match = color.Fmt(color.Bg+"244") + match + color.Reset + color.Dim
-		desc = e.IsearchRegex.ReplaceAllLiteralString(desc, match)
+	} else if e.IsearchRegex != nil && e.isearchBuf.Len() > 0 && e.isearchDescs && !selected {
+		desc = e.IsearchRegex.ReplaceAllStringFunc(desc, func(match string) string {
+			return color.Fmt(color.Bg+"244") + match + color.Reset + color.Dim
+		})
 	}
 
 	// If the comp is currently selected, overwrite any highlighting already applied.
 	// Replace all background reset escape sequences in it, to ensure correct display.
-	if row == grp.posY && col == grp.posX && grp.isCurrent && !grp.aliased {
+	if row == grp.posY && col == grp.posX && grp.isCurrent && !grp.aliased && !e.indOnly {
 		userDescStyle := color.UnquoteRC(e.config.GetString("completion-selection-style"))
 		selectionHighlightStyle := color.Fmt(color.Bg+"255") + userDescStyle
 		desc = strings.ReplaceAll(desc, color.BgDefault, userDescStyle)
@@ -171,94 +370,34 @@ func (e *Engine) highlightDesc(grp *group, val Candidate, pad, row, col int, sel
 	return compDescStyle + desc + color.Reset + padded
 }
 
-// cropCompletions - When the user cycles through a completion list longer
-// than the console MaxTabCompleterRows value, we crop the completions string
-// so that "global" cycling (across all groups) is printed correctly.
-func (e *Engine) cropCompletions(comps string, maxRows int) (cropped string, usedY int) {
-	// Get the current absolute candidate position
-	absPos := e.getAbsPos()
-
-	// Scan the completions for cutting them at newlines
-	scanner := bufio.NewScanner(strings.NewReader(comps))
-
-	// If absPos < MaxTabCompleterRows, cut below MaxTabCompleterRows and return
-	if absPos < maxRows-1 {
-		return e.cutCompletionsBelow(scanner, maxRows)
-	}
-
-	// If absolute > MaxTabCompleterRows, cut above and below and return
-	//      -> This includes de facto when we tabCompletionReverse
-	if absPos >= maxRows-1 {
-		return e.cutCompletionsAboveBelow(scanner, maxRows, absPos)
-	}
-
-	return
-}
-
-func (e *Engine) cutCompletionsBelow(scanner *bufio.Scanner, maxRows int) (string, int) {
-	var count int
-	var cropped string
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		if count < maxRows-1 {
-			cropped += line + term.NewlineReturn
-			count++
-		} else {
-			break
-		}
+// renderPreview renders the full description of the selected candidate, if
+// the preview is enabled, below a separator and on at most maxRows rows (the
+// separator included). Description lines are truncated to the terminal width.
+func (e *Engine) renderPreview(width, maxRows int) string {
+	if !e.preview || e.selected.Description == "" || maxRows < 2 {
+		return ""
 	}
 
-	cropped = strings.TrimSuffix(cropped, term.NewlineReturn)
-
-	// Add hint for remaining completions, if any.
-	_, used := e.completionCount()
-	remain := used - count
-
-	if remain <= 0 {
-		return cropped, count - 1
+	lines := strings.Split(strutil.FormatTabs(e.selected.Description, e.tabWidth, 0), "\n")
+	if len(lines) > maxRows-1 {
+		lines = lines[:maxRows-1]
 	}
 
-	cropped += fmt.Sprintf(term.NewlineReturn+color.Dim+color.FgYellow+" %d more completion rows... (scroll down to show)"+color.Reset, remain)
-
-	return cropped, count
-}
-
-func (e *Engine) cutCompletionsAboveBelow(scanner *bufio.Scanner, maxRows, absPos int) (string, int) {
-	cutAbove := absPos - maxRows + 1
-
-	var cropped string
-	var count int
-
-	for scanner.Scan() {
-		line := scanner.Text()
-
-		if count <= cutAbove {
-			count++
-
-			continue
-		}
+	descStyle := color.UnquoteRC(e.config.GetString("completion-description-style"))
 
-		if count > cutAbove && count <= absPos {
-			cropped += line + term.NewlineReturn
-			count++
-		} else {
-			break
-		}
+	separatorWidth := width - 1
+	if separatorWidth > previewSeparatorWidth {
+		separatorWidth = previewSeparatorWidth
 	}
 
-	cropped = strings.TrimSuffix(cropped, term.NewlineReturn)
-	count -= cutAbove + 1
+	var preview strings.Builder
 
-	// Add hint for remaining completions, if any.
-	_, used := e.completionCount()
-	remain := used - (maxRows + cutAbove)
+	preview.WriteString(term.NewlineReturn + color.Dim + strings.Repeat("─", separatorWidth) + color.Reset + term.ClearLineAfter)
 
-	if remain <= 0 {
-		return cropped, count - 1
+	for _, line := range lines {
+		line = color.TrimWidth(strings.TrimSuffix(line, "\r"), width-1)
+		preview.WriteString(term.NewlineReturn + descStyle + line + color.Reset + term.ClearLineAfter)
 	}
 
-	cropped += fmt.Sprintf(term.NewlineReturn+color.Dim+color.FgYellow+" %d more completion rows... (scroll down to show)"+color.Reset, remain)
-
-	return cropped, count
+	return preview.String()
 }
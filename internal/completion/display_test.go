@@ -0,0 +1,316 @@
+package completion
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/rivo/uniseg"
+
+	"github.com/reeflective/readline/internal/color"
+	"github.com/reeflective/readline/internal/keymap"
+	"github.com/reeflective/readline/internal/term"
+)
+
+// newTestMenu returns an engine with a list menu of count candidates,
+// one per row, in order (candidate00000, candidate00001, etc).
+func newTestMenu(count int) *Engine {
+	values := make(RawValues, 0, count)
+
+	for i := 0; i < count; i++ {
+		value := fmt.Sprintf("candidate%05d", i)
+		values = append(values, Candidate{Value: value, Display: value, Description: "description " + strconv.Itoa(i)})
+	}
+
+	comps := AddRaw(values)
+	comps.Layouts = map[string]Layout{"*": LayoutList}
+
+	eng := newTestEngine("git c")
+	eng.keymap.SetLocal(keymap.MenuSelect)
+	eng.Generate(comps)
+
+	return eng
+}
+
+func TestEngine_SetIndicator(t *testing.T) {
+	tests := []struct {
+		name      string
+		indicator string
+		only      bool
+		wantRows  []string
+	}{
+		{
+			name:      "No indicator",
+			indicator: "",
+			wantRows:  []string{"candidate00000", "candidate00001"},
+		},
+		{
+			name:      "Indicator with highlighting",
+			indicator: "> ",
+			wantRows:  []string{"> candidate00000", "  candidate00001"},
+		},
+		{
+			name:      "Wide indicator only",
+			indicator: "👉",
+			only:      true,
+			wantRows:  []string{"👉candidate00000", "  candidate00001"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("TERM", "dumb")
+
+			values := RawValues{
+				{Value: "candidate00000", Display: "candidate00000", Description: "first"},
+				{Value: "candidate00001", Display: "candidate00001", Description: "second"},
+			}
+
+			comps := AddRaw(values)
+			comps.Layouts = map[string]Layout{"*": LayoutList}
+
+			eng := newTestEngine("git c")
+			eng.SetIndicator(test.indicator, "32", test.only)
+			eng.keymap.SetLocal(keymap.MenuSelect)
+			eng.Generate(comps)
+			eng.Select(1, 0)
+
+			menu, _ := eng.renderMenu(10)
+			rows := strings.Split(menu, term.NewlineReturn)
+
+			for i, want := range test.wantRows {
+				row := color.Strip(rows[i])
+				if !strings.HasPrefix(row, want) {
+					t.Errorf("renderMenu() row %d = %q, want prefix %q", i, row, want)
+				}
+			}
+
+			// Descriptions must stay aligned, whatever the indicator width.
+			first, _, _ := strings.Cut(color.Strip(rows[0]), "first")
+			second, _, _ := strings.Cut(color.Strip(rows[1]), "second")
+
+			if uniseg.StringWidth(first) != uniseg.StringWidth(second) {
+				t.Errorf("descriptions are not aligned: %q and %q", first, second)
+			}
+		})
+	}
+}
+
+func TestEngine_renderMenuWidths(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxDisplay int
+		values     RawValues
+	}{
+		{
+			name:       "Truncated displays",
+			maxDisplay: 10,
+			values: RawValues{
+				{Value: "--short", Display: "--short", Description: "first"},
+				{Value: "--a-very-long-option", Display: "--a-very-long-option", Description: "second"},
+			},
+		},
+		{
+			name: "Wide characters",
+			values: RawValues{
+				{Value: "ascii", Display: "ascii", Description: "first"},
+				{Value: "日本語", Display: "日本語", Description: "second"},
+			},
+		},
+		{
+			name: "Emojis",
+			values: RawValues{
+				{Value: "rocket", Display: "🚀 rocket", Description: "first"},
+				{Value: "plain", Display: "plain", Description: "second"},
+			},
+		},
+		{
+			name:       "Truncated wide characters",
+			maxDisplay: 6,
+			values: RawValues{
+				{Value: "abc", Display: "abc", Description: "first"},
+				{Value: "日本語の候補", Display: "日本語の候補", Description: "second"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("TERM", "dumb")
+
+			comps := AddRaw(test.values)
+			comps.Layouts = map[string]Layout{"*": LayoutList}
+
+			eng := newTestEngine("git ")
+			eng.SetMaxDisplayWidth(test.maxDisplay)
+			eng.keymap.SetLocal(keymap.MenuSelect)
+			eng.Generate(comps)
+
+			menu, _ := eng.renderMenu(10)
+			rows := strings.Split(menu, term.NewlineReturn)
+
+			// Descriptions must start on the same column, whatever the displays.
+			first, _, _ := strings.Cut(color.Strip(rows[0]), "first")
+			second, _, _ := strings.Cut(color.Strip(rows[1]), "second")
+
+			if uniseg.StringWidth(first) != uniseg.StringWidth(second) {
+				t.Errorf("descriptions are not aligned: %q and %q", first, second)
+			}
+
+			if test.maxDisplay <= 0 {
+				return
+			}
+
+			for _, row := range []string{first, second} {
+				candidate, _, _ := strings.Cut(row, " --")
+				if width := uniseg.StringWidth(strings.TrimSpace(candidate)); width > test.maxDisplay {
+					t.Errorf("candidate %q is %d columns wide, want at most %d", row, width, test.maxDisplay)
+				}
+			}
+		})
+	}
+}
+
+func TestEngine_renderMenuUsed(t *testing.T) {
+	t.Setenv("TERM", "dumb")
+
+	values := RawValues{
+		{Value: "--all", Display: "--all", Description: "all", Used: true},
+		{Value: "--force", Display: "--force", Description: "force"},
+		{Value: "--dry-run", Display: "--dry-run", Description: "dry run", Used: true},
+		{Value: "--verbose", Display: "--verbose", Description: "verbose"},
+	}
+
+	comps := AddRaw(values)
+	comps.Layouts = map[string]Layout{"*": LayoutList}
+
+	eng := newTestEngine("git --")
+	eng.keymap.SetLocal(keymap.MenuSelect)
+	eng.Generate(comps)
+
+	menu, _ := eng.renderMenu(10)
+	rows := strings.Split(menu, term.NewlineReturn)
+	want := []string{"--force", "--verbose", "--all", "--dry-run"}
+
+	for i, value := range want {
+		if row := color.Strip(rows[i]); !strings.HasPrefix(row, value+" ") {
+			t.Errorf("renderMenu() row %d = %q, want %q", i, row, value)
+		}
+	}
+}
+
+func TestEngine_renderMenuWrapped(t *testing.T) {
+	t.Setenv("TERM", "dumb")
+
+	long := strings.Repeat("a long description ", 10)
+	values := RawValues{
+		{Value: "commit", Display: "commit", Description: long},
+		{Value: "config", Display: "config", Description: "short"},
+	}
+
+	comps := AddRaw(values)
+	comps.Layouts = map[string]Layout{"*": LayoutList}
+	comps.WrapDescriptions = map[string]bool{"*": true}
+
+	eng := newTestEngine("git c")
+	eng.keymap.SetLocal(keymap.MenuSelect)
+	eng.Generate(comps)
+	eng.Select(1, 0)
+
+	menu, _ := eng.renderMenu(20)
+	rows := strings.Split(color.Strip(menu), term.NewlineReturn)
+
+	if len(rows) < 3 || !strings.HasPrefix(rows[0], "commit") || !strings.HasPrefix(rows[len(rows)-1], "config") {
+		t.Fatalf("renderMenu() rows = %q, want commit, its continuation lines, then config", rows)
+	}
+
+	descX := strings.Index(rows[0], "a long")
+
+	var wrapped string
+
+	for _, row := range rows[:len(rows)-1] {
+		if width := uniseg.StringWidth(row); width > 80 {
+			t.Errorf("renderMenu() row %q is %d columns wide", row, width)
+		}
+
+		wrapped += " " + strings.TrimSpace(row[descX:])
+	}
+
+	if got := strings.Fields(wrapped); strings.Join(got, " ") != strings.TrimSpace(long) {
+		t.Errorf("renderMenu() wrapped description = %q, want %q", wrapped, long)
+	}
+
+	// Continuation lines do not select any candidate.
+	if eng.SelectAt(1, descX) {
+		t.Errorf("SelectAt() selected a continuation line")
+	}
+
+	if !eng.SelectAt(len(rows)-1, 0) || eng.selected.Value != "config" {
+		t.Errorf("SelectAt() did not select the candidate below the continuation lines")
+	}
+}
+
+func TestEngine_renderMenu(t *testing.T) {
+	tests := []struct {
+		name     string
+		selected int
+		maxRows  int
+		wantRows []string
+	}{
+		{
+			name:     "Top of the menu",
+			selected: 1,
+			maxRows:  4,
+			wantRows: []string{"candidate00000", "candidate00001", "candidate00002"},
+		},
+		{
+			name:     "Menu scrolled down to the selection",
+			selected: 10,
+			maxRows:  4,
+			wantRows: []string{"candidate00007", "candidate00008", "candidate00009"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("TERM", "dumb")
+
+			eng := newTestMenu(1000)
+
+			for i := 0; i < test.selected; i++ {
+				eng.Select(1, 0)
+			}
+
+			menu, _ := eng.renderMenu(test.maxRows)
+			rows := strings.Split(menu, term.NewlineReturn)
+
+			// The last row is the hint for remaining completions.
+			if len(rows) != len(test.wantRows)+1 {
+				t.Fatalf("renderMenu() rendered %d rows, want %d", len(rows)-1, len(test.wantRows))
+			}
+
+			for i, want := range test.wantRows {
+				if !strings.Contains(rows[i], want) {
+					t.Errorf("renderMenu() row %d = %q, want %q", i, rows[i], want)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkEngine_renderMenu(b *testing.B) {
+	b.Setenv("TERM", "dumb")
+
+	eng := newTestMenu(50000)
+
+	for i := 0; i < 100; i++ {
+		eng.Select(1, 0)
+	}
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		eng.renderMenu(20)
+	}
+}
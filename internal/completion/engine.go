@@ -2,10 +2,12 @@ package completion
 
 import (
 	"regexp"
+	"time"
 
 	"github.com/reeflective/readline/inputrc"
 	"github.com/reeflective/readline/internal/core"
 	"github.com/reeflective/readline/internal/keymap"
+	"github.com/reeflective/readline/internal/term"
 	"github.com/reeflective/readline/internal/ui"
 )
 
@@ -16,6 +18,7 @@ type Engine struct {
 	cached        Completer       // A cached completer function to use when updating.
 	autoCompleter Completer       // Completer used by things like autocomplete
 	hint          *ui.Hint        // The completions can feed hint/usage messages
+	out           *term.Output    // The terminal on which completions are displayed.
 
 	// Line parameters
 	keys       *core.Keys      // The input keys reader
@@ -34,9 +37,44 @@ type Engine struct {
 	suffix      string        // The current word suffix
 	inserted    []rune        // The selected candidate (inserted in line) without prefix or suffix.
 	usedY       int           // Comprehensive size offset (terminal rows) of the currently built completions.
+	pageRows    int           // Rows of candidates displayed (without the preview), to move by pages.
+	menuOffset  int           // Rows of candidates cropped above the displayed ones.
 	auto        bool          // Is the engine autocompleting ?
 	autoForce   bool          // Special autocompletion mode (isearch-style)
 	skipDisplay bool          // Don't display completions if there are some.
+	matchMode   MatchMode     // How candidates are matched against the prefix.
+	layout      Layout        // Default layout of groups, when completions don't specify one.
+	headers     Headers       // Default visibility of group headers, when completions don't specify one.
+	maxColumns  int           // Maximum number of columns in grids (unlimited if <= 0).
+	maxDisplay  int           // Maximum width of candidates displays (unlimited if <= 0).
+	preview     bool          // Print the selected candidate description below the menu.
+	tabWidth    int           // Columns between tab stops in the description preview.
+	menuUnique  bool          // Show the menu for unique candidates, instead of inserting them.
+	indicator   string        // Printed before the selected candidate, and as much spaces before others.
+	indStyle    string        // Style of the selection indicator.
+	indOnly     bool          // The indicator replaces the selected candidate highlighting.
+	context     []string      // The path of the command being completed, shown above the menu.
+	contextRows int           // Rows used by the context above the menu (0 or 1).
+
+	// Collapsed groups
+	collapsed map[string]bool // Tags of the groups whose candidates are hidden.
+
+	// Hints
+	hintBase     string // The completion hint (usage, messages, etc), without the selection position.
+	hintSelected bool   // The selected candidate position is currently shown in the hint.
+	hideNoMatch  bool   // Don't show a hint when completions yield no matches.
+
+	// Asynchronous completions
+	stream      chan struct{} // Closed when the current completion stream is cancelled.
+	streamed    Values        // All completions received from the current stream.
+	streamFrame int           // Current frame of the streaming spinner.
+	cache       cache         // Completions cached by line and cursor position.
+	generated   *generated    // Last completions generated, to filter again.
+	onError     func(error)   // Notified of panics recovered in completers.
+
+	// Spinner
+	spinnerFrames    []string      // Frames of the spinner shown while fetching completions.
+	spinnerThreshold time.Duration // Blocking completers not returned after this are awaited in the background.
 
 	// Incremental search
 	IsearchRegex       *regexp.Regexp // Holds the current search regex match
@@ -51,14 +89,26 @@ type Engine struct {
 	isearchStartCursor int            // The cursor position before starting isearch
 	isearchLast        string         // The last non-incremental buffer.
 	isearchModeExit    keymap.Mode    // The main keymap to restore after exiting isearch
+	isearchRegexMode   bool           // The minibuffer starts with a '/', values are matched as a strict regexp.
+	isearchDescs       bool           // Also match candidates descriptions/display strings.
+	isearchMatchCase   bool           // Match case-sensitively, even with a lowercase minibuffer.
+	isearchDirected    bool           // The search has a direction (history), shown in its hint.
+	isearchReversed    bool           // The search goes in the opposite order of the candidates.
+	isearchErr         error          // The error compiling the minibuffer as a regexp, if any.
+
+	// Line before completing
+	savedLine   string // The input line before the completion/isearch session.
+	savedCursor int    // The cursor position before the session.
+	saved       bool   // A line is saved, and restored if the session is aborted.
 }
 
 // NewEngine initializes a new completion engine with the shell operating parameters.
-func NewEngine(h *ui.Hint, km *keymap.Engine, o *inputrc.Config) *Engine {
+func NewEngine(h *ui.Hint, km *keymap.Engine, o *inputrc.Config, out *term.Output) *Engine {
 	return &Engine{
 		config: o,
 		hint:   h,
 		keymap: km,
+		out:    out,
 	}
 }
 
@@ -79,14 +129,15 @@ func Init(eng *Engine, k *core.Keys, l *core.Line, cur *core.Cursor, s *core.Sel
 func (e *Engine) Generate(completions Values) {
 	e.prepare(completions)
 
-	if e.noCompletions() {
+	// Completions still being streamed will need the menu.
+	if e.noCompletions() && !e.Streaming() {
 		e.ClearMenu(true)
 	}
 
 	// Incremental search is a special case, because the user may
 	// want to keep searching for another match, so we don't drop
 	// the completion list and exit the incremental search mode.
-	if e.hasUniqueCandidate() && e.keymap.Local() != keymap.Isearch {
+	if e.hasUniqueCandidate() && e.keymap.Local() != keymap.Isearch && !e.Streaming() {
 		e.acceptCandidate()
 		e.ClearMenu(true)
 	}
@@ -102,7 +153,18 @@ func (e *Engine) GenerateWith(completer Completer) {
 
 	// Call the provided/cached completer
 	// and use the completions as normal
-	e.Generate(e.cached())
+	e.Generate(e.run(e.cached))
+}
+
+// SetOnError sets the function notified of the panics recovered in completers,
+// which are otherwise only notified with a completion message (see Recover).
+func (e *Engine) SetOnError(onError func(err error)) {
+	e.onError = onError
+}
+
+// run calls a completer, recovering from any panic in it.
+func (e *Engine) run(completer Completer) Values {
+	return Recover(completer, e.onError)()
 }
 
 // SkipDisplay avoids printing completions below the
@@ -113,11 +175,14 @@ func (e *Engine) SkipDisplay() {
 
 // Select moves the completion selector by some X or Y value,
 // and updates the inserted candidate in the input line.
-func (e *Engine) Select(row, column int) {
+// If the `completion-no-wrap` option is set, the selector does
+// not wrap around the first/last candidates, and true is returned
+// when the selector has been clamped because of this.
+func (e *Engine) Select(row, column int) (clamped bool) {
 	grp := e.currentGroup()
 
 	if grp == nil || len(grp.rows) == 0 {
-		return
+		return false
 	}
 
 	// Ensure the completion keymaps are set.
@@ -129,39 +194,72 @@ func (e *Engine) Select(row, column int) {
 
 	// If we already have an inserted candidate
 	// remove it before inserting the new one.
-	if len(e.selected.Value) > 0 {
+	selected := len(e.selected.Value) > 0
+	if selected {
 		e.cancelCompletedLine()
 	}
 
 	defer e.refreshLine()
 
+	// Candidates of collapsed groups cannot be selected.
+	if grp.collapsed {
+		e.cycleExpandedGroup(row >= 0 && column >= 0)
+		return false
+	}
+
 	// Move the selector
+	posX, posY := grp.posX, grp.posY
+
 	done, next := grp.moveSelector(row, column)
 	if !done {
-		return
+		return false
 	}
 
-	var newGrp *group
+	// Stay on the first/last candidate instead of wrapping around.
+	if selected && e.config.GetBool("completion-no-wrap") && e.isEdgeGroup(grp, next) {
+		grp.posX, grp.posY = posX, posY
+		return true
+	}
 
-	if next {
-		e.cycleNextGroup()
-		newGrp = e.currentGroup()
-		newGrp.firstCell()
-	} else {
-		e.cyclePreviousGroup()
-		newGrp = e.currentGroup()
-		newGrp.lastCell()
+	e.cycleExpandedGroup(next)
+
+	return false
+}
+
+// SelectIndex selects the nth candidate (starting at 1) in the order of the
+// menu, regardless of the candidate currently selected, if any. Like Select(),
+// this returns true if the selection has been clamped because of the option
+// `completion-no-wrap`, in which case the last candidate is selected.
+func (e *Engine) SelectIndex(index int) (clamped bool) {
+	// Start over from the first candidate of the first group.
+	for _, grp := range e.groups {
+		grp.posX, grp.posY = -1, -1
+		grp.isCurrent = false
 	}
+
+	for i := 0; i < index; i++ {
+		if e.Select(1, 0) {
+			return true
+		}
+	}
+
+	return false
 }
 
 // SelectTag allows to select the first value of the next tag (next=true),
-// or the last value of the previous tag (next=false).
-func (e *Engine) SelectTag(next bool) {
+// or the last value of the previous tag (next=false). If the tag is collapsed,
+// only its header is selected and no candidate is inserted. Like Select(), this
+// returns true if the selection has been clamped because of `completion-no-wrap`.
+func (e *Engine) SelectTag(next bool) (clamped bool) {
 	// Ensure the completion keymaps are set.
 	e.adjustSelectKeymap()
 
 	if len(e.groups) <= 1 {
-		return
+		return false
+	}
+
+	if e.config.GetBool("completion-no-wrap") && e.isEdgeGroup(e.currentGroup(), next) {
+		return true
 	}
 
 	// If the completion candidate is not empty,
@@ -183,6 +281,117 @@ func (e *Engine) SelectTag(next bool) {
 		newGrp := e.currentGroup()
 		newGrp.firstCell()
 	}
+
+	return false
+}
+
+// SelectPage moves the selection forward (next=true) or backward by a page of
+// candidates, that is, as many as the rows of the menu currently displayed can
+// hold in the current group. Like Select(), this returns true if the selection
+// has been clamped because of `completion-no-wrap`.
+func (e *Engine) SelectPage(next bool) (clamped bool) {
+	grp := e.currentGroup()
+	if grp == nil || len(grp.rows) == 0 {
+		return false
+	}
+
+	step := 1
+	if !next {
+		step = -1
+	}
+
+	page := max(e.pageRows, 1) * max(grp.maxX, 1)
+
+	for i := 0; i < page; i++ {
+		if e.Select(step, 0) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SelectEdge selects the first candidate of the first expanded group, or the
+// last candidate of the last one if last is true.
+func (e *Engine) SelectEdge(last bool) {
+	var edge *group
+
+	for _, grp := range e.groups {
+		if len(grp.rows) > 0 && !grp.collapsed && (edge == nil || last) {
+			edge = grp
+		}
+	}
+
+	if edge == nil {
+		return
+	}
+
+	// Ensure the completion keymaps are set.
+	e.adjustSelectKeymap()
+
+	if len(e.selected.Value) > 0 {
+		e.cancelCompletedLine()
+	}
+
+	defer e.refreshLine()
+
+	for _, grp := range e.groups {
+		grp.isCurrent = grp == edge
+	}
+
+	if last {
+		edge.lastCell()
+	} else {
+		edge.firstCell()
+	}
+}
+
+// SelectAt selects the candidate displayed at a row and column of the menu (both
+// starting at 0, the row being relative to the first displayed one), and returns
+// false if there is no candidate displayed at these coordinates.
+func (e *Engine) SelectAt(row, column int) (found bool) {
+	grp, posX, posY := e.candidateAt(row, column)
+	if grp == nil {
+		return false
+	}
+
+	e.adjustSelectKeymap()
+
+	if len(e.selected.Value) > 0 {
+		e.cancelCompletedLine()
+	}
+
+	defer e.refreshLine()
+
+	for _, other := range e.groups {
+		other.isCurrent = other == grp
+	}
+
+	grp.posX, grp.posY = posX, posY
+
+	return true
+}
+
+// SelectedAt returns true if the candidate displayed at a row and
+// column of the menu (see SelectAt) is the currently selected one.
+func (e *Engine) SelectedAt(row, column int) bool {
+	grp, posX, posY := e.candidateAt(row, column)
+	if grp == nil || len(e.selected.Value) == 0 {
+		return false
+	}
+
+	return grp.isCurrent && grp.posX == posX && grp.posY == posY
+}
+
+// Accept inserts the selected candidate in the line for good, and exits
+// the completion menu (and the incremental search mode, if searching).
+func (e *Engine) Accept() {
+	e.Cancel(false, true)
+	e.ClearMenu(true)
+
+	if e.keymap.Local() == keymap.Isearch {
+		e.IsearchStop(false)
+	}
 }
 
 // Cancel exits the current completions with the following behavior:
@@ -193,8 +402,10 @@ func (e *Engine) SelectTag(next bool) {
 // any active completion menu will still be kept/displayed.
 func (e *Engine) Cancel(inserted, cached bool) {
 	if cached {
+		e.cancelStream()
 		e.cached = nil
 		e.hint.Reset()
+		e.hintSelected = false
 	}
 
 	if len(e.selected.Value) == 0 && !inserted {
@@ -211,6 +422,11 @@ func (e *Engine) Cancel(inserted, cached bool) {
 	} else {
 		e.line.Set(*e.compLine...)
 		e.cursor.Set(e.compCursor.Pos())
+
+		// The Emacs region has been replaced by the candidate.
+		if e.keymap.IsEmacs() {
+			e.selection.Reset()
+		}
 	}
 }
 
@@ -229,6 +445,28 @@ func (e *Engine) ResetForce() {
 	e.IsearchStop(revertLine)
 }
 
+// SaveLine saves the current input line and cursor position as the ones to restore
+// if the completion (or incremental search) session being started is aborted.
+func (e *Engine) SaveLine() {
+	e.savedLine = string(*e.line)
+	e.savedCursor = e.cursor.Pos()
+	e.saved = true
+}
+
+// Abort cancels the current completion/incremental search session like ResetForce,
+// and restores the input line and cursor to their state before the session started,
+// thus also dropping any candidate inserted in the real line in the meantime.
+func (e *Engine) Abort() {
+	line, cursor, saved := e.savedLine, e.savedCursor, e.saved
+
+	e.ResetForce()
+
+	if saved {
+		e.line.Set([]rune(line)...)
+		e.cursor.Set(cursor)
+	}
+}
+
 // Reset accepts the currently inserted candidate (if any), clears the current
 // list of completions and exits the incremental-search mode if active.
 // If the completion engine was not active to begin with, nothing will happen.
@@ -248,6 +486,16 @@ func (e *Engine) Reset() {
 // the current list of generated completions (if completions is true).
 func (e *Engine) ClearMenu(completions bool) {
 	e.skipDisplay = false
+	e.hintUnselect()
+
+	if completions {
+		e.collapsed = nil
+	}
+
+	// The session is over, unless still searching.
+	if e.keymap.Local() != keymap.Isearch {
+		e.saved = false
+	}
 
 	e.resetValues(completions, false)
 
@@ -269,6 +517,17 @@ func (e *Engine) IsActive() bool {
 	return (completing || isearching) && !nonIsearching
 }
 
+// Selecting returns true if the menu-select keymap is active, that is,
+// if the completion menu has the focus instead of the input line.
+func (e *Engine) Selecting() bool {
+	return e.keymap.Local() == keymap.MenuSelect
+}
+
+// HasMenu returns true if there are completions to display below the line.
+func (e *Engine) HasMenu() bool {
+	return e.Matches() > 0 && !e.skipDisplay
+}
+
 // IsInserting returns true if a candidate is currently virtually inserted.
 func (e *Engine) IsInserting() bool {
 	return e.selected.Value != ""
@@ -314,9 +573,9 @@ func (e *Engine) Autocomplete() {
 
 	// Regenerate the completions.
 	if e.cached != nil {
-		e.prepare(e.cached())
+		e.prepare(e.run(e.cached))
 	} else if e.autoCompleter != nil {
-		e.prepare(e.autoCompleter())
+		e.prepare(e.run(e.autoCompleter))
 	}
 }
 
@@ -0,0 +1,222 @@
+package completion
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/reeflective/readline/internal/core"
+	"github.com/reeflective/readline/internal/keymap"
+	"github.com/reeflective/readline/internal/term"
+	"github.com/reeflective/readline/internal/ui"
+)
+
+func newTestEngine(line string) *Engine {
+	keys := new(core.Keys)
+	buf := core.Line(line)
+	cursor := core.NewCursor(&buf)
+	cursor.Set(buf.Len())
+
+	keymaps, config := keymap.NewEngine(keys, new(core.Iterations), term.NewOutput())
+	eng := NewEngine(new(ui.Hint), keymaps, config, term.NewOutput())
+	Init(eng, keys, &buf, cursor, core.NewSelection(&buf, cursor), nil)
+
+	return eng
+}
+
+func TestEngine_Abort(t *testing.T) {
+	candidates := RawValues{{Value: "commit"}, {Value: "config"}, {Value: "clone"}}
+
+	tests := []struct {
+		name    string
+		line    string
+		session func(eng *Engine)
+	}{
+		{
+			name: "Cancel menu with inserted candidate",
+			line: "git co",
+			session: func(eng *Engine) {
+				eng.Select(1, 0)
+			},
+		},
+		{
+			name: "Cancel isearch after candidate made real",
+			line: "git co",
+			session: func(eng *Engine) {
+				eng.Select(1, 0)
+				eng.Cancel(false, false)
+				eng.IsearchStart("completions", false, false)
+			},
+		},
+		{
+			name: "Cancel isearch with partial insertion",
+			line: "git c",
+			session: func(eng *Engine) {
+				eng.IsearchStart("completions", true, false)
+				eng.isearchBuf.Insert(0, 'l')
+				eng.UpdateIsearch()
+				eng.Cancel(false, false)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TERM", "dumb")
+
+			eng := newTestEngine(tt.line)
+
+			eng.SaveLine()
+			eng.keymap.SetLocal(keymap.MenuSelect)
+			eng.Generate(AddRaw(candidates))
+
+			tt.session(eng)
+			eng.Abort()
+
+			if got := string(*eng.line); got != tt.line {
+				t.Errorf("Abort() line = %q, want %q", got, tt.line)
+			}
+
+			if got := eng.cursor.Pos(); got != len(tt.line) {
+				t.Errorf("Abort() cursor = %d, want %d", got, len(tt.line))
+			}
+		})
+	}
+}
+
+func TestEngine_GenerateWithPanic(t *testing.T) {
+	tests := []struct {
+		name      string
+		completer Completer
+		wantError bool
+	}{
+		{
+			name:      "Panicking completer",
+			completer: func() Values { panic("index out of range") },
+			wantError: true,
+		},
+		{
+			name:      "Completer with nil values",
+			completer: func() Values { return Values{} },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TERM", "dumb")
+
+			var notified error
+
+			eng := newTestEngine("git c")
+			eng.SetOnError(func(err error) { notified = err })
+			eng.keymap.SetLocal(keymap.MenuSelect)
+			eng.GenerateWith(tt.completer)
+
+			var panicErr *PanicError
+			if isPanic := errors.As(notified, &panicErr); isPanic != tt.wantError {
+				t.Fatalf("GenerateWith() notified error = %v, want a panic: %v", notified, tt.wantError)
+			}
+
+			if tt.wantError && len(panicErr.Stack) == 0 {
+				t.Errorf("GenerateWith() panic error has no stack trace")
+			}
+
+			if matches := eng.Matches(); matches != 0 {
+				t.Errorf("GenerateWith() matches = %d, want 0", matches)
+			}
+		})
+	}
+}
+
+func TestEngine_GenerateUnique(t *testing.T) {
+	tests := []struct {
+		name       string
+		menuUnique bool
+		unique     map[string]bool
+		wantLine   string
+	}{
+		{
+			name:     "Unique candidate inserted by default",
+			wantLine: "git commit",
+		},
+		{
+			name:       "Menu shown for unique candidates",
+			menuUnique: true,
+			wantLine:   "git c",
+		},
+		{
+			name:       "Unique candidate of a tag inserted",
+			menuUnique: true,
+			unique:     map[string]bool{"commands": true},
+			wantLine:   "git commit",
+		},
+		{
+			name:     "Menu shown for all tags",
+			unique:   map[string]bool{"*": false},
+			wantLine: "git c",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TERM", "dumb")
+
+			comps := AddRaw(RawValues{{Value: "commit", Tag: "commands"}})
+			comps.InsertUnique = tt.unique
+
+			eng := newTestEngine("git c")
+			eng.SetMenuUnique(tt.menuUnique)
+			eng.Generate(comps)
+
+			if line := string(*eng.line); line != tt.wantLine {
+				t.Errorf("Generate() line = %q, want %q", line, tt.wantLine)
+			}
+		})
+	}
+}
+
+func TestEngine_SelectIndex(t *testing.T) {
+	candidates := RawValues{
+		{Value: "one"}, {Value: "two"}, {Value: "three"},
+		{Value: "four"}, {Value: "five"}, {Value: "six"},
+	}
+
+	tests := []struct {
+		name     string
+		layout   Layout
+		columns  int
+		selected int
+		index    int
+		want     string
+	}{
+		{name: "First candidate in list", layout: LayoutList, index: 1, want: "one"},
+		{name: "Fifth candidate in list", layout: LayoutList, index: 5, want: "five"},
+		{name: "Fifth candidate in grid", layout: LayoutGrid, index: 5, want: "five"},
+		{name: "Last candidate in grid", layout: LayoutGrid, index: 6, want: "six"},
+		{name: "Next row in grid", layout: LayoutGrid, columns: 2, index: 3, want: "three"},
+		{name: "Last row in grid", layout: LayoutGrid, columns: 2, index: 6, want: "six"},
+		{name: "Absolute with open menu", layout: LayoutList, selected: 2, index: 3, want: "three"},
+		{name: "Absolute with open grid", layout: LayoutGrid, selected: 4, index: 2, want: "two"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TERM", "dumb")
+
+			comps := AddRaw(candidates)
+			comps.Layouts = map[string]Layout{"*": tt.layout}
+			comps.NoSort = map[string]bool{"*": true}
+
+			eng := newTestEngine("cmd ")
+			eng.SetMaxColumns(tt.columns)
+			eng.SaveLine()
+			eng.keymap.SetLocal(keymap.MenuSelect)
+			eng.Generate(comps)
+
+			for i := 0; i < tt.selected; i++ {
+				eng.Select(1, 0)
+			}
+
+			eng.SelectIndex(tt.index)
+
+			if got := eng.selected.Value; got != tt.want {
+				t.Errorf("SelectIndex(%d) = %q, want %q", tt.index, got, tt.want)
+			}
+		})
+	}
+}
@@ -6,10 +6,10 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/rivo/uniseg"
 	"golang.org/x/exp/slices"
 
 	"github.com/reeflective/readline/internal/color"
-	"github.com/reeflective/readline/internal/term"
 )
 
 // group is used to structure different types of completions with different
@@ -18,18 +18,30 @@ type group struct {
 	tag               string        // Printed on top of the group's completions
 	rows              [][]Candidate // Values are grouped by aliases/rows, with computed paddings.
 	noSpace           SuffixMatcher // Suffixes to remove if a space or non-nil character is entered after the completion.
+	quote             QuoteStyle    // How to quote inserted values containing shell metacharacters.
+	addSpace          bool          // Append a space to inserted values not matching the noSpace suffixes.
 	columnsWidth      []int         // Computed width for each column of completions, when aliases
 	descriptionsWidth []int         // Computed width for each column of completions, when aliases
+	columnsX          []int         // Terminal column at which each column of completions starts, as displayed.
 	listSeparator     string        // This is used to separate completion candidates from their descriptions.
 	list              bool          // Force completions to be listed instead of grided
 	noSort            bool          // Don't sort completions
 	aliased           bool          // Are their aliased completions
 	preserveEscapes   bool          // Preserve escape sequences in the completion inserted values.
 	isCurrent         bool          // Currently cycling through this group, for highlighting choice
+	collapsed         bool          // Only the tag is shown, candidates are not displayed nor selectable.
+	insertUnique      bool          // The candidate is inserted without menu when it is the only one.
+	wrapDescs         bool          // Long descriptions are wrapped on continuation lines (lists only).
+	wrapped           [][]string    // Lines of the wrapped description of each row, if any.
+	headers           Headers       // Whether the tag is displayed above the candidates.
+	headerStyle       string        // Style of the tag, when displayed above the candidates.
 	longestValue      int           // Used when display is map/list, for determining message width
 	longestDesc       int           // Used to know how much descriptions can use when there are aliases.
 	maxDescAllowed    int           // Maximum ALLOWED description width.
 	termWidth         int           // Term size queried at beginning of computes by the engine.
+	maxColumns        int           // Maximum number of columns, regardless of the terminal width.
+	maxDisplay        int           // Maximum width of candidates displays, truncated beyond.
+	indicatorWidth    int           // Width of the selection indicator, reserved before each candidate.
 
 	// Selectors (position/bounds) management
 	posX int
@@ -41,13 +53,19 @@ type group struct {
 // newCompletionGroup initializes a group of completions to be displayed in the same area/header.
 func (e *Engine) newCompletionGroup(comps Values, tag string, vals RawValues, descriptions []string) {
 	grp := &group{
-		tag:          tag,
-		noSpace:      comps.NoSpace,
-		posX:         -1,
-		posY:         -1,
-		columnsWidth: []int{0},
-		termWidth:    term.GetWidth(),
-		longestDesc:  longest(descriptions, true),
+		tag:            tag,
+		noSpace:        comps.NoSpace,
+		quote:          comps.Quote,
+		addSpace:       comps.AddSpace,
+		posX:           -1,
+		posY:           -1,
+		columnsWidth:   []int{0},
+		termWidth:      e.out.Width(),
+		maxColumns:     e.maxColumns,
+		maxDisplay:     e.maxDisplay,
+		indicatorWidth: uniseg.StringWidth(e.indicator),
+		longestDesc:    longest(descriptions, true),
+		collapsed:      tag != "" && e.collapsed[tag],
 	}
 
 	// Initialize all options for the group.
@@ -58,6 +76,20 @@ func (e *Engine) newCompletionGroup(comps Values, tag string, vals RawValues, de
 		sort.Stable(vals)
 	}
 
+	// Candidates already used are listed after the others.
+	sort.SliceStable(vals, func(i, j int) bool {
+		return !vals[i].Used && vals[j].Used
+	})
+
+	// Candidates without a style use the one of their tag, if any.
+	if style, found := forTag(comps.TagStyles, tag); found {
+		for i := range vals {
+			if vals[i].Style == "" {
+				vals[i].Style = style
+			}
+		}
+	}
+
 	// Initial processing of our assigned values:
 	// Compute color/no-color sizes, some max/min, etc.
 	grp.prepareValues(vals)
@@ -76,10 +108,17 @@ func (e *Engine) newCompletionGroup(comps Values, tag string, vals RawValues, de
 
 // initOptions checks for global or group-specific options (display, behavior, grouping, etc).
 func (g *group) initOptions(eng *Engine, comps *Values, tag string, vals RawValues) {
-	// Override grid/list displays
-	_, g.list = comps.ListLong[tag]
-	if _, all := comps.ListLong["*"]; all && len(comps.ListLong) == 1 {
-		g.list = true
+	// Grid/list displays
+	layout := eng.layoutFor(comps, tag)
+	g.list = layout == LayoutList
+	g.headers = eng.headersFor(comps, tag)
+	g.insertUnique = eng.insertUniqueFor(comps, tag)
+	g.wrapDescs, _ = forTag(comps.WrapDescriptions, tag)
+
+	if style, found := forTag(comps.HeaderStyles, tag); found {
+		g.headerStyle = color.Fmt(style)
+	} else {
+		g.headerStyle = color.UnquoteRC(eng.config.GetString("completion-header-style"))
 	}
 
 	// Description list separator
@@ -96,8 +135,8 @@ func (g *group) initOptions(eng *Engine, comps *Values, tag string, vals RawValu
 		g.preserveEscapes = comps.Escapes["*"]
 	}
 
-	// Always list long commands when they have descriptions.
-	if strings.HasSuffix(g.tag, "commands") && len(vals) > 0 && vals[0].Description != "" {
+	// Unless specified, always list long commands when they have descriptions.
+	if layout == LayoutAuto && strings.HasSuffix(g.tag, "commands") && len(vals) > 0 && vals[0].Description != "" {
 		g.list = true
 	}
 
@@ -134,10 +173,15 @@ func (g *group) initCompletionsGrid(comps RawValues) {
 		maxColumns = 1
 	}
 
+	if g.maxColumns > 0 && maxColumns > g.maxColumns {
+		maxColumns = g.maxColumns
+	}
+
 	rowCount := int(math.Ceil(float64(len(comps)) / (float64(maxColumns))))
 
 	g.rows = createGrid(comps, rowCount, maxColumns)
 	g.calculateMaxColumnWidths(g.rows)
+	g.wrapDescriptions()
 }
 
 // initCompletionsGrid arranges completions when some of them share the same description.
@@ -195,6 +239,10 @@ func (g *group) wrapExcessAliases(grid [][]Candidate, descriptions []string) {
 		breakeven += width + 1
 	}
 
+	if g.maxColumns > 0 && maxColumns > g.maxColumns {
+		maxColumns = g.maxColumns
+	}
+
 	var rows [][]Candidate
 
 	for rowIndex := range grid {
@@ -220,9 +268,18 @@ func (g *group) prepareValues(vals RawValues) RawValues {
 			value.Display = value.Value
 		}
 
+		if value.Annotation != "" {
+			value.Display += " " + color.Dim + value.Annotation + color.DimReset
+		}
+
+		value = g.truncateDisplay(value)
+
 		// Only pass for colors regex should be here.
-		value.displayLen = len(color.Strip(value.Display))
-		value.descLen = len(color.Strip(value.Description))
+		value.displayLen = uniseg.StringWidth(color.Strip(value.Display))
+		value.descLen = uniseg.StringWidth(color.Strip(value.Description))
+
+		// The selection indicator is part of the candidate width in the grid.
+		value.displayLen += g.indicatorWidth
 
 		if value.displayLen > g.longestValue {
 			g.longestValue = value.displayLen
@@ -289,8 +346,9 @@ func (g *group) calculateMaxColumnWidths(grid [][]Candidate) {
 		}
 	}
 
-	// Last time adjustment: try to reallocate any space modulo to each column.
-	shouldPad := len(grid) > 1 && numColumns > 1 && sum(descriptions) == 0
+	// Last time adjustment: try to reallocate any space modulo to each column,
+	// unless their number is capped, in which case they would be too spread out.
+	shouldPad := len(grid) > 1 && numColumns > 1 && sum(descriptions) == 0 && numColumns != g.maxColumns
 	intraColumnSpace := (numColumns * 2)
 	totalSpaceUsed := sum(values) + sum(descriptions) + intraColumnSpace
 	freeSpace := g.termWidth - totalSpaceUsed
@@ -365,7 +423,7 @@ func (g *group) trimDisplay(comp Candidate, pad, col int) (candidate, padded str
 	val = sanitizer.Replace(val)
 
 	if comp.displayLen > maxDisplayWidth {
-		val = color.Trim(val, maxDisplayWidth-trailingValueLen)
+		val = color.TrimWidth(val, maxDisplayWidth-trailingValueLen-g.indicatorWidth)
 		val += "..." // 3 dots + 1 safety space = -3
 
 		return val, " "
@@ -392,7 +450,7 @@ func (g *group) trimDesc(val Candidate, pad int) (desc, padded string) {
 
 	// Trim the description accounting for escapes.
 	if val.descLen > g.maxDescAllowed && g.maxDescAllowed > 0 {
-		desc = color.Trim(desc, g.maxDescAllowed-trailingDescLen)
+		desc = color.TrimWidth(desc, g.maxDescAllowed-trailingDescLen)
 		desc += "..." // 3 dots =  -3
 
 		return g.listSep() + desc, ""
@@ -447,20 +505,29 @@ func (g *group) updateIsearch(eng *Engine) {
 		return
 	}
 
-	suggs := make([]Candidate, 0)
+	suggs := make(RawValues, 0)
 
 	for i := range g.rows {
 		row := g.rows[i]
 
 		for _, val := range row {
-			if eng.IsearchRegex.MatchString(val.Value) {
+			switch {
+			case eng.isearchRegexMode:
+				suggs = append(suggs, val)
+			case eng.IsearchRegex.MatchString(val.Value):
 				suggs = append(suggs, val)
-			} else if val.Description != "" && eng.IsearchRegex.MatchString(val.Description) {
+			case eng.isearchDescs && val.matchDescription(eng.IsearchRegex.MatchString):
 				suggs = append(suggs, val)
 			}
 		}
 	}
 
+	// In regexp mode, only values are matched against the pattern,
+	// compiled once for all groups when the minibuffer was updated.
+	if eng.isearchRegexMode {
+		suggs = suggs.filterMatching(eng.IsearchRegex)
+	}
+
 	// Reset the group parameters
 	g.rows = make([][]Candidate, 0)
 	g.posX = -1
@@ -1,10 +1,13 @@
 package completion
 
 import (
+	"fmt"
 	"strings"
 
 	"github.com/reeflective/readline/internal/color"
+	"github.com/reeflective/readline/internal/keymap"
 	"github.com/reeflective/readline/internal/term"
+	"github.com/reeflective/readline/internal/ui"
 )
 
 func (e *Engine) hintCompletions(comps Values) {
@@ -14,7 +17,7 @@ func (e *Engine) hintCompletions(comps Values) {
 	// and only if we don't have completions.
 	if len(comps.values) == 0 || e.config.GetBool("usage-hint-always") {
 		if comps.Usage != "" {
-			hint += color.Dim + comps.Usage + color.Reset + term.NewlineReturn
+			hint += e.hint.Format(comps.Usage, ui.HintUsage) + color.Reset + term.NewlineReturn
 		}
 	}
 
@@ -25,25 +28,130 @@ func (e *Engine) hintCompletions(comps Values) {
 	messages = strings.TrimSuffix(messages, term.NewlineReturn)
 
 	if messages != "" {
-		hint = hint + color.Dim + messages
+		hint += e.hint.Format(messages, ui.HintInfo)
 	}
 
 	// If we don't have any completions, and no messages, let's say it.
-	if e.Matches() == 0 && hint == color.Dim+term.NewlineReturn && !e.auto {
-		hint = e.hintNoMatches()
+	// This hint is cleared as soon as the user types another key.
+	noMatches := e.Matches() == 0 && hint == color.Dim+term.NewlineReturn && !e.auto && !e.Streaming()
+
+	if noMatches && !e.hideNoMatch {
+		e.hintBase = ""
+		e.hint.SetTemporary(e.hintNoMatches())
+
+		return
+	} else if noMatches {
+		hint = ""
+	}
+
+	// Completions might still be arriving.
+	if e.Streaming() {
+		hint = e.streamHint() + term.NewlineReturn + hint
 	}
 
 	hint = strings.TrimSuffix(hint, term.NewlineReturn)
+	if hint != "" {
+		hint += color.Reset
+	}
+
+	e.hintBase = hint
+
+	// Add the selected candidate position if any.
+	if len(e.selected.Value) > 0 {
+		e.hintSelection()
+		return
+	}
+
 	if hint == "" {
 		return
 	}
 
 	// Add the hint to the shell.
-	e.hint.Set(hint + color.Reset)
+	e.hint.Set(hint)
+}
+
+// hintSelection appends the position of the currently selected candidate
+// among all of them (and its group tag, if there are several groups) to the
+// completion hint (usage, messages, etc), without overwriting the latter.
+func (e *Engine) hintSelection() {
+	if e.keymap.Local() == keymap.Isearch {
+		return
+	}
+
+	current := e.currentGroup()
+	if current == nil || len(e.selected.Value) == 0 {
+		return
+	}
+
+	var index, total, tags int
+	var selected Candidate
+
+	for _, grp := range e.groups {
+		if len(grp.rows) > 0 {
+			tags++
+		}
+
+		for posY, row := range grp.rows {
+			for posX := range row {
+				total++
+
+				if grp == current && posY == grp.posY && posX == grp.posX {
+					index = total
+					selected = row[posX]
+				}
+			}
+		}
+	}
+
+	position := fmt.Sprintf("candidate %d/%d", index, total)
+
+	if tags > 1 && current.tag != "" {
+		position += " (" + current.tag + ")"
+	}
+
+	hint := e.hint.Format(position, ui.HintInfo) + color.Reset
+
+	// Show the complete display of candidates truncated in the menu.
+	if selected.fullDisplay != "" {
+		hint += term.NewlineReturn + selected.fullDisplay + color.Reset
+	}
+
+	if e.hintBase != "" {
+		hint = e.hintBase + term.NewlineReturn + hint
+	}
+
+	e.hint.Set(hint)
+	e.hintSelected = true
+}
+
+// hintUnselect removes the selected candidate position
+// from the hint, restoring the completion hint if any.
+func (e *Engine) hintUnselect() {
+	if !e.hintSelected {
+		return
+	}
+
+	e.hintSelected = false
+
+	if e.hintBase == "" {
+		e.hint.Reset()
+	} else {
+		e.hint.Set(e.hintBase)
+	}
+}
+
+// SetNoMatchHint enables or disables the hint shown
+// when completions yield no matching candidates.
+func (e *Engine) SetNoMatchHint(enabled bool) {
+	e.hideNoMatch = !enabled
 }
 
 func (e *Engine) hintNoMatches() string {
-	noMatches := color.Dim + "no matching"
+	noMatches := "no matches"
+
+	if e.prefix != "" {
+		noMatches += " for " + e.prefix
+	}
 
 	var groups []string
 
@@ -56,9 +164,8 @@ func (e *Engine) hintNoMatches() string {
 	}
 
 	if len(groups) > 0 {
-		groupsStr := strings.Join(groups, ", ")
-		noMatches += "'" + groupsStr + "'"
+		noMatches += " (" + strings.Join(groups, ", ") + ")"
 	}
 
-	return noMatches + " completions"
+	return e.hint.Format(noMatches, ui.HintInfo)
 }
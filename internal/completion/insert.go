@@ -8,6 +8,24 @@ import (
 	"github.com/reeflective/readline/internal/keymap"
 )
 
+// SetMenuUnique sets whether the menu is shown when there is a single candidate,
+// instead of inserting it right away (the default), for groups for which
+// completions do not specify it.
+func (e *Engine) SetMenuUnique(menu bool) {
+	e.menuUnique = menu
+}
+
+// insertUniqueFor returns whether the only candidate of a group is inserted
+// right away: as specified for its tag, or for all tags, and if none, as
+// the default of the engine.
+func (e *Engine) insertUniqueFor(comps *Values, tag string) bool {
+	if insert, found := forTag(comps.InsertUnique, tag); found {
+		return insert
+	}
+
+	return !e.menuUnique
+}
+
 // UpdateInserted should be called only once in between the two shell keymaps
 // (local/main) in the main readline loop, to either drop or confirm a virtually
 // inserted candidate.
@@ -90,6 +108,11 @@ func (e *Engine) refreshLine() {
 		return
 	}
 
+	// Collapsed groups only have their header selected.
+	if e.currentGroup().collapsed {
+		return
+	}
+
 	// Incremental search is a special case, because the user may
 	// want to keep searching for another match, so we don't drop
 	// the completion list and exit the incremental search mode.
@@ -98,6 +121,7 @@ func (e *Engine) refreshLine() {
 		e.ResetForce()
 	} else {
 		e.insertCandidate()
+		e.hintSelection()
 	}
 }
 
@@ -115,10 +139,13 @@ func (e *Engine) acceptCandidate() {
 	completion := e.prepareSuffix()
 	e.inserted = []rune(completion)
 
-	// Remove the line prefix and insert the candidate.
-	e.cursor.Move(-1 * len(e.prefix))
-	e.line.Cut(e.cursor.Pos(), e.cursor.Pos()+len(e.prefix))
+	// Remove the line prefix (and the Emacs region,
+	// which is then deactivated) and insert the candidate.
+	bpos, epos := e.replacedRange()
+	e.line.Cut(bpos, epos)
+	e.cursor.Set(bpos)
 	e.cursor.InsertAt(e.inserted...)
+	e.selection.Reset()
 
 	// And forget about this inserted completion.
 	e.inserted = make([]rune, 0)
@@ -135,7 +162,7 @@ func (e *Engine) insertCandidate() {
 
 	e.selected = grp.selected()
 
-	if len(e.selected.Value) < len(e.prefix) {
+	if len(e.selected.Value) < len(unquote(e.prefix, grp.quote)) {
 		return
 	}
 
@@ -149,11 +176,11 @@ func (e *Engine) insertCandidate() {
 	e.compLine = &completed
 
 	e.compCursor = core.NewCursor(e.compLine)
-	e.compCursor.Set(e.cursor.Pos())
 
-	// Remove the line prefix and insert the candidate.
-	e.compCursor.Move(-1 * len(e.prefix))
-	e.compLine.Cut(e.compCursor.Pos(), e.compCursor.Pos()+len(e.prefix))
+	// Remove the line prefix (and the Emacs region) and insert the candidate.
+	bpos, epos := e.replacedRange()
+	e.compLine.Cut(bpos, epos)
+	e.compCursor.Set(bpos)
 	e.compCursor.InsertAt(e.inserted...)
 }
 
@@ -165,24 +192,51 @@ func (e *Engine) prepareSuffix() (comp string) {
 		return
 	}
 
-	comp = e.selected.Value
+	comp = quote(e.selected.Value, e.prefix, cur.quote)
 	prefix := len(e.prefix)
 
+	// Values followed by a space are complete: there is no suffix to remove.
+	if cur.addSpace {
+		if spaced := cur.noSpace.AppendSpace(comp); spaced != comp {
+			e.sm = SuffixMatcher{}
+			return spaced
+		}
+	}
+
 	// When the completion has a size of 1, don't remove anything:
 	// stacked flags, for example, will never be inserted otherwise.
-	if len(comp) > 0 && len(comp[prefix:]) <= 1 {
+	if len(comp) > 0 && len(comp)-prefix <= 1 {
 		return
 	}
 
 	// If we are to even consider removing a suffix, we keep the suffix
 	// matcher for later: whatever the decision we take here will be identical
 	// to the one we take while removing suffix in "non-virtual comp" mode.
+	bpos, _ := e.replacedRange()
 	e.sm = cur.noSpace
-	e.sm.pos = e.cursor.Pos() + len(comp) - prefix - 1
+	e.sm.pos = bpos + len(comp) - 1
 
 	return comp
 }
 
+// replacedRange returns the range of the line replaced by an inserted candidate:
+// the completion prefix before the cursor or, in Emacs mode, the active region
+// (set with set-mark, etc) if any, extended to include this prefix.
+func (e *Engine) replacedRange() (bpos, epos int) {
+	bpos, epos = e.cursor.Pos()-len(e.prefix), e.cursor.Pos()
+
+	if !e.keymap.IsEmacs() || !e.selection.Active() {
+		return bpos, epos
+	}
+
+	rbpos, repos := e.selection.Pos()
+	if rbpos == -1 || repos == -1 {
+		return bpos, epos
+	}
+
+	return min(bpos, rbpos), max(epos, repos)
+}
+
 func (e *Engine) cancelCompletedLine() {
 	// The completed line includes any currently selected
 	// candidate, just overwrite it with the normal line.
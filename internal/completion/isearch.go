@@ -2,6 +2,7 @@ package completion
 
 import (
 	"regexp"
+	"strings"
 
 	"github.com/reeflective/readline/internal/color"
 	"github.com/reeflective/readline/internal/core"
@@ -18,8 +19,14 @@ func (e *Engine) IsearchStart(name string, autoinsert, replaceLine bool) {
 	e.isearchStartBuf = string(*e.line)
 	e.isearchStartCursor = e.cursor.Pos()
 
+	// Searching in an open menu keeps the line saved when opening it.
+	if !e.saved {
+		e.SaveLine()
+	}
+
 	e.isearchBuf = new(core.Line)
 	e.isearchCur = core.NewCursor(e.isearchBuf)
+	e.isearchDescs = e.config.GetBool("isearch-descriptions")
 
 	// Prepare all keymaps and modes.
 	e.auto = true
@@ -28,7 +35,69 @@ func (e *Engine) IsearchStart(name string, autoinsert, replaceLine bool) {
 
 	// Hints
 	e.isearchName = name
-	e.hint.Set(color.Bold + color.FgCyan + e.isearchName + " (isearch): " + color.Reset + string(*e.isearchBuf))
+	e.isearchDirected = false
+	e.isearchReversed = false
+	e.isearchErr = nil
+	e.hint.Set(color.Bold + color.FgCyan + e.isearchName + e.isearchLabel(" (isearch)") + ": " + color.Reset + string(*e.isearchBuf))
+}
+
+// IsearchSetDirection gives a direction to the current incremental search,
+// forward if the candidates are ordered from the oldest to the newest ones
+// (like history lines), and backward otherwise. The direction can then be
+// reversed, and is shown in the hint: `(i-search)` or `(reverse-i-search)`.
+func (e *Engine) IsearchSetDirection(forward bool) {
+	if e.keymap.Local() != keymap.Isearch {
+		return
+	}
+
+	e.isearchDirected = true
+	e.isearchForward = forward
+	e.isearchReversed = false
+
+	e.updateIsearchHint()
+}
+
+// IsearchDirection returns true if the current incremental search has a
+// direction, and whether this direction is forward (toward newer matches).
+func (e *Engine) IsearchDirection() (directed, forward bool) {
+	if e.keymap.Local() != keymap.Isearch || !e.isearchDirected {
+		return false, false
+	}
+
+	return true, e.isearchForward != e.isearchReversed
+}
+
+// IsearchReverseDirection reverses the direction of the current incremental
+// search: the next matches are then the previous ones in the candidates list.
+// The currently inserted match is kept, and nothing is done for searches
+// without a direction.
+func (e *Engine) IsearchReverseDirection() {
+	if e.keymap.Local() != keymap.Isearch || !e.isearchDirected {
+		return
+	}
+
+	e.isearchReversed = !e.isearchReversed
+	e.updateIsearchHint()
+}
+
+// IsearchNextMatch inserts the next match in the current direction of the
+// incremental search, or the previous one if next is false. Returns true if
+// the selector has been clamped on the first/last match (see Select()).
+func (e *Engine) IsearchNextMatch(next bool) (clamped bool) {
+	if e.keymap.Local() != keymap.Isearch {
+		return false
+	}
+
+	step := 1
+	if e.isearchReversed {
+		step = -1
+	}
+
+	if !next {
+		step = -step
+	}
+
+	return e.Select(step, 0)
 }
 
 // IsearchStop exists the incremental search mode,
@@ -48,7 +117,14 @@ func (e *Engine) IsearchStop(revertLine bool) {
 
 	e.isearchStartBuf = ""
 	e.isearchStartCursor = 0
+	e.saved = false
 	e.isearchReplaceLine = false
+	e.isearchRegexMode = false
+	e.isearchMatchCase = false
+	e.isearchDirected = false
+	e.isearchReversed = false
+	e.isearchForward = false
+	e.isearchErr = nil
 
 	// And clear all related completion keymaps/modes.
 	e.auto = false
@@ -57,6 +133,28 @@ func (e *Engine) IsearchStop(revertLine bool) {
 	e.resetIsearchInsertMode()
 }
 
+// IsearchToggleDescriptions toggles matching the incremental search minibuffer
+// against candidates descriptions and display strings, in addition to values.
+// This is only valid for the current search session.
+func (e *Engine) IsearchToggleDescriptions() {
+	if e.keymap.Local() != keymap.Isearch {
+		return
+	}
+
+	e.isearchDescs = !e.isearchDescs
+	e.updateIncrementalSearch()
+}
+
+// IsearchMatchCase forces the current incremental search to match
+// case-sensitively, even if the minibuffer has no uppercase letters.
+func (e *Engine) IsearchMatchCase() {
+	if e.keymap.Local() != keymap.Isearch {
+		return
+	}
+
+	e.isearchMatchCase = true
+}
+
 // GetBuffer returns the correct input line buffer (and its cursor/
 // selection) depending on the context and active components:
 // - If in non/incremental-search mode, the minibuffer.
@@ -80,6 +178,20 @@ func (e *Engine) GetBuffer() (*core.Line, *core.Cursor, *core.Selection) {
 	return e.line, e.cursor, e.selection
 }
 
+// IsearchHighlight returns the incremental search pattern to highlight
+// in the input line, if a candidate is currently inserted in it, or nil.
+func (e *Engine) IsearchHighlight() *regexp.Regexp {
+	if e.keymap.Local() != keymap.Isearch || e.IsearchRegex == nil {
+		return nil
+	}
+
+	if e.isearchBuf.Len() == 0 || len(e.selected.Value) == 0 {
+		return nil
+	}
+
+	return e.IsearchRegex
+}
+
 // UpdateIsearch recompiles the isearch buffer as a regex and
 // filters matching candidates in the available completions.
 func (e *Engine) UpdateIsearch() {
@@ -154,18 +266,21 @@ func (e *Engine) NonIncrementallySearching() (searching, forward, substring bool
 
 func (e *Engine) updateIncrementalSearch() {
 	var regexStr string
-	if hasUpper(*e.isearchBuf) {
+
+	// A leading slash matches candidate values against the rest
+	// of the minibuffer, as a regular expression, and nothing else.
+	e.isearchRegexMode = strings.HasPrefix(string(*e.isearchBuf), "/")
+
+	switch {
+	case e.isearchRegexMode:
+		regexStr = string((*e.isearchBuf)[1:])
+	case e.isearchMatchCase, hasUpper(*e.isearchBuf):
 		regexStr = string(*e.isearchBuf)
-	} else {
+	default:
 		regexStr = "(?i)" + string(*e.isearchBuf)
 	}
 
-	var err error
-	e.IsearchRegex, err = regexp.Compile(regexStr)
-
-	if err != nil {
-		e.hint.Set(color.FgRed + "Failed to compile i-search regexp")
-	}
+	e.IsearchRegex, e.isearchErr = regexp.Compile(regexStr)
 
 	// Refresh completions with the current minibuffer as a filter.
 	e.GenerateWith(e.cached)
@@ -176,15 +291,7 @@ func (e *Engine) updateIncrementalSearch() {
 	}
 
 	// Update the hint section.
-	isearchHint := color.Bold + color.FgCyan + e.isearchName + " (inc-search)"
-
-	if e.Matches() == 0 {
-		isearchHint += color.Reset + color.Bold + color.FgRed + " (no matches)"
-	}
-
-	isearchHint += ": " + color.Reset + color.Bold + string(*e.isearchBuf) + color.Reset + "_"
-
-	e.hint.Set(isearchHint)
+	e.updateIsearchHint()
 
 	// And update the inserted candidate if autoinsert is enabled.
 	if e.isearchInsert && e.Matches() > 0 && e.isearchBuf.Len() > 0 {
@@ -203,6 +310,42 @@ func (e *Engine) updateIncrementalSearch() {
 	}
 }
 
+// updateIsearchHint shows the incremental search minibuffer in the hint,
+// along with the search direction and status (invalid regexp, no matches).
+func (e *Engine) updateIsearchHint() {
+	isearchHint := color.Bold + color.FgCyan + e.isearchName + e.isearchLabel(" (inc-search)")
+
+	if e.isearchDescs && !e.isearchRegexMode {
+		isearchHint += color.Reset + color.Dim + " (+descriptions)"
+	}
+
+	switch {
+	case e.isearchErr != nil:
+		isearchHint += color.Reset + color.FgRed + " (invalid regexp: " + e.isearchErr.Error() + ")"
+	case e.Matches() == 0:
+		isearchHint += color.Reset + color.Bold + color.FgRed + " (no matches)"
+	}
+
+	isearchHint += ": " + color.Reset + color.Bold + string(*e.isearchBuf) + color.Reset + "_"
+
+	e.hint.Set(isearchHint)
+}
+
+// isearchLabel returns the direction of the incremental
+// search if it has one, or the given default label.
+func (e *Engine) isearchLabel(label string) string {
+	directed, forward := e.IsearchDirection()
+
+	switch {
+	case !directed:
+		return label
+	case forward:
+		return " (i-search)"
+	default:
+		return " (reverse-i-search)"
+	}
+}
+
 func (e *Engine) updateNonIncrementalSearch() {
 	isearchHint := color.Bold + color.FgCyan + e.isearchName +
 		" (non-inc-search): " + color.Reset + color.Bold + string(*e.isearchBuf) + color.Reset + "_"
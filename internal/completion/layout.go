@@ -0,0 +1,303 @@
+package completion
+
+import (
+	"strings"
+
+	"github.com/rivo/uniseg"
+
+	"github.com/reeflective/readline/internal/color"
+)
+
+// Layout is the way the candidates of a group are arranged in the completion menu.
+type Layout int
+
+const (
+	// LayoutAuto arranges candidates in a grid, except for commands
+	// with descriptions, which are listed one per line (default).
+	LayoutAuto Layout = iota
+	// LayoutList lists candidates one per line, with their descriptions.
+	LayoutList
+	// LayoutGrid arranges candidates in as many columns as the terminal width allows.
+	LayoutGrid
+)
+
+// Headers is whether the tags of groups are displayed as headers above their candidates.
+type Headers int
+
+const (
+	// HeadersAuto displays headers only when there are several groups (default).
+	HeadersAuto Headers = iota
+	// HeadersAlways displays headers, even for a single group.
+	HeadersAlways
+	// HeadersNever does not display headers, except for collapsed groups.
+	HeadersNever
+)
+
+// SetLayout sets the layout used by groups for which completions do not specify one.
+func (e *Engine) SetLayout(layout Layout) {
+	e.layout = layout
+}
+
+// SetMaxColumns caps the number of columns of candidates in the menu, whatever
+// the terminal width: a value <= 0 uses as many columns as the width allows.
+func (e *Engine) SetMaxColumns(columns int) {
+	e.maxColumns = columns
+}
+
+// SetMaxDisplayWidth sets the maximum number of terminal columns used by candidates
+// displays in the menu: longer ones are truncated with an ellipsis. The full display
+// is shown in the hint when the candidate is selected. A width <= 0 disables this.
+func (e *Engine) SetMaxDisplayWidth(width int) {
+	e.maxDisplay = width
+}
+
+// SetIndicator sets a string printed before the selected candidate in the menu,
+// in the given style (cterm color codes), while other candidates are preceded by
+// as many spaces, so that columns stay aligned. If only is true, the indicator
+// replaces the selected candidate highlighting instead of being added to it.
+// An empty indicator disables it, along with only.
+func (e *Engine) SetIndicator(indicator, style string, only bool) {
+	e.indicator = indicator
+	e.indStyle = style
+	e.indOnly = only && indicator != ""
+}
+
+// SetPreview enables or disables the preview of the selected candidate full
+// description (possibly on several lines), printed below the completion menu.
+func (e *Engine) SetPreview(enabled bool) {
+	e.preview = enabled
+}
+
+// SetTabWidth sets the number of columns between tab stops, used to expand
+// the tabs of the selected candidate description in its preview.
+func (e *Engine) SetTabWidth(width int) {
+	e.tabWidth = width
+}
+
+// SetHeaders sets the visibility of headers for groups for which completions do not specify one.
+func (e *Engine) SetHeaders(headers Headers) {
+	e.headers = headers
+}
+
+// layoutFor returns the layout of a group: the one specified for its tag,
+// or for all tags, and if none, the default layout of the engine.
+func (e *Engine) layoutFor(comps *Values, tag string) Layout {
+	if layout, found := comps.Layouts[tag]; found {
+		return layout
+	}
+
+	if layout, found := comps.Layouts["*"]; found {
+		return layout
+	}
+
+	return e.layout
+}
+
+// headersFor returns the header visibility of a group: the one specified
+// for its tag, or for all tags, and if none, the default of the engine.
+func (e *Engine) headersFor(comps *Values, tag string) Headers {
+	if headers, found := comps.Headers[tag]; found {
+		return headers
+	}
+
+	if headers, found := comps.Headers["*"]; found {
+		return headers
+	}
+
+	return e.headers
+}
+
+// hasHeader returns true if the group tag is displayed above its candidates.
+// Collapsed groups always have one, since they are only shown as their header.
+func (e *Engine) hasHeader(grp *group) bool {
+	if grp.tag == "" {
+		return false
+	}
+
+	switch {
+	case grp.collapsed, grp.headers == HeadersAlways:
+		return true
+	case grp.headers == HeadersNever:
+		return false
+	}
+
+	groups := 0
+
+	for _, other := range e.groups {
+		if len(other.rows) > 0 {
+			groups++
+		}
+	}
+
+	return groups > 1
+}
+
+// truncateDisplay truncates the candidate display to the maximum display width
+// of the group (if any), with an ellipsis, and keeps the full display aside.
+func (g *group) truncateDisplay(value Candidate) Candidate {
+	if g.maxDisplay <= 0 || uniseg.StringWidth(color.Strip(value.Display)) <= g.maxDisplay {
+		return value
+	}
+
+	value.fullDisplay = value.Display
+	value.Display = color.TrimWidth(value.Display, g.maxDisplay-1) + color.Reset + "…"
+
+	return value
+}
+
+// relayout arranges the group candidates again for a new terminal width,
+// keeping the currently selected candidate (if any) selected.
+func (g *group) relayout(width int) {
+	var selected Candidate
+	if g.posX != -1 && g.posY != -1 {
+		selected = g.rows[g.posY][g.posX]
+	}
+
+	values := make(RawValues, 0)
+	for _, row := range g.rows {
+		values = append(values, row...)
+	}
+
+	g.rows = make([][]Candidate, 0)
+	g.columnsWidth = []int{0}
+	g.descriptionsWidth = nil
+	g.aliased = false
+	g.termWidth = width
+
+	if completionsAreAliases(values) {
+		g.initCompletionAliased(values)
+	} else {
+		g.initCompletionsGrid(values)
+	}
+
+	if selected.Value == "" {
+		return
+	}
+
+	for posY, row := range g.rows {
+		for posX, candidate := range row {
+			if candidate.Value == selected.Value && candidate.Display == selected.Display {
+				g.posX, g.posY = posX, posY
+				return
+			}
+		}
+	}
+}
+
+// wrapDescriptions splits the descriptions of the group which are too long to fit
+// on their row into as many lines as needed, by display width. Only list layouts
+// are wrapped, and only if the completions asked for it: the first line is shown
+// on the candidate row, and the others on continuation lines below it.
+func (g *group) wrapDescriptions() {
+	g.wrapped = nil
+
+	if !g.wrapDescs || !g.list || g.aliased || len(g.descriptionsWidth) == 0 {
+		return
+	}
+
+	width := g.setMaximumSizes(0)
+	if width <= 0 {
+		return
+	}
+
+	for row, candidates := range g.rows {
+		if len(candidates) == 0 || candidates[0].descLen <= width {
+			continue
+		}
+
+		if g.wrapped == nil {
+			g.wrapped = make([][]string, len(g.rows))
+		}
+
+		g.wrapped[row] = wrapWords(color.Strip(candidates[0].Description), width)
+	}
+}
+
+// continuations returns the number of continuation lines
+// used by the wrapped description of a row, if any.
+func (g *group) continuations(row int) int {
+	if row >= len(g.wrapped) || len(g.wrapped[row]) < 2 {
+		return 0
+	}
+
+	return len(g.wrapped[row]) - 1
+}
+
+// lines returns the number of terminal lines used by the first
+// rows of the group, continuation lines of descriptions included.
+func (g *group) lines(rows int) int {
+	lines := rows
+
+	for row := 0; row < rows && row < len(g.wrapped); row++ {
+		lines += g.continuations(row)
+	}
+
+	return lines
+}
+
+// rowAt returns the row of the group displayed at a line (relative to the
+// first row of the group), or false if this line is a continuation line.
+func (g *group) rowAt(line int) (row int, found bool) {
+	if g.wrapped == nil {
+		return line, line < len(g.rows)
+	}
+
+	for row = range g.rows {
+		if line == 0 {
+			return row, true
+		}
+
+		if line <= g.continuations(row) {
+			return row, false
+		}
+
+		line -= 1 + g.continuations(row)
+	}
+
+	return 0, false
+}
+
+// wrapWords splits a text into lines of at most width terminal columns,
+// breaking them between words, or within words longer than a line.
+func wrapWords(text string, width int) (lines []string) {
+	var line strings.Builder
+
+	lineWidth := 0
+
+	for _, word := range strings.Fields(text) {
+		wordWidth := uniseg.StringWidth(word)
+
+		if lineWidth > 0 && lineWidth+1+wordWidth > width {
+			lines = append(lines, line.String())
+			line.Reset()
+
+			lineWidth = 0
+		}
+
+		if lineWidth > 0 {
+			line.WriteString(" ")
+			lineWidth++
+		}
+
+		// Words longer than a line are broken where needed.
+		for _, char := range word {
+			charWidth := uniseg.StringWidth(string(char))
+
+			if lineWidth > 0 && lineWidth+charWidth > width {
+				lines = append(lines, line.String())
+				line.Reset()
+
+				lineWidth = 0
+			}
+
+			line.WriteRune(char)
+			lineWidth += charWidth
+		}
+	}
+
+	if line.Len() > 0 {
+		lines = append(lines, line.String())
+	}
+
+	return lines
+}
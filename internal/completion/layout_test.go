@@ -0,0 +1,54 @@
+package completion
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWrapWords(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		width int
+		want  []string
+	}{
+		{
+			name:  "Short text",
+			text:  "fits on a line",
+			width: 20,
+			want:  []string{"fits on a line"},
+		},
+		{
+			name:  "Break between words",
+			text:  "show the working tree status",
+			width: 12,
+			want:  []string{"show the", "working tree", "status"},
+		},
+		{
+			name:  "Break within long words",
+			text:  "see https://example.com/a/long/path",
+			width: 10,
+			want:  []string{"see", "https://ex", "ample.com/", "a/long/pat", "h"},
+		},
+		{
+			name:  "Wide characters",
+			text:  "日本語の説明",
+			width: 5,
+			want:  []string{"日本", "語の", "説明"},
+		},
+		{
+			name:  "Newlines and spaces",
+			text:  "first line\n  second\tline",
+			width: 11,
+			want:  []string{"first line", "second line"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := wrapWords(test.text, test.width); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("wrapWords() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
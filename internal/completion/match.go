@@ -0,0 +1,115 @@
+package completion
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/reeflective/readline/internal/color"
+)
+
+// MatchMode is the way candidates are matched against the word being completed.
+type MatchMode int
+
+const (
+	// MatchPrefix keeps candidates whose values start with the word (default).
+	MatchPrefix MatchMode = iota
+	// MatchSubstring keeps candidates whose values contain the word anywhere.
+	MatchSubstring
+	// MatchFuzzy keeps candidates whose values contain all the characters
+	// of the word, in the same order but not necessarily contiguous.
+	MatchFuzzy
+)
+
+// filterMatch filters the values matching the prefix with the given mode.
+func filterMatch(values RawValues, prefix string, mode MatchMode, matchCase bool) RawValues {
+	switch mode {
+	case MatchSubstring:
+		return values.FilterSubstring(prefix, matchCase)
+	case MatchFuzzy:
+		return values.FilterFuzzy(prefix, matchCase)
+	default:
+		return values.FilterPrefix(prefix, matchCase)
+	}
+}
+
+// isFuzzyMatch returns true if all runes of the pattern
+// are found in the value, in the same order.
+func isFuzzyMatch(value, pattern string) bool {
+	runes := []rune(pattern)
+
+	for _, char := range value {
+		if len(runes) == 0 {
+			break
+		}
+
+		if char == runes[0] {
+			runes = runes[1:]
+		}
+	}
+
+	return len(runes) == 0
+}
+
+// highlightMatch highlights the parts of a candidate display matching the
+// completed word, according to the match mode: the word itself when matching
+// prefixes or substrings, or each of its characters when fuzzy-matching.
+func highlightMatch(candidate, word string, mode MatchMode, matchCase bool, reset string) string {
+	if word == "" {
+		return candidate
+	}
+
+	highlight := func(match string) string {
+		return color.Bold + color.FgBlue + match + color.BoldReset + color.FgDefault + reset
+	}
+
+	if mode == MatchFuzzy {
+		return highlightFuzzy(candidate, word, matchCase, highlight)
+	}
+
+	pattern := regexp.QuoteMeta(word)
+	if !matchCase {
+		pattern = "(?i)" + pattern
+	}
+
+	if mode == MatchPrefix {
+		pattern = "^" + pattern
+	}
+
+	matcher, err := regexp.Compile(pattern)
+	if err != nil {
+		return candidate
+	}
+
+	loc := matcher.FindStringIndex(candidate)
+	if loc == nil {
+		return candidate
+	}
+
+	return candidate[:loc[0]] + highlight(candidate[loc[0]:loc[1]]) + candidate[loc[1]:]
+}
+
+// highlightFuzzy highlights each character of the candidate fuzzy-matching the word.
+func highlightFuzzy(candidate, word string, matchCase bool, highlight func(string) string) string {
+	var highlighted strings.Builder
+
+	runes := []rune(word)
+
+	for _, char := range candidate {
+		if len(runes) > 0 && (char == runes[0] || !matchCase && unicode.ToLower(char) == unicode.ToLower(runes[0])) {
+			highlighted.WriteString(highlight(string(char)))
+			runes = runes[1:]
+
+			continue
+		}
+
+		highlighted.WriteRune(char)
+	}
+
+	// Don't highlight anything if not all characters matched.
+	if len(runes) > 0 {
+		return candidate
+	}
+
+	return highlighted.String()
+}
@@ -0,0 +1,109 @@
+package completion
+
+import (
+	"strings"
+)
+
+// QuoteStyle is the style used to quote/escape the candidates inserted in the line,
+// when their values contain spaces or other shell metacharacters.
+type QuoteStyle int
+
+const (
+	// QuoteNone inserts candidates values verbatim (default).
+	QuoteNone QuoteStyle = iota
+	// QuoteSingle encloses values in single quotes: 'my file'.
+	QuoteSingle
+	// QuoteDouble encloses values in double quotes: "my file".
+	QuoteDouble
+	// QuoteBackslash escapes each metacharacter with a backslash: my\ file.
+	QuoteBackslash
+)
+
+// metaChars are the characters requiring candidate values to be quoted.
+const metaChars = " \t\n'\"\\$`|&;()<>*?[]{}!#"
+
+// quote returns the value quoted with the given style, if it needs to be.
+// If the prefix (what is being replaced in the line) starts with a quote,
+// the value is enclosed in the same quotes, since the user already quoted it.
+func quote(value, prefix string, style QuoteStyle) string {
+	if style == QuoteNone {
+		return value
+	}
+
+	switch {
+	case strings.HasPrefix(prefix, "'"):
+		style = QuoteSingle
+	case strings.HasPrefix(prefix, "\""):
+		style = QuoteDouble
+	case !strings.ContainsAny(value, metaChars):
+		return value
+	}
+
+	switch style {
+	case QuoteSingle:
+		return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+
+	case QuoteDouble:
+		escaper := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`")
+		return "\"" + escaper.Replace(value) + "\""
+
+	default:
+		var escaped strings.Builder
+
+		for _, char := range value {
+			if strings.ContainsRune(metaChars, char) {
+				escaped.WriteRune('\\')
+			}
+
+			escaped.WriteRune(char)
+		}
+
+		return escaped.String()
+	}
+}
+
+// unquote returns the prefix without its quotes or escaping backslashes,
+// so that it can be matched against the unquoted values of candidates.
+// Quotes may be left open, and a trailing backslash escapes nothing yet.
+func unquote(prefix string, style QuoteStyle) string {
+	if style == QuoteNone || prefix == "" {
+		return prefix
+	}
+
+	var unquoted strings.Builder
+
+	runes := []rune(prefix)
+	quoting := rune(0)
+
+	for pos := 0; pos < len(runes); pos++ {
+		char := runes[pos]
+
+		switch {
+		case quoting == '\'' && char == '\'':
+			quoting = 0
+		case quoting == '\'':
+			unquoted.WriteRune(char)
+		case char == '\\':
+			if pos+1 == len(runes) {
+				break
+			}
+
+			// In double quotes, only some characters can be escaped.
+			if quoting == '"' && !strings.ContainsRune("\\\"$`", runes[pos+1]) {
+				unquoted.WriteRune(char)
+				break
+			}
+
+			pos++
+			unquoted.WriteRune(runes[pos])
+		case quoting == 0 && (char == '\'' || char == '"'):
+			quoting = char
+		case quoting == '"' && char == '"':
+			quoting = 0
+		default:
+			unquoted.WriteRune(char)
+		}
+	}
+
+	return unquoted.String()
+}
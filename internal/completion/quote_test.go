@@ -0,0 +1,95 @@
+package completion
+
+import "testing"
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  string
+		prefix string
+		style  QuoteStyle
+		want   string
+	}{
+		// No quoting
+		{name: "None, spaces", value: "my file", style: QuoteNone, want: "my file"},
+		{name: "None, quoted prefix", value: "my file", prefix: "'my", style: QuoteNone, want: "my file"},
+
+		// Single quotes
+		{name: "Single, plain", value: "main.go", style: QuoteSingle, want: "main.go"},
+		{name: "Single, spaces", value: "my file", style: QuoteSingle, want: "'my file'"},
+		{name: "Single, embedded single quote", value: "it's", style: QuoteSingle, want: `'it'\''s'`},
+		{name: "Single, embedded double quote", value: `say "hi"`, style: QuoteSingle, want: `'say "hi"'`},
+		{name: "Single, backslash", value: `a\b`, style: QuoteSingle, want: `'a\b'`},
+		{name: "Single, metacharacters", value: "$HOME;ls", style: QuoteSingle, want: "'$HOME;ls'"},
+		{name: "Single, open double quote", value: "my file", prefix: `"my`, style: QuoteSingle, want: `"my file"`},
+
+		// Double quotes
+		{name: "Double, plain", value: "main.go", style: QuoteDouble, want: "main.go"},
+		{name: "Double, spaces", value: "my file", style: QuoteDouble, want: `"my file"`},
+		{name: "Double, embedded double quote", value: `say "hi"`, style: QuoteDouble, want: `"say \"hi\""`},
+		{name: "Double, embedded single quote", value: "it's", style: QuoteDouble, want: `"it's"`},
+		{name: "Double, backslash", value: `a\b`, style: QuoteDouble, want: `"a\\b"`},
+		{name: "Double, metacharacters", value: "$HOME `id`", style: QuoteDouble, want: "\"\\$HOME \\`id\\`\""},
+		{name: "Double, open single quote", value: "it's", prefix: "'it", style: QuoteDouble, want: `'it'\''s'`},
+
+		// Backslashes
+		{name: "Backslash, plain", value: "main.go", style: QuoteBackslash, want: "main.go"},
+		{name: "Backslash, spaces", value: "my file", style: QuoteBackslash, want: `my\ file`},
+		{name: "Backslash, embedded quotes", value: `it's "x"`, style: QuoteBackslash, want: `it\'s\ \"x\"`},
+		{name: "Backslash, backslash", value: `a\b`, style: QuoteBackslash, want: `a\\b`},
+		{name: "Backslash, metacharacters", value: "a&b|c*", style: QuoteBackslash, want: `a\&b\|c\*`},
+		{name: "Backslash, open single quote", value: "my file", prefix: "'my", style: QuoteBackslash, want: "'my file'"},
+		{name: "Backslash, open double quote", value: "main.go", prefix: `"ma`, style: QuoteBackslash, want: `"main.go"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := quote(test.value, test.prefix, test.style); got != test.want {
+				t.Errorf("quote(%q, %q) = %s, want %s", test.value, test.prefix, got, test.want)
+			}
+		})
+	}
+}
+
+func TestUnquote(t *testing.T) {
+	tests := []struct {
+		name   string
+		prefix string
+		style  QuoteStyle
+		want   string
+	}{
+		{name: "None", prefix: `'my\ fi`, style: QuoteNone, want: `'my\ fi`},
+		{name: "Empty", prefix: "", style: QuoteSingle, want: ""},
+
+		// Single quotes
+		{name: "Single, open quote", prefix: "'my fi", style: QuoteSingle, want: "my fi"},
+		{name: "Single, closed quote", prefix: "'my file'", style: QuoteSingle, want: "my file"},
+		{name: "Single, embedded single quote", prefix: `'it'\''s`, style: QuoteSingle, want: "it's"},
+		{name: "Single, partial embedded quote", prefix: `'it'\`, style: QuoteSingle, want: "it"},
+		{name: "Single, backslash", prefix: `'a\b`, style: QuoteSingle, want: `a\b`},
+		{name: "Single, metacharacters", prefix: "'$HOME;", style: QuoteSingle, want: "$HOME;"},
+
+		// Double quotes
+		{name: "Double, open quote", prefix: `"my fi`, style: QuoteDouble, want: "my fi"},
+		{name: "Double, embedded double quote", prefix: `"say \"h`, style: QuoteDouble, want: `say "h`},
+		{name: "Double, embedded single quote", prefix: `"it's`, style: QuoteDouble, want: "it's"},
+		{name: "Double, backslash", prefix: `"a\\b`, style: QuoteDouble, want: `a\b`},
+		{name: "Double, literal backslash", prefix: `"a\b`, style: QuoteDouble, want: `a\b`},
+		{name: "Double, metacharacters", prefix: `"\$HOME`, style: QuoteDouble, want: "$HOME"},
+
+		// Backslashes
+		{name: "Backslash, spaces", prefix: `my\ fi`, style: QuoteBackslash, want: "my fi"},
+		{name: "Backslash, embedded quotes", prefix: `it\'s\ \"`, style: QuoteBackslash, want: `it's "`},
+		{name: "Backslash, backslash", prefix: `a\\b`, style: QuoteBackslash, want: `a\b`},
+		{name: "Backslash, trailing backslash", prefix: `my\`, style: QuoteBackslash, want: "my"},
+		{name: "Backslash, quote in the word", prefix: `my' fi`, style: QuoteBackslash, want: "my fi"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := unquote(test.prefix, test.style); got != test.want {
+				t.Errorf("unquote(%q) = %q, want %q", test.prefix, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package completion
+
+import (
+	"time"
+
+	"github.com/reeflective/readline/internal/color"
+	"github.com/reeflective/readline/internal/keymap"
+	"github.com/reeflective/readline/internal/ui"
+)
+
+// Streamer is a function generating completions asynchronously.
+// Batches of completions are sent on the returned channel as soon
+// as they are produced, and the channel must be closed when done,
+// or as soon as the done channel is closed (completions not needed).
+type Streamer func(done <-chan struct{}) <-chan Values
+
+// DefaultSpinnerFrames are used to show that completions are being fetched.
+var DefaultSpinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// spinnerInterval is the time between each spinner frame refresh.
+const spinnerInterval = 100 * time.Millisecond
+
+// Stream starts generating completions in the background with a streamer,
+// after cancelling any stream still in progress, and returns the completions
+// received so far (thus none). Each batch of completions received is merged
+// with the previous ones, and the completion menu is regenerated and refreshed
+// on the fly, while it can still be used normally (selecting candidates, etc).
+func (e *Engine) Stream(streamer Streamer) Values {
+	e.cancelStream()
+
+	done := make(chan struct{})
+	batches := e.startStreamer(streamer, done)
+
+	e.stream = done
+	e.streamed = Values{}
+	e.streamFrame = 0
+
+	// Any regeneration of the completions (autocomplete, etc)
+	// must use those received so far, not start a new stream.
+	e.cached = func() Values { return e.streamed }
+
+	go e.receiveStream(done, batches)
+
+	return e.streamed
+}
+
+// startStreamer starts a streamer and returns its stream of completions. If the
+// streamer panics, the stream only sends the completions notifying the panic.
+func (e *Engine) startStreamer(streamer Streamer, done <-chan struct{}) (batches <-chan Values) {
+	defer func() {
+		if err := recover(); err != nil {
+			failed := make(chan Values, 1)
+			failed <- recovered(err, e.onError)
+			close(failed)
+
+			batches = failed
+		}
+	}()
+
+	return streamer(done)
+}
+
+// SetSpinner sets the frames of the spinner shown in the hint while completions
+// are being fetched, and the time after which blocking completers are awaited
+// in the background (a threshold <= 0 always waits for them in the foreground).
+func (e *Engine) SetSpinner(frames []string, threshold time.Duration) {
+	if len(frames) == 0 {
+		frames = DefaultSpinnerFrames
+	}
+
+	e.spinnerFrames = frames
+	e.spinnerThreshold = threshold
+}
+
+// Await calls a blocking completer in the background and returns its completions
+// if they are produced within the spinner threshold. Otherwise, the completions
+// are streamed instead, so that the spinner is shown and the shell keeps reading
+// input while waiting for them, and the completions received so far (none) are
+// returned. Since it might run in the background, the completer must not access
+// the line being edited, nor the engine itself.
+func (e *Engine) Await(completer Completer) Values {
+	// Panics must be recovered in the goroutine running the completer.
+	completer = Recover(completer, e.onError)
+
+	if e.spinnerThreshold <= 0 {
+		return completer()
+	}
+
+	results := make(chan Values, 1)
+
+	go func() { results <- completer() }()
+
+	select {
+	case values := <-results:
+		return values
+	case <-time.After(e.spinnerThreshold):
+	}
+
+	return e.Stream(func(done <-chan struct{}) <-chan Values {
+		batches := make(chan Values)
+
+		go func() {
+			defer close(batches)
+
+			select {
+			case values := <-results:
+				select {
+				case batches <- values:
+				case <-done:
+				}
+			case <-done:
+			}
+		}()
+
+		return batches
+	})
+}
+
+// Streaming returns true if completions are currently being streamed.
+func (e *Engine) Streaming() bool {
+	return e.stream != nil
+}
+
+// receiveStream reads batches of completions in the background, and
+// queues them to be merged into the current ones by the main loop.
+func (e *Engine) receiveStream(done chan struct{}, batches <-chan Values) {
+	spinner := time.NewTicker(spinnerInterval)
+	defer spinner.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+
+		case <-spinner.C:
+			e.keys.Queue(func() { e.refreshSpinner(done) })
+
+		case values, open := <-batches:
+			e.keys.Queue(func() { e.mergeStream(done, values, open) })
+
+			if !open {
+				return
+			}
+		}
+	}
+}
+
+// mergeStream merges a batch of completions with those already received,
+// and regenerates the completion groups without losing any current selection.
+func (e *Engine) mergeStream(done chan struct{}, values Values, open bool) {
+	// Batches of a cancelled stream might have
+	// been queued before it has been cancelled.
+	if e.stream != done {
+		return
+	}
+
+	if open {
+		e.streamed.Merge(values)
+	} else {
+		e.stream = nil
+	}
+
+	// The user might have dropped the completion menu
+	// while waiting for the completions to arrive.
+	if !e.IsActive() {
+		e.cancelStream()
+		return
+	}
+
+	selected := e.selected
+
+	e.prepare(e.streamed)
+	e.restoreSelection(selected)
+
+	if e.noCompletions() && !e.Streaming() {
+		e.ClearMenu(true)
+	}
+}
+
+// refreshSpinner updates the streaming spinner in the hint area.
+func (e *Engine) refreshSpinner(done chan struct{}) {
+	if e.stream != done {
+		return
+	}
+
+	e.streamFrame++
+	e.hintCompletions(e.streamed)
+}
+
+// streamHint returns the hint spinner to show while streaming.
+func (e *Engine) streamHint() string {
+	frames := e.spinnerFrames
+	if len(frames) == 0 {
+		frames = DefaultSpinnerFrames
+	}
+
+	frame := frames[e.streamFrame%len(frames)]
+
+	return e.hint.Format(frame+" fetching completions...", ui.HintInfo) + color.Reset
+}
+
+// cancelStream stops any completion stream still in progress.
+func (e *Engine) cancelStream() {
+	if e.stream == nil {
+		return
+	}
+
+	close(e.stream)
+	e.stream = nil
+}
+
+// restoreSelection selects a candidate again after
+// the completion groups have been regenerated.
+func (e *Engine) restoreSelection(selected Candidate) {
+	if selected.Value == "" {
+		return
+	}
+
+	// Ensure the completion keymaps are still set.
+	if e.keymap.Local() != keymap.Isearch {
+		e.keymap.SetLocal(keymap.MenuSelect)
+	}
+
+	for _, grp := range e.groups {
+		grp.isCurrent = false
+	}
+
+	for _, grp := range e.groups {
+		for posY, row := range grp.rows {
+			for posX, candidate := range row {
+				if candidate.Value != selected.Value || candidate.Tag != selected.Tag {
+					continue
+				}
+
+				grp.isCurrent = true
+				grp.posX, grp.posY = posX, posY
+
+				return
+			}
+		}
+	}
+}
@@ -49,6 +49,16 @@ func (sm SuffixMatcher) Matches(s string) bool {
 	return false
 }
 
+// AppendSpace returns the value followed by a space, unless it already ends
+// with a space, or with one of the suffixes (or the matcher has a wildcard).
+func (sm SuffixMatcher) AppendSpace(value string) string {
+	if value == "" || strings.HasSuffix(value, " ") || sm.Matches(value) {
+		return value
+	}
+
+	return value + " "
+}
+
 type byRune []rune
 
 func (r byRune) Len() int           { return len(r) }
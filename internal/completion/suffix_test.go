@@ -0,0 +1,32 @@
+package completion
+
+import "testing"
+
+func TestSuffixMatcher_AppendSpace(t *testing.T) {
+	var paths, all, none SuffixMatcher
+
+	paths.Add('/', '=')
+	all.Add('*')
+
+	tests := []struct {
+		name    string
+		matcher SuffixMatcher
+		value   string
+		want    string
+	}{
+		{name: "Directory", matcher: paths, value: "src/", want: "src/"},
+		{name: "File", matcher: paths, value: "main.go", want: "main.go "},
+		{name: "Flag with value", matcher: paths, value: "--color=", want: "--color="},
+		{name: "Already spaced", matcher: paths, value: "main.go ", want: "main.go "},
+		{name: "No rules", matcher: none, value: "src/", want: "src/ "},
+		{name: "Global NoSpace", matcher: all, value: "main.go", want: "main.go"},
+		{name: "Empty value", matcher: none, value: "", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.matcher.AppendSpace(tt.value); got != tt.want {
+				t.Errorf("AppendSpace() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,8 +1,9 @@
 package completion
 
 import (
+	"unicode"
+
 	"github.com/reeflective/readline/internal/core"
-	"github.com/reeflective/readline/internal/strutil"
 )
 
 // CompleteSyntax updates the line with either user-defined syntax completers, or with the builtin ones.
@@ -25,44 +26,75 @@ func (e *Engine) CompleteSyntax(completer func([]rune, int) ([]rune, int)) {
 	e.cursor.Set(newPos)
 }
 
+// DefaultAutopairs are the pairs of characters inserted together by default.
+var DefaultAutopairs = map[rune]rune{
+	'(':  ')',
+	'[':  ']',
+	'{':  '}',
+	'"':  '"',
+	'\'': '\'',
+	'`':  '`',
+}
+
 // AutopairInsertOrJump checks if the character to be inserted in the line is a pair character.
-// If the character is an opening one, its inserted along with its closing equivalent.
-// If it's a closing one and the next character in line is the same, the cursor jumps over it.
-func AutopairInsertOrJump(key rune, line *core.Line, cur *core.Cursor) (skipInsert bool) {
-	matcher, closer := strutil.SurroundType(key)
+// If the character is an opening one, its closing equivalent is inserted after the cursor,
+// unless the next character is a word one. If it's a closing one and the next character in
+// line is the same, the cursor jumps over it and the character should not be inserted.
+func AutopairInsertOrJump(key rune, line *core.Line, cur *core.Cursor, pairs map[rune]rune) (skipInsert bool) {
+	closeChar, opener := pairs[key]
 
-	if !matcher {
-		return
+	// Step over closing characters already there.
+	if isAutopairCloser(key, pairs) && cur.Pos() < line.Len() && cur.Char() == key {
+		cur.Inc()
+		return true
 	}
 
-	switch {
-	case closer && cur.Char() == key:
-		skipInsert = true
-		cur.Inc()
-	case closer && key != '\'' && key != '"':
-		return
-	default:
-		_, closeChar := strutil.MatchSurround(key)
-		line.Insert(cur.Pos(), closeChar)
+	if !opener || isWordChar(line, cur.Pos()) {
+		return false
 	}
 
-	return
+	// Quotes following a word character are most likely apostrophes.
+	if closeChar == key && isWordChar(line, cur.Pos()-1) {
+		return false
+	}
+
+	line.Insert(cur.Pos(), closeChar)
+
+	return false
 }
 
-// AutopairDelete checks if the character under the cursor is an opening pair
+// AutopairDelete checks if the character before the cursor is an opening pair
 // character which is immediately followed by its closing equivalent. If yes,
 // the closing character is removed.
-func AutopairDelete(line *core.Line, cur *core.Cursor) {
-	if cur.Pos() == 0 {
+func AutopairDelete(line *core.Line, cur *core.Cursor, pairs map[rune]rune) {
+	if cur.Pos() == 0 || cur.Pos() >= line.Len() {
 		return
 	}
 
 	toDelete := (*line)[cur.Pos()-1]
-	isPair, _ := strutil.SurroundType(toDelete)
-	matcher := strutil.IsSurround(toDelete, cur.Char())
 
 	// Cut the (closing) rune under the cursor.
-	if isPair && matcher {
+	if closeChar, opener := pairs[toDelete]; opener && closeChar == cur.Char() {
 		line.CutRune(cur.Pos())
 	}
 }
+
+func isAutopairCloser(key rune, pairs map[rune]rune) bool {
+	for _, closeChar := range pairs {
+		if closeChar == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isWordChar(line *core.Line, pos int) bool {
+	if pos < 0 || pos >= line.Len() {
+		return false
+	}
+
+	char := (*line)[pos]
+
+	return unicode.IsLetter(char) || unicode.IsDigit(char) || char == '_'
+}
@@ -5,6 +5,7 @@ import (
 	"unicode"
 
 	"github.com/reeflective/readline/internal/color"
+	"github.com/reeflective/readline/internal/core"
 	"github.com/reeflective/readline/internal/keymap"
 	"github.com/reeflective/readline/internal/term"
 )
@@ -12,6 +13,10 @@ import (
 const (
 	trailingDescLen  = 3
 	trailingValueLen = 4
+
+	// previewSeparatorWidth is the maximum width of the
+	// line separating the candidate preview from the menu.
+	previewSeparatorWidth = 40
 )
 
 var sanitizer = strings.NewReplacer(
@@ -26,6 +31,7 @@ var sanitizer = strings.NewReplacer(
 func (e *Engine) prepare(completions Values) {
 	e.prefix = ""
 	e.groups = make([]*group, 0)
+	e.context = completions.Context
 
 	e.setPrefix(completions)
 	e.setSuffix(completions)
@@ -46,8 +52,15 @@ func (e *Engine) generate(completions Values) {
 
 	// Apply the prefix to the completions, and filter out any
 	// completions that don't match, optionally ignoring case.
-	matchCase := e.config.GetBool("completion-ignore-case")
-	completions.values = completions.values.FilterPrefix(e.prefix, !matchCase)
+	// Quoted prefixes must match the unquoted candidate values.
+	prefix := unquote(e.prefix, completions.Quote)
+	completions.values = filterMatch(completions.values, prefix, completions.Match, e.matchCase(prefix))
+	e.matchMode = completions.Match
+
+	// Let the caller drop or reorder the remaining candidates.
+	if completions.PostFilter != nil {
+		completions.values = completions.PostFilter(completions.values)
+	}
 
 	// Classify, group together and initialize completions.
 	completions.values.EachTag(e.generateGroup(completions))
@@ -55,38 +68,61 @@ func (e *Engine) generate(completions Values) {
 }
 
 func (e *Engine) setPrefix(completions Values) {
-	switch completions.PREFIX {
-	case "":
+	e.prefix = Prefix(e.line, e.cursor.Pos(), completions)
+}
+
+// Prefix returns the part of the line before the cursor position (pos) which
+// is completed (and thus used to filter candidates) by a list of completions.
+func Prefix(line *core.Line, pos int, completions Values) string {
+	switch {
+	case completions.AtCursor:
+		return ""
+
+	case completions.PREFIX != "":
+		return completions.PREFIX
+
+	case completions.Separators != "", completions.Quote != QuoteNone:
+		bpos, _ := line.SelectSeparatedWord(pos, completions.Separators)
+		return string((*line)[bpos:pos])
+
+	default:
 		// Select the character just before the cursor.
-		cpos := e.cursor.Pos() - 1
+		cpos := pos - 1
 		if cpos < 0 {
 			cpos = 0
 		}
 
-		bpos, _ := e.line.SelectBlankWord(cpos)
+		bpos, _ := line.SelectBlankWord(cpos)
 
 		// Safety checks and adjustments.
 		if bpos > cpos {
 			bpos, cpos = cpos, bpos
 		}
 
-		if cpos < e.line.Len() {
+		if cpos < line.Len() {
 			cpos++
 		}
 
 		// You might wonder why we trim spaces here:
 		// in practice we don't really ever want to
 		// consider "how many spaces are somewhere".
-		e.prefix = strings.TrimSpace(string((*e.line)[bpos:cpos]))
-
-	default:
-		e.prefix = completions.PREFIX
+		return strings.TrimSpace(string((*line)[bpos:cpos]))
 	}
 }
 
 func (e *Engine) setSuffix(completions Values) {
-	switch completions.SUFFIX {
-	case "":
+	switch {
+	case completions.AtCursor:
+		e.suffix = ""
+
+	case completions.SUFFIX != "":
+		e.suffix = completions.SUFFIX
+
+	case completions.Separators != "", completions.Quote != QuoteNone:
+		_, epos := e.line.SelectSeparatedWord(e.cursor.Pos(), completions.Separators)
+		e.suffix = string((*e.line)[e.cursor.Pos():epos])
+
+	default:
 		cpos := e.cursor.Pos()
 		_, epos := e.line.SelectBlankWord(cpos)
 
@@ -107,9 +143,6 @@ func (e *Engine) setSuffix(completions Values) {
 		}
 
 		e.suffix = strings.TrimSpace(string((*e.line)[cpos:epos]))
-
-	default:
-		e.suffix = completions.SUFFIX
 	}
 }
 
@@ -193,6 +226,24 @@ func (e *Engine) currentGroup() (grp *group) {
 	return
 }
 
+// isEdgeGroup returns true if the group is the last non-empty
+// group (if next is true), or the first non-empty one otherwise.
+func (e *Engine) isEdgeGroup(grp *group, next bool) bool {
+	var edge *group
+
+	for _, g := range e.groups {
+		if len(g.rows) == 0 {
+			continue
+		}
+
+		if edge == nil || next {
+			edge = g
+		}
+	}
+
+	return grp == edge
+}
+
 // cycleNextGroup - Finds either the first non-empty group,
 // or the next non-empty group after the current one.
 func (e *Engine) cycleNextGroup() {
@@ -323,15 +374,15 @@ func (e *Engine) completionCount() (comps int, used int) {
 		}
 
 		// One line for the group name
-		if group.tag != "" {
+		if e.hasHeader(group) {
 			used++
 		}
 
-		if group.maxY > len(group.rows) {
-			used += group.maxY
-		} else {
-			used += len(group.rows)
+		if group.collapsed {
+			continue
 		}
+
+		used += group.lines(max(group.maxY, len(group.rows)))
 	}
 
 	return comps, used
@@ -344,7 +395,7 @@ func (e *Engine) hasUniqueCandidate() bool {
 
 	case 1:
 		cur := e.currentGroup()
-		if cur == nil {
+		if cur == nil || !cur.insertUnique {
 			return false
 		}
 
@@ -446,18 +497,23 @@ func (e *Engine) getAbsPos() int {
 			continue
 		}
 
-		if grp.tag != "" {
+		if e.hasHeader(grp) {
 			prev++
 		}
 
 		if grp.isCurrent {
-			prev += grp.posY
+			if !grp.collapsed {
+				prev += grp.lines(grp.posY)
+			}
+
 			foundCurrent = true
 
 			break
 		}
 
-		prev += grp.maxY
+		if !grp.collapsed {
+			prev += grp.lines(grp.maxY)
+		}
 	}
 
 	// If there was no current group, it means
@@ -470,6 +526,63 @@ func (e *Engine) getAbsPos() int {
 	return prev
 }
 
+// candidateAt returns the group and coordinates of the candidate displayed at
+// a row and column of the menu, or a nil group if there is none displayed there.
+func (e *Engine) candidateAt(row, column int) (grp *group, posX, posY int) {
+	// The context line above the menu has no candidates.
+	row -= e.contextRows
+
+	if row < 0 || row >= e.pageRows || column < 0 {
+		return nil, 0, 0
+	}
+
+	line := e.menuOffset + row
+
+	for _, grp := range e.groups {
+		if len(grp.rows) == 0 {
+			continue
+		}
+
+		// Group headers cannot be selected.
+		if e.hasHeader(grp) {
+			if line == 0 {
+				return nil, 0, 0
+			}
+
+			line--
+		}
+
+		if grp.collapsed {
+			continue
+		}
+
+		if lines := grp.lines(len(grp.rows)); line >= lines {
+			line -= lines
+			continue
+		}
+
+		// Continuation lines of descriptions cannot be selected.
+		posY, found := grp.rowAt(line)
+		if !found {
+			return nil, 0, 0
+		}
+
+		for col, start := range grp.columnsX {
+			if column >= start {
+				posX = col
+			}
+		}
+
+		if posX >= len(grp.rows[posY]) || grp.rows[posY][posX].Display == "" {
+			return nil, 0, 0
+		}
+
+		return grp, posX, posY
+	}
+
+	return nil, 0, 0
+}
+
 func sum(vals []int) (sum int) {
 	for _, val := range vals {
 		sum += val
@@ -478,6 +591,17 @@ func sum(vals []int) (sum int) {
 	return
 }
 
+// matchCase returns true if candidates must match the query case-sensitively.
+// With the `completion-smart-case` option, this is only the case if the query
+// contains uppercase letters, regardless of the `completion-ignore-case` option.
+func (e *Engine) matchCase(query string) bool {
+	if e.config.GetBool("completion-smart-case") {
+		return hasUpper([]rune(query))
+	}
+
+	return !e.config.GetBool("completion-ignore-case")
+}
+
 func hasUpper(line []rune) bool {
 	for _, r := range line {
 		if unicode.IsUpper(r) {
@@ -1,7 +1,12 @@
 package completion
 
 import (
+	"encoding/json"
+	"regexp"
+	"sort"
 	"strings"
+
+	"github.com/reeflective/readline/internal/color"
 )
 
 // RawValues is a list of completion candidates.
@@ -26,20 +31,148 @@ func (c RawValues) Filter(values ...string) RawValues {
 }
 
 // Merge merges a set of values with the current ones,
-// include usage/message strings, meta settings, etc.
+// include candidates, usage/message strings, meta settings, etc.
+// Candidates with the same value and tag as one already present
+// are dropped, so that only the first one seen is kept.
 func (c *Values) Merge(other Values) {
+	type candidateKey struct{ value, tag string }
+
+	seen := make(map[candidateKey]bool, len(c.values))
+
+	for _, val := range c.values {
+		seen[candidateKey{val.Value, val.Tag}] = true
+	}
+
+	for _, val := range other.values {
+		key := candidateKey{val.Value, val.Tag}
+		if seen[key] {
+			continue
+		}
+
+		seen[key] = true
+		c.values = append(c.values, val)
+	}
+
 	if other.Usage != "" {
 		c.Usage = other.Usage
 	}
 
+	if len(c.Context) == 0 {
+		c.Context = other.Context
+	}
+
 	c.NoSpace.Merge(other.NoSpace)
+	c.AddSpace = c.AddSpace || other.AddSpace
 	c.Messages.Merge(other.Messages)
 
-	for tag := range other.ListLong {
-		if _, found := c.ListLong[tag]; !found {
-			c.ListLong[tag] = true
-		}
+	c.Layouts = mergeTags(c.Layouts, other.Layouts)
+	c.Headers = mergeTags(c.Headers, other.Headers)
+	c.NoSort = mergeTags(c.NoSort, other.NoSort)
+	c.ListSep = mergeTags(c.ListSep, other.ListSep)
+	c.Pad = mergeTags(c.Pad, other.Pad)
+	c.Escapes = mergeTags(c.Escapes, other.Escapes)
+	c.HeaderStyles = mergeTags(c.HeaderStyles, other.HeaderStyles)
+	c.TagStyles = mergeTags(c.TagStyles, other.TagStyles)
+	c.InsertUnique = mergeTags(c.InsertUnique, other.InsertUnique)
+	c.WrapDescriptions = mergeTags(c.WrapDescriptions, other.WrapDescriptions)
+
+	if c.PREFIX == "" {
+		c.PREFIX = other.PREFIX
+	}
+
+	if c.SUFFIX == "" {
+		c.SUFFIX = other.SUFFIX
+	}
+
+	if c.Quote == QuoteNone {
+		c.Quote = other.Quote
+	}
+
+	if c.Match == MatchPrefix {
+		c.Match = other.Match
+	}
+
+	if c.Separators == "" {
+		c.Separators = other.Separators
 	}
+
+	if c.PostFilter == nil {
+		c.PostFilter = other.PostFilter
+	}
+
+	c.AtCursor = c.AtCursor || other.AtCursor
+}
+
+// clone returns a copy of the completions, not sharing
+// their candidates, messages and per-tag settings.
+func (c Values) clone() Values {
+	clone := c
+
+	clone.values = append(RawValues(nil), c.values...)
+	clone.Context = append([]string(nil), c.Context...)
+	clone.Messages = Messages{}
+	clone.Messages.Merge(c.Messages)
+
+	clone.Layouts = copyTags(c.Layouts)
+	clone.Headers = copyTags(c.Headers)
+	clone.NoSort = copyTags(c.NoSort)
+	clone.ListSep = copyTags(c.ListSep)
+	clone.Pad = copyTags(c.Pad)
+	clone.Escapes = copyTags(c.Escapes)
+	clone.HeaderStyles = copyTags(c.HeaderStyles)
+	clone.TagStyles = copyTags(c.TagStyles)
+	clone.InsertUnique = copyTags(c.InsertUnique)
+	clone.WrapDescriptions = copyTags(c.WrapDescriptions)
+
+	return clone
+}
+
+// Raw returns the completion candidates.
+func (c Values) Raw() RawValues {
+	return c.values
+}
+
+// MarshalJSON returns a stable representation of the completions: their prefix,
+// suffix, usage, context and messages, and their candidates grouped by tags. Groups are
+// sorted by tag, and candidates are sorted like in the menu (whatever the order
+// in which they were produced), so that the result can be compared in tests.
+func (c Values) MarshalJSON() ([]byte, error) {
+	type candidate struct {
+		Value       string `json:"value"`
+		Display     string `json:"display,omitempty"`
+		Description string `json:"description,omitempty"`
+	}
+
+	type group struct {
+		Tag        string      `json:"tag"`
+		Candidates []candidate `json:"candidates"`
+	}
+
+	groups := make([]group, 0)
+
+	c.values.EachTag(func(tag string, values RawValues) {
+		sorted := append(RawValues{}, values...)
+		sort.Stable(sorted)
+
+		grp := group{Tag: tag, Candidates: make([]candidate, 0, len(sorted))}
+
+		for _, val := range sorted {
+			grp.Candidates = append(grp.Candidates, candidate{val.Value, val.Display, val.Description})
+		}
+
+		groups = append(groups, grp)
+	})
+
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].Tag < groups[j].Tag })
+
+	return json.Marshal(struct {
+		Prefix   string   `json:"prefix,omitempty"`
+		Suffix   string   `json:"suffix,omitempty"`
+		Usage    string   `json:"usage,omitempty"`
+		Context  []string `json:"context,omitempty"`
+		Messages []string `json:"messages,omitempty"`
+		Groups   []group  `json:"groups"`
+	}{c.PREFIX, c.SUFFIX, c.Usage, c.Context, c.Messages.Get(), groups})
 }
 
 // EachTag iterates over each tag and runs a function for each group.
@@ -91,10 +224,212 @@ func (c RawValues) FilterPrefix(prefix string, matchCase bool) RawValues {
 	return filtered
 }
 
+// FilterSubstring filters values containing the given substring anywhere.
+// If matchCase is false, the filtering is made case-insensitive.
+func (c RawValues) FilterSubstring(substr string, matchCase bool) RawValues {
+	if substr == "" {
+		return c
+	}
+
+	filtered := make(RawValues, 0)
+
+	if !matchCase {
+		substr = strings.ToLower(substr)
+	}
+
+	for _, raw := range c {
+		val := raw.Value
+
+		if !matchCase {
+			val = strings.ToLower(val)
+		}
+
+		if strings.Contains(val, substr) {
+			filtered = append(filtered, raw)
+		}
+	}
+
+	return filtered
+}
+
+// FilterFuzzy filters values containing all the characters of the pattern,
+// in the same order, but not necessarily next to each other ("lcm" matches
+// "long-command"). If matchCase is false, the filtering is case-insensitive.
+func (c RawValues) FilterFuzzy(pattern string, matchCase bool) RawValues {
+	if pattern == "" {
+		return c
+	}
+
+	filtered := make(RawValues, 0)
+
+	if !matchCase {
+		pattern = strings.ToLower(pattern)
+	}
+
+	for _, raw := range c {
+		val := raw.Value
+
+		if !matchCase {
+			val = strings.ToLower(val)
+		}
+
+		if isFuzzyMatch(val, pattern) {
+			filtered = append(filtered, raw)
+		}
+	}
+
+	return filtered
+}
+
+// Map returns a new list of values, with the function applied to each of them.
+// The receiver values are left untouched. Candidates returned with an empty
+// value are kept as is (use Filter("") on the result to drop them).
+func (c RawValues) Map(f func(Candidate) Candidate) RawValues {
+	mapped := make(RawValues, len(c))
+
+	for i, raw := range c {
+		mapped[i] = f(raw)
+	}
+
+	return mapped
+}
+
+// FilterRegex filters values matching the regular expression pattern,
+// which is compiled only once. If the pattern is invalid, the values are
+// returned unfiltered, along with the compilation error.
+func (c RawValues) FilterRegex(pattern string) (RawValues, error) {
+	matcher, err := regexp.Compile(pattern)
+	if err != nil {
+		return c, err
+	}
+
+	return c.filterMatching(matcher), nil
+}
+
+// filterMatching filters values matching an already compiled regular expression.
+func (c RawValues) filterMatching(matcher *regexp.Regexp) RawValues {
+	filtered := make(RawValues, 0)
+
+	for _, raw := range c {
+		if matcher.MatchString(raw.Value) {
+			filtered = append(filtered, raw)
+		}
+	}
+
+	return filtered
+}
+
+// FilterDescription filters values whose description (or display string,
+// if any) contains the given substring, ignoring any color sequences in them.
+// If matchCase is false, the filtering is made case-insensitive.
+func (c RawValues) FilterDescription(substr string, matchCase bool) RawValues {
+	if substr == "" {
+		return c
+	}
+
+	filtered := make(RawValues, 0)
+
+	if !matchCase {
+		substr = strings.ToLower(substr)
+	}
+
+	contains := func(text string) bool {
+		if !matchCase {
+			text = strings.ToLower(text)
+		}
+
+		return strings.Contains(text, substr)
+	}
+
+	for _, raw := range c {
+		if raw.matchDescription(contains) {
+			filtered = append(filtered, raw)
+		}
+	}
+
+	return filtered
+}
+
+// matchDescription returns true if the description or the display string
+// of the candidate (if any), stripped from their colors, match.
+func (c Candidate) matchDescription(match func(text string) bool) bool {
+	if c.Description != "" && match(color.Strip(c.Description)) {
+		return true
+	}
+
+	return c.Display != "" && match(color.Strip(c.Display))
+}
+
 func (c RawValues) Len() int { return len(c) }
 
 func (c RawValues) Swap(i, j int) { c[i], c[j] = c[j], c[i] }
 
+// Less sorts candidates by their displays (or values when they have none),
+// so that the order in the menu is the one users see. Case-insensitively equal
+// displays are ordered case-sensitively, and then by values and descriptions,
+// so that the order does not depend on the order in which candidates arrived.
 func (c RawValues) Less(i, j int) bool {
-	return strings.ToLower(c[i].Value) < strings.ToLower(c[j].Value)
+	keyI, keyJ := c[i].sortKey(), c[j].sortKey()
+
+	if lowerI, lowerJ := strings.ToLower(keyI), strings.ToLower(keyJ); lowerI != lowerJ {
+		return lowerI < lowerJ
+	}
+
+	if keyI != keyJ {
+		return keyI < keyJ
+	}
+
+	if c[i].Value != c[j].Value {
+		return c[i].Value < c[j].Value
+	}
+
+	return c[i].Description < c[j].Description
+}
+
+func (c Candidate) sortKey() string {
+	if c.Display != "" {
+		return color.Strip(c.Display)
+	}
+
+	return c.Value
+}
+
+// forTag returns the setting of a tag, or the one of all tags ("*") if none.
+func forTag[T any](settings map[string]T, tag string) (setting T, found bool) {
+	if setting, found = settings[tag]; found {
+		return setting, true
+	}
+
+	setting, found = settings["*"]
+
+	return setting, found
+}
+
+// copyTags returns a copy of tag settings, or nil if they are nil.
+func copyTags[T any](tags map[string]T) map[string]T {
+	if tags == nil {
+		return nil
+	}
+
+	copied := make(map[string]T, len(tags))
+	for tag, value := range tags {
+		copied[tag] = value
+	}
+
+	return copied
+}
+
+// mergeTags adds all tag settings found in other and not in tags.
+func mergeTags[T any](tags, other map[string]T) map[string]T {
+	if len(other) > 0 && tags == nil {
+		tags = make(map[string]T)
+	}
+
+	for tag, value := range other {
+		if _, found := tags[tag]; !found {
+			tags[tag] = value
+		}
+	}
+
+	return tags
 }
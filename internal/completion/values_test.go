@@ -0,0 +1,276 @@
+package completion
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestValues_Merge(t *testing.T) {
+	tests := []struct {
+		name  string
+		base  RawValues
+		other RawValues
+		want  RawValues
+	}{
+		{
+			name:  "No overlap",
+			base:  RawValues{{Value: "a"}},
+			other: RawValues{{Value: "b"}},
+			want:  RawValues{{Value: "a"}, {Value: "b"}},
+		},
+		{
+			name:  "Same value and tag",
+			base:  RawValues{{Value: "a", Tag: "files"}, {Value: "b", Tag: "files"}},
+			other: RawValues{{Value: "b", Tag: "files"}, {Value: "c", Tag: "files"}},
+			want:  RawValues{{Value: "a", Tag: "files"}, {Value: "b", Tag: "files"}, {Value: "c", Tag: "files"}},
+		},
+		{
+			name:  "Same value, different tags",
+			base:  RawValues{{Value: "a", Tag: "files"}},
+			other: RawValues{{Value: "a", Tag: "commands"}},
+			want:  RawValues{{Value: "a", Tag: "files"}, {Value: "a", Tag: "commands"}},
+		},
+		{
+			name:  "First seen is kept",
+			base:  RawValues{{Value: "a", Description: "first"}},
+			other: RawValues{{Value: "a", Description: "second"}},
+			want:  RawValues{{Value: "a", Description: "first"}},
+		},
+		{
+			name:  "Duplicates in merged values",
+			base:  RawValues{},
+			other: RawValues{{Value: "a"}, {Value: "a"}},
+			want:  RawValues{{Value: "a"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := AddRaw(tt.base)
+			values.Merge(AddRaw(tt.other))
+
+			if !reflect.DeepEqual(values.values, tt.want) {
+				t.Errorf("Merge() = %v, want %v", values.values, tt.want)
+			}
+		})
+	}
+}
+
+func TestRawValues_FilterSubstring(t *testing.T) {
+	values := RawValues{{Value: "git-commit"}, {Value: "commit"}, {Value: "Committer"}, {Value: "push"}}
+
+	tests := []struct {
+		name      string
+		substr    string
+		matchCase bool
+		want      RawValues
+	}{
+		{
+			name:      "Empty substring",
+			substr:    "",
+			matchCase: true,
+			want:      values,
+		},
+		{
+			name:      "Infix match",
+			substr:    "commit",
+			matchCase: true,
+			want:      RawValues{{Value: "git-commit"}, {Value: "commit"}},
+		},
+		{
+			name:      "Case-insensitive",
+			substr:    "commit",
+			matchCase: false,
+			want:      RawValues{{Value: "git-commit"}, {Value: "commit"}, {Value: "Committer"}},
+		},
+		{
+			name:      "No match",
+			substr:    "pull",
+			matchCase: true,
+			want:      RawValues{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := values.FilterSubstring(tt.substr, tt.matchCase); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FilterSubstring() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRawValues_FilterFuzzy(t *testing.T) {
+	values := RawValues{{Value: "long-command"}, {Value: "clamp"}, {Value: "Lcm"}}
+
+	tests := []struct {
+		name      string
+		pattern   string
+		matchCase bool
+		want      RawValues
+	}{
+		{
+			name:      "Characters in order",
+			pattern:   "lcm",
+			matchCase: true,
+			want:      RawValues{{Value: "long-command"}},
+		},
+		{
+			name:      "Case-insensitive",
+			pattern:   "lcm",
+			matchCase: false,
+			want:      RawValues{{Value: "long-command"}, {Value: "Lcm"}},
+		},
+		{
+			name:      "Characters out of order",
+			pattern:   "mlc",
+			matchCase: false,
+			want:      RawValues{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := values.FilterFuzzy(tt.pattern, tt.matchCase); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FilterFuzzy() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRawValues_FilterDescription(t *testing.T) {
+	values := RawValues{
+		{Value: "ci", Description: "Commit the staged changes"},
+		{Value: "st", Description: "\x1b[33mShow\x1b[0m the working tree status"},
+		{Value: "br", Display: "branch (list branches)"},
+		{Value: "co"},
+	}
+
+	tests := []struct {
+		name      string
+		substr    string
+		matchCase bool
+		want      RawValues
+	}{
+		{
+			name:      "Empty substring",
+			substr:    "",
+			matchCase: true,
+			want:      values,
+		},
+		{
+			name:      "Description match",
+			substr:    "staged",
+			matchCase: true,
+			want:      RawValues{values[0]},
+		},
+		{
+			name:      "Colors ignored",
+			substr:    "Show the",
+			matchCase: true,
+			want:      RawValues{values[1]},
+		},
+		{
+			name:      "Display match",
+			substr:    "list",
+			matchCase: true,
+			want:      RawValues{values[2]},
+		},
+		{
+			name:      "Case-insensitive",
+			substr:    "commit",
+			matchCase: false,
+			want:      RawValues{values[0]},
+		},
+		{
+			name:      "Case-sensitive",
+			substr:    "commit",
+			matchCase: true,
+			want:      RawValues{},
+		},
+		{
+			name:      "Values not matched",
+			substr:    "co",
+			matchCase: true,
+			want:      RawValues{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := values.FilterDescription(tt.substr, tt.matchCase); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FilterDescription() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRawValues_SortByDisplay(t *testing.T) {
+	values := RawValues{
+		{Value: "id-3", Display: "banana"},
+		{Value: "id-1", Display: "cherry"},
+		{Value: "apricot"},
+		{Value: "id-2", Display: "\x1b[1mAvocado\x1b[0m"},
+	}
+
+	sort.Stable(values)
+
+	got := make([]string, 0, len(values))
+	for _, val := range values {
+		got = append(got, val.Value)
+	}
+
+	want := []string{"apricot", "id-2", "id-3", "id-1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sort.Stable() = %v, want %v", got, want)
+	}
+}
+
+func TestRawValues_SortDeterministic(t *testing.T) {
+	values := RawValues{
+		{Value: "b", Display: "same"},
+		{Value: "a", Display: "Same"},
+		{Value: "c", Display: "same", Description: "two"},
+		{Value: "c", Display: "same", Description: "one"},
+		{Value: "B", Display: "SAME"},
+	}
+
+	want := []string{"B:", "a:", "b:", "c:one", "c:two"}
+
+	// Whatever the order of candidates, the sorted one must be the same.
+	for shift := range values {
+		shuffled := append(RawValues{}, values[shift:]...)
+		shuffled = append(shuffled, values[:shift]...)
+
+		sort.Stable(shuffled)
+
+		got := make([]string, 0, len(shuffled))
+		for _, val := range shuffled {
+			got = append(got, val.Value+":"+val.Description)
+		}
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("sort.Stable() (shift %d) = %v, want %v", shift, got, want)
+		}
+	}
+}
+
+func TestValues_MarshalJSON(t *testing.T) {
+	values := AddRaw([]Candidate{
+		{Value: "main.go", Tag: "files", Description: "source"},
+		{Value: "build", Tag: "commands"},
+		{Value: "go.mod", Tag: "files"},
+	})
+	values.Usage = "usage"
+
+	got, err := json.Marshal(values)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+
+	want := `{"usage":"usage","groups":[` +
+		`{"tag":"commands","candidates":[{"value":"build"}]},` +
+		`{"tag":"files","candidates":[{"value":"go.mod"},{"value":"main.go","description":"source"}]}]}`
+
+	if string(got) != want {
+		t.Errorf("json.Marshal() = %s, want %s", got, want)
+	}
+}
@@ -3,6 +3,7 @@ package core
 import (
 	"github.com/reeflective/readline/inputrc"
 	"github.com/reeflective/readline/internal/strutil"
+	"github.com/reeflective/readline/internal/term"
 )
 
 // Cursor is the cursor position in the current line buffer.
@@ -359,6 +360,14 @@ func (c *Cursor) CheckCommand() {
 // (y value), and the number of columns since the beginning of the current line (x value).
 // @indent -    Used to align all lines (except the first) together on a single column.
 func CoordinatesCursor(cur *Cursor, indent int) (x, y int) {
+	return CoordinatesCursorWith(cur, indent, indent, strutil.DefaultTabWidth, term.GetWidth())
+}
+
+// CoordinatesCursorWith is like CoordinatesCursor, except that all lines after
+// the first one start at the secondary indent column, instead of the first one,
+// that tabs are expanded to tab stops every tabWidth columns, and that lines
+// wrap at termWidth columns.
+func CoordinatesCursorWith(cur *Cursor, indent, secondary, tabWidth, termWidth int) (x, y int) {
 	cur.CheckAppend()
 
 	newlines := cur.line.newlines()
@@ -366,19 +375,24 @@ func CoordinatesCursor(cur *Cursor, indent int) (x, y int) {
 	usedY := 0
 
 	for pos, newline := range newlines {
+		lineIndent := indent
+		if pos > 0 {
+			lineIndent = secondary
+		}
+
 		switch {
 		case newline[0] < cur.pos:
 			// Until we didn't reach the cursor line,
 			// simply care about the line count.
 			line := (*cur.line)[bpos:newline[0]]
 			bpos = newline[0] + 1
-			_, y := strutil.LineSpan(line, pos, indent)
+			_, y := strutil.LineSpan(line, pos, lineIndent, tabWidth, termWidth)
 			usedY += y
 
 		default:
 			// On the cursor line, use both line and column count.
 			line := (*cur.line)[bpos:cur.pos]
-			usedX, y := strutil.LineSpan(line, pos, indent)
+			usedX, y := strutil.LineSpan(line, pos, lineIndent, tabWidth, termWidth)
 			usedY += y
 
 			return usedX, usedY
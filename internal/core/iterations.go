@@ -10,9 +10,11 @@ import (
 
 // Iterations manages iterations for commands.
 type Iterations struct {
-	times   string // Stores iteration value
-	active  bool   // Are we currently setting the iterations.
-	pending bool   // Has the last command been an iteration one (vi-pending style)
+	times     string // Stores iteration value
+	active    bool   // Are we currently setting the iterations.
+	pending   bool   // Has the last command been an iteration one (vi-pending style)
+	universal bool   // Iterations set by a universal argument, not followed by digits yet.
+	held      int    // Iterations of a pending operator, multiplying the next ones.
 }
 
 // Add accepts a string to be converted as an integer representing
@@ -32,6 +34,17 @@ func (i *Iterations) Add(times string) {
 	i.active = true
 	i.pending = true
 
+	// Digits following a universal argument replace its value.
+	if i.universal {
+		i.universal = false
+
+		if strings.HasPrefix(i.times, "-") {
+			i.times = "-"
+		} else {
+			i.times = ""
+		}
+	}
+
 	switch {
 	case times == "-":
 		i.times = times + i.times
@@ -42,8 +55,46 @@ func (i *Iterations) Add(times string) {
 	}
 }
 
-// Get returns the number of iterations (possibly
-// negative), and resets the iterations to 1.
+// Universal sets the iterations like the Emacs universal-argument: when no
+// digits have been given yet, the current value (1 by default) is multiplied
+// by four, and digits added afterwards replace it. When digits have already
+// been given, the iterations are only kept active for the next command.
+func (i *Iterations) Universal() {
+	i.active = true
+	i.pending = true
+
+	if i.times != "" && i.times != "-" && !i.universal {
+		return
+	}
+
+	times := 1
+
+	switch i.times {
+	case "":
+	case "-":
+		times = -1
+	default:
+		times, _ = strconv.Atoi(i.times)
+	}
+
+	i.times = strconv.Itoa(times * 4)
+	i.universal = true
+}
+
+// Hold keeps the current iterations (if any) aside, and resets them: they will
+// multiply the iterations returned by the next call to Get(). This is used by
+// Vim operators waiting for a motion, so that `2d3w` deletes six words, while
+// `2dw` and `d2w` both delete two of them.
+func (i *Iterations) Hold() {
+	if i.times == "" {
+		return
+	}
+
+	i.held = i.Get()
+}
+
+// Get returns the number of iterations (possibly negative), multiplied
+// by any held ones, and resets the iterations to 1.
 func (i *Iterations) Get() int {
 	times, err := strconv.Atoi(i.times)
 
@@ -61,7 +112,13 @@ func (i *Iterations) Get() int {
 		times++
 	}
 
+	if i.held != 0 {
+		times *= i.held
+	}
+
 	i.times = ""
+	i.universal = false
+	i.held = 0
 
 	return times
 }
@@ -82,6 +139,8 @@ func (i *Iterations) Reset() {
 	i.times = ""
 	i.active = false
 	i.pending = false
+	i.universal = false
+	i.held = 0
 }
 
 // ResetPostRunIterations resets the iterations if the last command didn't set them.
@@ -98,6 +157,7 @@ func ResetPostRunIterations(iter *Iterations) (hint string) {
 	}
 
 	iter.active = false
+	iter.universal = false
 
 	return
 }
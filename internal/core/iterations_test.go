@@ -154,6 +154,136 @@ func TestIterations_Get(t *testing.T) {
 	}
 }
 
+func TestIterations_Universal(t *testing.T) {
+	type fields struct {
+		times     string
+		universal bool
+	}
+	tests := []struct {
+		name          string
+		fields        fields
+		add           string
+		wantTimes     string
+		wantUniversal bool
+	}{
+		{
+			name:          "Universal argument without iterations",
+			fields:        fields{},
+			wantTimes:     "4",
+			wantUniversal: true,
+		},
+		{
+			name:          "Repeated universal argument",
+			fields:        fields{times: "4", universal: true},
+			wantTimes:     "16",
+			wantUniversal: true,
+		},
+		{
+			name:          "Universal argument after a minus sign",
+			fields:        fields{times: "-"},
+			wantTimes:     "-4",
+			wantUniversal: true,
+		},
+		{
+			name:      "Universal argument after digits",
+			fields:    fields{times: "12"},
+			wantTimes: "12",
+		},
+		{
+			name:      "Digits after a universal argument",
+			fields:    fields{times: "4", universal: true},
+			add:       "3",
+			wantTimes: "3",
+		},
+		{
+			name:      "Minus sign after a universal argument",
+			fields:    fields{times: "4", universal: true},
+			add:       "-",
+			wantTimes: "-",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			iter := &Iterations{
+				times:     test.fields.times,
+				universal: test.fields.universal,
+			}
+
+			if test.add != "" {
+				iter.Add(test.add)
+			} else {
+				iter.Universal()
+			}
+
+			if iter.times != test.wantTimes {
+				t.Errorf("Iterations.Universal() = %v, want %v", iter.times, test.wantTimes)
+			}
+			if iter.universal != test.wantUniversal {
+				t.Errorf("Iterations.Universal() = %v, want %v", iter.universal, test.wantUniversal)
+			}
+			if !iter.active || !iter.pending {
+				t.Errorf("Iterations.Universal() should be active and pending")
+			}
+		})
+	}
+}
+
+func TestIterations_Hold(t *testing.T) {
+	tests := []struct {
+		name     string
+		operator string
+		motion   string
+		want     int
+	}{
+		{
+			name:     "Operator count only (3dw)",
+			operator: "3",
+			want:     3,
+		},
+		{
+			name:   "Motion count only (d3w)",
+			motion: "3",
+			want:   3,
+		},
+		{
+			name:     "Operator and motion counts (2d3w)",
+			operator: "2",
+			motion:   "3",
+			want:     6,
+		},
+		{
+			name:     "Negative operator count",
+			operator: "-2",
+			motion:   "3",
+			want:     -6,
+		},
+		{
+			name: "No counts",
+			want: 1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			iter := &Iterations{}
+
+			iter.Add(test.operator)
+			iter.Hold()
+			iter.Add(test.motion)
+
+			if got := iter.Get(); got != test.want {
+				t.Errorf("Iterations.Get() = %v, want %v", got, test.want)
+			}
+
+			// Held iterations are only used once.
+			if got := iter.Get(); got != 1 {
+				t.Errorf("Iterations.Get() = %v, want %v", got, 1)
+			}
+		})
+	}
+}
+
 func TestIterations_Reset(t *testing.T) {
 	type fields struct {
 		times   string
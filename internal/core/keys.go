@@ -1,11 +1,14 @@
 package core
 
 import (
+	"bytes"
 	"errors"
 	"io"
 	"os"
 	"regexp"
+	"strconv"
 	"sync"
+	"unicode/utf8"
 
 	"github.com/reeflective/readline/inputrc"
 	"github.com/reeflective/readline/internal/strutil"
@@ -13,6 +16,9 @@ import (
 
 const (
 	keyScanBufSize = 1024
+
+	// pasteEnd is sent by terminals at the end of a bracketed paste.
+	pasteEnd = "\x1b[201~"
 )
 
 // Stdin is used by the Keys struct to read and write keys.
@@ -20,7 +26,29 @@ const (
 // custom io.Readers, such as the one used on Windows.
 var Stdin io.ReadCloser = os.Stdin
 
-var rxRcvCursorPos = regexp.MustCompile(`\x1b\[([0-9]+);([0-9]+)R`)
+var (
+	rxRcvCursorPos = regexp.MustCompile(`\x1b\[([0-9]+);([0-9]+)R`)
+	rxMouseEvent   = regexp.MustCompile(`^\x1b\[<([0-9]+);([0-9]+);([0-9]+)([Mm])`)
+)
+
+// Mouse buttons reported in mouse events (modifier keys ignored).
+const (
+	MouseLeft      = 0
+	MouseMiddle    = 1
+	MouseRight     = 2
+	MouseWheelUp   = 64
+	MouseWheelDown = 65
+)
+
+// MouseEvent is a mouse event reported by the terminal
+// when SGR mouse reporting is enabled (see term.MouseOn).
+type MouseEvent struct {
+	Button  int  // Button pressed or released, or wheel direction.
+	X       int  // Terminal column of the event (starting at 1).
+	Y       int  // Terminal row of the event (starting at 1).
+	Release bool // The button has been released.
+	Motion  bool // The mouse has moved while the button is held.
+}
 
 // Keys is used read, manage and use keys input by the shell user.
 type Keys struct {
@@ -30,9 +58,16 @@ type Keys struct {
 	mustWait  bool        // Keys are in the stack, but we must still read stdin.
 	waiting   bool        // Currently waiting for keys on stdin.
 	reading   bool        // Currently reading keys out of the main loop.
+	pending   bool        // A read on stdin is pending in the background.
+	closed    bool        // The last read on stdin failed with io.EOF.
 	keysOnce  chan []byte // Passing keys from the main routine.
 	cursor    chan []byte // Cursor coordinates has been read on stdin.
 	resize    chan bool   // Resize events on Windows are sent on stdin.
+	input     chan read   // Keys read in the background are sent here.
+	queued    []func()    // Functions queued for execution by the main loop.
+	wakeup    chan bool   // Notifies the main loop when functions are queued.
+	reader    io.Reader   // Keys are read from this reader instead of Stdin, if not nil.
+	output    io.Writer   // The terminal is queried on this writer instead of os.Stdout, if not nil.
 
 	cfg   *inputrc.Config // Configuration file used for meta key settings
 	mutex sync.RWMutex    // Concurrency safety
@@ -55,6 +90,7 @@ func WaitAvailableKeys(keys *Keys, cfg *inputrc.Config) {
 	keys.mutex.Lock()
 	keys.waiting = true
 	keys.cursor = make(chan []byte)
+	wakeup := keys.wakeupChannel()
 	keys.mutex.Unlock()
 
 	defer func() {
@@ -64,11 +100,32 @@ func WaitAvailableKeys(keys *Keys, cfg *inputrc.Config) {
 	}()
 
 	for {
+		// Functions queued by other goroutines must be run
+		// by the caller before we wait for any more keys.
+		if HasQueued(keys) {
+			return
+		}
+
 		// Start reading from os.Stdin in the background.
 		// We will either read keyBuf from user, or an EOF
 		// send by ourselves, because we pause reading.
-		keyBuf, err := keys.readInputFiltered()
-		if err != nil && errors.Is(err, io.EOF) {
+		var input read
+
+		select {
+		case input = <-keys.readAsync():
+		case <-wakeup:
+			continue
+		}
+
+		keyBuf, err := input.keys, input.err
+
+		closed := err != nil && errors.Is(err, io.EOF)
+
+		keys.mutex.Lock()
+		keys.closed = closed
+		keys.mutex.Unlock()
+
+		if closed {
 			return
 		}
 
@@ -97,6 +154,15 @@ func WaitAvailableKeys(keys *Keys, cfg *inputrc.Config) {
 	}
 }
 
+// IsClosed returns true if no keys are available because the
+// last attempt to read them failed (standard input is closed).
+func IsClosed(keys *Keys) bool {
+	keys.mutex.RLock()
+	defer keys.mutex.RUnlock()
+
+	return keys.closed && len(keys.buf) == 0 && len(keys.macroKeys) == 0
+}
+
 // PopKey is used to pop a key off the key stack without
 // yet marking this key as having matched a bind command.
 func PopKey(keys *Keys) (key byte, empty bool) {
@@ -183,6 +249,130 @@ func PopForce(keys *Keys) (key byte, empty bool) {
 	return key, false
 }
 
+// PopKeySequence removes and returns the first complete key sequence in the
+// stack: either a single (possibly multibyte) character, a meta-prefixed one,
+// or a full CSI/SS3 escape sequence, such as those sent by arrow/function keys.
+// If the key stack is empty, an empty sequence is returned.
+func PopKeySequence(keys *Keys) (sequence string) {
+	keys.mutex.Lock()
+	defer keys.mutex.Unlock()
+
+	length := keySequenceLen(keys.buf)
+	if length == 0 {
+		return ""
+	}
+
+	sequence = string(keys.buf[:length])
+	keys.buf = keys.buf[length:]
+	keys.mustWait = false
+
+	return sequence
+}
+
+// PopMouseEvent removes and returns the mouse event at the beginning of the
+// key stack, if any: otherwise, the key stack is left untouched.
+func PopMouseEvent(keys *Keys) (event MouseEvent, found bool) {
+	keys.mutex.Lock()
+	defer keys.mutex.Unlock()
+
+	match := rxMouseEvent.FindSubmatch(keys.buf)
+	if match == nil {
+		return event, false
+	}
+
+	button, _ := strconv.Atoi(string(match[1]))
+	event.X, _ = strconv.Atoi(string(match[2]))
+	event.Y, _ = strconv.Atoi(string(match[3]))
+	event.Release = match[4][0] == 'm'
+
+	// Drop shift/meta/control modifiers, and the motion bit.
+	event.Motion = button&32 != 0
+	event.Button = button &^ (4 | 8 | 16 | 32)
+
+	keys.buf = keys.buf[len(match[0]):]
+	keys.mustWait = false
+
+	return event, true
+}
+
+// PopPaste removes and returns the text of a bracketed paste, once its start
+// sequence has been matched: keys are read until the sequence marking the end
+// of the paste (which is dropped), since terminals might send long pastes in
+// several chunks. The text read so far is returned if standard input is closed,
+// or if functions are queued by other goroutines and must be run.
+func PopPaste(keys *Keys, cfg *inputrc.Config) string {
+	var pasted []byte
+
+	for {
+		keys.mutex.Lock()
+		text, complete := popPasted(keys)
+		keys.mutex.Unlock()
+
+		pasted = append(pasted, text...)
+
+		if complete || IsClosed(keys) || HasQueued(keys) {
+			return string(pasted)
+		}
+
+		WaitAvailableKeys(keys, cfg)
+	}
+}
+
+// popPasted removes and returns the pasted keys in the stack, up to the end
+// of the paste if found (in which case complete is true), or all of them.
+func popPasted(keys *Keys) (text []byte, complete bool) {
+	// Keys fed by macros are pasted after those read.
+	if len(keys.macroKeys) > 0 {
+		keys.buf = append(keys.buf, []byte(string(keys.macroKeys))...)
+		keys.macroKeys = nil
+	}
+
+	end := bytes.Index(keys.buf, []byte(pasteEnd))
+	if end == -1 {
+		text, keys.buf = keys.buf, nil
+		return text, false
+	}
+
+	text = append([]byte{}, keys.buf[:end]...)
+	keys.buf = keys.buf[end+len(pasteEnd):]
+	keys.mustWait = false
+
+	return text, true
+}
+
+// keySequenceLen returns the length of the first key sequence in buf.
+func keySequenceLen(buf []byte) int {
+	if len(buf) == 0 {
+		return 0
+	}
+
+	// Normal characters, possibly multibyte ones.
+	if buf[0] != byte(inputrc.Esc) || len(buf) == 1 {
+		_, size := utf8.DecodeRune(buf)
+		return size
+	}
+
+	// Control sequences (CSI and SS3) end with their final byte,
+	// while other escaped characters are meta-prefixed ones.
+	switch buf[1] {
+	case '[':
+		for i := 2; i < len(buf); i++ {
+			if buf[i] >= 0x40 && buf[i] <= 0x7e {
+				return i + 1
+			}
+		}
+
+		return len(buf)
+
+	case 'O':
+		return min(3, len(buf))
+
+	default:
+		_, size := utf8.DecodeRune(buf[1:])
+		return 1 + size
+	}
+}
+
 // MacroKeys returns the keys that have matched a given command, and thus can be recorded
 // as a part of the current macro. This function is different from keys.Caller() in that it
 // won't return keys that have only matched a prefix, to avoid recording them twice.
@@ -225,8 +415,8 @@ func (k *Keys) ReadKey() (key rune, isAbort bool) {
 		buf := <-k.keysOnce
 		key = []rune(string(buf))[0]
 	default:
-		buf, _ := k.readInputFiltered()
-		key = []rune(string(buf))[0]
+		input := <-k.readAsync()
+		key = []rune(string(input.keys))[0]
 	}
 
 	// Always mark those keys as matched, so that
@@ -287,6 +477,132 @@ func (k *Keys) Feed(begin bool, keys ...rune) {
 	}
 }
 
+// Queue adds a function to be executed by the shell main loop, as soon as
+// it is done with the current command or, when it is waiting for user input,
+// immediately. This is the only safe way for other goroutines to act on the
+// shell state, and the display is always refreshed after queued functions run.
+func (k *Keys) Queue(event func()) {
+	if event == nil {
+		return
+	}
+
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	k.queued = append(k.queued, event)
+	wakeup := k.wakeupChannel()
+
+	select {
+	case wakeup <- true:
+	default:
+	}
+}
+
+// HasQueued returns true if some functions have been queued
+// for execution by the main loop, and are not yet consumed.
+func HasQueued(keys *Keys) bool {
+	keys.mutex.RLock()
+	defer keys.mutex.RUnlock()
+
+	return len(keys.queued) > 0
+}
+
+// PopQueued returns all functions queued for execution by the main loop,
+// and removes them from the queue: the caller is in charge of running them.
+func PopQueued(keys *Keys) []func() {
+	keys.mutex.Lock()
+	defer keys.mutex.Unlock()
+
+	queued := keys.queued
+	keys.queued = nil
+
+	return queued
+}
+
+// read is the result of a read on stdin performed in the background.
+type read struct {
+	keys []byte
+	err  error
+}
+
+// SetTerminal sets the reader from which keys are read (Stdin if nil), and the
+// writer through which the terminal is queried, eg. for the cursor position
+// (standard output if nil). Those are specific to each Keys, so that several
+// shells can read keys from different terminals at the same time.
+func (k *Keys) SetTerminal(reader io.Reader, output io.Writer) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	k.reader = reader
+	k.output = output
+}
+
+// stdin returns the reader from which keys are read.
+func (k *Keys) stdin() io.Reader {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+
+	if k.reader == nil {
+		return Stdin
+	}
+
+	return k.reader
+}
+
+// stdout returns the writer through which the terminal is queried.
+func (k *Keys) stdout() io.Writer {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+
+	if k.output == nil {
+		return os.Stdout
+	}
+
+	return k.output
+}
+
+// readAsync starts reading stdin in the background if no read is already
+// pending, and returns the channel on which the keys will be sent. There is
+// never more than one pending read, so that keys read when the caller has
+// stopped waiting (because of queued functions) are not lost, but consumed
+// by the next caller.
+func (k *Keys) readAsync() <-chan read {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if k.input == nil {
+		k.input = make(chan read, 1)
+	}
+
+	if k.pending {
+		return k.input
+	}
+
+	k.pending = true
+
+	go func() {
+		keys, err := k.readInputFiltered()
+
+		k.mutex.Lock()
+		k.pending = false
+		k.mutex.Unlock()
+
+		k.input <- read{keys: keys, err: err}
+	}()
+
+	return k.input
+}
+
+// wakeupChannel returns the channel used to notify the main loop
+// of queued functions, creating it if needed. Must be called locked.
+func (k *Keys) wakeupChannel() chan bool {
+	if k.wakeup == nil {
+		k.wakeup = make(chan bool, 1)
+	}
+
+	return k.wakeup
+}
+
 func (k *Keys) extractCursorPos(keys []byte) (cursor, remain []byte) {
 	if !rxRcvCursorPos.Match(keys) {
 		return cursor, keys
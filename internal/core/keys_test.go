@@ -0,0 +1,191 @@
+package core
+
+import (
+	"testing"
+)
+
+func TestPopKeySequence(t *testing.T) {
+	tests := []struct {
+		name       string
+		buf        string
+		want       string
+		wantRemain string
+	}{
+		{
+			name: "Empty key stack",
+			buf:  "",
+			want: "",
+		},
+		{
+			name:       "Single character",
+			buf:        "yes",
+			want:       "y",
+			wantRemain: "es",
+		},
+		{
+			name:       "Multibyte character",
+			buf:        "日本",
+			want:       "日",
+			wantRemain: "本",
+		},
+		{
+			name:       "Arrow key (CSI sequence)",
+			buf:        "\x1b[Ay",
+			want:       "\x1b[A",
+			wantRemain: "y",
+		},
+		{
+			name: "Function key with parameters",
+			buf:  "\x1b[15;5~",
+			want: "\x1b[15;5~",
+		},
+		{
+			name:       "SS3 sequence",
+			buf:        "\x1bOPn",
+			want:       "\x1bOP",
+			wantRemain: "n",
+		},
+		{
+			name:       "Meta-prefixed character",
+			buf:        "\x1bfy",
+			want:       "\x1bf",
+			wantRemain: "y",
+		},
+		{
+			name: "Lone escape",
+			buf:  "\x1b",
+			want: "\x1b",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			keys := &Keys{buf: []byte(test.buf)}
+
+			if got := PopKeySequence(keys); got != test.want {
+				t.Errorf("PopKeySequence() = %q, want %q", got, test.want)
+			}
+
+			if remain := string(keys.buf); remain != test.wantRemain {
+				t.Errorf("PopKeySequence() remaining keys = %q, want %q", remain, test.wantRemain)
+			}
+		})
+	}
+}
+
+func TestPopMouseEvent(t *testing.T) {
+	tests := []struct {
+		name       string
+		buf        string
+		want       MouseEvent
+		wantFound  bool
+		wantRemain string
+	}{
+		{
+			name:       "No mouse event",
+			buf:        "\x1b[Ay",
+			wantRemain: "\x1b[Ay",
+		},
+		{
+			name:       "Left button press",
+			buf:        "\x1b[<0;12;5My",
+			want:       MouseEvent{Button: MouseLeft, X: 12, Y: 5},
+			wantFound:  true,
+			wantRemain: "y",
+		},
+		{
+			name:      "Left button release",
+			buf:       "\x1b[<0;12;5m",
+			want:      MouseEvent{Button: MouseLeft, X: 12, Y: 5, Release: true},
+			wantFound: true,
+		},
+		{
+			name:      "Wheel down with control",
+			buf:       "\x1b[<81;1;20M",
+			want:      MouseEvent{Button: MouseWheelDown, X: 1, Y: 20},
+			wantFound: true,
+		},
+		{
+			name:      "Drag with left button",
+			buf:       "\x1b[<32;3;4M",
+			want:      MouseEvent{Button: MouseLeft, X: 3, Y: 4, Motion: true},
+			wantFound: true,
+		},
+		{
+			name:       "Mouse event after other keys",
+			buf:        "a\x1b[<0;1;1M",
+			wantRemain: "a\x1b[<0;1;1M",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			keys := &Keys{buf: []byte(test.buf)}
+
+			got, found := PopMouseEvent(keys)
+			if found != test.wantFound || got != test.want {
+				t.Errorf("PopMouseEvent() = %+v, %v, want %+v, %v", got, found, test.want, test.wantFound)
+			}
+
+			if remain := string(keys.buf); remain != test.wantRemain {
+				t.Errorf("PopMouseEvent() remaining keys = %q, want %q", remain, test.wantRemain)
+			}
+		})
+	}
+}
+
+func TestPopPasted(t *testing.T) {
+	tests := []struct {
+		name         string
+		buf          string
+		macro        string
+		want         string
+		wantComplete bool
+		wantRemain   string
+	}{
+		{
+			name:         "Complete paste",
+			buf:          "ls -l\x1b[201~",
+			want:         "ls -l",
+			wantComplete: true,
+		},
+		{
+			name:         "Keys typed after the paste",
+			buf:          "ls -l\x1b[201~\r",
+			want:         "ls -l",
+			wantComplete: true,
+			wantRemain:   "\r",
+		},
+		{
+			name: "Paste chunk without its end",
+			buf:  "ls -l | gr",
+			want: "ls -l | gr",
+		},
+		{
+			name:         "Paste fed by a macro",
+			buf:          "ls",
+			macro:        " -l\x1b[201~",
+			want:         "ls -l",
+			wantComplete: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			keys := &Keys{buf: []byte(test.buf), macroKeys: []rune(test.macro)}
+
+			text, complete := popPasted(keys)
+			if string(text) != test.want {
+				t.Errorf("popPasted() = %q, want %q", string(text), test.want)
+			}
+
+			if complete != test.wantComplete {
+				t.Errorf("popPasted() complete = %v, want %v", complete, test.wantComplete)
+			}
+
+			if remain := string(keys.buf); remain != test.wantRemain {
+				t.Errorf("popPasted() remaining keys = %q, want %q", remain, test.wantRemain)
+			}
+		})
+	}
+}
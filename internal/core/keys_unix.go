@@ -23,7 +23,7 @@ func (k *Keys) GetCursorPos() (x, y int) {
 
 	// Echo the query and wait for the main key
 	// reading routine to send us the response back.
-	fmt.Print("\x1b[6n")
+	fmt.Fprint(k.stdout(), "\x1b[6n")
 
 	// In order not to get stuck with an input that might be user-one
 	// (like when the user typed before the shell is fully started, and yet not having
@@ -31,12 +31,12 @@ func (k *Keys) GetCursorPos() (x, y int) {
 	// Everything else is passed back as user input.
 	for {
 		switch {
-		case k.waiting, k.reading:
+		case k.waiting, k.reading, k.pending:
 			cursor = <-k.cursor
 		default:
 			buf := make([]byte, keyScanBufSize)
 
-			read, err := os.Stdin.Read(buf)
+			read, err := k.stdin().Read(buf)
 			if err != nil {
 				return disable()
 			}
@@ -89,7 +89,7 @@ func (k *Keys) readInputFiltered() (keys []byte, err error) {
 	// send by ourselves, because we pause reading.
 	buf := make([]byte, keyScanBufSize)
 
-	read, err := Stdin.Read(buf)
+	read, err := k.stdin().Read(buf)
 	if err != nil && errors.Is(err, io.EOF) {
 		return
 	}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+	"sync"
 	"unicode"
 	"unicode/utf8"
 
@@ -22,10 +23,60 @@ type Tokenizer func(cursorPos int) (split []string, index int, newPos int)
 // split itself with tokenizers, and displaying itself.
 type Line []rune
 
+// editHooks are the functions notified of the modifications of lines, by line.
+var editHooks sync.Map
+
+// OnEdit registers a function called after each modification of the line made
+// with its methods, with the position of the modification, and the number of
+// characters removed and inserted there. A nil function unregisters it.
+func OnEdit(line *Line, edited func(pos, removed, inserted int)) {
+	if edited == nil {
+		editHooks.Delete(line)
+		return
+	}
+
+	editHooks.Store(line, edited)
+}
+
 // Set replaces the line contents altogether with a new slice of characters.
-// If no characters are passed, the line is thus made empty.
+// If no characters are passed, the line is thus made empty. The modification
+// notified (see OnEdit) is the part of the line between their common prefix
+// and suffix.
 func (l *Line) Set(chars ...rune) {
+	hook, found := editHooks.Load(l)
+	if !found {
+		*l = chars
+		return
+	}
+
+	last := *l
 	*l = chars
+
+	prefix := 0
+	for prefix < len(last) && prefix < len(chars) && last[prefix] == chars[prefix] {
+		prefix++
+	}
+
+	suffix := 0
+	for suffix < len(last)-prefix && suffix < len(chars)-prefix &&
+		last[len(last)-1-suffix] == chars[len(chars)-1-suffix] {
+		suffix++
+	}
+
+	if removed, inserted := len(last)-prefix-suffix, len(chars)-prefix-suffix; removed > 0 || inserted > 0 {
+		hook.(func(pos, removed, inserted int))(prefix, removed, inserted)
+	}
+}
+
+// edited notifies the function registered for the line (if any) of a modification.
+func (l *Line) edited(pos, removed, inserted int) {
+	if removed == 0 && inserted == 0 {
+		return
+	}
+
+	if hook, found := editHooks.Load(l); found {
+		hook.(func(pos, removed, inserted int))(pos, removed, inserted)
+	}
 }
 
 // Insert inserts one or more runes at the given position.
@@ -59,6 +110,8 @@ func (l *Line) Insert(pos int, chars ...rune) {
 	case pos == l.Len():
 		*l = append(*l, chars...)
 	}
+
+	l.edited(pos, 0, len(chars))
 }
 
 // InsertBetween inserts one or more runes into the line, between the specified
@@ -74,6 +127,7 @@ func (l *Line) InsertBetween(bpos, epos int, chars ...rune) {
 	switch {
 	case epos == -1:
 		l.Insert(bpos, chars...)
+		return
 	case epos == l.Len():
 		cut := string((*l)[:bpos]) + string(chars)
 		*l = []rune(cut)
@@ -83,6 +137,8 @@ func (l *Line) InsertBetween(bpos, epos int, chars ...rune) {
 		cut += forward
 		*l = []rune(cut)
 	}
+
+	l.edited(bpos, epos-bpos, len(chars))
 }
 
 // Cut deletes a slice of runes between a beginning and end position on the line.
@@ -94,16 +150,21 @@ func (l *Line) Cut(bpos, epos int) {
 		return
 	}
 
+	removed := l.Len() - bpos
+
 	switch epos {
 	case -1:
 		cut := string((*l)[:bpos])
 		*l = []rune(cut)
 	default:
+		removed = epos - bpos
 		forward := string((*l)[epos:])
 		cut := string((*l)[:bpos])
 		cut += forward
 		*l = []rune(cut)
 	}
+
+	l.edited(bpos, removed, 0)
 }
 
 // CutRune deletes a rune at the given position in the line.
@@ -118,12 +179,15 @@ func (l *Line) CutRune(pos int) {
 		*l = (*l)[1:]
 	case pos == l.Len():
 		*l = (*l)[:pos-1]
+		pos--
 	default:
 		forward := string((*l)[pos+1:])
 		cut := string((*l)[:pos])
 		cut += forward
 		*l = []rune(cut)
 	}
+
+	l.edited(pos, 1, 0)
 }
 
 // Len returns the length of the line, as given by ut8.RuneCount.
@@ -133,6 +197,22 @@ func (l *Line) Len() int {
 	return utf8.RuneCountInString(string(*l))
 }
 
+// Fit returns the part of chars that can be inserted in the line without making
+// it longer than max characters (a max of 0 or less means no limit), and true if
+// chars had to be shortened. If all is true, either all chars fit or none does.
+func (l *Line) Fit(chars []rune, max int, all bool) (fit []rune, capped bool) {
+	room := max - l.Len()
+
+	switch {
+	case max <= 0 || len(chars) <= room:
+		return chars, false
+	case all || room <= 0:
+		return nil, true
+	default:
+		return chars[:room], true
+	}
+}
+
 // SelectWord returns the begin and end index positions of a word
 // (separated by punctuation or spaces) around the specified position.
 func (l *Line) SelectWord(pos int) (bpos, epos int) {
@@ -222,6 +302,55 @@ func (l *Line) SelectBlankWord(pos int) (bpos, epos int) {
 	return bpos, epos
 }
 
+// SelectSeparatedWord returns the begin and end index positions of the word in
+// which the specified position is, where words are separated by spaces and any
+// of the given separator characters. Separators that are escaped or quoted are
+// ignored, so that quoted segments are always part of the word containing them.
+// Contrary to other selection functions, the end position is exclusive.
+func (l *Line) SelectSeparatedWord(pos int, separators string) (bpos, epos int) {
+	pos = l.checkPosRange(pos)
+
+	var quote rune
+	var escaped bool
+
+	// Returns true if the rune is an unquoted word separator,
+	// and updates the quoting state of the line as we go.
+	separates := func(char rune) bool {
+		switch {
+		case escaped:
+			escaped = false
+		case char == '\\' && quote != '\'':
+			escaped = true
+		case quote != 0:
+			if char == quote {
+				quote = 0
+			}
+		case char == '"' || char == '\'':
+			quote = char
+		case unicode.IsSpace(char) || strings.ContainsRune(separators, char):
+			return true
+		}
+
+		return false
+	}
+
+	// The word begins after the last separator found before pos.
+	for i := 0; i < pos; i++ {
+		if separates((*l)[i]) {
+			bpos = i + 1
+		}
+	}
+
+	// And ends on the first separator after pos.
+	for epos = pos; epos < l.Len(); epos++ {
+		if separates((*l)[epos]) {
+			break
+		}
+	}
+
+	return bpos, epos
+}
+
 // Find returns the index position of a target rune, or -1 if not found.
 func (l *Line) Find(char rune, pos int, forward bool) int {
 	if l.Len() == 0 {
@@ -319,6 +448,15 @@ func (l *Line) SurroundQuotes(single bool, pos int) (bpos, epos int) {
 // Params:
 // @indent -    Used to align all lines (except the first) together on a single column.
 func DisplayLine(l *Line, indent int) {
+	DisplayLineWith(l, indent, nil, term.NewOutput())
+}
+
+// DisplayLineWith is like DisplayLine, except that if prompts is not nil, each
+// line after the first one is preceded by its prompt (the first prompt is for the
+// second line, and so on) instead of being aligned with the first line. All the
+// prompts should have the same width, since they are used as indentation.
+// The line is printed to the given terminal output.
+func DisplayLineWith(l *Line, indent int, prompts []string, out *term.Output) {
 	lines := strings.Split(string(*l), "\n")
 
 	if strings.HasSuffix(string(*l), "\n") {
@@ -329,21 +467,28 @@ func DisplayLine(l *Line, indent int) {
 		// Don't let any visual selection go further than length.
 		line += color.BgDefault
 
+		lineIndent := indent
+
 		// Clear everything before each line, except the first.
-		if num > 0 {
-			term.MoveCursorForwards(indent)
+		switch {
+		case num > 0 && prompts != nil:
+			prompt := prompts[min(num, len(prompts))-1]
+			lineIndent = strutil.RealLength(prompt)
+			line = term.ClearLineBefore + prompt + color.Reset + line
+		case num > 0:
+			out.MoveCursorForwards(indent)
 			line = term.ClearLineBefore + line
 		}
 
 		// Clear everything after each line, except the last.
 		if num < len(lines)-1 {
-			if len(line)+indent < term.GetWidth() {
+			if len(line)+lineIndent < out.Width() {
 				line += term.ClearLineAfter
 			}
 			line += term.NewlineReturn
 		}
 
-		fmt.Print(line)
+		fmt.Fprint(out, line)
 	}
 }
 
@@ -356,12 +501,25 @@ func DisplayLine(l *Line, indent int) {
 // @x - The number of columns, starting from the terminal left, to the end of the last line.
 // @y - The number of actual lines on which the line spans, accounting for line wrap.
 func CoordinatesLine(l *Line, indent int) (x, y int) {
+	return CoordinatesLineWith(l, indent, indent, strutil.DefaultTabWidth, term.GetWidth())
+}
+
+// CoordinatesLineWith is like CoordinatesLine, except that all lines after
+// the first one start at the secondary indent column, instead of the first one,
+// that tabs are expanded to tab stops every tabWidth columns, and that lines
+// wrap at termWidth columns.
+func CoordinatesLineWith(l *Line, indent, secondary, tabWidth, termWidth int) (x, y int) {
 	line := string(*l)
 	lines := strings.Split(line, "\n")
 	usedY, usedX := 0, 0
 
 	for i, line := range lines {
-		x, y := strutil.LineSpan([]rune(line), i, indent)
+		lineIndent := indent
+		if i > 0 {
+			lineIndent = secondary
+		}
+
+		x, y := strutil.LineSpan([]rune(line), i, lineIndent, tabWidth, termWidth)
 		usedY += y
 		usedX = x
 	}
@@ -383,6 +541,11 @@ func (l *Line) Lines() int {
 // Forward returns the offset to the beginning of the next
 // (forward) token determined by the tokenizer function.
 func (l *Line) Forward(tokenizer Tokenizer, pos int) (adjust int) {
+	// Nothing forward, eg. when repeating a motion past the end of line.
+	if pos >= l.Len() {
+		return
+	}
+
 	split, index, pos := tokenizer(pos)
 
 	switch {
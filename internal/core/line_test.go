@@ -248,6 +248,75 @@ func TestLine_Len(t *testing.T) {
 	}
 }
 
+func TestLine_Fit(t *testing.T) {
+	line := Line("git commit")
+
+	type args struct {
+		chars []rune
+		max   int
+		all   bool
+	}
+	tests := []struct {
+		name       string
+		args       args
+		want       string
+		wantCapped bool
+	}{
+		{
+			name: "No limit",
+			args: args{chars: []rune(" -m 'message'"), max: 0},
+			want: " -m 'message'",
+		},
+		{
+			name: "Paste within the limit",
+			args: args{chars: []rune(" -a"), max: 20},
+			want: " -a",
+		},
+		{
+			name: "Paste filling the line up to the limit",
+			args: args{chars: []rune(" --amend"), max: 18},
+			want: " --amend",
+		},
+		{
+			name:       "Paste exceeding the limit (truncated)",
+			args:       args{chars: []rune(" --amend"), max: 14},
+			want:       " --a",
+			wantCapped: true,
+		},
+		{
+			name:       "Paste exceeding the limit (rejected)",
+			args:       args{chars: []rune(" --amend"), max: 14, all: true},
+			want:       "",
+			wantCapped: true,
+		},
+		{
+			name:       "Paste in a full line",
+			args:       args{chars: []rune("x"), max: 10},
+			want:       "",
+			wantCapped: true,
+		},
+		{
+			name:       "Paste in a line already exceeding the limit",
+			args:       args{chars: []rune("x"), max: 5},
+			want:       "",
+			wantCapped: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fit, capped := line.Fit(test.args.chars, test.args.max, test.args.all)
+			if string(fit) != test.want {
+				t.Errorf("Line.Fit() = %q, want %q", string(fit), test.want)
+			}
+
+			if capped != test.wantCapped {
+				t.Errorf("Line.Fit() capped = %v, want %v", capped, test.wantCapped)
+			}
+		})
+	}
+}
+
 func TestLine_SelectWord(t *testing.T) {
 	line := Line("basic -c true -p on")
 
@@ -381,6 +450,70 @@ func TestLine_SelectBlankWord(t *testing.T) {
 	}
 }
 
+func TestLine_SelectSeparatedWord(t *testing.T) {
+	line := Line(`set key:path/to "quoted:word here" escaped\:sep`)
+
+	type args struct {
+		pos        int
+		separators string
+	}
+	tests := []struct {
+		name     string
+		l        *Line
+		args     args
+		wantBpos int
+		wantEpos int
+	}{
+		{
+			name:     "Select word with only space separators",
+			l:        &line,
+			args:     args{6, ""},
+			wantBpos: 4,
+			wantEpos: 15,
+		},
+		{
+			name:     "Select word between custom separators",
+			l:        &line,
+			args:     args{10, ":/"},
+			wantBpos: 8,
+			wantEpos: 12,
+		},
+		{
+			name:     "Select word right after a separator",
+			l:        &line,
+			args:     args{8, ":/"},
+			wantBpos: 8,
+			wantEpos: 12,
+		},
+		{
+			name:     "Select in middle of quoted word",
+			l:        &line,
+			args:     args{20, ":/"},
+			wantBpos: 16,
+			wantEpos: 34,
+		},
+		{
+			name:     "Select word with escaped separator",
+			l:        &line,
+			args:     args{len(line), ":/"},
+			wantBpos: 35,
+			wantEpos: 47,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			gotBpos, gotEpos := test.l.SelectSeparatedWord(test.args.pos, test.args.separators)
+			if gotBpos != test.wantBpos {
+				t.Errorf("Line.SelectSeparatedWord() gotBpos = %v, want %v", gotBpos, test.wantBpos)
+			}
+			if gotEpos != test.wantEpos {
+				t.Errorf("Line.SelectSeparatedWord() gotEpos = %v, want %v", gotEpos, test.wantEpos)
+			}
+		})
+	}
+}
+
 func TestLine_Find(t *testing.T) {
 	line := Line("basic -f \"commands.go,line.go\" -cp=/usr --option [value1 value2]")
 	pos := 0 // We reuse the same updated position for each next test case.
@@ -672,6 +805,12 @@ func TestLine_Forward(t *testing.T) {
 			args:       args{split: line.TokenizeBlock, pos: 48},
 			wantAdjust: 0,
 		},
+		{
+			name:       "Forward word at end of line (counts are clamped)",
+			l:          &line,
+			args:       args{split: line.Tokenize, pos: len(line)},
+			wantAdjust: 0,
+		},
 	}
 
 	for _, test := range tests {
@@ -1090,3 +1229,88 @@ func TestCoordinatesLine(t *testing.T) {
 		})
 	}
 }
+
+func TestCoordinatesLineWith(t *testing.T) {
+	indent := 10
+	multiline := Line("basic -f \"commands.go \nanother testing\" --alternate \"another\nquote\" -v { expression here } -a [value1 value2]")
+	tabs := Line("a\tb")
+	multilineTabs := Line("abc\n\tb")
+
+	// Reassign the function for getting the terminal width to a fixed value
+	getTermWidth = func() int { return 80 }
+
+	type args struct {
+		indent    int
+		secondary int
+		tabWidth  int
+	}
+	tests := []struct {
+		name  string
+		l     *Line
+		args  args
+		wantX int
+		wantY int
+	}{
+		{
+			name:  "Aligned continuation lines",
+			l:     &multiline,
+			args:  args{indent: indent, secondary: indent},
+			wantY: 2,
+			wantX: indent + 48,
+		},
+		{
+			name:  "Narrower secondary prompt",
+			l:     &multiline,
+			args:  args{indent: indent, secondary: 2},
+			wantY: 2,
+			wantX: 2 + 48,
+		},
+		{
+			name:  "Wrapping continuation line",
+			l:     &multiline,
+			args:  args{indent: indent, secondary: 40},
+			wantY: 3,
+			wantX: 40 + 48 - 80,
+		},
+		{
+			name:  "Tab stops from the indent column",
+			l:     &tabs,
+			args:  args{indent: 3, secondary: 3, tabWidth: 4},
+			wantY: 0,
+			wantX: 9,
+		},
+		{
+			name:  "Default tab stops",
+			l:     &tabs,
+			args:  args{indent: 3, secondary: 3},
+			wantY: 0,
+			wantX: 9,
+		},
+		{
+			name:  "Wide tab stops",
+			l:     &tabs,
+			args:  args{indent: 3, secondary: 3, tabWidth: 10},
+			wantY: 0,
+			wantX: 11,
+		},
+		{
+			name:  "Tab stops from the secondary column",
+			l:     &multilineTabs,
+			args:  args{indent: 10, secondary: 2, tabWidth: 8},
+			wantY: 1,
+			wantX: 9,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			gotX, gotY := CoordinatesLineWith(test.l, test.args.indent, test.args.secondary, test.args.tabWidth, getTermWidth())
+			if gotX != test.wantX {
+				t.Errorf("CoordinatesLineWith() gotX = %v, want %v", gotX, test.wantX)
+			}
+			if gotY != test.wantY {
+				t.Errorf("CoordinatesLineWith() gotY = %v, want %v", gotY, test.wantY)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package core
 import (
 	"regexp"
 	"unicode"
+	"unicode/utf8"
 
 	"github.com/reeflective/readline/inputrc"
 	"github.com/reeflective/readline/internal/color"
@@ -585,13 +586,72 @@ func HighlightMatchers(sel *Selection) {
 	}
 }
 
-// ResetMatchers is used by the display engine
-// to reset matching parens highlighting regions.
+// HighlightSearch adds highlighting to the parts of a line matching an
+// incremental search pattern. The line is the one being displayed, which
+// might not be the one of the selection (eg. with an inserted candidate).
+func HighlightSearch(sel *Selection, line *Line, pattern *regexp.Regexp) {
+	text := string(*line)
+
+	for _, match := range pattern.FindAllStringIndex(text, -1) {
+		bpos := utf8.RuneCountInString(text[:match[0]])
+		epos := utf8.RuneCountInString(text[:match[1]])
+
+		if bpos == epos {
+			continue
+		}
+
+		sel.surrounds = append(sel.surrounds, Selection{
+			Type:   "search",
+			active: true,
+			visual: true,
+			bpos:   bpos,
+			epos:   epos - 1,
+			bg:     color.Fmt(color.Bg + "244"),
+			line:   line,
+			cursor: sel.cursor,
+		})
+	}
+}
+
+// HighlightTrailingSpace adds highlighting to the spaces and tabs at the
+// end of each line in the buffer. Like HighlightSearch, the line is the one
+// being displayed, which might not be the one of the selection.
+func HighlightTrailingSpace(sel *Selection, line *Line) {
+	bpos := 0
+
+	for pos := 0; pos <= line.Len(); pos++ {
+		if pos < line.Len() && (*line)[pos] != '\n' {
+			if (*line)[pos] != ' ' && (*line)[pos] != '\t' {
+				bpos = pos + 1
+			}
+
+			continue
+		}
+
+		if bpos < pos {
+			sel.surrounds = append(sel.surrounds, Selection{
+				Type:   "whitespace",
+				active: true,
+				visual: true,
+				bpos:   bpos,
+				epos:   pos - 1,
+				bg:     color.BgRed,
+				line:   line,
+				cursor: sel.cursor,
+			})
+		}
+
+		bpos = pos + 1
+	}
+}
+
+// ResetMatchers is used by the display engine to reset matching parens,
+// incremental search matches and trailing whitespace highlighting regions.
 func ResetMatchers(sel *Selection) {
 	var surrounds []Selection
 
 	for _, surround := range sel.surrounds {
-		if surround.Type == "matcher" {
+		if surround.IsHighlight() {
 			continue
 		}
 
@@ -601,6 +661,13 @@ func ResetMatchers(sel *Selection) {
 	sel.surrounds = surrounds
 }
 
+// IsHighlight returns true if the selection is only used to highlight
+// parts of the line (matching parens, search matches, etc), and thus
+// uses its own colors instead of the region ones.
+func (s Selection) IsHighlight() bool {
+	return s.Type == "matcher" || s.Type == "search" || s.Type == "whitespace"
+}
+
 // Reset makes the current selection inactive, resetting all of its values.
 func (s *Selection) Reset() {
 	s.Type = ""
@@ -2,6 +2,7 @@ package core
 
 import (
 	"reflect"
+	"regexp"
 	"testing"
 	"unicode"
 )
@@ -1443,6 +1444,112 @@ func TestHighlightMatchers(t *testing.T) {
 	}
 }
 
+func TestHighlightSearch(t *testing.T) {
+	line, cur := newLine("git commit -m 'café commit'")
+
+	tests := []struct {
+		name       string
+		pattern    string
+		wantRanges [][2]int
+	}{
+		{
+			name:    "No match",
+			pattern: "push",
+		},
+		{
+			name:       "Several matches",
+			pattern:    "commit",
+			wantRanges: [][2]int{{4, 10}, {20, 26}},
+		},
+		{
+			name:       "Match after multibyte characters",
+			pattern:    "é c",
+			wantRanges: [][2]int{{18, 21}},
+		},
+		{
+			name:    "Empty matches",
+			pattern: "x*",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sel := newTestSelection(fieldsWith(line, &cur))
+
+			HighlightSearch(sel, &line, regexp.MustCompile(test.pattern))
+
+			if len(sel.surrounds) != len(test.wantRanges) {
+				t.Fatalf("HighlightSearch() len(sel.surrounds) = %v, want %v", len(sel.surrounds), len(test.wantRanges))
+			}
+
+			for i, surround := range sel.surrounds {
+				if bpos, epos := surround.Pos(); bpos != test.wantRanges[i][0] || epos != test.wantRanges[i][1] {
+					t.Errorf("HighlightSearch() match %d = [%d, %d), want %v", i, bpos, epos, test.wantRanges[i])
+				}
+			}
+
+			ResetMatchers(sel)
+
+			if len(sel.surrounds) != 0 {
+				t.Errorf("ResetMatchers() len(sel.surrounds) = %v, want 0", len(sel.surrounds))
+			}
+		})
+	}
+}
+
+func TestHighlightTrailingSpace(t *testing.T) {
+	tests := []struct {
+		name       string
+		line       string
+		wantRanges [][2]int
+	}{
+		{
+			name: "No trailing whitespace",
+			line: "git commit -m 'message'",
+		},
+		{
+			name:       "Trailing spaces and tabs",
+			line:       "git status \t ",
+			wantRanges: [][2]int{{10, 13}},
+		},
+		{
+			name:       "Multiline",
+			line:       "git status  \n\nls -l\n  \ncd ",
+			wantRanges: [][2]int{{10, 12}, {20, 22}, {25, 26}},
+		},
+		{
+			name:       "Only whitespace",
+			line:       "   ",
+			wantRanges: [][2]int{{0, 3}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			line, cur := newLine(test.line)
+			sel := newTestSelection(fieldsWith(line, &cur))
+
+			HighlightTrailingSpace(sel, &line)
+
+			if len(sel.surrounds) != len(test.wantRanges) {
+				t.Fatalf("HighlightTrailingSpace() len(sel.surrounds) = %v, want %v", len(sel.surrounds), len(test.wantRanges))
+			}
+
+			for i, surround := range sel.surrounds {
+				if bpos, epos := surround.Pos(); bpos != test.wantRanges[i][0] || epos != test.wantRanges[i][1] {
+					t.Errorf("HighlightTrailingSpace() region %d = [%d, %d), want %v", i, bpos, epos, test.wantRanges[i])
+				}
+			}
+
+			ResetMatchers(sel)
+
+			if len(sel.surrounds) != 0 {
+				t.Errorf("ResetMatchers() len(sel.surrounds) = %v, want 0", len(sel.surrounds))
+			}
+		})
+	}
+}
+
 func TestResetMatchers(t *testing.T) {
 	line, cur := newLine("multiple-ambiguous { surrounded 'quoted word' } words")
 	type args struct {
@@ -2,6 +2,7 @@ package display
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/reeflective/readline/inputrc"
 	"github.com/reeflective/readline/internal/color"
@@ -18,11 +19,31 @@ var (
 	halfTerminalHeight     = 2
 )
 
+// AutosuggestPrecedence determines how the line autosuggested from the history
+// coexists with the completion menu, since both of them suggest how to complete
+// the line (the suggestion after the cursor, the menu below the line).
+type AutosuggestPrecedence int
+
+const (
+	// MenuOverAutosuggest hides the autosuggested line while the completion
+	// menu is displayed, and shows it again once the menu is closed (default).
+	MenuOverAutosuggest AutosuggestPrecedence = iota
+	// AutosuggestOverMenu hides the completion menu (but not the hints)
+	// while a line is autosuggested, like when autocompleting.
+	AutosuggestOverMenu
+	// AutosuggestWithMenu displays both of them at the same time.
+	AutosuggestWithMenu
+)
+
 // Engine handles all display operations: it refreshes the terminal
 // interface and stores the necessary offsets of each components.
 type Engine struct {
 	// Operating parameters
 	highlighter    func(line []rune) string
+	trailingSpace  bool
+	dimBackground  bool
+	precedence     AutosuggestPrecedence
+	autosuggested  bool
 	startCols      int
 	startRows      int
 	lineCol        int
@@ -32,6 +53,11 @@ type Engine struct {
 	hintRows       int
 	compRows       int
 	primaryPrinted bool
+	tabWidth       int
+
+	// Secondary prompts of continuation lines.
+	secondary     []string
+	secondaryCols int
 
 	// UI components
 	keys      *core.Keys
@@ -44,10 +70,11 @@ type Engine struct {
 	hint      *ui.Hint
 	completer *completion.Engine
 	opts      *inputrc.Config
+	out       *term.Output
 }
 
 // NewEngine is a required constructor for the display engine.
-func NewEngine(k *core.Keys, s *core.Selection, h *history.Sources, p *ui.Prompt, i *ui.Hint, c *completion.Engine, opts *inputrc.Config) *Engine {
+func NewEngine(k *core.Keys, s *core.Selection, h *history.Sources, p *ui.Prompt, i *ui.Hint, c *completion.Engine, opts *inputrc.Config, out *term.Output) *Engine {
 	return &Engine{
 		keys:      k,
 		selection: s,
@@ -56,6 +83,7 @@ func NewEngine(k *core.Keys, s *core.Selection, h *history.Sources, p *ui.Prompt
 		hint:      i,
 		completer: c,
 		opts:      opts,
+		out:       out,
 	}
 }
 
@@ -66,22 +94,64 @@ func Init(e *Engine, highlighter func([]rune) string) {
 	e.highlighter = highlighter
 }
 
+// SetTrailingWhitespace enables or disables highlighting
+// the whitespace at the end of each line in the input buffer.
+func (e *Engine) SetTrailingWhitespace(enabled bool) {
+	e.trailingSpace = enabled
+}
+
+// SetTabWidth sets the number of columns between tab stops,
+// used to expand the tabs of the input line when displaying it.
+func (e *Engine) SetTabWidth(width int) {
+	e.tabWidth = width
+}
+
+// SetDimBackground enables or disables dimming the prompt and the input
+// line while the completion menu has the focus (menu-select keymap).
+func (e *Engine) SetDimBackground(enabled bool) {
+	e.dimBackground = enabled
+}
+
+// SetAutosuggestPrecedence sets how the autosuggested line
+// and the completion menu are displayed when both are available.
+func (e *Engine) SetAutosuggestPrecedence(precedence AutosuggestPrecedence) {
+	e.precedence = precedence
+}
+
+// Autosuggesting returns true if a line autosuggested from the history
+// is currently displayed, and can thus be accepted by the user.
+func (e *Engine) Autosuggesting() bool {
+	return e.autosuggested
+}
+
 // Refresh recomputes and redisplays the entire readline interface, except
 // the first lines of the primary prompt when the latter is a multiline one.
 func (e *Engine) Refresh() {
-	fmt.Print(term.HideCursor)
+	fmt.Fprint(e.out, term.HideCursor)
 
 	// Go back to the first column, and if the primary prompt
 	// was not printed yet, back up to the line's beginning row.
-	term.MoveCursorBackwards(term.GetWidth())
+	e.out.MoveCursorBackwards(e.out.Width())
 
 	if !e.primaryPrinted {
-		term.MoveCursorUp(e.cursorRow)
+		e.out.MoveCursorUp(e.cursorRow)
+	}
+
+	// Recompute completions if autocompletion is on, so that we know
+	// if the menu is displayed when printing the line. When dimming,
+	// this must be known before printing the prompt as well.
+	if e.dimBackground {
+		e.completer.Autocomplete()
 	}
 
 	// Print either all or the last line of the prompt.
+	e.prompt.SetDimmed(e.dimmed())
 	e.prompt.LastPrint()
 
+	if !e.dimBackground {
+		e.completer.Autocomplete()
+	}
+
 	// Get all positions required for the redisplay to come:
 	// prompt end (thus indentation), cursor positions, etc.
 	e.computeCoordinates(true)
@@ -94,7 +164,7 @@ func (e *Engine) Refresh() {
 	// Go back to the start of the line, then to cursor.
 	e.cursorHintToLineStart()
 	e.lineStartToCursorPos()
-	fmt.Print(term.ShowCursor)
+	fmt.Fprint(e.out, term.ShowCursor)
 }
 
 // PrintPrimaryPrompt redraws the primary prompt.
@@ -105,15 +175,46 @@ func (e *Engine) PrintPrimaryPrompt() {
 	e.primaryPrinted = true
 }
 
+// RefreshPrompt redraws the primary prompt in place (all of its lines, which
+// are generated again), and then the input line and helpers below it, with
+// the cursor kept at its position in the line.
+func (e *Engine) RefreshPrompt() {
+	fmt.Fprint(e.out, term.HideCursor)
+
+	// Go back to the first row and column of the primary prompt.
+	e.CursorToLineStart()
+	e.out.MoveCursorUp(e.prompt.PrimaryUsed())
+	e.out.MoveCursorBackwards(e.out.Width())
+	fmt.Fprint(e.out, term.ClearScreenBelow)
+
+	e.PrintPrimaryPrompt()
+	e.Refresh()
+}
+
+// ClearScreen clears the visible screen, and the terminal scrollback buffer if
+// scrollback is true, and redraws the primary prompt at the top of the screen.
+// The input line (with the cursor at its current position), its hints and any
+// completions are redrawn below it by the next refresh, and are thus preserved.
+func (e *Engine) ClearScreen(scrollback bool) {
+	fmt.Fprint(e.out, term.CursorTopLeft)
+	fmt.Fprint(e.out, term.ClearScreen)
+
+	if scrollback {
+		fmt.Fprint(e.out, term.ClearDisplay)
+	}
+
+	e.PrintPrimaryPrompt()
+}
+
 // ClearHelpers clears the hint and completion sections below the line.
 func (e *Engine) ClearHelpers() {
 	e.CursorBelowLine()
-	fmt.Print(term.ClearScreenBelow)
+	fmt.Fprint(e.out, term.ClearScreenBelow)
 
-	term.MoveCursorUp(1)
-	term.MoveCursorUp(e.lineRows)
-	term.MoveCursorDown(e.cursorRow)
-	term.MoveCursorForwards(e.cursorCol)
+	e.out.MoveCursorUp(1)
+	e.out.MoveCursorUp(e.lineRows)
+	e.out.MoveCursorDown(e.cursorRow)
+	e.out.MoveCursorForwards(e.cursorCol)
 }
 
 // ResetHelpers cancels all active hints and completions.
@@ -132,17 +233,17 @@ func (e *Engine) AcceptLine() {
 	e.computeCoordinates(false)
 
 	// Go back to the end of the non-suggested line.
-	term.MoveCursorBackwards(term.GetWidth())
-	term.MoveCursorDown(e.lineRows)
-	term.MoveCursorForwards(e.lineCol)
-	fmt.Print(term.ClearScreenBelow)
+	e.out.MoveCursorBackwards(e.out.Width())
+	e.out.MoveCursorDown(e.lineRows)
+	e.out.MoveCursorForwards(e.lineCol)
+	fmt.Fprint(e.out, term.ClearScreenBelow)
 
 	// Reprint the right-side prompt if it's not a tooltip one.
 	e.prompt.RightPrint(e.lineCol, false)
 
 	// Go below this non-suggested line and clear everything.
-	term.MoveCursorBackwards(term.GetWidth())
-	fmt.Print(term.NewlineReturn)
+	e.out.MoveCursorBackwards(e.out.Width())
+	fmt.Fprint(e.out, term.NewlineReturn)
 }
 
 // RefreshTransient goes back to the first line of the input buffer
@@ -154,21 +255,21 @@ func (e *Engine) RefreshTransient() {
 
 	// Go to the beginning of the primary prompt.
 	e.CursorToLineStart()
-	term.MoveCursorUp(e.prompt.PrimaryUsed())
+	e.out.MoveCursorUp(e.prompt.PrimaryUsed())
 
 	// And redisplay the transient/primary/line.
 	e.prompt.TransientPrint()
 	e.displayLine()
-	fmt.Print(term.NewlineReturn)
+	fmt.Fprint(e.out, term.NewlineReturn)
 }
 
 // CursorToLineStart moves the cursor just after the primary prompt.
 // This function should only be called when the cursor is on its
 // "cursor" position on the input line.
 func (e *Engine) CursorToLineStart() {
-	term.MoveCursorBackwards(e.cursorCol)
-	term.MoveCursorUp(e.cursorRow)
-	term.MoveCursorForwards(e.startCols)
+	e.out.MoveCursorBackwards(e.cursorCol)
+	e.out.MoveCursorUp(e.cursorRow)
+	e.out.MoveCursorForwards(e.startCols)
 }
 
 // CursorBelowLine moves the cursor to the leftmost
@@ -176,24 +277,24 @@ func (e *Engine) CursorToLineStart() {
 // This function should only be called when the cursor
 // is on its "cursor" position on the input line.
 func (e *Engine) CursorBelowLine() {
-	term.MoveCursorUp(e.cursorRow)
-	term.MoveCursorDown(e.lineRows)
-	fmt.Print(term.NewlineReturn)
+	e.out.MoveCursorUp(e.cursorRow)
+	e.out.MoveCursorDown(e.lineRows)
+	fmt.Fprint(e.out, term.NewlineReturn)
 }
 
 // lineStartToCursorPos can be used if the cursor is currently
 // at the very start of the input line, that is just after the
 // last character of the prompt.
 func (e *Engine) lineStartToCursorPos() {
-	term.MoveCursorDown(e.cursorRow)
-	term.MoveCursorBackwards(term.GetWidth())
-	term.MoveCursorForwards(e.cursorCol)
+	e.out.MoveCursorDown(e.cursorRow)
+	e.out.MoveCursorBackwards(e.out.Width())
+	e.out.MoveCursorForwards(e.cursorCol)
 }
 
 // cursor is on the line below the last line of input.
 func (e *Engine) cursorHintToLineStart() {
-	term.MoveCursorUp(1)
-	term.MoveCursorUp(e.lineRows - e.cursorRow)
+	e.out.MoveCursorUp(1)
+	e.out.MoveCursorUp(e.lineRows - e.cursorRow)
 	e.CursorToLineStart()
 }
 
@@ -219,15 +320,25 @@ func (e *Engine) computeCoordinates(suggested bool) {
 		e.startCols = e.prompt.LastUsed()
 	}
 
-	e.cursorCol, e.cursorRow = core.CoordinatesCursor(e.cursor, e.startCols)
+	// Continuation lines either start with secondary prompts,
+	// or are aligned with the first line of input.
+	displayed := e.line
+	e.autosuggested = suggested && e.showAutosuggest()
 
-	// Get the number of rows used by the line, and the end line X pos.
-	if e.opts.GetBool("history-autosuggest") && suggested {
-		e.lineCol, e.lineRows = core.CoordinatesLine(&e.suggested, e.startCols)
-	} else {
-		e.lineCol, e.lineRows = core.CoordinatesLine(e.line, e.startCols)
+	if e.autosuggested {
+		displayed = &e.suggested
+	}
+
+	e.secondary, e.secondaryCols = e.prompt.SecondaryPrompts(displayed.Lines())
+	if e.secondary == nil {
+		e.secondaryCols = e.startCols
 	}
 
+	e.cursorCol, e.cursorRow = core.CoordinatesCursorWith(e.cursor, e.startCols, e.secondaryCols, e.tabWidth, e.out.Width())
+
+	// Get the number of rows used by the line, and the end line X pos.
+	e.lineCol, e.lineRows = core.CoordinatesLineWith(displayed, e.startCols, e.secondaryCols, e.tabWidth, e.out.Width())
+
 	e.primaryPrinted = false
 }
 
@@ -247,53 +358,117 @@ func (e *Engine) displayLine() {
 		defer core.ResetMatchers(e.selection)
 	}
 
+	// And the incremental search matches in an inserted candidate.
+	if pattern := e.completer.IsearchHighlight(); pattern != nil {
+		core.HighlightSearch(e.selection, e.line, pattern)
+		defer core.ResetMatchers(e.selection)
+	}
+
+	// And the whitespace at the end of lines.
+	if e.trailingSpace {
+		core.HighlightTrailingSpace(e.selection, e.line)
+		defer core.ResetMatchers(e.selection)
+	}
+
 	// Apply visual selections highlighting if any
 	line = e.highlightLine([]rune(line), *e.selection)
 
 	// Get the subset of the suggested line to print.
-	if len(e.suggested) > e.line.Len() && e.opts.GetBool("history-autosuggest") {
-		line += color.Dim + color.Fmt(color.Fg+"242") + string(e.suggested[e.line.Len():]) + color.Reset
+	if e.autosuggested {
+		suggested := strutil.FormatControls(string(e.suggested[e.line.Len():]))
+		line += color.Dim + color.Fmt(color.Fg+"242") + suggested + color.Reset
+	}
+
+	// Attenuate the line (and its colors) while the menu has the focus.
+	if e.dimmed() {
+		line = color.Dimmed(line)
+	}
+
+	// Format tabs as spaces, for consistent display (control characters
+	// have been formatted before adding colors), from the columns at
+	// which the first line and the continuation lines start.
+	first, continued, multiline := strings.Cut(line, "\n")
+	line = strutil.FormatTabs(first, e.tabWidth, e.startCols)
+
+	if multiline {
+		line += "\n" + strutil.FormatTabs(continued, e.tabWidth, e.secondaryCols)
 	}
 
-	// Format tabs as spaces, for consistent display
-	line = strutil.FormatTabs(line) + term.ClearLineAfter
+	line += term.ClearLineAfter
 
 	// And display the line.
 	e.suggested.Set([]rune(line)...)
-	core.DisplayLine(&e.suggested, e.startCols)
+	core.DisplayLineWith(&e.suggested, e.startCols, e.secondary, e.out)
 
 	// Adjust the cursor if the line fits exactly in the terminal width.
 	if e.lineCol == 0 {
-		fmt.Print(term.NewlineReturn)
-		fmt.Print(term.ClearLineAfter)
+		fmt.Fprint(e.out, term.NewlineReturn)
+		fmt.Fprint(e.out, term.ClearLineAfter)
 	}
 }
 
+// dimmed returns true if the prompt and line must be dimmed, because
+// candidates are being selected in the completion menu below them.
+func (e *Engine) dimmed() bool {
+	return e.dimBackground && e.completer.Selecting() && e.completer.HasMenu()
+}
+
+// showAutosuggest returns true if there is a line autosuggested from the
+// history, and if it is not hidden by the completion menu being displayed.
+func (e *Engine) showAutosuggest() bool {
+	if !e.opts.GetBool("history-autosuggest") || e.suggested.Len() <= e.line.Len() {
+		return false
+	}
+
+	return e.precedence != MenuOverAutosuggest || !e.completer.HasMenu()
+}
+
 // displayHelpers renders the hint and completion sections.
 // It assumes that the cursor is on the last line of input,
 // and goes back to this same line after displaying this.
 func (e *Engine) displayHelpers() {
-	fmt.Print(term.NewlineReturn)
+	fmt.Fprint(e.out, term.NewlineReturn)
 
-	// Recompute completions and hints if autocompletion is on.
-	e.completer.Autocomplete()
+	// Display hint and completions, unless the latter
+	// are hidden by the autosuggested line.
+	ui.DisplayHint(e.hint, e.out)
+	e.hintRows = ui.CoordinatesHint(e.hint, e.out.Width())
 
-	// Display hint and completions.
-	ui.DisplayHint(e.hint)
-	e.hintRows = ui.CoordinatesHint(e.hint)
-	completion.Display(e.completer, e.AvailableHelperLines())
-	e.compRows = completion.Coordinates(e.completer)
+	if e.autosuggested && e.precedence == AutosuggestOverMenu {
+		fmt.Fprint(e.out, term.ClearScreenBelow)
+		e.compRows = 0
+	} else {
+		completion.Display(e.completer, e.AvailableHelperLines())
+		e.compRows = completion.Coordinates(e.completer)
+	}
 
 	// Go back to the first line below the input line.
-	term.MoveCursorBackwards(term.GetWidth())
-	term.MoveCursorUp(e.compRows)
-	term.MoveCursorUp(ui.CoordinatesHint(e.hint))
+	e.out.MoveCursorBackwards(e.out.Width())
+	e.out.MoveCursorUp(e.compRows)
+	e.out.MoveCursorUp(ui.CoordinatesHint(e.hint, e.out.Width()))
+}
+
+// CompletionsRow returns the terminal row (starting at 1) of the first line of
+// completions, as last displayed, or -1 if the line position is not known.
+func (e *Engine) CompletionsRow() int {
+	if e.startRows < 1 {
+		return -1
+	}
+
+	row := e.startRows + e.lineRows + e.hintRows + 1
+
+	// The screen scrolls if completions are displayed past its bottom.
+	if bottom := row + e.compRows; bottom > e.out.Length() {
+		row -= bottom - e.out.Length()
+	}
+
+	return row
 }
 
 // AvailableHelperLines returns the number of lines available below the hint section.
 // It returns half the terminal space if we currently have less than 1/3rd of it below.
 func (e *Engine) AvailableHelperLines() int {
-	termHeight := term.GetLength()
+	termHeight := e.out.Length()
 	compLines := termHeight - e.startRows - e.lineRows - e.hintRows
 
 	if compLines < (termHeight / oneThirdTerminalHeight) {
@@ -9,25 +9,99 @@ import (
 
 	"github.com/reeflective/readline/internal/color"
 	"github.com/reeflective/readline/internal/core"
+	"github.com/reeflective/readline/internal/strutil"
 )
 
+// Token is a range of runes of the input line, from Start (included) to
+// End (excluded), highlighted with a style (SGR parameters, eg. "1;32").
+type Token struct {
+	Start int
+	End   int
+	Style string
+}
+
+// TokenHighlighter returns a syntax highlighter rendering the line with the styles
+// of the tokens returned by tokenize. Tokens are clamped to the line, and those
+// left empty are ignored. Where tokens overlap, their styles are composed in the
+// order in which they are returned: the parameters of the last one come last, and
+// thus take precedence over conflicting ones (eg. foreground colors), so that the
+// result never depends on anything else than the tokens order.
+func TokenHighlighter(tokenize func(line string) []Token) func(line []rune) string {
+	return func(line []rune) string {
+		styles := make([]string, len(line))
+
+		for _, token := range tokenize(string(line)) {
+			start, end := max(token.Start, 0), min(token.End, len(line))
+
+			for pos := start; pos < end && token.Style != ""; pos++ {
+				if styles[pos] != "" {
+					styles[pos] += ";"
+				}
+
+				styles[pos] += token.Style
+			}
+		}
+
+		var highlighted strings.Builder
+
+		current := ""
+
+		for pos, char := range line {
+			if styles[pos] != current {
+				highlighted.WriteString(color.Reset)
+
+				if styles[pos] != "" {
+					highlighted.WriteString(color.Fmt(styles[pos]))
+				}
+
+				current = styles[pos]
+			}
+
+			highlighted.WriteRune(char)
+		}
+
+		if current != "" {
+			highlighted.WriteString(color.Reset)
+		}
+
+		return highlighted.String()
+	}
+}
+
+// colorStart matches a color sequence at the start of a string.
+var colorStart = regexp.MustCompile(`^\x1b\[[0-9;]*m`)
+
 // highlightLine applies visual/selection highlighting to a line.
 // The provided line might already have been highlighted by a user-provided
 // highlighter: this function accounts for any embedded color sequences.
 func (e *Engine) highlightLine(line []rune, selection core.Selection) string {
+	// Find the colors added by the highlighter, if any.
+	colorSeqs := highlighterColors(line, *e.line)
+
 	// Sort regions and extract colors/positions.
 	sorted := sortHighlights(selection)
-	colors := e.getHighlights(line, sorted)
+	colors := e.getHighlights(line, colorSeqs, sorted)
 
 	var highlighted string
 
-	// And apply highlighting before each rune.
+	// And apply highlighting before each rune. Control characters
+	// of the input line are rendered safely, with caret notation,
+	// even when starting colors: only those added by the highlighter
+	// are printed as is.
 	for i, r := range line {
 		if highlight, found := colors[i]; found {
 			highlighted += string(highlight)
 		}
 
-		highlighted += string(r)
+		if len(colorSeqs) > 0 && i >= colorSeqs[0][0] {
+			highlighted += string(r)
+
+			if i == colorSeqs[0][1]-1 {
+				colorSeqs = colorSeqs[1:]
+			}
+		} else {
+			highlighted += strutil.FormatControls(string(r))
+		}
 	}
 
 	// Finally, highlight comments using a regex.
@@ -95,15 +169,33 @@ func sortHighlights(vhl core.Selection) []core.Selection {
 	return sorted
 }
 
-func (e *Engine) getHighlights(line []rune, sorted []core.Selection) map[int][]rune {
-	highlights := make(map[int][]rune)
-
-	// Find any highlighting already applied on the line,
-	// and keep the indexes so that we can skip those.
+// highlighterColors returns the start and end indexes of the color sequences
+// added to the input line by the user highlighter, as opposed to those found
+// in the input line itself (typed or pasted), which are only text to display.
+func highlighterColors(line, input []rune) [][]int {
 	var colors [][]int
 
-	colorMatch := regexp.MustCompile(`\x1b\[[0-9;]+m`)
-	colors = colorMatch.FindAllStringIndex(string(line), -1)
+	for pos, inputPos := 0, 0; pos < len(line); {
+		if seq := []rune(colorStart.FindString(string(line[pos:]))); len(seq) > 0 &&
+			!strings.HasPrefix(string(input[inputPos:]), string(seq)) {
+			colors = append(colors, []int{pos, pos + len(seq)})
+			pos += len(seq)
+
+			continue
+		}
+
+		if inputPos < len(input) && line[pos] == input[inputPos] {
+			inputPos++
+		}
+
+		pos++
+	}
+
+	return colors
+}
+
+func (e *Engine) getHighlights(line []rune, colors [][]int, sorted []core.Selection) map[int][]rune {
+	highlights := make(map[int][]rune)
 
 	// marks that started highlighting, but not done yet.
 	regions := make([]core.Selection, 0)
@@ -170,7 +262,7 @@ func (e *Engine) hlAdd(regions []core.Selection, newHl core.Selection, line []ru
 	}
 
 	fg, bg = hl.Highlights()
-	matcher = hl.Type == "matcher"
+	matcher = hl.IsHighlight()
 
 	// Update the highlighting with inputrc settings if any.
 	if bg != "" && !matcher {
@@ -191,7 +283,7 @@ func (e *Engine) hlReset(regions []core.Selection, line []rune, pos int) ([]core
 	for i, reg := range regions {
 		_, epos := reg.Pos()
 		foreground, background := reg.Highlights()
-		matcher := reg.Type == "matcher"
+		matcher := reg.IsHighlight()
 
 		if epos != pos {
 			continue
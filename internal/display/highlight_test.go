@@ -0,0 +1,101 @@
+package display
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/reeflective/readline/internal/color"
+)
+
+func TestTokenHighlighter(t *testing.T) {
+	green, bold := color.Fmt("32"), color.Fmt("1")
+
+	tests := []struct {
+		name   string
+		line   string
+		tokens []Token
+		want   string
+	}{
+		{
+			name: "No tokens",
+			line: "git status",
+			want: "git status",
+		},
+		{
+			name:   "Single token",
+			line:   "git status",
+			tokens: []Token{{Start: 0, End: 3, Style: "32"}},
+			want:   color.Reset + green + "git" + color.Reset + " status",
+		},
+		{
+			name:   "Out of range tokens clamped",
+			line:   "ls",
+			tokens: []Token{{Start: -4, End: 1, Style: "32"}, {Start: 1, End: 10, Style: "1"}, {Start: 5, End: 8, Style: "31"}},
+			want:   color.Reset + green + "l" + color.Reset + bold + "s" + color.Reset,
+		},
+		{
+			name:   "Overlapping tokens composed in order",
+			line:   "echo 42",
+			tokens: []Token{{Start: 0, End: 7, Style: "1"}, {Start: 5, End: 7, Style: "32"}},
+			want:   color.Reset + bold + "echo " + color.Reset + color.Fmt("1;32") + "42" + color.Reset,
+		},
+		{
+			name:   "Multibyte runes",
+			line:   "échó 'été'",
+			tokens: []Token{{Start: 5, End: 10, Style: "32"}},
+			want:   "échó " + color.Reset + green + "'été'" + color.Reset,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			highlighter := TokenHighlighter(func(string) []Token { return test.tokens })
+
+			if got := highlighter([]rune(test.line)); got != test.want {
+				t.Errorf("TokenHighlighter() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestHighlighterColors(t *testing.T) {
+	green, red := color.Fmt("32"), color.Fmt("31")
+
+	tests := []struct {
+		name        string
+		input       string
+		highlighted string
+		want        [][]int
+	}{
+		{name: "No highlighter", input: "git", highlighted: "git"},
+		{
+			name:        "Highlighter colors",
+			input:       "git",
+			highlighted: green + "git" + color.Reset,
+			want:        [][]int{{0, 5}, {8, 12}},
+		},
+		{name: "Colors in the input", input: red + "git", highlighted: red + "git"},
+		{
+			name:        "Colors in the input and highlighter colors",
+			input:       "a" + red + "b",
+			highlighted: green + "a" + red + "b" + color.Reset,
+			want:        [][]int{{0, 5}, {12, 16}},
+		},
+		{
+			name:        "Highlighter color before the same color in the input",
+			input:       red + "b",
+			highlighted: red + red + "b",
+			want:        [][]int{{5, 10}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := highlighterColors([]rune(test.highlighted), []rune(test.input))
+
+			if fmt.Sprint(got) != fmt.Sprint(test.want) {
+				t.Errorf("highlighterColors(%q) = %v, want %v", test.highlighted, got, test.want)
+			}
+		})
+	}
+}
@@ -18,6 +18,10 @@ var (
 
 	numRegisters   = 10
 	alphaRegisters = 52
+
+	// registerPreviewLen is the maximum length of register contents
+	// displayed in the registers completion menu (fully described).
+	registerPreviewLen = 30
 )
 
 // Buffers is a list of registers in which to put yanked/cut contents.
@@ -182,6 +186,40 @@ func (reg *Buffers) WriteTo(register rune, content ...rune) {
 	}
 }
 
+// KillRing returns the contents of the kill ring (the numbered registers),
+// from the most recent kill (the one yanked by default) to the oldest one.
+func (reg *Buffers) KillRing() []string {
+	ring := make([]string, 0, len(reg.num))
+
+	for num := 0; num < numRegisters; num++ {
+		if buf, found := reg.num[num]; found {
+			ring = append(ring, string(buf))
+		}
+	}
+
+	return ring
+}
+
+// Registers returns the contents of all registers, indexed by their names:
+// numbered ones ("0" to "9"), lettered ones ("a" to "z") and read-only ones.
+func (reg *Buffers) Registers() map[string]string {
+	registers := make(map[string]string, len(reg.num)+len(reg.alpha)+len(reg.ro))
+
+	for num, buf := range reg.num {
+		registers[strconv.Itoa(num)] = string(buf)
+	}
+
+	for letter, buf := range reg.alpha {
+		registers[string(letter)] = string(buf)
+	}
+
+	for name, buf := range reg.ro {
+		registers[string(name)] = string(buf)
+	}
+
+	return registers
+}
+
 // IsSelected returns the name of the selected register, and
 // true if one is indeed selected, or the default one and false.
 func (reg *Buffers) IsSelected() (name string, selected bool) {
@@ -211,11 +249,14 @@ func (reg *Buffers) Complete() completion.Values {
 
 	comps.NoSort["*"] = true
 
-	if comps.ListLong == nil {
-		comps.ListLong = make(map[string]bool)
+	if comps.Layouts == nil {
+		comps.Layouts = make(map[string]completion.Layout)
 	}
 
-	comps.ListLong["*"] = true
+	comps.Layouts["*"] = completion.LayoutList
+
+	// Register contents are pasted at the cursor.
+	comps.AtCursor = true
 
 	// Registers Hint
 	hint := color.Bold + color.FgBlue + "(registers)"
@@ -291,12 +332,12 @@ func (reg *Buffers) completeNumRegs() []completion.Candidate {
 
 	for _, num := range nums {
 		buf := reg.num[num]
-		display := strings.ReplaceAll(string(buf), "\n", ` `)
 
 		comp := completion.Candidate{
-			Tag:     tag,
-			Value:   string(buf),
-			Display: fmt.Sprintf("%s\"%d%s %s", color.Dim, num, color.DimReset, display),
+			Tag:         tag,
+			Value:       string(buf),
+			Display:     fmt.Sprintf("%s\"%d%s %s", color.Dim, num, color.DimReset, registerPreview(buf, true)),
+			Description: registerPreview(buf, false),
 		}
 
 		regs = append(regs, comp)
@@ -314,16 +355,16 @@ func (reg *Buffers) completeAlphaRegs() []completion.Candidate {
 		lett = append(lett, slot)
 	}
 
-	sort.Slice(lett, func(i, j int) bool { return i < j })
+	sort.Slice(lett, func(i, j int) bool { return lett[i] < lett[j] })
 
 	for _, letter := range lett {
 		buf := reg.alpha[letter]
-		display := strings.ReplaceAll(string(buf), "\n", ` `)
 
 		comp := completion.Candidate{
-			Tag:     tag,
-			Value:   string(buf),
-			Display: fmt.Sprintf("%s\"%s%s %s", color.Dim, string(letter), color.DimReset, display),
+			Tag:         tag,
+			Value:       string(buf),
+			Display:     fmt.Sprintf("%s\"%s%s %s", color.Dim, string(letter), color.DimReset, registerPreview(buf, true)),
+			Description: registerPreview(buf, false),
 		}
 
 		regs = append(regs, comp)
@@ -331,3 +372,16 @@ func (reg *Buffers) completeAlphaRegs() []completion.Candidate {
 
 	return regs
 }
+
+// registerPreview returns the contents of a register with newlines
+// and tabs escaped, truncated with an ellipsis if truncate is true.
+func registerPreview(buf []rune, truncate bool) string {
+	escaper := strings.NewReplacer("\n", `\n`, "\t", `\t`, "\r", `\r`)
+	preview := []rune(escaper.Replace(string(buf)))
+
+	if truncate && len(preview) > registerPreviewLen {
+		preview = append(preview[:registerPreviewLen-1], '…')
+	}
+
+	return string(preview)
+}
@@ -0,0 +1,246 @@
+package history
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/reeflective/readline/internal/strutil"
+)
+
+// ErrNoHistory is returned when expanding history events without any history source.
+var ErrNoHistory = errors.New("no command history source")
+
+// ExpandLine performs bash-style history expansion on a line, with the current
+// history source, and returns the expanded line. The supported events are:
+//
+//	!!       The last history line.
+//	!$       The last argument of the last history line.
+//	!n       The history line number n (starting at 1).
+//	!-n      The history line n lines back.
+//	!prefix  The most recent history line starting with prefix.
+//	!?str?   The most recent history line containing str (the last '?'
+//	         may be omitted if it ends the line).
+//	^old^new The last history line, with the first occurrence of old
+//	         replaced with new (only at the beginning of the line, the
+//	         last '^' may be omitted, and is followed by the rest of it).
+//
+// Events in single quotes, or with an escaped '!', are not expanded,
+// and neither are '!' followed by a space, a '=', a '(', a quote, a
+// shell operator (;&|<>) or the line end.
+// If an event cannot be found, an error mentioning it is returned.
+func (h *Sources) ExpandLine(line string) (string, error) {
+	if strings.HasPrefix(line, "^") {
+		return h.substitute(line)
+	}
+
+	if !strings.Contains(line, "!") {
+		return line, nil
+	}
+
+	var expanded strings.Builder
+
+	runes := []rune(line)
+	quoted, escaped := false, false
+
+	for pos := 0; pos < len(runes); pos++ {
+		char := runes[pos]
+
+		switch {
+		case escaped:
+			escaped = false
+		case char == '\\' && !quoted:
+			escaped = true
+		case char == '\'':
+			quoted = !quoted
+		case char == '!' && !quoted && isEventStart(runes, pos+1):
+			event, length := readEvent(runes[pos+1:])
+
+			// Without an event designator, the '!' is kept as is.
+			if length == 0 {
+				break
+			}
+
+			value, err := h.expandEvent(event)
+			if err != nil {
+				return line, err
+			}
+
+			expanded.WriteString(value)
+			pos += length
+
+			continue
+		}
+
+		expanded.WriteRune(char)
+	}
+
+	return expanded.String(), nil
+}
+
+// substitute performs the quick substitution (^old^new^) at the beginning of
+// the line, on the last history line, and expands the rest of the line.
+func (h *Sources) substitute(line string) (string, error) {
+	parts := strings.SplitN(line[1:], "^", 3)
+
+	old, replacement, rest := parts[0], "", ""
+	if len(parts) > 1 {
+		replacement = parts[1]
+	}
+
+	if len(parts) > 2 {
+		rest = parts[2]
+	}
+
+	failed := fmt.Errorf("^%s^%s: substitution failed", old, replacement)
+
+	history := h.Current()
+	if history == nil {
+		return line, ErrNoHistory
+	}
+
+	last, err := h.eventLine(history.Len()-1, failed)
+	if err != nil || old == "" || !strings.Contains(last, old) {
+		return line, failed
+	}
+
+	rest, err = h.ExpandLine(rest)
+	if err != nil {
+		return line, err
+	}
+
+	return strings.Replace(last, old, replacement, 1) + rest, nil
+}
+
+// expandEvent returns the history line (or word) designated by an event.
+func (h *Sources) expandEvent(event string) (string, error) {
+	history := h.Current()
+	if history == nil {
+		return "", ErrNoHistory
+	}
+
+	notFound := fmt.Errorf("!%s: event not found", event)
+
+	switch {
+	case event == "!":
+		return h.eventLine(history.Len()-1, notFound)
+
+	case event == "$":
+		last, err := h.eventLine(history.Len()-1, notFound)
+		if err != nil {
+			return "", err
+		}
+
+		words, err := strutil.Split(last)
+		if err != nil || len(words) == 0 {
+			words = strings.Fields(last)
+		}
+
+		if len(words) == 0 {
+			return "", notFound
+		}
+
+		return words[len(words)-1], nil
+	}
+
+	// Absolute or relative line numbers.
+	if number, err := strconv.Atoi(event); err == nil {
+		if number < 0 {
+			return h.eventLine(history.Len()+number, notFound)
+		}
+
+		return h.eventLine(number-1, notFound)
+	}
+
+	// Or the most recent line containing, or starting with the event.
+	match := strings.HasPrefix
+
+	if strings.HasPrefix(event, "?") {
+		event = strings.TrimSuffix(event[1:], "?")
+		match = strings.Contains
+	}
+
+	for pos := history.Len() - 1; pos >= 0; pos-- {
+		line, err := history.GetLine(pos)
+		if err == nil && match(line, event) {
+			return line, nil
+		}
+	}
+
+	return "", notFound
+}
+
+// eventLine returns a line of the current history source, or a default error.
+func (h *Sources) eventLine(pos int, notFound error) (string, error) {
+	history := h.Current()
+
+	if pos < 0 || pos >= history.Len() {
+		return "", notFound
+	}
+
+	line, err := history.GetLine(pos)
+	if err != nil {
+		return "", notFound
+	}
+
+	return line, nil
+}
+
+// isEventStart returns true if the rune at pos can start a history event.
+func isEventStart(line []rune, pos int) bool {
+	if pos >= len(line) {
+		return false
+	}
+
+	switch char := line[pos]; {
+	case unicode.IsSpace(char), char == '=', char == '(':
+		return false
+	default:
+		return true
+	}
+}
+
+// readEvent returns the event designator at the beginning of
+// the line (following a '!'), and its length in the line.
+func readEvent(line []rune) (event string, length int) {
+	switch line[0] {
+	case '!', '$':
+		return string(line[0]), 1
+	case '?':
+		end := 1
+		for end < len(line) && line[end] != '?' {
+			end++
+		}
+
+		if end < len(line) {
+			end++
+		}
+
+		return string(line[:end]), end
+	}
+
+	end := 0
+
+	// Line numbers, possibly negative ones.
+	if line[0] == '-' || unicode.IsDigit(line[0]) {
+		end = 1
+		for end < len(line) && unicode.IsDigit(line[end]) {
+			end++
+		}
+
+		if end > 1 || unicode.IsDigit(line[0]) {
+			return string(line[:end]), end
+		}
+	}
+
+	// Line prefixes, until the end of the shell word.
+	for end = 0; end < len(line); end++ {
+		if unicode.IsSpace(line[end]) || strings.ContainsRune(`;&|()<>"'`, line[end]) {
+			break
+		}
+	}
+
+	return string(line[:end]), end
+}
@@ -0,0 +1,80 @@
+package history
+
+import (
+	"testing"
+
+	"github.com/reeflective/readline/inputrc"
+	"github.com/reeflective/readline/internal/core"
+	"github.com/reeflective/readline/internal/ui"
+)
+
+func TestSources_ExpandLine(t *testing.T) {
+	history := []string{"git status", "ls -la /tmp", "echo 'hello world'", "git diff --stat"}
+
+	tests := []struct {
+		name    string
+		line    string
+		want    string
+		wantErr bool
+	}{
+		{name: "No event", line: "echo foo", want: "echo foo"},
+		{name: "Last line", line: "sudo !!", want: "sudo git diff --stat"},
+		{name: "Last argument", line: "cat !$", want: "cat --stat"},
+		{name: "Absolute line", line: "!2", want: "ls -la /tmp"},
+		{name: "Relative line", line: "!-2 && !-1", want: "echo 'hello world' && git diff --stat"},
+		{name: "Line prefix", line: "!ls; pwd", want: "ls -la /tmp; pwd"},
+		{name: "Most recent prefix", line: "!git", want: "git diff --stat"},
+		{name: "Line containing", line: "!?status? -s", want: "git status -s"},
+		{name: "Line containing at end", line: "!?tmp", want: "ls -la /tmp"},
+		{name: "Quick substitution", line: "^diff^log", want: "git log --stat"},
+		{name: "Quick substitution with rest", line: "^--stat^^ -p", want: "git diff  -p"},
+		{name: "Escaped event", line: `echo \!!`, want: `echo \!!`},
+		{name: "Single quoted event", line: "echo '!!'", want: "echo '!!'"},
+		{name: "Not an event", line: "echo ! a!= !(x)", want: "echo ! a!= !(x)"},
+		{name: "Before a double quote", line: `echo "hi!"`, want: `echo "hi!"`},
+		{name: "Before a single quote", line: `echo hi!'x'`, want: `echo hi!'x'`},
+		{name: "Before a semicolon", line: "echo hi!; ls", want: "echo hi!; ls"},
+		{name: "Before an ampersand", line: "sleep 1!& wait", want: "sleep 1!& wait"},
+		{name: "Before a pipe", line: "echo hi!| cat", want: "echo hi!| cat"},
+		{name: "Before redirections", line: "cat !<in !>out", want: "cat !<in !>out"},
+		{name: "Absolute line out of range", line: "!5", wantErr: true},
+		{name: "Zero line", line: "!0", wantErr: true},
+		{name: "Relative line out of range", line: "!-5", wantErr: true},
+		{name: "Prefix not found", line: "!make", wantErr: true},
+		{name: "Substring not found", line: "!?make?", wantErr: true},
+		{name: "Substitution failed", line: "^make^go", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			line := new(core.Line)
+			cursor := core.NewCursor(line)
+
+			hist := NewSources(line, cursor, new(ui.Hint), inputrc.NewDefaultConfig())
+
+			source := NewInMemoryHistory()
+			for _, histLine := range history {
+				source.Write(histLine)
+			}
+
+			hist.Add("test", source)
+
+			got, err := hist.ExpandLine(test.line)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ExpandLine(%q) error = %v, wantErr %v", test.line, err, test.wantErr)
+			}
+
+			if err != nil {
+				if got != test.line {
+					t.Errorf("ExpandLine(%q) = %q on error, want the line unchanged", test.line, got)
+				}
+
+				return
+			}
+
+			if got != test.want {
+				t.Errorf("ExpandLine(%q) = %q, want %q", test.line, got, test.want)
+			}
+		})
+	}
+}
@@ -50,8 +50,13 @@ func openHist(filename string) (list []Item, err error) {
 	for scanner.Scan() {
 		var item Item
 
-		err := json.Unmarshal(scanner.Bytes(), &item)
-		if err != nil || len(item.Block) == 0 {
+		// Lines written without timestamps (plain text)
+		// are still loaded, without any date/time.
+		if err := json.Unmarshal(scanner.Bytes(), &item); err != nil {
+			item = Item{Block: strings.TrimSpace(scanner.Text())}
+		}
+
+		if len(item.Block) == 0 {
 			continue
 		}
 
@@ -118,6 +123,20 @@ func (h *fileHistory) GetLine(pos int) (string, error) {
 	return "", errOutOfRangeIndex
 }
 
+// GetTime returns the time at which a line was written to the history file.
+// Lines loaded from files written without timestamps have a zero time.
+func (h *fileHistory) GetTime(pos int) (time.Time, error) {
+	if pos < 0 {
+		return time.Time{}, errNegativeIndex
+	}
+
+	if pos < len(h.lines) {
+		return h.lines[pos].DateTime, nil
+	}
+
+	return time.Time{}, errOutOfRangeIndex
+}
+
 // Len returns the number of items in the history file.
 func (h *fileHistory) Len() int {
 	return len(h.lines)
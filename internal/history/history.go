@@ -1,5 +1,10 @@
 package history
 
+import (
+	"fmt"
+	"time"
+)
+
 var defaultSourceName = "default history"
 
 // Source is an interface to allow you to write your own history logging tools.
@@ -24,10 +29,22 @@ type Source interface {
 	Dump() interface{}
 }
 
+// TimedSource is a history source also recording the time at which each
+// line has been written. Sources implementing it have these times displayed
+// (as relative times) next to their lines in the history completion menu.
+type TimedSource interface {
+	Source
+
+	// GetTime returns the time at which the line number was written,
+	// or a zero time if this line has been written without one.
+	GetTime(int) (time.Time, error)
+}
+
 // memory is an in memory history.
 // One such history is bound to the readline shell by default.
 type memory struct {
 	items []string
+	times []time.Time
 }
 
 // NewInMemoryHistory creates a new in-memory command history source.
@@ -38,6 +55,8 @@ func NewInMemoryHistory() Source {
 // Write to history.
 func (h *memory) Write(s string) (int, error) {
 	h.items = append(h.items, s)
+	h.times = append(h.times, time.Now())
+
 	return len(h.items), nil
 }
 
@@ -50,6 +69,15 @@ func (h *memory) GetLine(i int) (string, error) {
 	return h.items[i], nil
 }
 
+// GetTime returns the time at which a line was written to history.
+func (h *memory) GetTime(i int) (time.Time, error) {
+	if i < 0 || i >= len(h.times) {
+		return time.Time{}, fmt.Errorf("%w: %d", errOutOfRangeIndex, i)
+	}
+
+	return h.times[i], nil
+}
+
 // Len returns the number of lines in history.
 func (h *memory) Len() int {
 	return len(h.items)
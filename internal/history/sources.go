@@ -5,6 +5,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/reeflective/readline/inputrc"
 	"github.com/reeflective/readline/internal/color"
@@ -15,6 +16,26 @@ import (
 
 // Sources manages and serves all history sources for the current shell.
 type Sources struct {
+	// Ignore is a list of glob patterns (like bash HISTIGNORE): lines
+	// matching any of them in their entirety are not written to history.
+	// A '*' matches any sequence of characters, a '?' any single one.
+	Ignore []string
+
+	// IgnoreSpace prevents lines starting with a space from being written.
+	IgnoreSpace bool
+
+	// IgnoreDups prevents lines identical to the last line of a
+	// history source from being written to it. Enabled by default.
+	IgnoreDups bool
+
+	// Expand enables bash-style history expansion (see ExpandLine) when lines
+	// are accepted, like the history-expansion inputrc option does.
+	Expand bool
+
+	// UndoGranularity determines how characters inserted by the user are
+	// grouped into undo steps. Defaults to UndoPerCommand.
+	UndoGranularity UndoGranularity
+
 	// Shell parameters
 	line   *core.Line
 	cursor *core.Cursor
@@ -24,10 +45,14 @@ type Sources struct {
 	// History sources
 	list       map[string]Source // Sources of history lines
 	names      []string          // Names of histories stored in rl.histories
+	sessions   map[string]bool   // Sources only recording the lines of the current session.
 	maxEntries int               // Inputrc configured maximum number of entries.
 	sourcePos  int               // The index of the currently used history
+	sessionPos int               // The index of the history used before UseSession(), or -1.
 	hpos       int               // Index used for navigating the history lines with arrows/j/k
 	cpos       int               // A temporary cursor position used when searching/moving around.
+	prefix     string            // The sticky prefix used when searching history lines.
+	buffer     *undoItem         // The line being edited when starting to walk history lines.
 
 	// Line changes history
 	skip    bool                            // Skip saving the current line state.
@@ -40,14 +65,19 @@ type Sources struct {
 	accepted   bool      // The line has been accepted and must be returned.
 	acceptHold bool      // Should we reuse the same accepted line on the next loop.
 	acceptLine core.Line // The line to return to the caller.
+	holdLine   core.Line // The line to edit again on the next loop, if holding it.
 	acceptErr  error     // An error to return to the caller.
+
+	// Lines written
+	ignoreExprs map[string]*regexp.Regexp // Ignore patterns compiled, or nil if invalid.
 }
 
 // NewSources is a required constructor for the history sources manager type.
 func NewSources(line *core.Line, cur *core.Cursor, hint *ui.Hint, opts *inputrc.Config) *Sources {
 	sources := &Sources{
 		// History sources
-		list: make(map[string]Source),
+		list:     make(map[string]Source),
+		sessions: make(map[string]bool),
 		// Line history
 		lines: make(map[string]map[int]*lineHistory),
 		// Shell parameters
@@ -57,6 +87,10 @@ func NewSources(line *core.Line, cur *core.Cursor, hint *ui.Hint, opts *inputrc.
 		hpos:   -1,
 		hint:   hint,
 		config: opts,
+		// Session history
+		sessionPos: -1,
+		// Recording
+		IgnoreDups: true,
 	}
 
 	sources.names = append(sources.names, defaultSourceName)
@@ -79,16 +113,20 @@ func NewSources(line *core.Line, cur *core.Cursor, hint *ui.Hint, opts *inputrc.
 // at the start of each readline loop. If the last command asked
 // to infer a command line from the history, it is performed now.
 func Init(hist *Sources) {
+	hist.buffer = nil
+
 	defer func() {
 		hist.accepted = false
 		hist.acceptLine = nil
+		hist.holdLine = nil
 		hist.acceptErr = nil
 		hist.cpos = -1
+		hist.LeaveSession()
 	}()
 
 	if hist.acceptHold {
 		hist.hpos = -1
-		hist.line.Set(hist.acceptLine...)
+		hist.line.Set(hist.holdLine...)
 		hist.cursor.Set(hist.line.Len())
 
 		return
@@ -136,18 +174,65 @@ func (h *Sources) AddFromFile(name, file string) {
 	h.Add(name, hist)
 }
 
+// AddSession adds an in-memory history source bound to a given name, which only
+// records the lines accepted during the current shell session. It can thus be
+// searched on its own, either by cycling through sources or with the command
+// `search-session-history`: the hint then shows the "session history" scope,
+// while it shows the "persistent history" one for all other sources.
+// Since the first source is the one used when walking the history, this
+// source should generally be added after the persistent ones.
+func (h *Sources) AddSession(name string) {
+	h.Add(name, new(memory))
+	h.sessions[name] = true
+}
+
+// UseSession makes the first session history source the active one,
+// returning false if there is none (see AddSession()). The source
+// previously active is used again once LeaveSession() is called.
+func (h *Sources) UseSession() bool {
+	for pos, name := range h.names {
+		if h.sessions[name] {
+			if h.sessionPos == -1 {
+				h.sessionPos = h.sourcePos
+			}
+
+			h.sourcePos = pos
+
+			return true
+		}
+	}
+
+	return false
+}
+
+// LeaveSession makes the history source active before UseSession()
+// the active one again, if it was called (otherwise this is a no-op).
+func (h *Sources) LeaveSession() {
+	if h.sessionPos == -1 {
+		return
+	}
+
+	if h.sessionPos < len(h.names) {
+		h.sourcePos = h.sessionPos
+	}
+
+	h.sessionPos = -1
+}
+
 // Delete deletes one or more history source by name.
 // If no arguments are passed, all currently bound sources are removed.
 func (h *Sources) Delete(sources ...string) {
 	if len(sources) == 0 {
 		h.list = make(map[string]Source)
 		h.names = make([]string, 0)
+		h.sessions = make(map[string]bool)
 
 		return
 	}
 
 	for _, name := range sources {
 		delete(h.list, name)
+		delete(h.sessions, name)
 
 		for i, hname := range h.names {
 			if hname == name {
@@ -158,6 +243,8 @@ func (h *Sources) Delete(sources ...string) {
 	}
 
 	h.sourcePos = 0
+	h.sessionPos = -1
+
 	if !h.infer {
 		h.hpos = -1
 	}
@@ -178,10 +265,12 @@ func (h *Sources) Walk(pos int) {
 		return
 	}
 
-	// Save the current line buffer if we are leaving it.
+	// Save the current line buffer if we are leaving it,
+	// to restore it when walking back past the newest line.
 	if h.hpos == -1 && pos > 0 {
 		h.skip = false
 		h.Save()
+		h.buffer = &undoItem{line: string(*h.line), pos: h.cursor.Pos()}
 		h.cpos = -1
 		h.hpos = 0
 	}
@@ -207,7 +296,7 @@ func (h *Sources) Walk(pos int) {
 	if hist := h.getLineHistory(); hist != nil && len(hist.items) > 0 {
 		line = hist.items[len(hist.items)-1].line
 	} else if line, err = history.GetLine(history.Len() - h.hpos); err != nil {
-		h.hint.Set(color.FgRed + "history error: " + err.Error())
+		h.hint.Set(h.hint.Format("history error: "+err.Error(), ui.HintError))
 		return
 	}
 
@@ -215,6 +304,17 @@ func (h *Sources) Walk(pos int) {
 	h.setLineCursorMatch(line)
 }
 
+// WalkEnd goes back from the history lines to the line being edited
+// before walking them, with its contents and cursor position at the
+// time. Nothing is done if the current line is not a history one.
+func (h *Sources) WalkEnd() {
+	if h.hpos <= 0 {
+		return
+	}
+
+	h.Walk(-h.hpos)
+}
+
 // Fetch fetches the history event at the provided
 // index position and makes it the current buffer.
 func (h *Sources) Fetch(pos int) {
@@ -230,7 +330,7 @@ func (h *Sources) Fetch(pos int) {
 
 	line, err := history.GetLine(pos)
 	if err != nil {
-		h.hint.Set(color.FgRed + "history error: " + err.Error())
+		h.hint.Set(h.hint.Format("history error: "+err.Error(), ui.HintError))
 		return
 	}
 
@@ -299,7 +399,7 @@ func (h *Sources) Write(infer bool) {
 
 	line := string(*h.line)
 
-	if len(strings.TrimSpace(line)) == 0 {
+	if len(strings.TrimSpace(line)) == 0 || h.ignored(line) {
 		return
 	}
 
@@ -310,24 +410,97 @@ func (h *Sources) Write(infer bool) {
 
 		// Don't write it if the history source has reached
 		// the maximum number of lines allowed (inputrc)
-		if h.maxEntries == 0 || h.maxEntries >= history.Len() {
+		if h.maxEntries > 0 && history.Len() >= h.maxEntries {
 			continue
 		}
 
-		var err error
-
-		// Don't write the line if it's identical to the last one.
-		last, err := history.GetLine(history.Len() - 1)
-		if err == nil && last != "" && strings.TrimSpace(last) == strings.TrimSpace(line) {
-			return
+		// Don't write the line if it's identical to the last one
+		// of this source, but still write it to the other ones.
+		if h.IgnoreDups && history.Len() > 0 {
+			last, err := history.GetLine(history.Len() - 1)
+			if err == nil && last != "" && strings.TrimSpace(last) == strings.TrimSpace(line) {
+				continue
+			}
 		}
 
 		// Save the line and notify through hints if an error raised.
-		_, err = history.Write(line)
-		if err != nil {
-			h.hint.Set(color.FgRed + err.Error())
+		if _, err := history.Write(line); err != nil {
+			h.hint.Set(h.hint.Format(err.Error(), ui.HintError))
+		}
+	}
+}
+
+// ignored returns true if the line must not be written to any history source,
+// either because it starts with a space or matches an ignore pattern.
+func (h *Sources) ignored(line string) bool {
+	if h.IgnoreSpace && strings.HasPrefix(line, " ") {
+		return true
+	}
+
+	if h.ignoreExprs == nil {
+		h.ignoreExprs = make(map[string]*regexp.Regexp)
+	}
+
+	for _, pattern := range h.Ignore {
+		matcher, compiled := h.ignoreExprs[pattern]
+		if !compiled {
+			matcher, _ = globRegexp(pattern)
+			h.ignoreExprs[pattern] = matcher
+		}
+
+		if matcher != nil && matcher.MatchString(line) {
+			return true
 		}
 	}
+
+	return false
+}
+
+// globRegexp returns a regular expression matching entire lines matching the glob pattern.
+func globRegexp(pattern string) (*regexp.Regexp, error) {
+	var expr strings.Builder
+
+	expr.WriteString("(?s)^")
+
+	runes := []rune(pattern)
+
+	for pos := 0; pos < len(runes); pos++ {
+		switch char := runes[pos]; char {
+		case '*':
+			expr.WriteString(".*")
+		case '?':
+			expr.WriteString(".")
+		case '\\':
+			if pos+1 < len(runes) {
+				pos++
+				expr.WriteString(regexp.QuoteMeta(string(runes[pos])))
+			}
+		case '[':
+			end := pos + 1
+			for end < len(runes) && runes[end] != ']' {
+				end++
+			}
+
+			if end == len(runes) {
+				expr.WriteString(`\[`)
+				continue
+			}
+
+			class := string(runes[pos+1 : end])
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+
+			expr.WriteString("[" + class + "]")
+			pos = end
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(char)))
+		}
+	}
+
+	expr.WriteString("$")
+
+	return regexp.Compile(expr.String())
 }
 
 // Accept is used to signal the line has been accepted by the user and must be
@@ -339,6 +512,7 @@ func (h *Sources) Accept(hold, infer bool, err error) {
 	h.accepted = true
 	h.acceptHold = hold
 	h.acceptLine = *h.line
+	h.holdLine = *h.line
 	h.acceptErr = err
 
 	// Write the line to the history sources only when the line is not
@@ -348,6 +522,20 @@ func (h *Sources) Accept(hold, infer bool, err error) {
 	}
 }
 
+// AcceptAs replaces the line returned to the readline caller once accepted
+// with the given one, while the line written to the history sources (if any)
+// is still the one accepted.
+func (h *Sources) AcceptAs(line []rune) {
+	h.acceptLine = core.Line(line)
+}
+
+// HoldAs replaces the line edited again on the next loop when the accepted
+// line is held (eg. with accept-and-hold) with the given one, like the line
+// as typed by the user, when the one accepted has been transformed.
+func (h *Sources) HoldAs(line []rune) {
+	h.holdLine = core.Line(line)
+}
+
 // LineAccepted returns true if the user has accepted the line, signaling
 // that the shell must return from its loop. The error can be nil, but may
 // indicate a CtrlC/CtrlD style error.
@@ -416,6 +604,59 @@ func (h *Sources) InsertMatch(line *core.Line, cur *core.Cursor, usePos, fwd, re
 	}
 }
 
+// SearchPrefix replaces the buffer with the next or previous history line starting
+// with the search prefix, and places the cursor at the end of the line. If start is
+// true (or if on the main input line), the current line becomes the new search prefix,
+// otherwise the one used by the previous search is kept. With an empty prefix, history
+// lines are just walked.
+func (h *Sources) SearchPrefix(start, fwd bool) {
+	if start || h.hpos == -1 {
+		h.prefix = string(*h.line)
+	}
+
+	if h.prefix == "" {
+		if fwd {
+			h.Walk(-1)
+		} else {
+			h.Walk(1)
+		}
+
+		return
+	}
+
+	if h.Current() == nil {
+		return
+	}
+
+	// Don't go back to the beginning of
+	// history if we are at the end of it.
+	if fwd && h.hpos <= -1 {
+		h.hpos = -1
+		return
+	}
+
+	// Save the main line buffer if we are leaving it.
+	h.getLine(h.line, h.cursor)
+
+	prefix := core.Line(h.prefix)
+
+	match, pos, found := h.match(&prefix, nil, true, fwd, false)
+
+	// Going forward past the last match restores the main line buffer.
+	if !found {
+		if fwd {
+			h.restoreLineBuffer()
+			h.cursor.Set(h.line.Len())
+		}
+
+		return
+	}
+
+	h.hpos = h.Current().Len() - pos
+	h.line.Set([]rune(match)...)
+	h.cursor.Set(h.line.Len())
+}
+
 // InferNext finds a line matching the current line in the history,
 // then finds the line event following it and, if any, inserts it.
 func (h *Sources) InferNext() {
@@ -482,7 +723,7 @@ func Complete(h *Sources, forward, filter bool, maxLines int, regex *regexp.Rege
 		return completion.Values{}
 	}
 
-	h.hint.Set(color.Bold + color.FgCyanBright + h.names[h.sourcePos] + color.Reset)
+	h.hint.Set(color.Bold + color.FgCyanBright + h.names[h.sourcePos] + color.Reset + color.Dim + h.Scope() + color.Reset)
 
 	compLines := make([]completion.Candidate, 0)
 
@@ -527,6 +768,13 @@ func Complete(h *Sources, forward, filter bool, maxLines int, regex *regexp.Rege
 		// Proper pad for indexes
 		indexStr := strconv.Itoa(histPos)
 		pad := strings.Repeat(" ", len(strconv.Itoa(history.Len()))-len(indexStr))
+
+		// And the time at which the line was run, if known.
+		if timed, ok := history.(TimedSource); ok {
+			indexStr += pad + " " + timeColumn(timed, histPos)
+			pad = ""
+		}
+
 		display = fmt.Sprintf("%s%s %s%s", color.Dim, indexStr+pad, color.DimReset, display)
 
 		value := completion.Candidate{
@@ -541,17 +789,64 @@ func Complete(h *Sources, forward, filter bool, maxLines int, regex *regexp.Rege
 
 	comps := completion.AddRaw(compLines)
 	comps.NoSort["*"] = true
-	comps.ListLong["*"] = true
+	comps.Layouts["*"] = completion.LayoutList
 	comps.PREFIX = string(*h.line)
 
 	return comps
 }
 
+// timeColumnWidth is the width of the relative times displayed in history completions.
+const timeColumnWidth = 8
+
+// timeColumn returns the time elapsed since a history line was
+// written (eg. "3m ago"), padded to the width of the time column.
+func timeColumn(history TimedSource, pos int) string {
+	written, err := history.GetTime(pos)
+	if err != nil || written.IsZero() {
+		return strings.Repeat(" ", timeColumnWidth)
+	}
+
+	var elapsed string
+
+	switch since := time.Since(written); {
+	case since < time.Minute:
+		elapsed = fmt.Sprintf("%ds ago", int(since.Seconds()))
+	case since < time.Hour:
+		elapsed = fmt.Sprintf("%dm ago", int(since.Minutes()))
+	case since < 24*time.Hour:
+		elapsed = fmt.Sprintf("%dh ago", int(since.Hours()))
+	case since < 365*24*time.Hour:
+		elapsed = fmt.Sprintf("%dd ago", int(since.Hours()/24))
+	default:
+		elapsed = fmt.Sprintf("%dy ago", int(since.Hours()/(365*24)))
+	}
+
+	if len(elapsed) < timeColumnWidth {
+		elapsed += strings.Repeat(" ", timeColumnWidth-len(elapsed))
+	}
+
+	return elapsed
+}
+
 // Name returns the name of the currently active history source.
 func (h *Sources) Name() string {
 	return h.names[h.sourcePos]
 }
 
+// Scope returns the scope of the current history source to be shown in hints,
+// if some sources are session ones (see AddSession()), or an empty string.
+func (h *Sources) Scope() string {
+	if len(h.sessions) == 0 || len(h.names) == 0 {
+		return ""
+	}
+
+	if h.sessions[h.names[h.sourcePos]] {
+		return " (session history)"
+	}
+
+	return " (persistent history)"
+}
+
 func (h *Sources) match(match *core.Line, cur *core.Cursor, usePos, fwd, regex bool) (line string, pos int, found bool) {
 	if len(h.list) == 0 {
 		return
@@ -0,0 +1,334 @@
+package history
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/reeflective/readline/inputrc"
+	"github.com/reeflective/readline/internal/core"
+	"github.com/reeflective/readline/internal/ui"
+)
+
+func TestSources_WalkRestoresLine(t *testing.T) {
+	tests := []struct {
+		name       string
+		history    []string
+		typed      string
+		up         int
+		down       int
+		wantLine   string
+		wantCursor int
+	}{
+		{
+			name:       "Up twice, down three times",
+			history:    []string{"first", "second", "third"},
+			typed:      "git sta",
+			up:         2,
+			down:       3,
+			wantLine:   "git sta",
+			wantCursor: 7,
+		},
+		{
+			name:       "Up once, down once",
+			history:    []string{"first", "second", "third"},
+			typed:      "git sta",
+			up:         1,
+			down:       1,
+			wantLine:   "git sta",
+			wantCursor: 7,
+		},
+		{
+			name:       "Up past the oldest line, back down",
+			history:    []string{"first", "second"},
+			typed:      "ls",
+			up:         4,
+			down:       4,
+			wantLine:   "ls",
+			wantCursor: 2,
+		},
+		{
+			name:     "Up twice, down once",
+			history:  []string{"first", "second", "third"},
+			typed:    "git sta",
+			up:       2,
+			down:     1,
+			wantLine: "third",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			line := new(core.Line)
+			cursor := core.NewCursor(line)
+
+			hist := NewSources(line, cursor, new(ui.Hint), inputrc.NewDefaultConfig())
+
+			source := NewInMemoryHistory()
+			for _, histLine := range test.history {
+				source.Write(histLine)
+			}
+
+			hist.Add("test", source)
+
+			// Like the shell when starting to read a line.
+			Init(hist)
+			hist.Save()
+
+			line.Set([]rune(test.typed)...)
+			cursor.Set(line.Len())
+
+			for up := 0; up < test.up; up++ {
+				hist.Walk(1)
+			}
+
+			for down := 0; down < test.down; down++ {
+				hist.Walk(-1)
+			}
+
+			if got := string(*line); got != test.wantLine {
+				t.Errorf("Line: %q, want %q", got, test.wantLine)
+			}
+
+			if test.wantCursor > 0 && cursor.Pos() != test.wantCursor {
+				t.Errorf("Cursor: %d, want %d", cursor.Pos(), test.wantCursor)
+			}
+		})
+	}
+}
+
+func TestSources_Write(t *testing.T) {
+	tests := []struct {
+		name        string
+		ignore      []string
+		ignoreSpace bool
+		noDups      bool
+		lines       []string
+		want        []string
+	}{
+		{
+			name:  "No filters",
+			lines: []string{"ls", " ls -la", "cd /tmp"},
+			want:  []string{"ls", " ls -la", "cd /tmp"},
+		},
+		{
+			name:  "Blank lines",
+			lines: []string{"ls", "  ", ""},
+			want:  []string{"ls"},
+		},
+		{
+			name:   "Star pattern",
+			ignore: []string{"cd *"},
+			lines:  []string{"cd /tmp", "cd", "ls", "cd ..; ls"},
+			want:   []string{"cd", "ls"},
+		},
+		{
+			name:   "Entire line patterns",
+			ignore: []string{"ls", "exit"},
+			lines:  []string{"ls", "ls -la", "exit", "exit 1"},
+			want:   []string{"ls -la", "exit 1"},
+		},
+		{
+			name:   "Question mark pattern",
+			ignore: []string{"?g"},
+			lines:  []string{"fg", "bg", "gg", "g", "fgg"},
+			want:   []string{"g", "fgg"},
+		},
+		{
+			name:   "Class patterns",
+			ignore: []string{"[bf]g", "job[!s]"},
+			lines:  []string{"fg", "bg", "gg", "jobs", "job1"},
+			want:   []string{"gg", "jobs"},
+		},
+		{
+			name:   "Escaped and literal metacharacters",
+			ignore: []string{`echo \*`, "a.b+c", "x[y"},
+			lines:  []string{"echo *", "echo foo", "a.b+c", "axb+c", "x[y", "xy"},
+			want:   []string{"echo foo", "axb+c", "xy"},
+		},
+		{
+			name:   "Multiline line",
+			ignore: []string{"for *"},
+			lines:  []string{"for i in 1 2; do\necho $i\ndone"},
+		},
+		{
+			name:        "Space prefix",
+			ignoreSpace: true,
+			lines:       []string{" secret", "ls", "\tls -la"},
+			want:        []string{"ls", "\tls -la"},
+		},
+		{
+			name:  "Duplicates",
+			lines: []string{"ls", "ls", " ls ", "cd", "ls"},
+			want:  []string{"ls", "cd", "ls"},
+		},
+		{
+			name:   "Duplicates kept",
+			noDups: true,
+			lines:  []string{"ls", "ls", "cd"},
+			want:   []string{"ls", "ls", "cd"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			line := new(core.Line)
+			cursor := core.NewCursor(line)
+
+			hist := NewSources(line, cursor, new(ui.Hint), inputrc.NewDefaultConfig())
+			hist.Ignore = test.ignore
+			hist.IgnoreSpace = test.ignoreSpace
+			hist.IgnoreDups = !test.noDups
+
+			source := NewInMemoryHistory()
+			hist.Add("test", source)
+
+			for _, accepted := range test.lines {
+				line.Set([]rune(accepted)...)
+				hist.Write(false)
+			}
+
+			var got []string
+
+			for pos := 0; pos < source.Len(); pos++ {
+				written, _ := source.GetLine(pos)
+				got = append(got, written)
+			}
+
+			if strings.Join(got, "|") != strings.Join(test.want, "|") || len(got) != len(test.want) {
+				t.Errorf("Lines written: %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSources_Write_sources(t *testing.T) {
+	tests := []struct {
+		name     string
+		size     int
+		previous []string
+		lines    []string
+		want     []string
+		wantNew  []string
+	}{
+		{
+			name:    "History size reached",
+			size:    2,
+			lines:   []string{"ls", "cd", "pwd"},
+			want:    []string{"ls", "cd"},
+			wantNew: []string{"ls", "cd"},
+		},
+		{
+			name:    "Unlimited history size",
+			lines:   []string{"ls", "cd", "pwd"},
+			want:    []string{"ls", "cd", "pwd"},
+			wantNew: []string{"ls", "cd", "pwd"},
+		},
+		{
+			name:     "Duplicate in one source only",
+			previous: []string{"ls"},
+			lines:    []string{"ls"},
+			want:     []string{"ls"},
+			wantNew:  []string{"ls"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			line := new(core.Line)
+			cursor := core.NewCursor(line)
+
+			config := inputrc.NewDefaultConfig()
+			if test.size > 0 {
+				config.Set("history-size", test.size)
+			}
+
+			hist := NewSources(line, cursor, new(ui.Hint), config)
+
+			previous := NewInMemoryHistory()
+			for _, histLine := range test.previous {
+				previous.Write(histLine)
+			}
+
+			fresh := NewInMemoryHistory()
+
+			hist.Add("previous", previous)
+			hist.Add("new", fresh)
+
+			for _, accepted := range test.lines {
+				line.Set([]rune(accepted)...)
+				hist.Write(false)
+			}
+
+			for name, source := range map[string]Source{"previous": previous, "new": fresh} {
+				want := test.want
+				if name == "new" {
+					want = test.wantNew
+				}
+
+				var got []string
+
+				for pos := 0; pos < source.Len(); pos++ {
+					written, _ := source.GetLine(pos)
+					got = append(got, written)
+				}
+
+				if strings.Join(got, "|") != strings.Join(want, "|") || len(got) != len(want) {
+					t.Errorf("Lines written to %s: %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSources_UseSession(t *testing.T) {
+	tests := []struct {
+		name     string
+		sessions []string
+		cycle    bool
+		want     bool
+	}{
+		{name: "No session source"},
+		{name: "Session source", sessions: []string{"session"}, want: true},
+		{name: "Sources cycled while searching", sessions: []string{"session"}, cycle: true, want: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			line := new(core.Line)
+			cursor := core.NewCursor(line)
+
+			hist := NewSources(line, cursor, new(ui.Hint), inputrc.NewDefaultConfig())
+			hist.Add("persistent", NewInMemoryHistory())
+
+			for _, name := range test.sessions {
+				hist.AddSession(name)
+			}
+
+			if got := hist.UseSession(); got != test.want {
+				t.Fatalf("UseSession() = %v, want %v", got, test.want)
+			}
+
+			if test.want && hist.Name() != test.sessions[0] {
+				t.Errorf("UseSession() source = %q, want %q", hist.Name(), test.sessions[0])
+			}
+
+			if test.cycle {
+				hist.Cycle(true)
+			}
+
+			hist.LeaveSession()
+
+			if hist.Name() != "persistent" {
+				t.Errorf("LeaveSession() source = %q, want %q", hist.Name(), "persistent")
+			}
+
+			// Sources cycled outside of a session search are kept.
+			hist.Cycle(false)
+			hist.LeaveSession()
+
+			if want := hist.names[len(hist.names)-1]; hist.Name() != want {
+				t.Errorf("LeaveSession() source = %q, want %q", hist.Name(), want)
+			}
+		})
+	}
+}
@@ -1,10 +1,28 @@
 package history
 
 import (
+	"unicode"
+
 	"github.com/reeflective/readline/inputrc"
 	"github.com/reeflective/readline/internal/core"
 )
 
+// UndoGranularity determines how the characters inserted
+// by the user (self-insert) are grouped into undo steps.
+type UndoGranularity int
+
+const (
+	// UndoPerCommand groups a run of inserted characters into a single undo
+	// step, until another command (like a movement or a kill) is run (default).
+	UndoPerCommand UndoGranularity = iota
+	// UndoPerWord groups a run of inserted characters until a whitespace is
+	// inserted after a word, or until another command is run: undoing thus
+	// erases the last word typed (without the spaces following it).
+	UndoPerWord
+	// UndoPerKey makes each inserted character its own undo step.
+	UndoPerKey
+)
+
 // lineHistory contains all state changes for a given input line,
 // whether it is the current input line or one of the history ones.
 type lineHistory struct {
@@ -17,6 +35,37 @@ type undoItem struct {
 	pos  int
 }
 
+// UndoState is a state of a line in its undo history: its contents
+// and the cursor position in it. It can be serialized as JSON.
+type UndoState struct {
+	Line   string `json:"line"`
+	Cursor int    `json:"cursor"`
+}
+
+// UndoStates returns the undo history of the current line, from its oldest state.
+func (h *Sources) UndoStates() []UndoState {
+	line := h.getLineHistory()
+	states := make([]UndoState, 0, len(line.items))
+
+	for _, item := range line.items {
+		states = append(states, UndoState{Line: item.line, Cursor: item.pos})
+	}
+
+	return states
+}
+
+// SetUndoStates replaces the undo history of the current line
+// with the given states (the oldest first), dropping any undo.
+func (h *Sources) SetUndoStates(states []UndoState) {
+	line := h.getLineHistory()
+	line.items = make([]undoItem, 0, len(states))
+	line.pos = 0
+
+	for _, state := range states {
+		line.items = append(line.items, undoItem{line: state.Line, pos: state.Cursor})
+	}
+}
+
 // Save saves the current line and cursor position as an undo state item.
 // If this was called while the shell was in the middle of its undo history
 // (eg. the caller has undone one or more times), all undone steps are dropped.
@@ -64,10 +113,34 @@ func (h *Sources) Save() {
 // (more precisely, the next call to h.Save() will have no effect).
 // This function is not useful is most cases, as call to saves will efficiently
 // compare the line with the last saved state, and will not add redundant ones.
+//
+// Commands inserting typed characters must not call it directly, but rather
+// SaveInsert(), which skips saves only when the undo granularity groups the
+// insertion with the previous ones. Other commands calling it are not undo
+// steps by themselves, whatever the granularity: the line they leave is saved
+// by the next command calling Save() before editing it.
 func (h *Sources) SkipSave() {
 	h.skip = true
 }
 
+// SaveInsert must be called by commands before inserting a character typed by
+// the user, and saves the line as an undo step (or not) depending on the undo
+// granularity: with UndoPerWord, the line is saved when a whitespace ends the
+// word before the cursor, and the insertion is otherwise grouped with previous
+// ones, like with UndoPerCommand. With UndoPerKey, each insertion is saved.
+func (h *Sources) SaveInsert(char rune) {
+	switch h.UndoGranularity {
+	case UndoPerKey:
+		return
+	case UndoPerWord:
+		if pos := h.cursor.Pos(); unicode.IsSpace(char) && pos > 0 && !unicode.IsSpace((*h.line)[pos-1]) {
+			h.Save()
+		}
+	}
+
+	h.SkipSave()
+}
+
 // SaveWithCommand is only meant to be called in the main readline loop of the shell,
 // and not from within commands themselves: it does the same job as Save(), but also
 // keeps the command that has just been executed.
@@ -234,6 +307,14 @@ func (h *Sources) getLineHistory() *lineHistory {
 func (h *Sources) restoreLineBuffer() {
 	h.hpos = -1
 
+	// The line as it was when we started walking the history.
+	if h.buffer != nil {
+		h.line.Set([]rune(h.buffer.line)...)
+		h.cursor.Set(h.buffer.pos)
+
+		return
+	}
+
 	hist := h.getHistoryLineChanges()
 	if hist == nil {
 		return
@@ -0,0 +1,101 @@
+package history
+
+import (
+	"testing"
+
+	"github.com/reeflective/readline/inputrc"
+	"github.com/reeflective/readline/internal/core"
+	"github.com/reeflective/readline/internal/ui"
+)
+
+func TestSources_UndoGranularity(t *testing.T) {
+	tests := []struct {
+		name        string
+		granularity UndoGranularity
+		typed       string
+		undos       int
+		want        string
+	}{
+		{
+			name:        "Per command (single word)",
+			granularity: UndoPerCommand,
+			typed:       "hello",
+			undos:       1,
+			want:        "",
+		},
+		{
+			name:        "Per command (several words)",
+			granularity: UndoPerCommand,
+			typed:       "hello world",
+			undos:       1,
+			want:        "",
+		},
+		{
+			name:        "Per word (single word)",
+			granularity: UndoPerWord,
+			typed:       "hello",
+			undos:       1,
+			want:        "",
+		},
+		{
+			name:        "Per word (several words)",
+			granularity: UndoPerWord,
+			typed:       "hello big world",
+			undos:       1,
+			want:        "hello big",
+		},
+		{
+			name:        "Per word (undo twice)",
+			granularity: UndoPerWord,
+			typed:       "hello big world",
+			undos:       2,
+			want:        "hello",
+		},
+		{
+			name:        "Per word (trailing spaces)",
+			granularity: UndoPerWord,
+			typed:       "hello  ",
+			undos:       1,
+			want:        "hello",
+		},
+		{
+			name:        "Per key",
+			granularity: UndoPerKey,
+			typed:       "hello",
+			undos:       2,
+			want:        "hel",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			line := new(core.Line)
+			cursor := core.NewCursor(line)
+
+			hist := NewSources(line, cursor, new(ui.Hint), inputrc.NewDefaultConfig())
+			hist.UndoGranularity = test.granularity
+
+			// Like the shell when starting to read a line.
+			Init(hist)
+			hist.Save()
+
+			// Type the characters like self-insert does,
+			// with the save done by the main loop after it.
+			for _, char := range test.typed {
+				hist.SaveInsert(char)
+				line.Insert(cursor.Pos(), char)
+				cursor.Inc()
+				hist.Save()
+			}
+
+			for undo := 0; undo < test.undos; undo++ {
+				hist.Undo()
+				hist.Save()
+			}
+
+			if got := string(*line); got != test.want {
+				t.Errorf("Line after %d undo(s): %q, want %q", test.undos, got, test.want)
+			}
+		})
+	}
+}
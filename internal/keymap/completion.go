@@ -16,6 +16,20 @@ var menuselectKeys = map[string]inputrc.Bind{
 	unescape(`\e[D`):    {Action: "menu-complete-backward"},
 	unescape(`\e[1;5A`): {Action: "menu-complete-prev-tag"},
 	unescape(`\e[1;5B`): {Action: "menu-complete-next-tag"},
+	unescape(`\e[1;5D`): {Action: "menu-collapse-tag"},
+	unescape(`\e[1;5C`): {Action: "menu-expand-tag"},
+	unescape(`\e[6~`):   {Action: "menu-page-next"},
+	unescape(`\e[5~`):   {Action: "menu-page-prev"},
+	unescape(`\e[H`):    {Action: "menu-first"},
+	unescape(`\e[F`):    {Action: "menu-last"},
+}
+
+// isearchKeys are the default keymaps in incremental-search
+// mode, in addition to those used in menuselect mode.
+var isearchKeys = map[string]inputrc.Bind{
+	unescape(`\M-d`): {Action: "isearch-toggle-descriptions"},
+	unescape(`\C-r`): {Action: "isearch-backward"},
+	unescape(`\C-s`): {Action: "isearch-forward"},
 }
 
 // isearchCommands is a subset of commands that are valid in incremental-search mode.
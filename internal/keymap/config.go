@@ -1,7 +1,9 @@
 package keymap
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/user"
 	"sort"
@@ -13,17 +15,27 @@ import (
 // readline global options specific to this library.
 var readlineOptions = map[string]interface{}{
 	// General edition
-	"autopairs": false,
+	"autopairs":              false,
+	"abbreviations-anywhere": false,
 
 	// Completion
 	"autocomplete":               false,
 	"completion-list-separator":  "--",
 	"completion-selection-style": "\x1b[1;30m",
+	"completion-header-style":    "\x1b[1;33m",
+	"completion-cache-size":      0,
+	"completion-cache-ttl":       0,
+	"completion-refilter":        false,
+	"list-on-first-tab":          false,
+	"completion-no-wrap":         false,
+	"completion-smart-case":      false,
+	"isearch-descriptions":       true,
 
 	// Prompt & General UI
 	"transient-prompt":    false,
 	"usage-hint-always":   false,
 	"history-autosuggest": false,
+	"history-expansion":   false,
 }
 
 // ReloadConfig parses all valid .inputrc configurations and immediately
@@ -110,7 +122,15 @@ func (m *Engine) loadBuiltinBinds() {
 	m.config.Binds[string(Visual)] = visualKeys
 	m.config.Binds[string(ViOpp)] = vioppKeys
 	m.config.Binds[string(MenuSelect)] = menuselectKeys
-	m.config.Binds[string(Isearch)] = menuselectKeys
+	m.config.Binds[string(Isearch)] = make(map[string]inputrc.Bind)
+
+	for seq, bind := range menuselectKeys {
+		m.config.Binds[string(Isearch)][seq] = bind
+	}
+
+	for seq, bind := range isearchKeys {
+		m.config.Binds[string(Isearch)][seq] = bind
+	}
 
 	// Default TTY binds
 	for _, keymap := range m.config.Binds {
@@ -133,7 +153,7 @@ func (m *Engine) overrideBindsSpecial() {
 	}
 }
 
-func printBindsReadable(commands []string, all map[string][]string) {
+func printBindsReadable(out io.Writer, commands []string, all map[string][]string) {
 	for _, command := range commands {
 		commandBinds := all[command]
 		sort.Strings(commandBinds)
@@ -148,7 +168,7 @@ func printBindsReadable(commands []string, all map[string][]string) {
 			}
 
 			bindsStr := strings.Join(firstBinds, ", ")
-			fmt.Printf("%s can be found on %s ...\n", command, bindsStr)
+			fmt.Fprintf(out, "%s can be found on %s ...\n", command, bindsStr)
 
 		default:
 			var firstBinds []string
@@ -158,20 +178,117 @@ func printBindsReadable(commands []string, all map[string][]string) {
 			}
 
 			bindsStr := strings.Join(firstBinds, ", ")
-			fmt.Printf("%s can be found on %s\n", command, bindsStr)
+			fmt.Fprintf(out, "%s can be found on %s\n", command, bindsStr)
 		}
 	}
 }
 
-func printBindsInputrc(commands []string, all map[string][]string) {
+func printBindsInputrc(out io.Writer, commands []string, all map[string][]string) {
 	for _, command := range commands {
 		commandBinds := all[command]
 		sort.Strings(commandBinds)
 
 		if len(commandBinds) > 0 {
 			for _, bind := range commandBinds {
-				fmt.Printf("\"%s\": %s\n", bind, command)
+				fmt.Fprintf(out, "\"%s\": %s\n", bind, command)
 			}
 		}
 	}
 }
+
+// DumpBinds returns the binds of the given keymaps in inputrc format, each
+// keymap starting with a `set keymap` directive, so that they can be loaded
+// back with LoadBinds(). Binds are sorted by command name, then by sequence.
+// Binds to commands not implemented by the shell are not included.
+func (m *Engine) DumpBinds(keymaps ...string) string {
+	var dump strings.Builder
+
+	for _, keymap := range keymaps {
+		binds := m.config.Binds[keymap]
+		if binds == nil {
+			continue
+		}
+
+		sequences := make([]string, 0, len(binds))
+
+		// Like PrintBinds, skip commands not implemented by the shell.
+		for seq, bind := range binds {
+			if _, found := m.commands[bind.Action]; found || bind.Macro {
+				sequences = append(sequences, seq)
+			}
+		}
+
+		sort.Slice(sequences, func(i, j int) bool {
+			iAction, jAction := binds[sequences[i]].Action, binds[sequences[j]].Action
+			if iAction != jAction {
+				return iAction < jAction
+			}
+
+			return sequences[i] < sequences[j]
+		})
+
+		fmt.Fprintf(&dump, "set keymap %s\n", keymap)
+
+		for _, seq := range sequences {
+			if bind := binds[seq]; bind.Macro {
+				fmt.Fprintf(&dump, "\"%s\": \"%s\"\n", inputrc.Escape(seq), inputrc.EscapeMacro(bind.Action))
+			} else {
+				fmt.Fprintf(&dump, "\"%s\": %s\n", inputrc.Escape(seq), bind.Action)
+			}
+		}
+
+		dump.WriteString("\n")
+	}
+
+	return dump.String()
+}
+
+// LoadBinds parses binds in inputrc format (as produced by DumpBinds) and applies
+// them to their keymaps. All binds are checked before being applied: if any of them
+// is invalid or refers to an unknown command, none are applied, and the returned
+// error mentions the offending bind. Other inputrc statements are applied as usual.
+func (m *Engine) LoadBinds(r io.Reader) error {
+	loader := &bindLoader{Config: m.config, commands: m.commands}
+
+	if err := inputrc.Parse(r, loader, inputrc.WithHaltOnErr(true)); err != nil {
+		return err
+	}
+
+	for _, bind := range loader.binds {
+		m.config.Bind(bind.keymap, bind.sequence, bind.Action, bind.Macro)
+	}
+
+	return nil
+}
+
+// ErrUnknownCommand is returned when loading a bind to a command that does not exist.
+var ErrUnknownCommand = errors.New("unknown command")
+
+// bindLoader is an inputrc handler checking the binds it
+// receives, and keeping them for later application.
+type bindLoader struct {
+	*inputrc.Config
+	commands map[string]func()
+	binds    []loadedBind
+}
+
+type loadedBind struct {
+	inputrc.Bind
+	keymap   string
+	sequence string
+}
+
+// Bind satisfies the inputrc.Handler interface.
+func (l *bindLoader) Bind(keymap, sequence, action string, macro bool) error {
+	if _, found := l.commands[action]; !found && !macro {
+		return fmt.Errorf("\"%s\": %s: %w", inputrc.Escape(sequence), action, ErrUnknownCommand)
+	}
+
+	l.binds = append(l.binds, loadedBind{
+		Bind:     inputrc.Bind{Action: action, Macro: macro},
+		keymap:   keymap,
+		sequence: sequence,
+	})
+
+	return nil
+}
@@ -2,6 +2,7 @@ package keymap
 
 import (
 	"fmt"
+	"os"
 	"strings"
 )
 
@@ -39,6 +40,31 @@ var cursors = map[CursorStyle]string{
 	cursorUserDefault:       "\x1b[0 q",
 }
 
+// CursorBlink is whether the cursor blinks, whatever its shape.
+type CursorBlink int
+
+const (
+	// CursorBlinkDefault uses the cursor styles as they are configured.
+	CursorBlinkDefault CursorBlink = iota
+	// CursorBlinkOn makes the cursor blink in all modes.
+	CursorBlinkOn
+	// CursorBlinkOff makes the cursor steady in all modes.
+	CursorBlinkOff
+)
+
+// blinkingCursors maps the steady cursor shapes to their blinking ones.
+var blinkingCursors = map[CursorStyle]CursorStyle{
+	cursorBlock:     cursorBlinkingBlock,
+	cursorUnderline: cursorBlinkingUnderline,
+	cursorBeam:      cursorBlinkingBeam,
+}
+
+// Terminal sequences (OSC 12/112) setting and resetting the cursor color.
+const (
+	cursorColorSet   = "\x1b]12;%s\x07"
+	cursorColorReset = "\x1b]112\x07"
+)
+
 var defaultCursors = map[Mode]CursorStyle{
 	ViInsert:  cursorBlinkingBeam,
 	Vi:        cursorBlinkingBeam,
@@ -51,6 +77,10 @@ var defaultCursors = map[Mode]CursorStyle{
 // PrintCursor prints the cursor for the given keymap mode,
 // either default value or the one specified in inputrc file.
 func (m *Engine) PrintCursor(keymap Mode) {
+	if !m.cursorStyled() {
+		return
+	}
+
 	var cursor CursorStyle
 
 	// Check for a configured cursor in .inputrc file.
@@ -58,14 +88,75 @@ func (m *Engine) PrintCursor(keymap Mode) {
 	modeSet := strings.TrimSpace(m.config.GetString(cursorOptname))
 
 	if _, valid := cursors[CursorStyle(modeSet)]; valid {
-		fmt.Print(cursors[CursorStyle(modeSet)])
+		fmt.Fprint(m.out, cursors[m.withBlink(CursorStyle(modeSet))])
 		return
 	}
 
 	if defaultCur, valid := defaultCursors[keymap]; valid {
-		fmt.Print(cursors[defaultCur])
+		fmt.Fprint(m.out, cursors[m.withBlink(defaultCur)])
+		return
+	}
+
+	fmt.Fprint(m.out, cursors[cursor])
+}
+
+// SetCursor sets whether the cursor blinks in all modes (its shape still depending
+// on the mode), and its color, as any color specification accepted by terminals
+// (eg. "#ff8700"). If disabled is true, no cursor style nor color is ever printed.
+func (m *Engine) SetCursor(blink CursorBlink, color string, disabled bool) {
+	m.cursorBlink = blink
+	m.cursorColor = color
+	m.cursorOff = disabled
+}
+
+// InitCursor prints the cursor color (if any), and the cursor
+// style corresponding to the current keymaps.
+func (m *Engine) InitCursor() {
+	if !m.cursorStyled() {
+		return
+	}
+
+	if m.cursorColor != "" {
+		fmt.Fprintf(m.out, cursorColorSet, m.cursorColor)
+	}
+
+	m.UpdateCursor()
+}
+
+// RestoreCursor restores the terminal default cursor style and color.
+func (m *Engine) RestoreCursor() {
+	if !m.cursorStyled() {
 		return
 	}
 
-	fmt.Print(cursors[cursor])
+	fmt.Fprint(m.out, cursors[cursorUserDefault])
+
+	if m.cursorColor != "" {
+		fmt.Fprint(m.out, cursorColorReset)
+	}
+}
+
+// withBlink returns the blinking or steady variant of a
+// cursor style, according to the cursor blink setting.
+func (m *Engine) withBlink(style CursorStyle) CursorStyle {
+	switch m.cursorBlink {
+	case CursorBlinkOn:
+		if blinking, found := blinkingCursors[style]; found {
+			return blinking
+		}
+	case CursorBlinkOff:
+		for steady, blinking := range blinkingCursors {
+			if blinking == style {
+				return steady
+			}
+		}
+	}
+
+	return style
+}
+
+// cursorStyled returns false if cursor styles are disabled, or
+// if the terminal is not known to support them (a dumb one).
+func (m *Engine) cursorStyled() bool {
+	return !m.cursorOff && os.Getenv("TERM") != "dumb"
 }
@@ -19,8 +19,9 @@ var emacsKeys = map[string]inputrc.Bind{
 	unescape(`\C-Xu`):    {Action: "undo"},
 	unescape(`\M-\C-^`):  {Action: "copy-prev-word"},
 	unescape(`\M-'`):     {Action: "quote-line"},
-	unescape(`\M-<`):     {Action: "beginning-of-buffer-or-history"},
-	unescape(`\M->`):     {Action: "end-of-buffer-or-history"},
+	unescape(`\M-\C-M`):  {Action: "insert-newline"},
+	unescape(`\M-<`):     {Action: "beginning-of-history"},
+	unescape(`\M->`):     {Action: "end-of-history"},
 	unescape(`\M-c`):     {Action: "capitalize-word"},
 	unescape(`\M-d`):     {Action: "kill-word"},
 	unescape(`\M-m`):     {Action: "copy-prev-shell-word"},
@@ -1,10 +1,12 @@
 package keymap
 
 import (
+	"fmt"
 	"sort"
 
 	"github.com/reeflective/readline/inputrc"
 	"github.com/reeflective/readline/internal/core"
+	"github.com/reeflective/readline/internal/term"
 )
 
 // Engine is used to manage the main and local keymaps for the shell.
@@ -18,19 +20,26 @@ type Engine struct {
 	isCaller     bool
 	nonIncSearch bool
 
+	// Cursor appearance
+	cursorBlink CursorBlink
+	cursorColor string
+	cursorOff   bool
+
 	keys       *core.Keys
 	iterations *core.Iterations
 	config     *inputrc.Config
 	commands   map[string]func()
+	out        *term.Output
 }
 
 // NewEngine is a required constructor for the keymap modes manager.
 // It initializes the keymaps to their defaults or configured values.
-func NewEngine(keys *core.Keys, i *core.Iterations, opts ...inputrc.Option) (*Engine, *inputrc.Config) {
+func NewEngine(keys *core.Keys, i *core.Iterations, out *term.Output, opts ...inputrc.Option) (*Engine, *inputrc.Config) {
 	modes := &Engine{
 		main:       Emacs,
 		keys:       keys,
 		iterations: i,
+		out:        out,
 		config:     inputrc.NewDefaultConfig(),
 		commands:   make(map[string]func()),
 	}
@@ -50,6 +59,17 @@ func (m *Engine) Register(commands map[string]func()) {
 	}
 }
 
+// Bind binds a key sequence (in inputrc notation, eg. `\C-x\C-t`) to a command
+// in a keymap. An error wrapping ErrUnknownCommand is returned if the command
+// is neither a builtin one nor one added with Register().
+func (m *Engine) Bind(keymap, sequence, command string) error {
+	if _, found := m.commands[command]; !found {
+		return fmt.Errorf("%w: %s", ErrUnknownCommand, command)
+	}
+
+	return m.config.Bind(keymap, inputrc.Unescape(sequence), command, false)
+}
+
 // SetMain sets the main keymap of the shell.
 // Valid builtin keymaps are:
 // - emacs, emacs-meta, emacs-ctlx, emacs-standard.
@@ -159,9 +179,9 @@ func (m *Engine) PrintBinds(keymap string, inputrcFormat bool) {
 	}
 
 	if inputrcFormat {
-		printBindsInputrc(commands, allBinds)
+		printBindsInputrc(m.out, commands, allBinds)
 	} else {
-		printBindsReadable(commands, allBinds)
+		printBindsReadable(m.out, commands, allBinds)
 	}
 }
 
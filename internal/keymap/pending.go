@@ -18,6 +18,9 @@ func (m *Engine) Pending() {
 	m.SetLocal(ViOpp)
 	m.skip = true
 
+	// The operator count multiplies the motion one.
+	m.iterations.Hold()
+
 	// Push the widget on the stack of widgets
 	m.pending = append(m.pending, m.active)
 }
@@ -4,27 +4,28 @@ import "github.com/reeflective/readline/inputrc"
 
 // viinsKeys are the default keymaps in Vim Insert mode.
 var viinsKeys = map[string]inputrc.Bind{
-	unescape(`\M-`):    {Action: "vi-movement-mode"},
-	unescape(`\C-M`):   {Action: "accept-line"},
-	unescape(`\C-L`):   {Action: "clear-screen"},
-	unescape(`\C-Y`):   {Action: "yank"},
-	unescape(`\C-A`):   {Action: "beginning-of-line"},
-	unescape(`\C-B`):   {Action: "backward-char"},
-	unescape(`\C-F`):   {Action: "forward-char"},
-	unescape(`\C-K`):   {Action: "kill-line"},
-	unescape(`\C-N`):   {Action: "down-line-or-history"},
-	unescape(`\C-O`):   {Action: "operate-and-get-next"},
-	unescape(`\C-Q`):   {Action: "accept-and-infer-next-history"},
-	unescape(`\C-P`):   {Action: "up-line-or-history"},
-	unescape(`\C-_`):   {Action: "undo"},
-	unescape(`\M-q`):   {Action: "macro-toggle-record"},
-	unescape(`\M-r`):   {Action: "vi-registers-complete"},
-	unescape(`\M-[3~`): {Action: "delete-char"},
-	unescape(`\M-[H`):  {Action: "beginning-of-line"},
-	unescape(`\M-[F`):  {Action: "end-of-line"},
-	unescape(`\M-[A`):  {Action: "up-line-or-search"},
-	unescape(`\M-[B`):  {Action: "down-line-or-search"},
-	unescape(`\M-@`):   {Action: "macro-run"},
+	unescape(`\M-`):     {Action: "vi-movement-mode"},
+	unescape(`\C-M`):    {Action: "accept-line"},
+	unescape(`\M-\C-M`): {Action: "insert-newline"},
+	unescape(`\C-L`):    {Action: "clear-screen"},
+	unescape(`\C-Y`):    {Action: "yank"},
+	unescape(`\C-A`):    {Action: "beginning-of-line"},
+	unescape(`\C-B`):    {Action: "backward-char"},
+	unescape(`\C-F`):    {Action: "forward-char"},
+	unescape(`\C-K`):    {Action: "kill-line"},
+	unescape(`\C-N`):    {Action: "down-line-or-history"},
+	unescape(`\C-O`):    {Action: "operate-and-get-next"},
+	unescape(`\C-Q`):    {Action: "accept-and-infer-next-history"},
+	unescape(`\C-P`):    {Action: "up-line-or-history"},
+	unescape(`\C-_`):    {Action: "undo"},
+	unescape(`\M-q`):    {Action: "macro-toggle-record"},
+	unescape(`\M-r`):    {Action: "vi-registers-complete"},
+	unescape(`\M-[3~`):  {Action: "delete-char"},
+	unescape(`\M-[H`):   {Action: "beginning-of-line"},
+	unescape(`\M-[F`):   {Action: "end-of-line"},
+	unescape(`\M-[A`):   {Action: "up-line-or-search"},
+	unescape(`\M-[B`):   {Action: "down-line-or-search"},
+	unescape(`\M-@`):    {Action: "macro-run"},
 }
 
 // viinsKeymaps are the default keymaps in Vim Command mode.
@@ -54,6 +55,9 @@ var vicmdKeys = map[string]inputrc.Bind{
 	unescape(" "):       {Action: "vi-forward-char"},
 	unescape("$"):       {Action: "vi-end-of-line"},
 	unescape("%"):       {Action: "vi-match"},
+	unescape("'"):       {Action: "vi-goto-mark-line"},
+	unescape("`"):       {Action: "vi-goto-mark"},
+	unescape("m"):       {Action: "vi-set-mark"},
 	unescape("\""):      {Action: "vi-set-buffer"},
 	unescape("0"):       {Action: "beginning-of-line"},
 	unescape("B"):       {Action: "vi-backward-bigword"},
@@ -64,6 +68,7 @@ var vicmdKeys = map[string]inputrc.Bind{
 	unescape("gE"):      {Action: "vi-backward-end-bigword"},
 	unescape("gu"):      {Action: "vi-down-case"},
 	unescape("gU"):      {Action: "vi-up-case"},
+	unescape("g~"):      {Action: "vi-oper-swap-case"},
 	unescape("f"):       {Action: "vi-find-next-char"},
 	unescape("t"):       {Action: "vi-find-next-char-skip"},
 	unescape("i"):       {Action: "vi-insertion-mode"},
@@ -132,6 +137,7 @@ var visualKeys = map[string]inputrc.Bind{
 	unescape("s"):   {Action: "vi-subst"},
 	unescape("S"):   {Action: "vi-add-surround"},
 	unescape("u"):   {Action: "vi-down-case"},
+	unescape("U"):   {Action: "vi-up-case"},
 	unescape("v"):   {Action: "vi-edit-command-line"},
 	unescape("x"):   {Action: "vi-delete-to"},
 	unescape("y"):   {Action: "vi-yank-to"},
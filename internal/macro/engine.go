@@ -8,6 +8,7 @@ import (
 	"github.com/reeflective/readline/inputrc"
 	"github.com/reeflective/readline/internal/color"
 	"github.com/reeflective/readline/internal/core"
+	"github.com/reeflective/readline/internal/term"
 	"github.com/reeflective/readline/internal/ui"
 )
 
@@ -23,18 +24,20 @@ type Engine struct {
 	macros     map[rune]string // All previously recorded macros.
 	started    bool
 
-	keys   *core.Keys // The engine feeds macros directly in the key stack.
-	hint   *ui.Hint   // The engine notifies when macro recording starts/stops.
-	status string     // The hint status displaying the currently recorded macro.
+	keys   *core.Keys   // The engine feeds macros directly in the key stack.
+	hint   *ui.Hint     // The engine notifies when macro recording starts/stops.
+	out    *term.Output // Macros are printed to the terminal of the shell.
+	status string       // The hint status displaying the currently recorded macro.
 }
 
 // NewEngine is a required constructor to setup a working macro engine.
-func NewEngine(keys *core.Keys, hint *ui.Hint) *Engine {
+func NewEngine(keys *core.Keys, hint *ui.Hint, out *term.Output) *Engine {
 	return &Engine{
 		current: make([]rune, 0),
 		macros:  make(map[rune]string),
 		keys:    keys,
 		hint:    hint,
+		out:     out,
 	}
 }
 
@@ -76,7 +79,7 @@ func (e *Engine) StartRecord(key rune) {
 
 	e.started = true
 	e.recording = true
-	e.status = color.Dim + "Recording macro: " + color.Bold
+	e.status = e.hint.Format("Recording macro: ", ui.HintInfo) + color.Bold
 	e.hint.Persist(e.status)
 }
 
@@ -152,7 +155,7 @@ func (e *Engine) PrintLastMacro() {
 	// Print the macro and the prompt.
 	// The shell takes care of clearing itself
 	// before printing, and refreshing after.
-	fmt.Printf("\n%s\n", e.macros[e.currentKey])
+	fmt.Fprintf(e.out, "\n%s\n", e.macros[e.currentKey])
 }
 
 // PrintAllMacros dumps all macros to the screen, which one line
@@ -178,7 +181,7 @@ func (e *Engine) PrintAllMacros() {
 			macro = '"'
 		}
 
-		fmt.Printf("\"%s\": %s\n", string(macro), sequence)
+		fmt.Fprintf(e.out, "\"%s\": %s\n", string(macro), sequence)
 	}
 }
 
@@ -3,31 +3,101 @@ package strutil
 import (
 	"strings"
 
+	"github.com/reeflective/readline/inputrc"
 	"github.com/reeflective/readline/internal/color"
-	"github.com/reeflective/readline/internal/term"
 	"github.com/rivo/uniseg"
 )
 
-// FormatTabs replaces all '\t' occurrences in a string with 6 spaces each.
-func FormatTabs(s string) string {
-	return strings.ReplaceAll(s, "\t", "     ")
+// DefaultTabWidth is the default number of columns between tab stops.
+const DefaultTabWidth = 8
+
+// FormatTabs replaces all '\t' occurrences in a string with the number of spaces
+// needed to reach the next tab stop, with tab stops every width columns (or the
+// default width if not positive). Each line in the string is assumed to start at
+// the col terminal column, like after a prompt. Colors/escapes are ignored and
+// wide characters are accounted for in widths.
+func FormatTabs(s string, width, col int) string {
+	if !strings.Contains(s, "\t") {
+		return s
+	}
+
+	if width <= 0 {
+		width = DefaultTabWidth
+	}
+
+	var expanded strings.Builder
+
+	for num, line := range strings.Split(s, "\n") {
+		if num > 0 {
+			expanded.WriteString("\n")
+		}
+
+		lineCol := col
+		parts := strings.Split(line, "\t")
+
+		for pos, part := range parts {
+			expanded.WriteString(part)
+
+			if pos == len(parts)-1 {
+				break
+			}
+
+			lineCol += uniseg.StringWidth(color.Strip(part))
+			spaces := width - lineCol%width
+			lineCol += spaces
+
+			expanded.WriteString(strings.Repeat(" ", spaces))
+		}
+	}
+
+	return expanded.String()
+}
+
+// FormatControls replaces all control characters in a string (inserted
+// verbatim with quoted-insert, for instance) with their caret notation
+// (eg. ^A), so that they are rendered safely. Tabs and newlines are left
+// untouched. Since escapes are formatted as well (^[), the string must not
+// contain any sequence meant for the terminal, like colors: those must be
+// added after formatting the text, or stripped before computing its width.
+func FormatControls(s string) string {
+	if !strings.ContainsFunc(s, isFormattedControl) {
+		return s
+	}
+
+	var formatted strings.Builder
+
+	for _, char := range s {
+		if !isFormattedControl(char) {
+			formatted.WriteRune(char)
+			continue
+		}
+
+		formatted.WriteRune('^')
+		formatted.WriteRune(inputrc.Decontrol(char))
+	}
+
+	return formatted.String()
 }
 
 // RealLength returns the real length of a string (the number of terminal
 // columns used to render the line, which may contain special graphemes).
-// Before computing the width, it replaces tabs with (4) spaces, and strips colors.
+// Before computing the width, it expands tabs to the default tab stops (from
+// the start of the string), formats control characters with their caret
+// notation, and strips colors.
 func RealLength(s string) int {
-	colors := color.Strip(s)
-	tabs := strings.ReplaceAll(colors, "\t", "     ")
+	return uniseg.StringWidth(FormatTabs(FormatControls(color.Strip(s)), DefaultTabWidth, 0))
+}
 
-	return uniseg.StringWidth(tabs)
+func isFormattedControl(char rune) bool {
+	return inputrc.IsControl(char) && char != '\t' && char != '\n'
 }
 
 // LineSpan computes the number of columns and lines that are needed for a given line,
-// accounting for any ANSI escapes/color codes, and tabulations replaced with 4 spaces.
-func LineSpan(line []rune, idx, indent int) (x, y int) {
-	termWidth := term.GetWidth()
-	lineLen := RealLength(string(line))
+// starting at the indent column, accounting for color codes, tabulations expanded to
+// tab stops every tabWidth columns, and other control characters (including escapes
+// not starting colors), rendered with caret notation, and wrapping at termWidth columns.
+func LineSpan(line []rune, idx, indent, tabWidth, termWidth int) (x, y int) {
+	lineLen := uniseg.StringWidth(FormatTabs(FormatControls(color.StripSGR(string(line))), tabWidth, indent))
 	lineLen += indent
 
 	cursorY := lineLen / termWidth
@@ -0,0 +1,81 @@
+package strutil
+
+import "testing"
+
+func TestFormatControls(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want string
+	}{
+		{name: "No controls", s: "git status", want: "git status"},
+		{name: "Control character", s: "a\x01b", want: "a^Ab"},
+		{name: "Escape alone", s: "\x1b", want: "^["},
+		{name: "Escape followed by bracket", s: "\x1b[2J", want: "^[[2J"},
+		{name: "Escape followed by parenthesis", s: "\x1b(0", want: "^[(0"},
+		{name: "Escape starting a color", s: "\x1b[31mred", want: "^[[31mred"},
+		{name: "Tabs and newlines kept", s: "a\tb\nc", want: "a\tb\nc"},
+		{name: "Multibyte runes", s: "été\x02", want: "été^B"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := FormatControls(test.s); got != test.want {
+				t.Errorf("FormatControls(%q) = %q, want %q", test.s, got, test.want)
+			}
+		})
+	}
+}
+
+func TestFormatTabs(t *testing.T) {
+	tests := []struct {
+		name  string
+		s     string
+		width int
+		col   int
+		want  string
+	}{
+		{name: "No tabs", s: "abc", width: 4, want: "abc"},
+		{name: "Tab stops", s: "a\tbc\td", width: 4, want: "a   bc  d"},
+		{name: "Default width", s: "a\tb", want: "a       b"},
+		{name: "Tab on a tab stop", s: "abcd\te", width: 4, want: "abcd    e"},
+		{name: "Starting column", s: "a\tb", width: 4, col: 2, want: "a b"},
+		{name: "Starting column on each line", s: "a\tb\n\tc", width: 4, col: 3, want: "a    b\n c"},
+		{name: "Wide characters", s: "中\tb", width: 4, want: "中  b"},
+		{name: "Colors ignored", s: "\x1b[31ma\x1b[0m\tb", width: 4, want: "\x1b[31ma\x1b[0m   b"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := FormatTabs(test.s, test.width, test.col); got != test.want {
+				t.Errorf("FormatTabs(%q) = %q, want %q", test.s, got, test.want)
+			}
+		})
+	}
+}
+
+func TestLineSpan(t *testing.T) {
+	tests := []struct {
+		name     string
+		line     string
+		indent   int
+		tabWidth int
+		wantX    int
+	}{
+		{name: "Plain line", line: "abc", wantX: 3},
+		{name: "Colors ignored", line: "\x1b[31mabc\x1b[0m", wantX: 3},
+		{name: "Control characters", line: "a\x01", wantX: 3},
+		{name: "Escape sequence not a color", line: "\x1b[2J", wantX: 5},
+		{name: "Tab", line: "a\tb", tabWidth: 4, wantX: 5},
+		{name: "Tab after indent", line: "a\tb", indent: 2, tabWidth: 4, wantX: 5},
+		{name: "Tab and wide characters", line: "中文\tb", indent: 1, tabWidth: 8, wantX: 9},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if x, _ := LineSpan([]rune(test.line), 0, test.indent, test.tabWidth, 80); x != test.wantX {
+				t.Errorf("LineSpan(%q) x = %d, want %d", test.line, x, test.wantX)
+			}
+		})
+	}
+}
@@ -132,6 +132,39 @@ func IsBracket(char rune) bool {
 	return false
 }
 
+// MatchBracket returns the position of the bracket/brace/parenthesis matching the
+// one at pos in the line, taking nested pairs of the same kind into account, or -1
+// if the character at pos is not a bracket, or if its matching one is not found.
+func MatchBracket(line []rune, pos int) int {
+	if pos < 0 || pos >= len(line) || !IsBracket(line[pos]) {
+		return -1
+	}
+
+	opener, closer := MatchSurround(line[pos])
+
+	step := 1
+	if line[pos] == closer {
+		step = -1
+	}
+
+	depth := 0
+
+	for idx := pos; idx >= 0 && idx < len(line); idx += step {
+		switch line[idx] {
+		case opener:
+			depth += step
+		case closer:
+			depth -= step
+		}
+
+		if depth == 0 {
+			return idx
+		}
+	}
+
+	return -1
+}
+
 // GetQuotedWordStart returns the position of the outmost containing quote
 // of the word (going backward from the end of the provided line), if the
 // current word is a shell word that is not closed yet.
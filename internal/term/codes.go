@@ -16,6 +16,12 @@ const (
 	RestoreCursorPos = "\x1b8"
 	HideCursor       = "\x1b[?25l"
 	ShowCursor       = "\x1b[?25h"
+
+	MouseOn  = "\x1b[?1000h\x1b[?1006h" // Reports clicks and wheel events (SGR encoding)
+	MouseOff = "\x1b[?1006l\x1b[?1000l"
+
+	BracketedPasteOn  = "\x1b[?2004h" // Pastes are enclosed in \x1b[200~ and \x1b[201~
+	BracketedPasteOff = "\x1b[?2004l"
 )
 
 // Some core keys needed by some stuff.
@@ -2,7 +2,9 @@ package term
 
 import (
 	"fmt"
+	"io"
 	"os"
+	"sync"
 
 	"golang.org/x/term"
 )
@@ -50,7 +52,88 @@ func GetLength() int {
 	return length
 }
 
-func printf(format string, a ...interface{}) {
-	s := fmt.Sprintf(format, a...)
-	fmt.Print(s)
+// Output is the terminal on which a shell displays itself: the writer to which
+// it prints its prompts, input line, helpers and all escape sequences, along with
+// the size of this terminal. Each shell has its own output, so that several ones
+// can run at the same time on different terminals (eg. PTYs or SSH sessions).
+type Output struct {
+	writer io.Writer
+	size   func() (width, height int)
+	mutex  sync.RWMutex
+}
+
+// NewOutput returns an output printing to standard output.
+func NewOutput() *Output {
+	return &Output{writer: os.Stdout}
+}
+
+// SetWriter sets the writer to which the output is printed (standard output if nil).
+func (o *Output) SetWriter(writer io.Writer) {
+	if writer == nil {
+		writer = os.Stdout
+	}
+
+	o.mutex.Lock()
+	o.writer = writer
+	o.mutex.Unlock()
+}
+
+// SetSize sets the function returning the size of the terminal on which the output
+// is displayed. If nil, the size is queried on the writer if it is a terminal, and
+// is 80 columns and 80 lines otherwise.
+func (o *Output) SetSize(size func() (width, height int)) {
+	o.mutex.Lock()
+	o.size = size
+	o.mutex.Unlock()
+}
+
+// Write implements io.Writer.
+func (o *Output) Write(data []byte) (int, error) {
+	o.mutex.RLock()
+	writer := o.writer
+	o.mutex.RUnlock()
+
+	return writer.Write(data)
+}
+
+// Width returns the width of the terminal, or 80 if it cannot be established.
+func (o *Output) Width() int {
+	width, _ := o.getSize()
+	return width
+}
+
+// Length returns the length of the terminal
+// (Y length), or 80 if it cannot be established.
+func (o *Output) Length() int {
+	_, length := o.getSize()
+	return length
+}
+
+func (o *Output) getSize() (width, length int) {
+	o.mutex.RLock()
+	writer, size := o.writer, o.size
+	o.mutex.RUnlock()
+
+	switch file, isFile := writer.(*os.File); {
+	case size != nil:
+		width, length = size()
+	case writer == os.Stdout:
+		width, length = GetWidth(), GetLength()
+	case isFile:
+		width, length, _ = GetSize(int(file.Fd()))
+	}
+
+	if width <= 0 {
+		width = defaultTermWidth
+	}
+
+	if length <= 0 {
+		length = defaultTermWidth
+	}
+
+	return width, length
+}
+
+func (o *Output) printf(format string, a ...interface{}) {
+	fmt.Fprintf(o, format, a...)
 }
@@ -9,6 +9,20 @@ import (
 	"github.com/reeflective/readline/internal/term"
 )
 
+// HintKind is the kind of a hint message, used to format it.
+type HintKind int
+
+const (
+	// HintInfo is an informational message (status, completion messages, etc).
+	HintInfo HintKind = iota
+	// HintUsage is the usage string of what is being completed.
+	HintUsage
+	// HintError is an error message.
+	HintError
+	// HintSuccess reports an action that succeeded (eg. a configuration reload).
+	HintSuccess
+)
+
 // Hint is in charge of printing the usage messages below the input line.
 // Various other UI components have access to it so that they can feed
 // specialized usage messages to it, like completions.
@@ -18,6 +32,36 @@ type Hint struct {
 	cleanup    bool
 	temp       bool
 	set        bool
+	formatter  func(hint string, kind HintKind) string
+}
+
+// FormatHint is the default hint formatter: error messages are red,
+// success ones are green, and all other messages are dimmed.
+func FormatHint(hint string, kind HintKind) string {
+	switch kind {
+	case HintError:
+		return color.FgRed + hint
+	case HintSuccess:
+		return color.FgGreen + hint
+	default:
+		return color.Dim + hint
+	}
+}
+
+// SetFormatter sets the function used to format hint messages
+// according to their kind. If nil, FormatHint() is used.
+func (h *Hint) SetFormatter(formatter func(hint string, kind HintKind) string) {
+	h.formatter = formatter
+}
+
+// Format returns the hint message formatted according to its kind.
+// All components should format their messages with it before setting them.
+func (h *Hint) Format(hint string, kind HintKind) string {
+	if h.formatter == nil {
+		return FormatHint(hint, kind)
+	}
+
+	return h.formatter(hint, kind)
 }
 
 // Set sets the hint message to the given text.
@@ -68,8 +112,8 @@ func (h *Hint) ResetPersist() {
 	h.persistent = make([]rune, 0)
 }
 
-// DisplayHint prints the hint (persistent and/or temporary) sections.
-func DisplayHint(hint *Hint) {
+// DisplayHint prints the hint (persistent and/or temporary) sections to out.
+func DisplayHint(hint *Hint, out *term.Output) {
 	if hint.temp && hint.set {
 		hint.set = false
 	} else if hint.temp {
@@ -78,7 +122,7 @@ func DisplayHint(hint *Hint) {
 
 	if len(hint.text) == 0 && len(hint.persistent) == 0 {
 		if hint.cleanup {
-			fmt.Print(term.ClearLineAfter)
+			fmt.Fprint(out, term.ClearLineAfter)
 		}
 
 		hint.cleanup = false
@@ -95,7 +139,7 @@ func DisplayHint(hint *Hint) {
 	text += term.ClearLineAfter + color.Reset
 
 	if len(text) > 0 {
-		fmt.Print(text)
+		fmt.Fprint(out, text)
 	}
 }
 
@@ -118,8 +162,9 @@ func (h *Hint) renderHint() (text string) {
 	return text
 }
 
-// CoordinatesHint returns the number of terminal rows used by the hint.
-func CoordinatesHint(hint *Hint) int {
+// CoordinatesHint returns the number of terminal rows used by
+// the hint, when displayed on a terminal termWidth columns wide.
+func CoordinatesHint(hint *Hint, termWidth int) int {
 	text := hint.renderHint()
 
 	// Nothing to do if no real text
@@ -134,7 +179,7 @@ func CoordinatesHint(hint *Hint) int {
 	lines := strings.Split(text, term.ClearLineAfter)
 
 	for i, line := range lines {
-		x, y := strutil.LineSpan([]rune(line), i, 0)
+		x, y := strutil.LineSpan([]rune(line), i, 0, strutil.DefaultTabWidth, termWidth)
 		if x != 0 {
 			y++
 		}
@@ -0,0 +1,35 @@
+package ui
+
+import (
+	"testing"
+
+	"github.com/reeflective/readline/internal/color"
+)
+
+func TestHint_Format(t *testing.T) {
+	bold := func(hint string, kind HintKind) string { return color.Bold + hint }
+
+	tests := []struct {
+		name      string
+		formatter func(hint string, kind HintKind) string
+		kind      HintKind
+		want      string
+	}{
+		{name: "Info", kind: HintInfo, want: color.Dim + "hint"},
+		{name: "Usage", kind: HintUsage, want: color.Dim + "hint"},
+		{name: "Error", kind: HintError, want: color.FgRed + "hint"},
+		{name: "Success", kind: HintSuccess, want: color.FgGreen + "hint"},
+		{name: "Custom formatter", formatter: bold, kind: HintError, want: color.Bold + "hint"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hint := new(Hint)
+			hint.SetFormatter(test.formatter)
+
+			if got := hint.Format("hint", test.kind); got != test.want {
+				t.Errorf("Format() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
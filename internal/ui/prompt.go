@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/reeflective/readline/inputrc"
+	"github.com/reeflective/readline/internal/color"
 	"github.com/reeflective/readline/internal/core"
 	"github.com/reeflective/readline/internal/keymap"
 	"github.com/reeflective/readline/internal/strutil"
@@ -18,11 +19,13 @@ type Prompt struct {
 	primaryF    func() string
 	primaryRows int
 	primaryCols int
+	dimmed      bool
 
-	secondaryF func() string
+	secondaryF func(line int) string
 	transientF func() string
 	rightF     func() string
 	tooltipF   func() string
+	indicatorF func() string
 
 	// True if some logs have printed asynchronously
 	// since last loop. Check refresh prompt funcs.
@@ -33,15 +36,17 @@ type Prompt struct {
 	cursor  *core.Cursor
 	keymaps *keymap.Engine
 	opts    *inputrc.Config
+	out     *term.Output
 }
 
 // NewPrompt is a required constructor to initialize the prompt system.
-func NewPrompt(line *core.Line, cursor *core.Cursor, keymaps *keymap.Engine, opts *inputrc.Config) *Prompt {
+func NewPrompt(line *core.Line, cursor *core.Cursor, keymaps *keymap.Engine, opts *inputrc.Config, out *term.Output) *Prompt {
 	return &Prompt{
 		line:    line,
 		cursor:  cursor,
 		keymaps: keymaps,
 		opts:    opts,
+		out:     out,
 	}
 }
 
@@ -55,11 +60,51 @@ func (p *Prompt) Right(prompt func() string) {
 	p.rightF = prompt
 }
 
+// Indicator uses a function returning a status string (eg. the keymap mode)
+// printed at the end of the right prompt, or alone if there is no such prompt.
+func (p *Prompt) Indicator(indicator func() string) {
+	p.indicatorF = indicator
+}
+
 // Secondary uses a function returning the prompt to use as the secondary prompt.
 func (p *Prompt) Secondary(prompt func() string) {
+	if prompt == nil {
+		p.secondaryF = nil
+		return
+	}
+
+	p.secondaryF = func(int) string { return prompt() }
+}
+
+// SecondaryLine uses a function returning the secondary prompt to use for
+// a given continuation line of the input (starting at 1 for the second line).
+func (p *Prompt) SecondaryLine(prompt func(line int) string) {
 	p.secondaryF = prompt
 }
 
+// SecondaryPrompts returns the secondary prompts to print before each of the
+// continuation lines of an input having the given number of newlines. They are
+// all padded to the width of the widest one, which is returned along with them.
+// If no secondary prompt is set, no prompts are returned.
+func (p *Prompt) SecondaryPrompts(newlines int) (prompts []string, width int) {
+	if p.secondaryF == nil || newlines == 0 {
+		return nil, 0
+	}
+
+	prompts = make([]string, newlines)
+
+	for line := range prompts {
+		prompts[line] = p.secondaryF(line + 1)
+		width = max(width, strutil.RealLength(prompts[line]))
+	}
+
+	for line, prompt := range prompts {
+		prompts[line] = strings.Repeat(" ", width-strutil.RealLength(prompt)) + prompt
+	}
+
+	return prompts, width
+}
+
 // Transient uses a function returning the prompt to use as a transient prompt.
 func (p *Prompt) Transient(prompt func() string) {
 	p.transientF = prompt
@@ -103,18 +148,14 @@ func (p *Prompt) PrimaryPrint() {
 
 	// Print the various lines.
 	if prompt != "" {
-		fmt.Print(prompt)
+		fmt.Fprint(p.out, prompt)
 	}
 
-	fmt.Print(lastPrompt)
+	fmt.Fprint(p.out, lastPrompt)
 
 	// And compute coordinates
 	p.primaryRows = strings.Count(prompt, "\n")
 	p.primaryCols = strutil.RealLength(lastPrompt)
-
-	if p.primaryCols > 0 {
-		p.primaryCols--
-	}
 }
 
 // PrimaryUsed returns the number of terminal rows on which
@@ -144,18 +185,28 @@ func (p *Prompt) LastPrint() {
 
 	prompt := p.formatLastPrompt(lines[len(lines)-1])
 
-	fmt.Print(prompt)
+	if p.dimmed {
+		fmt.Fprint(p.out, color.Dimmed(prompt))
+	} else {
+		fmt.Fprint(p.out, prompt)
+	}
 
 	p.primaryCols = strutil.RealLength(prompt)
-	if p.primaryCols > 0 {
-		p.primaryCols--
-	}
+}
+
+// SetDimmed sets whether the last line of the primary prompt is printed
+// with a reduced intensity by LastPrint (eg. while a menu has the focus).
+func (p *Prompt) SetDimmed(dimmed bool) {
+	p.dimmed = dimmed
 }
 
 // LastUsed returns the number of terminal columns used by the last
 // part of the primary prompt (of the entire string if not multiline).
 // This, in effect, returns the X coordinate at which the input line
 // should be printed, and indentation for subsequent lines if several.
+// Escape sequences are ignored, and wide glyphs (like most emojis)
+// account for the two columns they use, so that wrapping lines are
+// correctly computed.
 func (p *Prompt) LastUsed() int {
 	if p.primaryF == nil {
 		return 0
@@ -172,10 +223,6 @@ func (p *Prompt) LastUsed() int {
 	prompt := p.formatLastPrompt(lines[len(lines)-1])
 	p.primaryCols = strutil.RealLength(prompt)
 
-	if p.primaryCols > 0 {
-		p.primaryCols--
-	}
-
 	return p.primaryCols
 }
 
@@ -194,14 +241,22 @@ func (p *Prompt) RightPrint(startColumn int, force bool) {
 		rprompt = p.rightF()
 	}
 
+	if p.indicatorF != nil {
+		if indicator := p.indicatorF(); indicator != "" && rprompt != "" {
+			rprompt += " " + indicator
+		} else if indicator != "" {
+			rprompt = indicator
+		}
+	}
+
 	if rprompt == "" {
 		return
 	}
 
 	if prompt, canPrint := p.formatRightPrompt(rprompt, startColumn); canPrint {
-		fmt.Print(prompt)
+		fmt.Fprint(p.out, prompt)
 	} else {
-		fmt.Print(term.ClearLineAfter)
+		fmt.Fprint(p.out, term.ClearLineAfter)
 	}
 }
 
@@ -212,12 +267,12 @@ func (p *Prompt) TransientPrint() {
 	}
 
 	// Clean everything below where the prompt will be printed.
-	term.MoveCursorBackwards(term.GetWidth())
-	term.MoveCursorUp(p.primaryRows)
-	fmt.Print(term.ClearScreenBelow)
+	p.out.MoveCursorBackwards(p.out.Width())
+	p.out.MoveCursorUp(p.primaryRows)
+	fmt.Fprint(p.out, term.ClearScreenBelow)
 
 	// And print the prompt
-	fmt.Print(p.transientF())
+	fmt.Fprint(p.out, p.transientF())
 }
 
 // Refreshing returns true if the prompt is currently redisplaying
@@ -259,7 +314,7 @@ func (p *Prompt) formatLastPrompt(prompt string) string {
 
 func (p *Prompt) formatRightPrompt(rprompt string, startColumn int) (prompt string, canPrint bool) {
 	// Dimensions
-	termWidth := term.GetWidth()
+	termWidth := p.out.Width()
 	promptLen := strutil.RealLength(rprompt)
 	padLen := termWidth - startColumn - promptLen
 
@@ -0,0 +1,75 @@
+package ui
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/reeflective/readline/inputrc"
+	"github.com/reeflective/readline/internal/core"
+	"github.com/reeflective/readline/internal/term"
+)
+
+func TestPrompt_LastUsed(t *testing.T) {
+	width := term.GetWidth()
+
+	tests := []struct {
+		name    string
+		prompt  string
+		line    string
+		wantCol int
+		wantX   int
+		wantY   int
+	}{
+		{
+			name:    "Narrow prompt",
+			prompt:  "> ",
+			line:    strings.Repeat("a", 10),
+			wantCol: 2,
+			wantX:   12,
+			wantY:   0,
+		},
+		{
+			name:    "Colored wide glyph prompt",
+			prompt:  "\x1b[1;32m🚀\x1b[0m ",
+			line:    strings.Repeat("a", width-4),
+			wantCol: 3,
+			wantX:   width - 1,
+			wantY:   0,
+		},
+		{
+			name:    "Wide glyph prompt, line wrapping at the boundary",
+			prompt:  "\x1b[1;32m🚀\x1b[0m ",
+			line:    strings.Repeat("a", width-3),
+			wantCol: 3,
+			wantX:   0,
+			wantY:   1,
+		},
+		{
+			name:    "Multiline wide glyph prompt",
+			prompt:  "~/code\n🚀🚀 ",
+			line:    strings.Repeat("a", width-5),
+			wantCol: 5,
+			wantX:   0,
+			wantY:   1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			prompt := NewPrompt(nil, nil, nil, inputrc.NewDefaultConfig(), term.NewOutput())
+			prompt.Primary(func() string { return test.prompt })
+
+			col := prompt.LastUsed()
+			if col != test.wantCol {
+				t.Errorf("LastUsed() = %d, want %d", col, test.wantCol)
+			}
+
+			line := core.Line(test.line)
+
+			x, y := core.CoordinatesLine(&line, col)
+			if x != test.wantX || y != test.wantY {
+				t.Errorf("CoordinatesLine() = (%d, %d), want (%d, %d)", x, y, test.wantX, test.wantY)
+			}
+		})
+	}
+}
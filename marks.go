@@ -0,0 +1,177 @@
+package readline
+
+const (
+	// lastJumpMark is the mark holding the cursor position before the last jump.
+	lastJumpMark = '`'
+
+	// regionMark is the Emacs mark set with set-mark-command, which is not a
+	// Vim mark name: the region is between this mark and the cursor position.
+	regionMark = '@'
+)
+
+// viMarks are the Vim marks set in the line being edited. Since the line can be
+// modified after they are set, marks are adjusted after each modification so that
+// they keep pointing to the same character: marks after a modification are shifted,
+// and marks on a modified character are invalidated (deleted).
+type viMarks struct {
+	marks    map[rune]int // Positions of marks, by name.
+	modified bool         // The line has been modified since the last command.
+	dropped  bool         // The region mark has been invalidated since the last command.
+}
+
+// set sets a mark at a position in the line.
+func (m *viMarks) set(name rune, pos int) {
+	if m.marks == nil {
+		m.marks = make(map[rune]int)
+	}
+
+	m.marks[name] = pos
+}
+
+// get returns the position of a mark, if it is set.
+func (m *viMarks) get(name rune) (pos int, found bool) {
+	pos, found = m.marks[name]
+	return pos, found
+}
+
+// reset drops all marks.
+func (m *viMarks) reset() {
+	m.marks = nil
+	m.modified = false
+	m.dropped = false
+}
+
+// edited shifts or invalidates the marks after removing characters from
+// the line at a position, and inserting others there: marks on a character
+// before which some are inserted are shifted, like the ones after it, except
+// the Emacs region mark, which stays before them like in Emacs (so that the
+// region includes the text inserted at the mark).
+func (m *viMarks) edited(pos, removed, inserted int) {
+	m.modified = true
+
+	for name, mark := range m.marks {
+		switch {
+		case mark < pos:
+		case mark == pos && removed == 0 && name == regionMark:
+		case mark >= pos+removed:
+			m.marks[name] = mark + inserted - removed
+		default:
+			delete(m.marks, name)
+			m.dropped = m.dropped || name == regionMark
+		}
+	}
+}
+
+// adjustMarks updates the Emacs region after the modifications made to the line
+// by the last command (the marks themselves are adjusted on each modification):
+// when active, it keeps starting at its mark, and is deactivated if the character
+// on which the mark is set is modified.
+func (rl *Shell) adjustMarks() {
+	modified, dropped := rl.marks.modified, rl.marks.dropped
+	rl.marks.modified, rl.marks.dropped = false, false
+
+	if !modified || !rl.Keymap.IsEmacs() || !rl.selection.Active() {
+		return
+	}
+
+	if dropped {
+		rl.selection.Reset()
+		return
+	}
+
+	rl.activateRegion()
+}
+
+// activateRegion activates and highlights the Emacs region, between the
+// mark and the cursor position, and returns false if no mark is set.
+func (rl *Shell) activateRegion() bool {
+	mark, found := rl.marks.get(regionMark)
+	if !found {
+		return false
+	}
+
+	rl.selection.MarkRange(mark, -1)
+	rl.selection.Visual(false)
+
+	return true
+}
+
+// isMarkName returns true if the key can be used as a mark name.
+func isMarkName(key rune) bool {
+	return key >= 'a' && key <= 'z'
+}
+
+// Set the mark read from the keyboard (a-z) at the cursor position.
+func (rl *Shell) viSetMark() {
+	rl.History.SkipSave()
+
+	done := rl.Keymap.PendingCursor()
+	defer done()
+
+	key, isAbort := rl.Keys.ReadKey()
+	if isAbort {
+		return
+	}
+
+	if !isMarkName(key) {
+		rl.bell()
+		return
+	}
+
+	rl.marks.set(key, rl.cursor.Pos())
+}
+
+// Move to the mark read from the keyboard (a-z), or to the position
+// before the last jump if the key is a backquote or a single quote.
+func (rl *Shell) viGotoMark() {
+	rl.History.SkipSave()
+
+	if pos, found := rl.readMark(); found {
+		rl.jumpTo(pos)
+	}
+}
+
+// Move to the first non-blank character of the line on which the mark
+// read from the keyboard is (a-z), or of the line before the last jump.
+func (rl *Shell) viGotoMarkLine() {
+	rl.History.SkipSave()
+
+	if pos, found := rl.readMark(); found {
+		rl.jumpTo(pos)
+		rl.cursor.BeginningOfLine()
+		rl.cursor.ToFirstNonSpace(true)
+	}
+}
+
+// readMark reads a mark name from the keyboard and returns its position,
+// ringing the bell if the key is not a mark name or if the mark is not set.
+func (rl *Shell) readMark() (pos int, found bool) {
+	done := rl.Keymap.PendingCursor()
+	defer done()
+
+	key, isAbort := rl.Keys.ReadKey()
+	if isAbort {
+		return 0, false
+	}
+
+	if key == '\'' {
+		key = lastJumpMark
+	}
+
+	if isMarkName(key) || key == lastJumpMark {
+		pos, found = rl.marks.get(key)
+	}
+
+	if !found {
+		rl.bell()
+	}
+
+	return pos, found
+}
+
+// jumpTo moves the cursor to a mark position, and
+// keeps the previous position as the last jump one.
+func (rl *Shell) jumpTo(pos int) {
+	rl.marks.set(lastJumpMark, rl.cursor.Pos())
+	rl.cursor.Set(pos)
+}
@@ -0,0 +1,102 @@
+package readline
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/reeflective/readline/internal/core"
+)
+
+func TestViMarks_edited(t *testing.T) {
+	tests := []struct {
+		name  string
+		line  string
+		marks map[rune]int
+		edit  func(line *core.Line)
+		want  map[rune]int
+	}{
+		{
+			name:  "Insert repeated text before mark",
+			line:  "abab",
+			marks: map[rune]int{'a': 2},
+			edit:  func(line *core.Line) { line.Insert(0, 'a', 'b') },
+			want:  map[rune]int{'a': 4},
+		},
+		{
+			name:  "Insert repeated text after mark",
+			line:  "abab",
+			marks: map[rune]int{'a': 1},
+			edit:  func(line *core.Line) { line.Insert(2, 'a', 'b') },
+			want:  map[rune]int{'a': 1},
+		},
+		{
+			name:  "Insert at mark",
+			line:  "abcd",
+			marks: map[rune]int{'a': 2},
+			edit:  func(line *core.Line) { line.Insert(2, 'x') },
+			want:  map[rune]int{'a': 3},
+		},
+		{
+			name:  "Delete repeated text before mark",
+			line:  "aaaa",
+			marks: map[rune]int{'a': 2, 'b': 3},
+			edit:  func(line *core.Line) { line.CutRune(0) },
+			want:  map[rune]int{'a': 1, 'b': 2},
+		},
+		{
+			name:  "Delete marked character",
+			line:  "aaaa",
+			marks: map[rune]int{'a': 1, 'b': 3},
+			edit:  func(line *core.Line) { line.CutRune(1) },
+			want:  map[rune]int{'b': 2},
+		},
+		{
+			name:  "Cut range around mark",
+			line:  "hello world",
+			marks: map[rune]int{'a': 0, 'b': 7, 'c': 10},
+			edit:  func(line *core.Line) { line.Cut(6, 9) },
+			want:  map[rune]int{'a': 0, 'c': 7},
+		},
+		{
+			name:  "Cut to the end of line",
+			line:  "hello world",
+			marks: map[rune]int{'a': 2, 'b': 8},
+			edit:  func(line *core.Line) { line.Cut(5, -1) },
+			want:  map[rune]int{'a': 2},
+		},
+		{
+			name:  "Replace range",
+			line:  "hello world",
+			marks: map[rune]int{'a': 1, 'b': 4, 'c': 6},
+			edit:  func(line *core.Line) { line.InsertBetween(0, 5, []rune("hi")...) },
+			want:  map[rune]int{'c': 3},
+		},
+		{
+			name:  "Set line",
+			line:  "git status",
+			marks: map[rune]int{'a': 0, 'b': 5, 'c': 9},
+			edit:  func(line *core.Line) { line.Set([]rune("git stash")...) },
+			want:  map[rune]int{'a': 0, 'b': 5},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			line := core.Line(test.line)
+
+			var marks viMarks
+			for name, pos := range test.marks {
+				marks.set(name, pos)
+			}
+
+			core.OnEdit(&line, marks.edited)
+			defer core.OnEdit(&line, nil)
+
+			test.edit(&line)
+
+			if !reflect.DeepEqual(marks.marks, test.want) {
+				t.Errorf("Marks = %v, want %v", marks.marks, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package readline
+
+import (
+	"fmt"
+
+	"github.com/reeflective/readline/internal/completion"
+	"github.com/reeflective/readline/internal/core"
+	"github.com/reeflective/readline/internal/term"
+)
+
+// updateMouse enables the terminal mouse reporting when the completion
+// menu is active (and CompletionMouse is set), and disables it otherwise.
+func (rl *Shell) updateMouse() {
+	enabled := rl.CompletionMouse && rl.completer.IsActive()
+	if enabled == rl.mouse {
+		return
+	}
+
+	if enabled {
+		fmt.Fprint(rl.output, term.MouseOn)
+	} else {
+		fmt.Fprint(rl.output, term.MouseOff)
+	}
+
+	rl.mouse = enabled
+}
+
+// stopMouse disables the terminal mouse reporting if it is enabled.
+// It is called when returning from Readline(), since the menu might
+// still be active at this point.
+func (rl *Shell) stopMouse() {
+	if !rl.mouse {
+		return
+	}
+
+	fmt.Fprint(rl.output, term.MouseOff)
+
+	rl.mouse = false
+}
+
+// handleMouse consumes the mouse event at the beginning of the key stack, if
+// any, and uses it on the completion menu. Returns false if there is no event.
+func (rl *Shell) handleMouse() bool {
+	if !rl.CompletionMouse {
+		return false
+	}
+
+	event, found := core.PopMouseEvent(rl.Keys)
+	if !found {
+		return false
+	}
+
+	// Events might still be reported after the menu is
+	// closed, but before their reporting is disabled.
+	if !rl.completer.IsActive() || event.Release || event.Motion {
+		return true
+	}
+
+	switch event.Button {
+	case core.MouseWheelUp:
+		rl.completer.Select(-1, 0)
+	case core.MouseWheelDown:
+		rl.completer.Select(1, 0)
+	case core.MouseLeft:
+		rl.clickCompletion(event)
+	}
+
+	return true
+}
+
+// clickCompletion selects the candidate clicked on, or inserts it if it
+// was already selected, and cancels the completion if clicked outside of
+// the menu area (including the preview and the remaining rows hint).
+func (rl *Shell) clickCompletion(event core.MouseEvent) {
+	menuRow := rl.Display.CompletionsRow()
+	if menuRow == -1 {
+		return
+	}
+
+	row, column := event.Y-menuRow, event.X-1
+
+	switch {
+	case row < 0 || row > completion.Coordinates(rl.completer):
+		rl.completer.ResetForce()
+	case rl.completer.SelectedAt(row, column):
+		rl.completer.Accept()
+	default:
+		rl.completer.SelectAt(row, column)
+	}
+}
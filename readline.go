@@ -19,12 +19,14 @@
 package readline
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"strings"
 
 	"github.com/reeflective/readline/inputrc"
-	"github.com/reeflective/readline/internal/color"
 	"github.com/reeflective/readline/internal/completion"
 	"github.com/reeflective/readline/internal/core"
 	"github.com/reeflective/readline/internal/display"
@@ -32,42 +34,78 @@ import (
 	"github.com/reeflective/readline/internal/keymap"
 	"github.com/reeflective/readline/internal/macro"
 	"github.com/reeflective/readline/internal/term"
+	"github.com/reeflective/readline/internal/ui"
 )
 
-// ErrInterrupt is returned when the interrupt sequence
-// is pressed on the keyboard. The sequence is usually Ctrl-C.
-var ErrInterrupt = errors.New(os.Interrupt.String())
+var (
+	// ErrInterrupt is returned when the interrupt sequence
+	// is pressed on the keyboard. The sequence is usually Ctrl-C.
+	ErrInterrupt = errors.New(os.Interrupt.String())
+
+	// ErrEOF is returned when the end-of-file sequence is pressed on
+	// the keyboard with an empty line. The sequence is usually Ctrl-D.
+	// It wraps io.EOF, so that errors.Is(err, io.EOF) is also true.
+	ErrEOF = fmt.Errorf("end of file: %w", io.EOF)
+
+	// ErrUnknownCommand is returned when binding keys to a command
+	// that is neither a builtin one nor a registered one.
+	ErrUnknownCommand = keymap.ErrUnknownCommand
+)
 
 // Readline displays the readline prompt and reads user input.
 // It can return from the call because of different things:
 //
-//   - When the user accepts the line (generally with Enter).
-//   - If a particular keystroke mapping returns an error.
-//     (Ctrl-C returns ErrInterrupt, Ctrl-D returns io.EOF).
+//   - When the user accepts the line (generally with Enter): the error is nil.
+//   - When the interrupt sequence is pressed (generally Ctrl-C): ErrInterrupt.
+//   - When the end-of-file sequence is pressed on an empty line (generally Ctrl-D): ErrEOF.
+//   - When standard input is closed: io.EOF itself.
+//   - When the terminal cannot be set up (raw mode): the corresponding error.
+//
+// Since ErrEOF wraps io.EOF, errors.Is(err, io.EOF) is true for both of the
+// last cases, while errors.Is(err, ErrEOF) is only true for the keypress.
 //
 // In all cases, the current input line is returned along with any error,
-// and it is up to the caller to decide what to do with the line result.
+// and it is up to the caller to decide what to do with the line result:
+// a common pattern is to clear the line on ErrInterrupt, and to exit on io.EOF.
 // When the error is not nil, the returned line is not written to history.
 func (rl *Shell) Readline() (string, error) {
-	descriptor := int(os.Stdin.Fd())
+	// Input piped from a file or another program.
+	if _, terminal := rl.inputTerminal(); !terminal && rl.InputReader == nil {
+		return rl.readlineNonInteractive()
+	}
 
-	state, err := term.MakeRaw(descriptor)
+	restore, err := rl.makeRaw()
 	if err != nil {
 		return "", err
 	}
-	defer term.Restore(descriptor, state)
+	defer restore()
 
 	// Prompts and cursor styles
 	rl.Display.PrintPrimaryPrompt()
 	defer rl.Display.RefreshTransient()
-	defer fmt.Print(keymap.CursorStyle("default"))
+	defer rl.Keymap.RestoreCursor()
+	defer rl.stopFlash()
+	defer rl.stopMouse()
 
 	rl.init()
 
+	// Pasted text is enclosed in sequences (see bracketed-paste-begin).
+	if rl.Config.GetBool("enable-bracketed-paste") {
+		fmt.Fprint(rl.output, term.BracketedPasteOn)
+		defer fmt.Fprint(rl.output, term.BracketedPasteOff)
+	}
+
+	rl.reading.Store(true)
+	defer rl.reading.Store(false)
+
 	// Terminal resize events
 	resize := display.WatchResize(rl.Display)
 	defer close(resize)
 
+	// Notify the caller when the user does not type anything.
+	rl.armIdle()
+	defer rl.stopIdle()
+
 	for {
 		// Whether or not the command is resolved, let the macro
 		// engine record the keys if currently recording a macro.
@@ -79,6 +117,15 @@ func (rl *Shell) Readline() (string, error) {
 		// been consumed but did not match any command.
 		core.FlushUsed(rl.Keys)
 
+		// Notify the caller of any change made by the last command,
+		// and keep the Vim marks on the characters they were set on.
+		rl.updateCurrent()
+		rl.adjustMarks()
+		rl.leaveSessionHistory()
+		rl.previewExpansion()
+		rl.hintModeIndicator()
+		rl.updateMouse()
+
 		// Since we always update helpers after being asked to read
 		// for user input again, we do it before actually reading it.
 		rl.Display.Refresh()
@@ -88,6 +135,27 @@ func (rl *Shell) Readline() (string, error) {
 		// the macro engine has fed some keys in bulk when running one.
 		core.WaitAvailableKeys(rl.Keys, rl.Config)
 
+		// There is no user input to expect anymore.
+		if core.IsClosed(rl.Keys) {
+			rl.Display.AcceptLine()
+			return string(*rl.line), io.EOF
+		}
+
+		// Functions queued by other goroutines (like completions
+		// being streamed) are run before any key, and the display
+		// is refreshed before waiting again for user input.
+		if rl.runQueued() {
+			continue
+		}
+
+		// A key has been read: the user is not idle anymore.
+		rl.armIdle()
+
+		// Mouse events are only reported for the completion menu.
+		if rl.handleMouse() {
+			continue
+		}
+
 		// 1 - Local keymap (Completion/Isearch/Vim operator pending).
 		bind, command, prefixed := keymap.MatchLocal(rl.Keymap)
 		if prefixed {
@@ -125,6 +193,79 @@ func (rl *Shell) Readline() (string, error) {
 	}
 }
 
+// readlineNonInteractive reads the next line of standard input when the latter
+// is not a terminal (eg. piped input): there is no prompt, no line editing or
+// completion, and the line is returned without its newline. The line is still
+// written to the history sources. Once all input is read, io.EOF is returned.
+func (rl *Shell) readlineNonInteractive() (string, error) {
+	if rl.stdin == nil {
+		rl.stdin = bufio.NewReader(rl.input())
+	}
+
+	line, err := rl.stdin.ReadString('\n')
+	if err != nil && (line == "" || !errors.Is(err, io.EOF)) {
+		return line, err
+	}
+
+	line = strings.TrimSuffix(line, "\n")
+	line = strings.TrimSuffix(line, "\r")
+
+	// Write the line to history sources.
+	history.Init(rl.History)
+	rl.line.Set([]rune(line)...)
+	rl.cursor.Set(rl.line.Len())
+	rl.History.Accept(false, false, nil)
+
+	return line, nil
+}
+
+// input returns the reader from which the shell reads keys:
+// the InputReader of the shell if any, or standard input.
+func (rl *Shell) input() io.Reader {
+	if rl.InputReader != nil {
+		return rl.InputReader
+	}
+
+	return os.Stdin
+}
+
+// inputTerminal returns the file descriptor of the shell input,
+// and true if the latter is a terminal (which is not the case of
+// pipes, files or network connections, for instance).
+func (rl *Shell) inputTerminal() (descriptor int, terminal bool) {
+	file, isFile := rl.input().(interface{ Fd() uintptr })
+	if !isFile {
+		return -1, false
+	}
+
+	descriptor = int(file.Fd())
+
+	return descriptor, term.IsTerminal(descriptor)
+}
+
+// makeRaw sets up the terminal of the shell: keys are read from its InputReader
+// and the shell is displayed on its OutputWriter, if any (or on the standard ones),
+// and the input is put in raw mode if it is a terminal. Custom inputs which are not
+// terminals (eg. network connections) are expected to be raw already. The returned
+// function restores the terminal state.
+func (rl *Shell) makeRaw() (restore func(), err error) {
+	rl.output.SetWriter(rl.OutputWriter)
+	rl.output.SetSize(rl.TerminalSize)
+	rl.Keys.SetTerminal(rl.InputReader, rl.output)
+
+	descriptor, terminal := rl.inputTerminal()
+	if !terminal {
+		return func() {}, nil
+	}
+
+	state, err := term.MakeRaw(descriptor)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() { term.Restore(descriptor, state) }, nil
+}
+
 // init gathers all steps to perform at the beginning of readline loop.
 func (rl *Shell) init() {
 	// Reset core editor components.
@@ -132,6 +273,8 @@ func (rl *Shell) init() {
 	rl.line.Set()
 	rl.cursor.Set(0)
 	rl.cursor.ResetMark()
+	rl.marks.reset()
+	rl.yankArg = yankArgState{}
 	rl.selection.Reset()
 	rl.Buffers.Reset()
 	rl.History.Reset()
@@ -142,10 +285,44 @@ func (rl *Shell) init() {
 	history.Init(rl.History)
 	rl.History.Save()
 
+	if rl.buffer != nil {
+		rl.setBuffer(*rl.buffer)
+		rl.buffer = nil
+	}
+
 	// Reset/initialize user interface components.
 	rl.Hint.Reset()
+	rl.Hint.SetFormatter(rl.HintFormatter)
+	rl.completer.SetSpinner(rl.SpinnerFrames, rl.SpinnerThreshold)
+	rl.completer.SetLayout(rl.CompletionLayout)
+	rl.completer.SetHeaders(rl.CompletionHeaders)
+	rl.completer.SetMaxColumns(rl.CompletionMaxColumns)
+	rl.completer.SetMaxDisplayWidth(rl.CompletionMaxDisplayWidth)
+	rl.completer.SetMenuUnique(rl.CompletionMenuUnique)
+	rl.completer.SetIndicator(rl.CompletionIndicator, rl.CompletionIndicatorStyle, rl.CompletionIndicatorOnly)
+	rl.completer.SetPreview(rl.CompletionPreview)
+	rl.completer.SetTabWidth(rl.TabWidth)
+	rl.completer.SetOnError(rl.OnError)
+	rl.completer.SetNoMatchHint(rl.CompletionNoMatch == NoMatchHintBell || rl.CompletionNoMatch == NoMatchHint)
+	rl.Keymap.SetCursor(rl.CursorBlink, rl.CursorColor, rl.NoCursorStyle)
+	rl.Keymap.InitCursor()
 	rl.completer.ResetForce()
-	display.Init(rl.Display, rl.SyntaxHighlighter)
+	display.Init(rl.Display, rl.syntaxHighlighter())
+	rl.Display.SetTrailingWhitespace(rl.HighlightTrailingWhitespace)
+	rl.Display.SetTabWidth(rl.TabWidth)
+	rl.Display.SetAutosuggestPrecedence(rl.AutosuggestPrecedence)
+	rl.Display.SetDimBackground(rl.CompletionDimBackground)
+}
+
+// syntaxHighlighter returns the function highlighting the line:
+// the Highlighter tokens adapted to a highlighted string if any,
+// or the SyntaxHighlighter otherwise.
+func (rl *Shell) syntaxHighlighter() func(line []rune) string {
+	if rl.Highlighter != nil {
+		return display.TokenHighlighter(rl.Highlighter)
+	}
+
+	return rl.SyntaxHighlighter
 }
 
 // run wraps the execution of a target command/sequence with various pre/post actions
@@ -172,8 +349,18 @@ func (rl *Shell) run(main bool, bind inputrc.Bind, command func()) (bool, string
 	// The command might be nil, because the provided key sequence
 	// did not match any. We regardless execute everything related
 	// to the command, like any pending ones, and cursor checks.
+	hooked := rl.hookedCommand(bind, command)
+
+	if hooked != "" && rl.BeforeCommand != nil {
+		rl.BeforeCommand(hooked)
+	}
+
 	rl.execute(command)
 
+	if hooked != "" && rl.AfterCommand != nil {
+		rl.AfterCommand(hooked)
+	}
+
 	// Either print/clear iterations/active registers hints.
 	rl.updatePosRunHints()
 
@@ -217,6 +404,32 @@ func (rl *Shell) execute(command func()) {
 	}
 }
 
+// runQueued runs all functions queued for execution by the main
+// loop, and returns true if at least one of them has been run.
+func (rl *Shell) runQueued() bool {
+	queued := core.PopQueued(rl.Keys)
+
+	for _, event := range queued {
+		event()
+	}
+
+	return len(queued) > 0
+}
+
+// hookedCommand returns the name of the command to pass to the command
+// hooks, or an empty string if they must not be called for this command.
+func (rl *Shell) hookedCommand(bind inputrc.Bind, command func()) string {
+	if command == nil || bind.Macro {
+		return ""
+	}
+
+	if bind.Action == "self-insert" && !rl.HookSelfInsert {
+		return ""
+	}
+
+	return bind.Action
+}
+
 // Some commands show their current status as a hint (iterations/macro).
 func (rl *Shell) updatePosRunHints() {
 	hint := core.ResetPostRunIterations(rl.Iterations)
@@ -230,7 +443,7 @@ func (rl *Shell) updatePosRunHints() {
 	if hint != "" {
 		rl.Hint.Persist(hint)
 	} else if selected {
-		rl.Hint.Persist(color.Dim + fmt.Sprintf("(register: %s)", register))
+		rl.Hint.Persist(rl.Hint.Format(fmt.Sprintf("(register: %s)", register), ui.HintInfo))
 	}
 }
 
@@ -245,5 +458,9 @@ func (rl *Shell) handleUndefined(bind inputrc.Bind, cmd func()) {
 	if rl.Keymap.Local() == keymap.Isearch {
 		rl.Hint.Reset()
 		rl.completer.Reset()
+
+		return
 	}
+
+	rl.bell()
 }
@@ -0,0 +1,206 @@
+package readline
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/reeflective/readline/internal/color"
+	"github.com/reeflective/readline/internal/term"
+)
+
+// testTerminal is the output of shells under test: it records everything
+// written to it, and answers cursor position queries on the input like a
+// real terminal would.
+type testTerminal struct {
+	input  *io.PipeWriter
+	output bytes.Buffer
+}
+
+func (t *testTerminal) Write(data []byte) (int, error) {
+	if bytes.Contains(data, []byte("\x1b[6n")) {
+		go t.input.Write([]byte("\x1b[1;1R"))
+	}
+
+	return t.output.Write(data)
+}
+
+// readTestLine runs the shell on a pipe as if keys had been typed in a terminal,
+// and returns the line read. Each string of keys is sent in a separate read, a
+// bit after the previous one. The test fails if no line is returned in time.
+func readTestLine(t *testing.T, rl *Shell, keys ...string) (string, error) {
+	t.Helper()
+
+	reader, writer := io.Pipe()
+	defer reader.Close()
+
+	rl.InputReader = reader
+	rl.OutputWriter = &testTerminal{input: writer}
+
+	go func() {
+		for _, key := range keys {
+			writer.Write([]byte(key))
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+
+	type result struct {
+		line string
+		err  error
+	}
+
+	done := make(chan result, 1)
+
+	go func() {
+		line, err := rl.Readline()
+		done <- result{line, err}
+	}()
+
+	select {
+	case res := <-done:
+		return res.line, res.err
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Readline() with keys %q did not return", strings.Join(keys, ""))
+	}
+
+	return "", nil
+}
+
+func TestShell_Readline_customIO(t *testing.T) {
+	tests := []struct {
+		name string
+		keys string
+		want string
+	}{
+		{name: "Plain line", keys: "hello\r", want: "hello"},
+		{name: "Arrow key", keys: "abc\x1b[DX\r", want: "abXc"},
+		{name: "Home key", keys: "bc\x1b[Ha\r", want: "abc"},
+		{name: "Delete key", keys: "abc\x01\x1b[3~\r", want: "bc"},
+		{name: "Meta key", keys: "foo bar\x1bbX\r", want: "foo Xbar"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rl := NewShell()
+
+			got, err := readTestLine(t, rl, test.keys)
+			if err != nil {
+				t.Errorf("Readline() error = %v", err)
+			}
+
+			if got != test.want {
+				t.Errorf("Readline() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestShell_Readline_concurrent(t *testing.T) {
+	words := []string{"first", "second", "third"}
+
+	for i, word := range words {
+		word, other := word, words[(i+1)%len(words)]
+
+		t.Run(word, func(t *testing.T) {
+			t.Parallel()
+
+			rl := NewShell()
+
+			got, err := readTestLine(t, rl, word, "\r")
+			if err != nil {
+				t.Errorf("Readline() error = %v", err)
+			}
+
+			if got != word {
+				t.Errorf("Readline() = %q, want %q", got, word)
+			}
+
+			output := rl.OutputWriter.(*testTerminal).output.String()
+
+			if !strings.Contains(output, word) || strings.Contains(output, other) {
+				t.Errorf("Readline() output = %q, want only the line of its shell", output)
+			}
+		})
+	}
+}
+
+func TestShell_Readline_terminalSize(t *testing.T) {
+	rl := NewShell()
+	rl.Prompt.Primary(func() string { return "> " })
+	rl.Prompt.Right(func() string { return "R" })
+	rl.TerminalSize = func() (width, height int) { return 20, 10 }
+
+	if _, err := readTestLine(t, rl, "abc", "\r"); err != nil {
+		t.Errorf("Readline() error = %v", err)
+	}
+
+	// The right prompt ends on the last column of the terminal
+	// (the test terminal reports the line to start on column 0).
+	output := rl.OutputWriter.(*testTerminal).output.String()
+	right := "abc" + color.Reset + term.ClearLineAfter + color.BgDefault + strings.Repeat(" ", 20-len("abc")-1) + "R"
+
+	if !strings.Contains(output, right) {
+		t.Errorf("Readline() output = %q, want the right prompt on column 20", output)
+	}
+}
+
+func TestShell_Readline_quotedEscape(t *testing.T) {
+	rl := NewShell()
+
+	line, err := readTestLine(t, rl, "a\x16", "\x1b", "[2J\r")
+	if err != nil {
+		t.Errorf("Readline() error = %v", err)
+	}
+
+	if line != "a\x1b[2J" {
+		t.Errorf("Readline() = %q, want %q", line, "a\x1b[2J")
+	}
+
+	output := rl.OutputWriter.(*testTerminal).output.String()
+
+	if strings.Contains(output, "\x1b[2J") {
+		t.Errorf("Readline() output contains the escape sequence typed by the user: %q", output)
+	}
+
+	if !strings.Contains(output, "a^[[2J") {
+		t.Errorf("Readline() output does not render the escape with caret notation: %q", output)
+	}
+}
+
+func TestShell_Readline_quotedColor(t *testing.T) {
+	rl := NewShell()
+	rl.SyntaxHighlighter = func(line []rune) string {
+		return color.Fmt("32") + string(line) + color.Reset
+	}
+
+	line, err := readTestLine(t, rl, "a\x16", "\x1b", "[31mb\r")
+	if err != nil {
+		t.Errorf("Readline() error = %v", err)
+	}
+
+	if line != "a\x1b[31mb" {
+		t.Errorf("Readline() = %q, want %q", line, "a\x1b[31mb")
+	}
+
+	output := rl.OutputWriter.(*testTerminal).output.String()
+
+	if strings.Contains(output, "\x1b[31m") {
+		t.Errorf("Readline() output contains the color typed by the user: %q", output)
+	}
+
+	if !strings.Contains(output, color.Fmt("32")+"a^[[31mb") {
+		t.Errorf("Readline() output = %q, want the typed color in caret notation, highlighted", output)
+	}
+}
+
+func TestShell_inject(t *testing.T) {
+	rl := NewShell()
+
+	rl.inject("echo a\nb\r\nc")
+
+	if got := string(*rl.line); got != "echo a\nb\nc" {
+		t.Errorf("inject() line = %q, want %q", got, "echo a\nb\nc")
+	}
+}
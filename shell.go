@@ -1,7 +1,11 @@
 package readline
 
 import (
+	"bufio"
 	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
 
 	"github.com/reeflective/readline/inputrc"
 	"github.com/reeflective/readline/internal/completion"
@@ -11,6 +15,7 @@ import (
 	"github.com/reeflective/readline/internal/history"
 	"github.com/reeflective/readline/internal/keymap"
 	"github.com/reeflective/readline/internal/macro"
+	"github.com/reeflective/readline/internal/strutil"
 	"github.com/reeflective/readline/internal/term"
 	"github.com/reeflective/readline/internal/ui"
 )
@@ -34,6 +39,16 @@ type Shell struct {
 	Keymap     *keymap.Engine   // Manages main/local keymaps, binds, stores command functions, etc.
 	History    *history.Sources // History manages all history types/sources (past commands and undo)
 	Macros     *macro.Engine    // Record, use and display macros.
+	stdin      *bufio.Reader    // Reads lines when standard input is not a terminal.
+	output     *term.Output     // The terminal on which the shell displays itself.
+	current    lineState        // A snapshot of the line, safe to read from other goroutines.
+	reading    atomic.Bool      // Readline() is currently running.
+	viInserts  int              // Number of times the text typed in Vim insert mode is inserted.
+	viTyped    viInsertion      // The text typed in the current Vim insert mode session.
+	viInserted viInsertion      // The text typed in the last Vim insert mode session, for vi-redo.
+	marks      viMarks          // Vim marks set in the current line.
+	yankArg    yankArgState     // Arguments inserted by successive yank-last-arg.
+	buffer     *bufferState     // Line to edit in the next Readline() call.
 
 	// User interface
 	Config    *inputrc.Config    // Contains all keymaps, binds and per-application settings.
@@ -53,16 +68,328 @@ type Shell struct {
 	// keep reading input on a newline (thus, insert a newline and read).
 	AcceptMultiline func(line []rune) (accept bool)
 
+	// JoinLines replaces the newlines of the accepted line (inserted with the
+	// insert-newline command or when AcceptMultiline refuses it) with spaces,
+	// in the line returned by Readline() and saved in history. By default,
+	// newlines are preserved.
+	JoinLines bool
+
+	// OnAccept is called with the line accepted by the user (once validated by
+	// AcceptMultiline, if any, and with newlines replaced if JoinLines is set),
+	// to transform it, eg. to trim it or to expand aliases: the line it returns
+	// is the one returned by Readline() and saved in history, while the line
+	// is still displayed as typed. If it returns an error, the line is not
+	// accepted: the error is shown in the hint, and the user keeps editing.
+	OnAccept func(line string) (string, error)
+
+	// RecordOriginal saves the line accepted by the user in history, as typed,
+	// instead of the one transformed by OnAccept (which is still returned).
+	RecordOriginal bool
+
+	// MaxLineLength is the maximum number of characters of the input line (0, the
+	// default, means no limit), eg. to respect a protocol limit. Characters typed,
+	// yanked or pasted beyond it are dropped, with a hint and the bell: commands
+	// deleting characters, moving the cursor, etc, still work on a full line.
+	MaxLineLength int
+
+	// RejectLongPaste makes pasted or yanked texts that would exceed MaxLineLength
+	// rejected entirely, instead of having their beginning inserted up to the limit.
+	RejectLongPaste bool
+
 	// SyntaxHighlighter is a helper function to provide syntax highlighting.
 	// Once enabled, set to nil to disable again.
 	SyntaxHighlighter func(line []rune) string
 
+	// Highlighter provides syntax highlighting as a list of tokens, each of them
+	// styling a range of runes of the line (eg. strings, keywords or numbers found
+	// by a lexer), instead of a highlighted string. Out of range tokens are clamped
+	// to the line, and overlapping ones have their styles composed, the last token
+	// taking precedence (see Token). It takes precedence over SyntaxHighlighter.
+	Highlighter func(line string) []Token
+
+	// HighlightTrailingWhitespace renders the spaces and tabs at the end of the
+	// line (and of each line of a multiline buffer) with a red background, on
+	// top of the syntax highlighting, so that accidental ones are visible.
+	HighlightTrailingWhitespace bool
+
 	// Completer is a function that produces completions.
 	// It takes the readline line ([]rune) and cursor pos as parameters,
 	// and returns completions with their associated metadata/settings.
+	// When SpinnerThreshold is set, it might run on another goroutine:
+	// it must then only use its arguments, and not call the shell back.
+	// When the completion-refilter option is on, the completions generated
+	// for a word are filtered again as more of it is typed, instead of calling
+	// the completer again: it must then return all candidates for the word, not
+	// only a limited number of those matching the prefix typed so far.
 	Completer func(line []rune, cursor int) Completions
+
+	// WordSeparators is a list of characters separating words in the input line
+	// (in addition to spaces, which always do), used to find the word currently
+	// completed by the Completer: the part of this word before the cursor is the
+	// prefix against which candidates are filtered, and the whole word is replaced
+	// when inserting a candidate. Quoted or escaped separators are ignored, so that
+	// a quoted segment of the line is always part of the word containing it.
+	// Completers can still override the prefix/suffix with Completions.PREFIX/SUFFIX.
+	WordSeparators string
+
+	// StreamCompleter is like Completer, except that completions are sent in
+	// batches on the returned channel, as soon as they are produced: they are
+	// merged together and the completion menu is refreshed as they arrive.
+	// The channel must be closed once all completions have been sent, or as
+	// soon as the done channel is closed, which happens when the completions
+	// are not needed anymore (new completion request, line modified, etc).
+	// When not nil, this function is used instead of the Completer one.
+	StreamCompleter func(line []rune, cursor int, done <-chan struct{}) <-chan Completions
+
+	// AutoPairs maps opening characters to the closing ones automatically inserted
+	// after them when the `autopairs` inputrc option is enabled. Typing a closing
+	// character already under the cursor steps over it, and deleting an opening
+	// character of an empty pair also deletes its closing one. It defaults to
+	// brackets, braces, parens, quotes and backticks: set it to nil to disable.
+	AutoPairs map[rune]rune
+
+	// Abbreviations maps words to the text replacing them when a space is typed
+	// after them (like fish abbreviations): `"gco": "git checkout"`. By default,
+	// only words in command position are expanded (set the inputrc option
+	// `abbreviations-anywhere` to expand them everywhere). The expansion can
+	// be undone, and can place the cursor with an AbbreviationCursor marker.
+	Abbreviations map[string]string
+
+	// AutoIndent makes new lines inserted in multiline input (when the line is not
+	// accepted by AcceptMultiline) start with the indentation of the previous one.
+	// If IndentUnit is not empty, a line ending with an opening bracket adds such
+	// a unit to the indentation, a closing bracket typed at the start of a line
+	// removes one, and so does backspace when the cursor is after the indentation.
+	AutoIndent bool
+	IndentUnit string
+
+	// ExpandPreview is called with the (blank-separated) word under the cursor,
+	// and returns its expansion, shown in the hint without modifying the line:
+	// this is meant to preview paths with a tilde or environment variables, and
+	// ExpandEnv can be used for this. If the word cannot be fully expanded (ok
+	// is false, eg. an unset variable), the expansion is shown as an error. The
+	// expand-word command replaces the word with its expansion.
+	ExpandPreview func(word string) (expanded string, ok bool)
+	expansion     string
+
+	// ModeIndicator returns the string indicating the current keymap mode, which
+	// is one of "emacs", "vi-insert", "vi-command", "vi-visual", "vi-opp", or of
+	// the "isearch" and "menu-select" mini-modes (when active, they take precedence
+	// over the main mode). DefaultModeIndicator can be used to show Vim-like
+	// `-- INSERT --` indicators. Empty strings are not displayed. The indicator
+	// is shown at ModeIndicatorPlacement, and updated on each keymap change.
+	ModeIndicator          func(mode string) string
+	ModeIndicatorPlacement ModeIndicatorPlacement
+	indicator              string
+
+	// InputReader and OutputWriter replace the standard input and output of the
+	// shell, eg. to drive it through a PTY or a network connection (like an SSH
+	// session). Keys are read and decoded from InputReader exactly like from a
+	// terminal. It is put in raw mode only if it is a terminal itself: other
+	// readers are never read as piped input, and must thus provide raw keys.
+	// Both are used when Readline() or ReadKey() is called, and only by this
+	// shell: several shells can read input on different terminals at a time.
+	InputReader  io.Reader
+	OutputWriter io.Writer
+
+	// TerminalSize returns the size (columns and lines) of the terminal on which
+	// the shell is displayed. If nil, the size is queried on the output if it is
+	// a terminal, and is 80 columns and 80 lines otherwise (eg. for an SSH session,
+	// this function should return the size sent by the client with its requests).
+	TerminalSize func() (width, height int)
+
+	// TabWidth is the number of columns between tab stops, used to render
+	// the tabs in the input line and to compute the cursor position (default 8).
+	TabWidth int
+
+	// CursorBlink makes the cursor blink (CursorBlinkOn) or not (CursorBlinkOff)
+	// in all modes, whose cursor shapes are kept. By default, the styles of the
+	// inputrc `cursor-<mode>` options (or the default ones) are used as is.
+	// CursorColor is the color of the cursor while reading input, as any color
+	// specification accepted by the terminal (eg. "#ff8700" or "rgb:ff/87/00").
+	// Both are restored to the terminal defaults when Readline() returns.
+	// NoCursorStyle disables all cursor shapes, blinking and color changes.
+	CursorBlink   CursorBlink
+	CursorColor   string
+	NoCursorStyle bool
+
+	// Bell is the way failures (no completions, no history match, undefined
+	// keys, etc) are signaled: by default, they are not signaled at all.
+	Bell     BellStyle
+	flashing *time.Timer
+
+	// OnIdle is called when the user has not typed any key for IdleTimeout while
+	// reading input (eg. to warn that a session is about to expire), once after
+	// each key. It runs on the input goroutine, between two commands, and can thus
+	// use the shell freely: change the hint, refresh the prompt, inject text, etc.
+	// A zero IdleTimeout (the default) disables it.
+	OnIdle      func()
+	IdleTimeout time.Duration
+	idle        *time.Timer
+
+	// HintFormatter formats all hint messages shown below the input line (errors,
+	// completion usage strings, status messages, etc) according to their kind, so
+	// that applications can style them consistently. Messages may still contain
+	// some emphasis (bold, etc). Incremental search prompts and history source
+	// names keep their own style. If nil, errors are red, success messages
+	// green, and other hints dimmed.
+	HintFormatter func(hint string, kind HintKind) string
+
+	// SpinnerFrames are the frames of the spinner animated in the hint while
+	// completions are being fetched: either streamed, or produced by a blocking
+	// Completer not having returned after SpinnerThreshold. In the latter case,
+	// the Completer keeps running in the background while the shell reads input,
+	// and its completions are discarded if the completion is cancelled meanwhile.
+	// The SpinnerThreshold is zero by default, which always waits for the Completer
+	// in the foreground: set it only for Completers not accessing the shell state.
+	SpinnerFrames    []string
+	SpinnerThreshold time.Duration
+
+	// CompletionLayout is the default layout of completion groups for which
+	// completions do not specify one with Completions.DisplayLayout/DisplayList.
+	CompletionLayout Layout
+
+	// CompletionHeaders is the default visibility of the completion groups headers
+	// (their tags), for groups for which completions do not specify one with
+	// Completions.DisplayHeaders. By default, they are only displayed when there
+	// are several groups. The inputrc option `completion-header-style` sets their style.
+	CompletionHeaders Headers
+
+	// CompletionMaxColumns caps the number of columns of candidates in the
+	// completion menu grids, whatever the terminal width (0 means unlimited).
+	CompletionMaxColumns int
+
+	// CompletionMaxDisplayWidth is the maximum number of terminal columns used by
+	// each candidate display in the completion menu: longer ones are truncated with
+	// an ellipsis, and shown in full in the hint when selected (0 means unlimited).
+	// The candidate value inserted in the line is never truncated.
+	CompletionMaxDisplayWidth int
+
+	// CompletionDimBackground dims the last line of the primary prompt and the
+	// input line while candidates are selected in the completion menu (the
+	// menu-select keymap is active), to draw focus to the latter: their colors
+	// (eg. syntax highlighting) are attenuated, not removed, and are fully
+	// restored as soon as the menu is closed. Menus only displayed (eg. with
+	// autocomplete) do not dim them.
+	CompletionDimBackground bool
+
+	// CompletionMenuUnique shows the completion menu even when there is a single
+	// candidate, so that it is explicitly selected, instead of inserting it right
+	// away (the default). Completions.InsertUnique overrides this for some groups.
+	CompletionMenuUnique bool
+
+	// CompletionListOnFirstTab makes the first completion request (eg. Tab) only
+	// list the candidates, like in bash, and the next ones select them: this is
+	// the same as the list-on-first-tab inputrc option, which is also honored.
+	// With autocomplete, completions are always listed: Tab then selects them.
+	CompletionListOnFirstTab bool
+
+	// CompletionIndicator is printed before the selected candidate in the completion
+	// menu (eg. "> " or "▶ "), in the CompletionIndicatorStyle (cterm color codes, eg.
+	// "1;32"), while other candidates are preceded by as many spaces, so that columns
+	// stay aligned. It is empty (disabled) by default. If CompletionIndicatorOnly is
+	// true, it replaces the highlighting of the selected candidate instead of adding
+	// to it. The indicator is purely cosmetic: it is never inserted in the line.
+	CompletionIndicator      string
+	CompletionIndicatorStyle string
+	CompletionIndicatorOnly  bool
+
+	// CompletionPreview enables a preview area below the completion menu, showing
+	// the full description of the currently selected candidate (multiline ones
+	// included), which is updated as the selection changes. It uses at most half
+	// of the rows available to the menu, and disappears along with the latter.
+	CompletionPreview bool
+
+	// CompletionMouse enables the terminal mouse reporting while the completion
+	// menu is active: clicking a candidate selects it (and clicking it again inserts
+	// it and closes the menu), the wheel moves the selection, and clicking outside
+	// of the menu cancels the completion. The reporting is disabled as soon as the
+	// menu is closed, so that the terminal mouse selection works as usual otherwise.
+	CompletionMouse bool
+	mouse           bool
+
+	// CompletionTriggerChars are characters (eg. '/' or '.') after which completions
+	// are generated and displayed as soon as they are typed, and then updated as the
+	// user types, like with the `autocomplete` option, until the menu is exited
+	// (with an escape, by accepting the line, etc). This does not depend on the
+	// `autocomplete` option, which completes the line after any character.
+	CompletionTriggerChars []rune
+
+	// CompletionNoMatch is the way the shell signals a completion request without
+	// any matching candidate: with a "no matches for <word>" hint (cleared on the
+	// next key), the bell (see Bell), both (default) or nothing. In all cases, the
+	// line and cursor are left untouched, and no completion menu is opened.
+	CompletionNoMatch NoMatchBehavior
+
+	// AutosuggestPrecedence determines what is displayed when both a line is
+	// autosuggested from the history (the `history-autosuggest` option) and the
+	// completion menu is displayed (eg. with the `autocomplete` option). By default,
+	// the suggestion is hidden while the menu is displayed, and shown again when the
+	// menu is closed. A hidden suggestion cannot be accepted with forward-char, etc.
+	AutosuggestPrecedence AutosuggestPrecedence
+
+	// OnCompletionGenerate is called with statistics about the completions each
+	// time they are produced by the Completer (or StreamCompleter, once its stream
+	// is closed): the word completed, the number of candidates and of tags, and
+	// the time taken, eg. to log slow completers or huge result sets. It is called
+	// in its own goroutine (in the stream one for streams) and cannot block the
+	// shell, but it must thus not use the shell without synchronization.
+	OnCompletionGenerate func(stats CompletionStats)
+
+	// OnError is notified of errors which do not prevent the shell from working,
+	// like a Completer (or StreamCompleter, or a history source) panicking: the
+	// panic is recovered, the completions are empty, a hint notifies the panic, and
+	// the error (a *CompletionPanicError, with the stack trace of the panic) is passed
+	// to OnError. It might be called from another goroutine than the input one.
+	OnError func(err error)
+
+	// OnChange is called with the input line and cursor position each time one
+	// of them is modified (by a command, a queued function, etc). It is called
+	// on the input goroutine, before the display is refreshed, so it can safely
+	// use the shell, but it must be cheap and must not block: heavier work (or
+	// work needing other goroutines) should be done asynchronously.
+	OnChange func(line string, pos int)
+
+	// BeforeCommand and AfterCommand are called with the name of each editing
+	// command (eg. "kill-word") dispatched by the shell, right before and after
+	// it runs. They are called synchronously on the input goroutine, but are not
+	// called for the self-insert command (printable characters) unless the
+	// HookSelfInsert option is true. Keys not bound to any command, and macros,
+	// do not trigger them either.
+	BeforeCommand  func(name string)
+	AfterCommand   func(name string)
+	HookSelfInsert bool
 }
 
+// CursorBlink is whether the cursor blinks, whatever its shape.
+type CursorBlink = keymap.CursorBlink
+
+// Cursor blinking settings.
+const (
+	CursorBlinkDefault = keymap.CursorBlinkDefault // Use the cursor styles as configured.
+	CursorBlinkOn      = keymap.CursorBlinkOn      // Blinking cursor in all modes.
+	CursorBlinkOff     = keymap.CursorBlinkOff     // Steady cursor in all modes.
+)
+
+// Token is a range of runes of the input line, from Start (included) to End
+// (excluded), highlighted with a style (SGR parameters, eg. "1;32" for bold
+// green), as returned by the Shell.Highlighter.
+type Token = display.Token
+
+// HintKind is the kind of a hint message, passed to the Shell.HintFormatter.
+type HintKind = ui.HintKind
+
+const (
+	// HintInfo is an informational message (status, completion messages, etc).
+	HintInfo = ui.HintInfo
+	// HintUsage is the usage string of what is being completed.
+	HintUsage = ui.HintUsage
+	// HintError is an error message.
+	HintError = ui.HintError
+	// HintSuccess reports an action that succeeded (eg. a configuration reload).
+	HintSuccess = ui.HintSuccess
+)
+
 // NewShell returns a readline shell instance initialized with a default
 // inputrc configuration and binds, and with an in-memory command history.
 // The constructor accepts an optional list of inputrc configuration options,
@@ -72,20 +399,30 @@ func NewShell(opts ...inputrc.Option) *Shell {
 
 	// Core editor
 	keys := new(core.Keys)
+	output := term.NewOutput()
 	line := new(core.Line)
 	cursor := core.NewCursor(line)
 	selection := core.NewSelection(line, cursor)
 	iterations := new(core.Iterations)
 
 	shell.Keys = keys
+	shell.output = output
 	shell.line = line
+	core.OnEdit(line, shell.marks.edited)
 	shell.cursor = cursor
 	shell.selection = selection
 	shell.Buffers = editor.NewBuffers()
 	shell.Iterations = iterations
+	shell.TabWidth = strutil.DefaultTabWidth
+	shell.SpinnerFrames = completion.DefaultSpinnerFrames
+	shell.AutoPairs = make(map[rune]rune, len(completion.DefaultAutopairs))
+
+	for opening, closing := range completion.DefaultAutopairs {
+		shell.AutoPairs[opening] = closing
+	}
 
 	// Keymaps and commands
-	keymaps, config := keymap.NewEngine(keys, iterations, opts...)
+	keymaps, config := keymap.NewEngine(keys, iterations, output, opts...)
 	keymaps.Register(shell.standardCommands())
 	keymaps.Register(shell.viCommands())
 	keymaps.Register(shell.historyCommands())
@@ -97,17 +434,18 @@ func NewShell(opts ...inputrc.Option) *Shell {
 
 	// User interface
 	hint := new(ui.Hint)
-	prompt := ui.NewPrompt(line, cursor, keymaps, config)
-	macros := macro.NewEngine(keys, hint)
+	prompt := ui.NewPrompt(line, cursor, keymaps, config, output)
+	macros := macro.NewEngine(keys, hint, output)
 	history := history.NewSources(line, cursor, hint, config)
-	completer := completion.NewEngine(hint, keymaps, config)
+	completer := completion.NewEngine(hint, keymaps, config, output)
 	completion.Init(completer, keys, line, cursor, selection, shell.commandCompletion)
 
-	display := display.NewEngine(keys, selection, history, prompt, hint, completer, config)
+	display := display.NewEngine(keys, selection, history, prompt, hint, completer, config, output)
 
 	shell.Config = config
 	shell.Hint = hint
 	shell.Prompt = prompt
+	shell.Prompt.Indicator(shell.rightModeIndicator)
 	shell.completer = completer
 	shell.Macros = macros
 	shell.History = history
@@ -137,6 +475,37 @@ func (rl *Shell) Cursor() *core.Cursor { return rl.cursor }
 // selections used to change/select multiple parts of the line at once.
 func (rl *Shell) Selection() *core.Selection { return rl.selection }
 
+// ReadKey reads a single key from the terminal, without running the line editor.
+// The terminal is put in raw mode for the duration of the call, and the keys are
+// read and decoded exactly like they are when reading a line: the returned string
+// is either a single character or a complete escape sequence (arrow keys, function
+// keys, meta-prefixed characters, etc), which can be compared against the result of
+// inputrc.Unescape() for a given key (eg. inputrc.Unescape(`\e[A`) for arrow up).
+// Keys read in excess are kept for the next call to this function or to Readline().
+// An io.EOF error is returned if standard input is closed.
+func (rl *Shell) ReadKey() (string, error) {
+	restore, err := rl.makeRaw()
+	if err != nil {
+		return "", err
+	}
+	defer restore()
+
+	for {
+		core.WaitAvailableKeys(rl.Keys, rl.Config)
+
+		if key := core.PopKeySequence(rl.Keys); key != "" {
+			return key, nil
+		}
+
+		// We might have been woken up by functions queued for the
+		// main loop, which we run: otherwise, no keys means that
+		// we could not read anything on stdin.
+		if !rl.runQueued() {
+			return "", io.EOF
+		}
+	}
+}
+
 // Printf prints a formatted string below the current line and redisplays the prompt
 // and input line (and possibly completions/hints if active) below the logged string.
 // A newline is added to the message so that the prompt is correctly refreshed below.
@@ -144,11 +513,11 @@ func (rl *Shell) Printf(msg string, args ...any) (n int, err error) {
 	// First go back to the last line of the input line,
 	// and clear everything below (hints and completions).
 	rl.Display.CursorBelowLine()
-	term.MoveCursorBackwards(term.GetWidth())
-	fmt.Print(term.ClearScreenBelow)
+	rl.output.MoveCursorBackwards(rl.output.Width())
+	fmt.Fprint(rl.output, term.ClearScreenBelow)
 
 	// Skip a line, and print the formatted message.
-	n, err = fmt.Printf(msg+"\n", args...)
+	n, err = fmt.Fprintf(rl.output, msg+"\n", args...)
 
 	// Redisplay the prompt, input line and active helpers.
 	rl.Prompt.PrimaryPrint()
@@ -163,12 +532,12 @@ func (rl *Shell) PrintTransientf(msg string, args ...any) (n int, err error) {
 	// First go back to the beginning of the line/prompt, and
 	// clear everything below (prompt/line/hints/completions).
 	rl.Display.CursorToLineStart()
-	term.MoveCursorBackwards(term.GetWidth())
-	term.MoveCursorUp(rl.Prompt.PrimaryUsed())
-	fmt.Print(term.ClearScreenBelow)
+	rl.output.MoveCursorBackwards(rl.output.Width())
+	rl.output.MoveCursorUp(rl.Prompt.PrimaryUsed())
+	fmt.Fprint(rl.output, term.ClearScreenBelow)
 
 	// Print the logged message.
-	n, err = fmt.Printf(msg+"\n", args...)
+	n, err = fmt.Fprintf(rl.output, msg+"\n", args...)
 
 	// Redisplay the prompt, input line and active helpers.
 	rl.Prompt.PrimaryPrint()
@@ -176,3 +545,65 @@ func (rl *Shell) PrintTransientf(msg string, args ...any) (n int, err error) {
 
 	return
 }
+
+// RefreshPrompt generates the primary prompt again and redraws it in place, along
+// with the input line (left untouched, as the cursor position) and any completions
+// or hints below it. This is useful for prompts showing information that changes
+// in the background (eg. the time or a git branch), and it is safe to call from
+// any goroutine: the redraw is queued to the input loop and happens between two
+// commands. An ErrNotReading error is returned if no Readline() call is running.
+func (rl *Shell) RefreshPrompt() error {
+	if !rl.reading.Load() {
+		return ErrNotReading
+	}
+
+	rl.Keys.Queue(rl.Display.RefreshPrompt)
+
+	return nil
+}
+
+// InvalidateCompletionCache drops all completions cached by the shell, so that
+// the next completions are generated by the completer again. This is only useful
+// when the completion cache is enabled (with the completion-cache-size option),
+// and when the data used by the completer has changed. It is safe to call this
+// function concurrently.
+func (rl *Shell) InvalidateCompletionCache() {
+	rl.completer.InvalidateCache()
+}
+
+// RegisterCommand adds a command to the shell, which can then be bound to keys
+// with BindKey() or in inputrc files. The command is dispatched like builtin ones:
+// its keys are recorded in macros, and it can use the numeric argument given to it
+// with rl.Iterations.Get(). Registering a builtin command name overrides it.
+func (rl *Shell) RegisterCommand(name string, command func()) {
+	rl.Keymap.Register(map[string]func(){name: command})
+}
+
+// BindKey binds a key sequence, in inputrc notation (eg. `\C-x\C-t`), to a
+// command in a keymap (emacs, vi-insert, vi-command, isearch, menu-select, etc).
+// An error is returned if the command is not a builtin or registered one.
+func (rl *Shell) BindKey(keymap, sequence, command string) error {
+	return rl.Keymap.Bind(keymap, sequence, command)
+}
+
+// DumpKeymaps returns the binds of the Emacs, Vim insert/command, incremental
+// search and completion menu keymaps, in inputrc format (like `bind -p`): each
+// keymap starts with a `set keymap` line, followed by one `"sequence": command`
+// line per bind. The result can be saved to a file and loaded with LoadKeymaps.
+func (rl *Shell) DumpKeymaps() string {
+	return rl.Keymap.DumpBinds(
+		keymap.Emacs,
+		keymap.ViInsert,
+		keymap.ViCommand,
+		keymap.Isearch,
+		keymap.MenuSelect,
+	)
+}
+
+// LoadKeymaps reads binds in inputrc format (like the output of DumpKeymaps)
+// and applies them to their keymaps (emacs by default, or the last one set with
+// `set keymap`). If a bind is invalid or refers to an unknown command, an error
+// identifying the offending bind is returned, and none of the binds are applied.
+func (rl *Shell) LoadKeymaps(r io.Reader) error {
+	return rl.Keymap.LoadBinds(r)
+}
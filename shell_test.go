@@ -0,0 +1,75 @@
+package readline
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/reeflective/readline/inputrc"
+	"github.com/reeflective/readline/internal/keymap"
+)
+
+func TestShell_DumpKeymaps(t *testing.T) {
+	keymaps := []keymap.Mode{keymap.Emacs, keymap.ViInsert, keymap.ViCommand, keymap.Isearch, keymap.MenuSelect}
+
+	rl := NewShell()
+	dump := rl.DumpKeymaps()
+
+	if strings.Contains(dump, `\x `) {
+		t.Errorf("DumpKeymaps() has space-padded hexadecimal escapes")
+	}
+
+	// Loading the dump in the same shell must not add or change any bind.
+	binds := make(map[string]map[string]inputrc.Bind)
+	for _, name := range keymaps {
+		binds[string(name)] = copyBinds(rl.Config.Binds[string(name)])
+	}
+
+	if err := rl.LoadKeymaps(strings.NewReader(dump)); err != nil {
+		t.Fatalf("LoadKeymaps() error = %v", err)
+	}
+
+	for _, name := range keymaps {
+		if got := rl.Config.Binds[string(name)]; !reflect.DeepEqual(got, binds[string(name)]) {
+			t.Errorf("LoadKeymaps() changed the %s keymap: %d binds, want %d", name, len(got), len(binds[string(name)]))
+		}
+	}
+
+	// And loading it in a shell without binds must restore them all.
+	loaded := NewShell()
+	for _, name := range keymaps {
+		loaded.Config.Binds[string(name)] = make(map[string]inputrc.Bind)
+	}
+
+	if err := loaded.LoadKeymaps(strings.NewReader(dump)); err != nil {
+		t.Fatalf("LoadKeymaps() error = %v", err)
+	}
+
+	if got := loaded.DumpKeymaps(); got != dump {
+		t.Errorf("DumpKeymaps() after LoadKeymaps() = %q, want %q", got, dump)
+	}
+}
+
+func TestShell_LoadKeymaps_errors(t *testing.T) {
+	rl := NewShell()
+
+	err := rl.LoadKeymaps(strings.NewReader(`"\C-x\C-z": no-such-command`))
+	if !errors.Is(err, keymap.ErrUnknownCommand) {
+		t.Errorf("LoadKeymaps() error = %v, want %v", err, keymap.ErrUnknownCommand)
+	}
+
+	var parseErr *inputrc.ParseError
+	if errors.As(err, &parseErr) {
+		t.Errorf("LoadKeymaps() error = %v, want the handler error unchanged", err)
+	}
+}
+
+func copyBinds(binds map[string]inputrc.Bind) map[string]inputrc.Bind {
+	copied := make(map[string]inputrc.Bind, len(binds))
+	for seq, bind := range binds {
+		copied[seq] = bind
+	}
+
+	return copied
+}
@@ -0,0 +1,37 @@
+package readline
+
+import "sync"
+
+// lineState is a snapshot of the input line and cursor position,
+// updated by the input goroutine and readable from any other one.
+type lineState struct {
+	mutex  sync.RWMutex
+	line   string
+	cursor int
+}
+
+// CurrentLine returns a snapshot of the line currently being edited, and of the
+// cursor position in it. Contrary to Line() and Cursor(), it is safe to call from
+// any goroutine, including while Readline() is running: the snapshot is updated
+// after each command run by the shell, before the display is refreshed.
+func (rl *Shell) CurrentLine() (string, int) {
+	rl.current.mutex.RLock()
+	defer rl.current.mutex.RUnlock()
+
+	return rl.current.line, rl.current.cursor
+}
+
+// updateCurrent updates the current line snapshot if the line
+// or the cursor position have changed, and notifies the caller.
+func (rl *Shell) updateCurrent() {
+	line, cursor := string(*rl.line), rl.cursor.Pos()
+
+	rl.current.mutex.Lock()
+	changed := line != rl.current.line || cursor != rl.current.cursor
+	rl.current.line, rl.current.cursor = line, cursor
+	rl.current.mutex.Unlock()
+
+	if changed && rl.OnChange != nil {
+		rl.OnChange(line, cursor)
+	}
+}
@@ -1,9 +1,11 @@
 package readline
 
 import (
+	"strings"
 	"unicode"
 
 	"github.com/reeflective/readline/inputrc"
+	"github.com/reeflective/readline/internal/core"
 	"github.com/reeflective/readline/internal/keymap"
 	"github.com/reeflective/readline/internal/strutil"
 )
@@ -52,6 +54,7 @@ func (rl *Shell) viCommands() commands {
 		"vi-back-to-indent":   rl.viBackToIndent,
 		"vi-first-print":      rl.viFirstPrint,
 		"vi-goto-mark":        rl.viGotoMark,
+		"vi-goto-mark-line":   rl.viGotoMarkLine,
 
 		"vi-backward-end-word":    rl.viBackwardWordEnd,
 		"vi-backward-end-bigword": rl.viBackwardBlankWordEnd,
@@ -73,6 +76,8 @@ func (rl *Shell) viCommands() commands {
 		"vi-open-line-below": rl.viOpenLineBelow,
 		"vi-down-case":       rl.viDownCase,
 		"vi-up-case":         rl.viUpCase,
+		"vi-oper-swap-case":  rl.viOperSwapCase,
+		"vi-swap-case":       rl.viChangeCase,
 
 		// Kill and Yanking
 		"vi-kill-eol":         rl.viKillEol,
@@ -107,7 +112,7 @@ func (rl *Shell) viCommands() commands {
 		"vi-char-search":              rl.viCharSearch,
 		"vi-set-mark":                 rl.viSetMark,
 		"vi-edit-and-execute-command": rl.viEditAndExecuteCommand,
-		"vi-undo":                     rl.undoLast,
+		"vi-undo":                     rl.viUndo,
 		"vi-redo":                     rl.viRedo,
 
 		"vi-edit-command-line":     rl.viEditCommandLine,
@@ -130,6 +135,14 @@ func (rl *Shell) viCommands() commands {
 func (rl *Shell) viInsertMode() {
 	rl.History.Save()
 
+	// The text inserted might have to be repeated (eg. `3ix<Esc>`).
+	rl.viInserts = 1
+	if rl.Iterations.IsSet() {
+		rl.viInserts = rl.Iterations.Get()
+	}
+
+	rl.viTyped = viInsertion{}
+
 	// Reset any visual selection and iterations.
 	rl.selection.Reset()
 	rl.Iterations.Reset()
@@ -155,7 +168,12 @@ func (rl *Shell) viCommandMode() {
 	rl.completer.Reset()
 	rl.line, rl.cursor, rl.selection = rl.completer.GetBuffer()
 
-	// Only go back if not in insert mode
+	// Repeat the insertion if needed, and only go back if not in insert mode.
+	if rl.Keymap.Main() == keymap.ViInsert {
+		rl.viRecordInsert()
+		rl.viRepeatInsert()
+	}
+
 	if rl.Keymap.Main() == keymap.ViInsert && !rl.cursor.AtBeginningOfLine() {
 		rl.cursor.Dec()
 	}
@@ -166,6 +184,87 @@ func (rl *Shell) viCommandMode() {
 	rl.Keymap.SetMain(keymap.ViCommand)
 }
 
+// viInsertion is the text typed in a Vim insert mode session, as the
+// characters inserted and deleted at the cursor while typing it.
+type viInsertion struct {
+	deleted int    // Characters deleted before the text, with backspace.
+	text    []rune // Characters typed, without those deleted afterwards.
+	cursor  int    // Cursor position after the last character typed or deleted.
+}
+
+// viRecordTyped records characters typed at pos in insert mode (not
+// in the minibuffer of a search), so that they can be inserted again.
+func (rl *Shell) viRecordTyped(pos int, chars ...rune) {
+	if !rl.viRecording() {
+		return
+	}
+
+	rl.viRecordMoved(pos)
+	rl.viTyped.text = append(rl.viTyped.text, chars...)
+	rl.viTyped.cursor = rl.cursor.Pos()
+}
+
+// viRecordDeleted records characters deleted before pos in insert mode:
+// those typed in the session first, and then those before them.
+func (rl *Shell) viRecordDeleted(pos int) {
+	if !rl.viRecording() {
+		return
+	}
+
+	rl.viRecordMoved(pos)
+
+	count := pos - rl.cursor.Pos()
+	typed := min(count, len(rl.viTyped.text))
+	rl.viTyped.text = rl.viTyped.text[:len(rl.viTyped.text)-typed]
+	rl.viTyped.deleted += count - typed
+	rl.viTyped.cursor = rl.cursor.Pos()
+}
+
+// viRecordMoved drops the text recorded in insert mode if the cursor was
+// moved since (eg. with arrow keys): like Vim, only the text typed after
+// the last move is inserted again.
+func (rl *Shell) viRecordMoved(pos int) {
+	if pos != rl.viTyped.cursor {
+		rl.viTyped = viInsertion{}
+	}
+}
+
+func (rl *Shell) viRecording() bool {
+	searching, _, _ := rl.completer.NonIncrementallySearching()
+
+	return rl.Keymap.Main() == keymap.ViInsert && rl.Keymap.Local() == "" && !searching
+}
+
+// viRecordInsert keeps the text typed since entering insert mode
+// (with the characters deleted while typing), so that vi-redo can
+// insert it again.
+func (rl *Shell) viRecordInsert() {
+	rl.viInserted = rl.viTyped
+	rl.viTyped = viInsertion{}
+}
+
+// viRepeatInsert inserts the text typed since entering insert mode again,
+// as many times as required by the count given to the insertion command.
+func (rl *Shell) viRepeatInsert() {
+	count := rl.viInserts
+	rl.viInserts = 1
+
+	for ; count > 1; count-- {
+		rl.viReplayInsert(rl.viInserted)
+	}
+}
+
+// viReplayInsert deletes and inserts the characters of an
+// insert mode session again at the cursor, like when typed.
+func (rl *Shell) viReplayInsert(insertion viInsertion) {
+	for deleted := insertion.deleted; deleted > 0 && rl.cursor.Pos() > 0; deleted-- {
+		rl.cursor.Dec()
+		rl.line.CutRune(rl.cursor.Pos())
+	}
+
+	rl.cursor.InsertAt(insertion.text...)
+}
+
 // Enter Vim visual mode.
 func (rl *Shell) viVisualMode() {
 	rl.History.SkipSave()
@@ -238,7 +337,7 @@ func (rl *Shell) viAddEol() {
 // Move forward one character, without changing lines.
 func (rl *Shell) viForwardChar() {
 	// Only exception where we actually don't forward a character.
-	if rl.Config.GetBool("history-autosuggest") && rl.cursor.Pos() == rl.line.Len()-1 {
+	if rl.Display.Autosuggesting() && rl.cursor.Pos() == rl.line.Len()-1 {
 		rl.autosuggestAccept()
 		return
 	}
@@ -396,42 +495,20 @@ func (rl *Shell) viForwardBlankWordEnd() {
 func (rl *Shell) viMatchBracket() {
 	rl.History.SkipSave()
 
-	nextPos := rl.cursor.Pos()
-	found := false
-
-	// If we are on a bracket/brace/parenthesis, we just find the matcher
-	if !strutil.IsBracket(rl.cursor.Char()) {
-		for i := rl.cursor.Pos() + 1; i < rl.line.Len(); i++ {
-			char := (*rl.line)[i]
-			if char == '}' || char == ')' || char == ']' {
-				nextPos = i - rl.cursor.Pos()
-				found = true
-
-				break
-			}
-		}
-
-		if !found {
-			return
+	_, match, found := rl.matchingBracket()
+	if !found {
+		// Don't let a pending operator (d%, c%) act on nothing.
+		if rl.Keymap.Local() == keymap.ViOpp {
+			rl.Keymap.CancelPending()
+			rl.selection.Reset()
 		}
 
-		rl.cursor.Move(nextPos)
-	}
-
-	var adjust int
-
-	split, index, pos := rl.line.TokenizeBlock(rl.cursor.Pos())
+		rl.bell()
 
-	switch {
-	case len(split) == 0:
 		return
-	case pos == 0:
-		adjust = len(split[index])
-	default:
-		adjust = pos * -1
 	}
 
-	rl.cursor.Move(adjust)
+	rl.cursor.Set(match)
 }
 
 // Move to the column specified by the numeric argument.
@@ -481,27 +558,6 @@ func (rl *Shell) viBackToIndent() {
 	rl.cursor.ToFirstNonSpace(true)
 }
 
-// Move to the specified mark.
-func (rl *Shell) viGotoMark() {
-	switch {
-	case rl.selection.Active():
-		// We either an active selection, in which case
-		// we go to the position (begin or end) that is
-		// set and not equal to the cursor.
-		bpos, epos := rl.selection.Pos()
-		if bpos != rl.cursor.Pos() {
-			rl.cursor.Set(bpos)
-		} else {
-			rl.cursor.Set(epos)
-		}
-
-	case rl.cursor.Mark() != -1:
-		// Or we go to the cursor mark, which was set when
-		// entering insert mode. This might have no effect.
-		rl.cursor.Set(rl.cursor.Mark())
-	}
-}
-
 //
 // Changing Text --------------------------------------------------------
 //
@@ -640,7 +696,8 @@ func (rl *Shell) viDeleteChar() {
 
 	vii := rl.Iterations.Get()
 
-	for i := 1; i <= vii; i++ {
+	// Counts past the end of the line only delete until there.
+	for i := 1; i <= vii && rl.cursor.Pos() < rl.line.Len(); i++ {
 		cutBuf = append(cutBuf, rl.cursor.Char())
 		rl.line.CutRune(rl.cursor.Pos())
 	}
@@ -694,29 +751,20 @@ func (rl *Shell) viReplace() {
 // Swap the case of the character under the cursor and move past it.
 // If in visual mode, change the case of each character in the selection.
 func (rl *Shell) viChangeCase() {
+	if rl.viCancelPending() {
+		return
+	}
+
 	switch {
 	case rl.selection.Active() && rl.selection.IsVisual():
-		rl.selection.ReplaceWith(func(char rune) rune {
-			if unicode.IsLower(char) {
-				return unicode.ToUpper(char)
-			}
-
-			return unicode.ToLower(char)
-		})
+		rl.selection.ReplaceWith(swapCase)
 
 	default:
 		if rl.line.Len() == 0 || rl.cursor.Pos() == rl.line.Len() {
 			return
 		}
 
-		char := rl.cursor.Char()
-		if unicode.IsLower(char) {
-			char = unicode.ToUpper(char)
-		} else {
-			char = unicode.ToLower(char)
-		}
-
-		rl.cursor.ReplaceWith(char)
+		rl.cursor.ReplaceWith(swapCase(rl.cursor.Char()))
 	}
 }
 
@@ -831,54 +879,123 @@ func (rl *Shell) viOpenLineBelow() {
 // Convert the current word to all lowercase and move past it.
 // If in visual mode, operate on the whole selection.
 func (rl *Shell) viDownCase() {
+	rl.viCaseOperator(unicode.ToLower)
+}
+
+// Convert the current word to all uppercase and move past it.
+// If in visual mode, operate on the whole selection.
+func (rl *Shell) viUpCase() {
+	rl.viCaseOperator(unicode.ToUpper)
+}
+
+// Toggle the case of all characters spanned by a movement command
+// (eg. `g~w`), or of the whole selection if in visual mode.
+// Characters without any case are left unchanged.
+func (rl *Shell) viOperSwapCase() {
+	rl.viCaseOperator(swapCase)
+}
+
+// viCaseOperator changes the case of the characters spanned by the movement
+// command to come (or of the current line when the operator is doubled), or of
+// the active selection, as a single undoable change.
+func (rl *Shell) viCaseOperator(transform func(rune) rune) {
 	switch {
 	case rl.Keymap.IsPending():
 		// In vi operator pending mode, it's that we've been called
-		// twice in a row (eg. `uu`), so modify the entire current line.
-		rl.History.Save()
-
-		rl.selection.Mark(rl.cursor.Pos())
-		rl.selection.Visual(true)
-		rl.selection.ReplaceWith(unicode.ToLower)
-		rl.viCommandMode()
+		// twice in a row (eg. `gugu`), so modify the entire current line.
+		rl.Keymap.CancelPending()
+		rl.viCaseLine(transform)
 
 	case rl.selection.Active():
+		// The cursor goes back to the beginning of the movement.
 		rl.History.Save()
-		rl.selection.ReplaceWith(unicode.ToLower)
+
+		rl.adjustSelectionPending()
+		cpos := rl.selection.Cursor()
+		rl.selection.ReplaceWith(transform)
+		rl.cursor.Set(cpos)
 		rl.viCommandMode()
 
 	default:
-		// Else if we are actually starting a yank action.
+		// Else if we are actually starting a case action.
 		rl.History.SkipSave()
 		rl.Keymap.Pending()
 		rl.selection.Mark(rl.cursor.Pos())
+
+		// The last key of the operator repeated (eg. `guu`, `g~~`)
+		// is not a movement: it's the entire current line instead.
+		if rl.viOperatorDoubled() {
+			rl.Keymap.CancelPending()
+			rl.viCaseLine(transform)
+		}
 	}
 }
 
-// Convert the current word to all uppercase and move past it.
-// If in visual mode, operate on the whole selection.
-func (rl *Shell) viUpCase() {
-	switch {
-	case rl.Keymap.IsPending():
-		// In vi operator pending mode, it's that we've been called
-		// twice in a row (eg. `uu`), so modify the entire current line.
-		rl.History.Save()
+// viCaseLine changes the case of the entire current line.
+func (rl *Shell) viCaseLine(transform func(rune) rune) {
+	rl.History.Save()
 
-		rl.selection.Mark(rl.cursor.Pos())
-		rl.selection.Visual(true)
-		rl.selection.ReplaceWith(unicode.ToUpper)
-		rl.viCommandMode()
+	rl.selection.Mark(rl.cursor.Pos())
+	rl.selection.Visual(true)
+	rl.selection.ReplaceWith(transform)
+	rl.viCommandMode()
+}
 
-	case rl.selection.Active():
-		rl.History.Save()
-		rl.selection.ReplaceWith(unicode.ToUpper)
-		rl.viCommandMode()
+// viOperatorDoubled waits for the key following the pending operator that has
+// just been called, and consumes it if it is the last key of the operator, in
+// which case true is returned. Other keys are left to match the movement.
+func (rl *Shell) viOperatorDoubled() bool {
+	caller := rl.Keys.Caller()
+	if len(caller) == 0 {
+		return false
+	}
+
+	core.WaitAvailableKeys(rl.Keys, rl.Config)
+
+	key, empty := core.PeekKey(rl.Keys)
+	if empty || rune(key) != caller[len(caller)-1] {
+		return false
+	}
+
+	rl.Keys.Pop()
+
+	return true
+}
+
+// viCancelPending cancels the pending operator when the command called in
+// operator pending mode is not a movement it could act on (eg. `du`, `c~`):
+// the line is left unchanged. Returns true if an operator was cancelled.
+func (rl *Shell) viCancelPending() bool {
+	if rl.Keymap.Local() != keymap.ViOpp {
+		return false
+	}
+
+	rl.History.SkipSave()
+	rl.Keymap.CancelPending()
+	rl.selection.Reset()
+	rl.bell()
+
+	return true
+}
+
+// Undo the last change, or cancel the pending operator if any.
+func (rl *Shell) viUndo() {
+	if rl.viCancelPending() {
+		return
+	}
+
+	rl.undoLast()
+}
 
+// swapCase returns the character with its case toggled, if it has one.
+func swapCase(char rune) rune {
+	switch {
+	case unicode.IsLower(char):
+		return unicode.ToUpper(char)
+	case unicode.IsUpper(char):
+		return unicode.ToLower(char)
 	default:
-		// Else if we are actually starting a yank action.
-		rl.History.SkipSave()
-		rl.Keymap.Pending()
-		rl.selection.Mark(rl.cursor.Pos())
+		return char
 	}
 }
 
@@ -1349,12 +1466,6 @@ func (rl *Shell) viCharSearch() {
 	}
 }
 
-// Set the specified mark at the cursor position.
-func (rl *Shell) viSetMark() {
-	rl.History.SkipSave()
-	rl.selection.Mark(rl.cursor.Pos())
-}
-
 // Invoke an editor on the current command line, and execute the result as shell commands.
 // Readline attempts to invoke $VISUAL, $EDITOR, and Vi as the editor, in that order.
 func (rl *Shell) viEditAndExecuteCommand() {
@@ -1362,7 +1473,9 @@ func (rl *Shell) viEditAndExecuteCommand() {
 }
 
 // Incrementally redo undone text modifications.
-// If at the beginning of the line changes, enter insert mode.
+// If at the beginning of the line changes, insert the text typed
+// in the last insert mode session again at the cursor, as many times
+// as the numeric argument, or enter insert mode if there is none.
 func (rl *Shell) viRedo() {
 	if rl.History.Pos() > 0 {
 		rl.History.Redo()
@@ -1370,7 +1483,21 @@ func (rl *Shell) viRedo() {
 	}
 
 	// Enter insert mode when no redo possible.
-	rl.viInsertMode()
+	if len(rl.viInserted.text) == 0 && rl.viInserted.deleted == 0 {
+		rl.viInsertMode()
+		return
+	}
+
+	rl.History.Save()
+
+	for count := rl.Iterations.Get(); count > 0; count-- {
+		rl.viReplayInsert(rl.viInserted)
+	}
+
+	// Like when leaving insert mode, the cursor
+	// ends on the last inserted character.
+	rl.cursor.Dec()
+	rl.cursor.CheckCommand()
 }
 
 // Invoke an editor on the current command line.
@@ -1492,6 +1619,27 @@ func (rl *Shell) viSearchAgainBackward() {
 // Utils ---------------------------------------------------------------
 //
 
+// matchingBracket returns the position of the bracket under the cursor (or of
+// the first closing one after it, without going past the end of the line) and
+// the position of its matching bracket, or false if there is none.
+func (rl *Shell) matchingBracket() (pos, match int, found bool) {
+	pos = rl.cursor.Pos()
+
+	if !strutil.IsBracket(rl.cursor.Char()) {
+		for pos < rl.line.Len() && !strings.ContainsRune("})]", (*rl.line)[pos]) {
+			if (*rl.line)[pos] == inputrc.Newline {
+				return pos, -1, false
+			}
+
+			pos++
+		}
+	}
+
+	match = strutil.MatchBracket(*rl.line, pos)
+
+	return pos, match, match != -1
+}
+
 // Some commands accepting a pending operator command (yw/de... etc), must
 // either encompass the character under cursor into the selection, or not.
 // Note that when this command while a yank/delete command has been called
@@ -0,0 +1,82 @@
+package readline
+
+import (
+	"io"
+	"testing"
+
+	"github.com/reeflective/readline/internal/keymap"
+)
+
+func TestShell_viCaseOperator(t *testing.T) {
+	tests := []struct {
+		name string
+		keys string
+		want string
+	}{
+		{name: "Down-case line", keys: "guu\r", want: "hello world"},
+		{name: "Up-case line", keys: "gUU\r", want: "HELLO WORLD"},
+		{name: "Swap-case line", keys: "g~~\r", want: "hELLO wORLD"},
+		{name: "Repeated operator", keys: "gUgU\r", want: "HELLO WORLD"},
+		{name: "Up-case word", keys: "gUw\r", want: "HELLO World"},
+		{name: "Swap-case word", keys: "wg~e\r", want: "Hello wORLD"},
+		{name: "Delete then u", keys: "du\r", want: "Hello World"},
+		{name: "Yank then U", keys: "yU\r", want: "Hello World"},
+		{name: "Change then ~", keys: "c~\r", want: "Hello World"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rl := NewShell()
+
+			rl.output.SetWriter(io.Discard)
+			rl.Keymap.SetMain(string(keymap.ViCommand))
+
+			rl.SetBuffer("Hello World", 0, nil)
+
+			got, err := readTestLine(t, rl, test.keys)
+			if err != nil {
+				t.Errorf("Readline() error = %v", err)
+			}
+
+			if got != test.want {
+				t.Errorf("Readline() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestShell_viRedoInsert(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []string
+		want string
+	}{
+		{name: "Repeat insertion", keys: []string{"i", "abc", "\x1b", ".", "\r"}, want: "ababccHello World"},
+		{name: "Repeat insertion with count", keys: []string{"i", "abc", "\x1b", "3", ".", "\r"}, want: "ababcabcabccHello World"},
+		{name: "Insertion with count", keys: []string{"3", "i", "ab", "\x1b", "\r"}, want: "abababHello World"},
+		{name: "Characters deleted while typing", keys: []string{"i", "abx", "\x7f", "c", "\x1b", ".", "\r"}, want: "ababccHello World"},
+		{name: "Characters deleted before insertion", keys: []string{"w", "i", "\x7f", "_", "\x1b", ".", "\r"}, want: "Hell__World"},
+		{name: "Cursor moved while typing", keys: []string{"i", "ab", "\x1b[D", "c", "\x1b", ".", "\r"}, want: "accbHello World"},
+		{name: "Nothing typed", keys: []string{"i", "\x1b", ".", "x", "\x1b", "\r"}, want: "xHello World"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rl := NewShell()
+
+			rl.output.SetWriter(io.Discard)
+			rl.Keymap.SetMain(string(keymap.ViCommand))
+
+			rl.SetBuffer("Hello World", 0, nil)
+
+			got, err := readTestLine(t, rl, test.keys...)
+			if err != nil {
+				t.Errorf("Readline() error = %v", err)
+			}
+
+			if got != test.want {
+				t.Errorf("Readline() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}